@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/pkg/errors"
@@ -37,6 +38,7 @@ var testFilter = &cli.Subcommand{
 }
 
 func runTestFilterCmd(subcommand *cli.Subcommand, args []string) error {
+	ctx := context.Background()
 
 	if testFilterArgs.job == "" {
 		return fmt.Errorf("must specify --job flag")
@@ -70,7 +72,7 @@ func runTestFilterCmd(subcommand *cli.Subcommand, args []string) error {
 	if testFilterArgs.input != "" {
 		fsnames = []string{testFilterArgs.input}
 	} else {
-		out, err := zfs.ZFSList([]string{"name"})
+		out, err := zfs.ZFSList(ctx, []string{"name"})
 		if err != nil {
 			return fmt.Errorf("could not list ZFS filesystems: %s", err)
 		}
@@ -132,12 +134,13 @@ var testPlaceholder = &cli.Subcommand{
 }
 
 func runTestPlaceholder(subcommand *cli.Subcommand, args []string) error {
+	ctx := context.Background()
 
 	var checkDPs []*zfs.DatasetPath
 
 	// all actions first
 	if testPlaceholderArgs.all {
-		out, err := zfs.ZFSList([]string{"name"})
+		out, err := zfs.ZFSList(ctx, []string{"name"})
 		if err != nil {
 			return errors.Wrap(err, "could not list ZFS filesystems")
 		}
@@ -161,7 +164,7 @@ func runTestPlaceholder(subcommand *cli.Subcommand, args []string) error {
 
 	fmt.Printf("IS_PLACEHOLDER\tDATASET\tzrepl:placeholder\n")
 	for _, dp := range checkDPs {
-		ph, err := zfs.ZFSGetFilesystemPlaceholderState(dp)
+		ph, err := zfs.ZFSGetFilesystemPlaceholderState(ctx, dp, zfs.PlaceholderPropertyName)
 		if err != nil {
 			return errors.Wrap(err, "cannot get placeholder state")
 		}
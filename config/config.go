@@ -179,6 +179,8 @@ type Global struct {
 	Monitoring []MonitoringEnum       `yaml:"monitoring,optional"`
 	Control    *GlobalControl         `yaml:"control,optional,fromdefaults"`
 	Serve      *GlobalServe           `yaml:"serve,optional,fromdefaults"`
+	Recv       *GlobalRecv            `yaml:"recv,optional,fromdefaults"`
+	ZFS        *GlobalZFS             `yaml:"zfs,optional,fromdefaults"`
 }
 
 func Default(i interface{}) {
@@ -355,6 +357,15 @@ type GlobalStdinServer struct {
 	SockDir string `yaml:"sockdir,default=/var/run/zrepl/stdinserver"`
 }
 
+type GlobalRecv struct {
+	LockDir string `yaml:"lock_dir,default=/var/run/zrepl/recvlock"`
+}
+
+type GlobalZFS struct {
+	ZFSBinary   string `yaml:"zfs_binary,default=zfs"`
+	ZPoolBinary string `yaml:"zpool_binary,default=zpool"`
+}
+
 type JobDebugSettings struct {
 	Conn *struct {
 		ReadDump  string `yaml:"read_dump"`
@@ -113,3 +113,30 @@ func TestLoggingOutletEnumList_SetDefaults(t *testing.T) {
 		assert.Equal(t, "warn", (*e)[0].Ret.(*StdoutLoggingOutlet).Level)
 	})
 }
+
+func TestGlobalRecvLockDir(t *testing.T) {
+	conf := testValidGlobalSection(t, "")
+	assert.Equal(t, "/var/run/zrepl/recvlock", conf.Global.Recv.LockDir)
+
+	conf = testValidGlobalSection(t, `
+global:
+  recv:
+    lock_dir: /run/user/1000/zrepl/recvlock
+`)
+	assert.Equal(t, "/run/user/1000/zrepl/recvlock", conf.Global.Recv.LockDir)
+}
+
+func TestGlobalZFSBinaries(t *testing.T) {
+	conf := testValidGlobalSection(t, "")
+	assert.Equal(t, "zfs", conf.Global.ZFS.ZFSBinary)
+	assert.Equal(t, "zpool", conf.Global.ZFS.ZPoolBinary)
+
+	conf = testValidGlobalSection(t, `
+global:
+  zfs:
+    zfs_binary: /usr/sbin/zfs
+    zpool_binary: /usr/sbin/zpool
+`)
+	assert.Equal(t, "/usr/sbin/zfs", conf.Global.ZFS.ZFSBinary)
+	assert.Equal(t, "/usr/sbin/zpool", conf.Global.ZFS.ZPoolBinary)
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/zrepl/zrepl/daemon/logging"
 	"github.com/zrepl/zrepl/logger"
 	"github.com/zrepl/zrepl/version"
+	"github.com/zrepl/zrepl/zfs"
 )
 
 func Run(conf *config.Config) error {
@@ -47,6 +48,18 @@ func Run(conf *config.Config) error {
 	log := logger.NewLogger(outlets, 1*time.Second)
 	log.Info(version.NewZreplVersionInformation().String())
 
+	if err := zfs.SetZFSBinary(conf.Global.ZFS.ZFSBinary); err != nil {
+		return errors.Wrap(err, "cannot use zfs binary")
+	}
+	if err := zfs.SetZPoolBinary(conf.Global.ZFS.ZPoolBinary); err != nil {
+		return errors.Wrap(err, "cannot use zpool binary")
+	}
+	if zfsVersion, err := zfs.ZFSBinaryVersion(ctx); err != nil {
+		log.WithError(err).WithField("zfs_binary", zfs.ZFS_BINARY).Warn("cannot determine zfs version")
+	} else {
+		log.WithField("zfs_binary", zfs.ZFS_BINARY).WithField("zfs_version", zfsVersion).Info("using zfs")
+	}
+
 	for _, job := range confJobs {
 		if IsInternalJobName(job.Name()) {
 			panic(fmt.Sprintf("internal job name used for config job '%s'", job.Name())) //FIXME
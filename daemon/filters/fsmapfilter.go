@@ -187,37 +187,54 @@ func (m DatasetMapFilter) InvertedFilter() (inv *DatasetMapFilter, err error) {
 	return inv, nil
 }
 
-// FIXME investigate whether we can support more...
+// Invert returns the mapping target => source for all entries that do not omit their paths.
+//
+// The inversion is only possible if the entries' targets do not overlap,
+// i.e. no target is equal to another or within another subtree entry's target.
+// Otherwise, a path could be the image of multiple sources and the inverse would be ambiguous.
 func (m DatasetMapFilter) Invert() (endpoint.FSMap, error) {
 
 	if m.filterMode {
 		return nil, errors.Errorf("can only invert mappings")
 	}
 
-	if len(m.entries) != 1 {
-		return nil, errors.Errorf("inversion of complicated mappings is not implemented") // FIXME
-	}
-
-	e := m.entries[0]
-
 	inv := &DatasetMapFilter{
-		make([]datasetMapFilterEntry, len(m.entries)),
+		make([]datasetMapFilterEntry, 0, len(m.entries)),
 		false,
 	}
-	mp, err := zfs.NewDatasetPath(e.mapping)
-	if err != nil {
-		return nil, err
-	}
 
-	inv.entries[0] = datasetMapFilterEntry{
-		path:         mp,
-		mapping:      e.path.ToString(),
-		subtreeMatch: e.subtreeMatch,
+	for _, e := range m.entries {
+		if strings.HasPrefix(e.mapping, MapFilterResultOmit) {
+			// no target, hence not reachable through the inverse
+			continue
+		}
+		mp, err := zfs.NewDatasetPath(e.mapping)
+		if err != nil {
+			return nil, errors.Wrapf(err, "mapping cannot be inverted: '%s' is not a dataset path", e.mapping)
+		}
+		ie := datasetMapFilterEntry{
+			path:         mp,
+			mapping:      e.path.ToString(),
+			subtreeMatch: e.subtreeMatch,
+		}
+		for _, o := range inv.entries {
+			if ie.overlaps(o) {
+				return nil, errors.Errorf("mapping cannot be inverted: targets '%s' and '%s' overlap", o.path.ToString(), ie.path.ToString())
+			}
+		}
+		inv.entries = append(inv.entries, ie)
 	}
 
 	return inv, nil
 }
 
+// whether a path could be matched by both e and o
+func (e datasetMapFilterEntry) overlaps(o datasetMapFilterEntry) bool {
+	return e.path.Equal(o.path) ||
+		(o.subtreeMatch && e.path.HasPrefix(o.path)) ||
+		(e.subtreeMatch && o.path.HasPrefix(e.path))
+}
+
 // Creates a new DatasetMapFilter in filter mode from a mapping
 // All accepting mapping results are mapped to accepting filter results
 // All rejecting mapping results are mapped to rejecting filter results
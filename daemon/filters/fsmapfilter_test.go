@@ -1,11 +1,15 @@
 package filters
 
 import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/endpoint"
 	"github.com/zrepl/zrepl/zfs"
 )
 
-import "testing"
-
 func TestDatasetMapFilter(t *testing.T) {
 
 	type testCase struct {
@@ -87,3 +91,79 @@ func TestDatasetMapFilter(t *testing.T) {
 	}
 
 }
+
+func TestDatasetMapFilterInvert(t *testing.T) {
+	m := NewDatasetMapFilter(4, false)
+	require.NoError(t, m.Add("tank/a<", "backup/a"))
+	require.NoError(t, m.Add("tank/a/special<", "backup/special"))
+	require.NoError(t, m.Add("tank/a/tmp<", "!"))
+	require.NoError(t, m.Add("zroot/home", "backup/home"))
+
+	inv, err := m.Invert()
+	require.NoError(t, err)
+
+	tcs := []struct {
+		source, target string
+	}{
+		{"tank/a", "backup/a"},
+		{"tank/a/b/c", "backup/a/b/c"},
+		{"tank/a/special", "backup/special"},
+		{"tank/a/special/x", "backup/special/x"},
+		{"zroot/home", "backup/home"},
+		{"zroot/home/alice", ""},
+		{"tank/a/tmp", ""},
+		{"tank/b", ""},
+	}
+	for _, tc := range tcs {
+		target, err := m.Map(toDatasetPath(t, tc.source))
+		require.NoError(t, err)
+		if tc.target == "" {
+			assert.Nil(t, target, "%s", tc.source)
+			continue
+		}
+		require.NotNil(t, target, "%s", tc.source)
+		assert.Equal(t, tc.target, target.ToString())
+
+		back, err := inv.Map(target)
+		require.NoError(t, err)
+		require.NotNil(t, back, "%s", tc.target)
+		assert.Equal(t, tc.source, back.ToString())
+	}
+
+	// the inverse maps both backup/a/x and backup/special/x to the subtree of tank/a
+	_, err = inv.Invert()
+	assert.Error(t, err)
+}
+
+func TestDatasetMapFilterInvertOverlappingTargets(t *testing.T) {
+	tcs := [][][2]string{
+		{{"tank<", "backup"}, {"zroot<", "backup/zroot"}},
+		{{"tank<", "backup"}, {"zroot", "backup/zroot"}},
+		{{"tank", "backup"}, {"zroot", "backup"}},
+	}
+	for _, tc := range tcs {
+		m := NewDatasetMapFilter(len(tc), false)
+		for _, e := range tc {
+			require.NoError(t, m.Add(e[0], e[1]))
+		}
+		_, err := m.Invert()
+		assert.Error(t, err, "%v", tc)
+		_, err = endpoint.NewMappingSender(zfs.NoFilter(), m)
+		assert.Error(t, err, "%v", tc)
+	}
+
+	m := NewDatasetMapFilter(2, false)
+	require.NoError(t, m.Add("tank", "backup"))
+	require.NoError(t, m.Add("zroot", "backup/zroot"))
+	_, err := m.Invert()
+	assert.NoError(t, err, "direct entries only match their exact path")
+
+	_, err = NewDatasetMapFilter(0, true).Invert()
+	assert.Error(t, err)
+}
+
+func toDatasetPath(t *testing.T, p string) *zfs.DatasetPath {
+	dp, err := zfs.NewDatasetPath(p)
+	require.NoError(t, err)
+	return dp
+}
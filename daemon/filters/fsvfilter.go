@@ -24,7 +24,7 @@ type PrefixFilter struct {
 	fstypeSet bool // optionals anyone?
 }
 
-var _ zfs.FilesystemVersionFilter = &PrefixFilter{}
+var _ zfs.FilesystemVersionTypeFilter = &PrefixFilter{}
 
 func NewPrefixFilter(prefix string) *PrefixFilter {
 	return &PrefixFilter{prefix: prefix}
@@ -39,3 +39,10 @@ func (f *PrefixFilter) Filter(t zfs.VersionType, name string) (accept bool, err
 	prefixMatches := strings.HasPrefix(name, f.prefix)
 	return fstypeMatches && prefixMatches, nil
 }
+
+func (f *PrefixFilter) AcceptedVersionTypes() []zfs.VersionType {
+	if !f.fstypeSet {
+		return nil
+	}
+	return []zfs.VersionType{f.fstype}
+}
@@ -0,0 +1,78 @@
+package filters
+
+import (
+	"fmt"
+
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// FilterRule allows or denies the datasets matched by Pattern.
+//
+// Pattern uses the same syntax as the filesystems filter in the config:
+// `tank/home` only matches tank/home, `tank/home<` matches tank/home and all its children.
+type FilterRule struct {
+	Pattern string
+	Allow   bool
+}
+
+func (r FilterRule) String() string {
+	if r.Allow {
+		return fmt.Sprintf("%s => ok", r.Pattern)
+	}
+	return fmt.Sprintf("%s => !", r.Pattern)
+}
+
+// RuleFilter is a zfs.DatasetFilter backed by an allow / deny list.
+//
+// The most specific matching rule decides whether a dataset passes:
+// a non-subtree pattern wins over a subtree pattern for the same path,
+// otherwise the subtree pattern with the longest matching prefix wins.
+// Datasets that match no rule do not pass.
+//
+// Example: "replicate tank/** except tank/tmp/**" is expressed as
+//
+//   []FilterRule{{"tank<", true}, {"tank/tmp<", false}}
+type RuleFilter struct {
+	rules []FilterRule
+	m     *DatasetMapFilter // entries[i] corresponds to rules[i]
+}
+
+var _ zfs.DatasetFilter = (*RuleFilter)(nil)
+
+func NewRuleFilter(rules []FilterRule) (*RuleFilter, error) {
+	f := &RuleFilter{
+		rules: make([]FilterRule, len(rules)),
+		m:     NewDatasetMapFilter(len(rules), true),
+	}
+	copy(f.rules, rules)
+	seen := make(map[string]bool, len(rules))
+	for _, r := range rules {
+		if seen[r.Pattern] {
+			return nil, fmt.Errorf("duplicate filter rule for pattern %q", r.Pattern)
+		}
+		seen[r.Pattern] = true
+		mapping := MapFilterResultOmit
+		if r.Allow {
+			mapping = MapFilterResultOk
+		}
+		if err := f.m.Add(r.Pattern, mapping); err != nil {
+			return nil, fmt.Errorf("invalid filter rule %q: %s", r, err)
+		}
+	}
+	return f, nil
+}
+
+func (f *RuleFilter) Filter(p *zfs.DatasetPath) (pass bool, err error) {
+	r, ok := f.MatchingRule(p)
+	return ok && r.Allow, nil
+}
+
+// MatchingRule returns the rule that decides whether p passes the filter.
+// ok is false if no rule matches p.
+func (f *RuleFilter) MatchingRule(p *zfs.DatasetPath) (rule FilterRule, ok bool) {
+	idx, found := f.m.mostSpecificPrefixMapping(p)
+	if !found {
+		return FilterRule{}, false
+	}
+	return f.rules[idx], true
+}
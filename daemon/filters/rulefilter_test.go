@@ -0,0 +1,59 @@
+package filters
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func TestRuleFilter(t *testing.T) {
+
+	f, err := NewRuleFilter([]FilterRule{
+		{"tank<", true},
+		{"tank/tmp<", false},
+		{"tank/tmp/keep", true},
+		{"tank/home", false},
+	})
+	require.NoError(t, err)
+
+	tcs := []struct {
+		path string
+		pass bool
+		rule string // "" if no rule matches
+	}{
+		{"zroot", false, ""},
+		{"tank", true, "tank<"},
+		{"tank/data/foo", true, "tank<"},
+		{"tank/tmp", false, "tank/tmp<"},
+		{"tank/tmp/foo", false, "tank/tmp<"},
+		{"tank/tmp/keep", true, "tank/tmp/keep"},
+		{"tank/tmp/keep/child", false, "tank/tmp<"},
+		{"tank/home", false, "tank/home"},
+		{"tank/home/alice", true, "tank<"},
+	}
+
+	for _, tc := range tcs {
+		p, err := zfs.NewDatasetPath(tc.path)
+		require.NoError(t, err)
+		pass, err := f.Filter(p)
+		require.NoError(t, err)
+		assert.Equal(t, tc.pass, pass, "%s", tc.path)
+		rule, ok := f.MatchingRule(p)
+		assert.Equal(t, tc.rule != "", ok, "%s", tc.path)
+		assert.Equal(t, tc.rule, rule.Pattern, "%s", tc.path)
+	}
+}
+
+func TestNewRuleFilterInvalid(t *testing.T) {
+	for _, rules := range [][]FilterRule{
+		{{"tank<", true}, {"tank<", false}},
+		{{"tank</foo", true}},
+		{{"tank<<", true}},
+	} {
+		_, err := NewRuleFilter(rules)
+		assert.Error(t, err, "%v", rules)
+	}
+}
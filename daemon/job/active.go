@@ -158,6 +158,8 @@ type modePull struct {
 	sender   *rpc.Client
 	rootFS   *zfs.DatasetPath
 	interval config.PositiveDurationOrManual
+
+	recvLockDir string
 }
 
 func (m *modePull) ConnectEndpoints(loggers rpc.Loggers, connecter transport.Connecter) {
@@ -167,6 +169,7 @@ func (m *modePull) ConnectEndpoints(loggers rpc.Loggers, connecter transport.Con
 		panic("inconsistent use of ConnectEndpoints and DisconnectEndpoints")
 	}
 	m.receiver = endpoint.NewReceiver(m.rootFS, false)
+	m.receiver.RecvLockDir = m.recvLockDir
 	m.sender = rpc.NewClient(connecter, loggers)
 }
 
@@ -234,6 +237,7 @@ func modePullFromConfig(g *config.Global, in *config.PullJob) (m *modePull, err
 	if m.rootFS.Length() <= 0 {
 		return nil, errors.New("RootFS must not be empty") // duplicates error check of receiver
 	}
+	m.recvLockDir = g.Recv.LockDir
 
 	return m, nil
 }
@@ -32,13 +32,18 @@ type passiveMode interface {
 }
 
 type modeSink struct {
-	rootDataset *zfs.DatasetPath
+	rootDataset       *zfs.DatasetPath
+	recvLockDir       string
+	promBytesReceived *prometheus.CounterVec // labels: client_identity
 }
 
 func (m *modeSink) Type() Type { return TypeSink }
 
 func (m *modeSink) Handler() rpc.Handler {
-	return endpoint.NewReceiver(m.rootDataset, true)
+	r := endpoint.NewReceiver(m.rootDataset, true)
+	r.BytesReceived = m.promBytesReceived
+	r.RecvLockDir = m.recvLockDir
+	return r
 }
 
 func (m *modeSink) RunPeriodic(_ context.Context)  {}
@@ -53,6 +58,14 @@ func modeSinkFromConfig(g *config.Global, in *config.SinkJob) (m *modeSink, err
 	if m.rootDataset.Length() <= 0 {
 		return nil, errors.New("root dataset must not be empty") // duplicates error check of receiver
 	}
+	m.recvLockDir = g.Recv.LockDir
+	m.promBytesReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   "zrepl",
+		Subsystem:   "sink",
+		Name:        "bytes_received",
+		Help:        "number of bytes received per client identity",
+		ConstLabels: prometheus.Labels{"zrepl_job": in.Name},
+	}, []string{"client_identity"})
 	return m, nil
 }
 
@@ -123,7 +136,11 @@ func (j *PassiveSide) OwnedDatasetSubtreeRoot() (rfs *zfs.DatasetPath, ok bool)
 	return sink.rootDataset.Copy(), true
 }
 
-func (*PassiveSide) RegisterMetrics(registerer prometheus.Registerer) {}
+func (j *PassiveSide) RegisterMetrics(registerer prometheus.Registerer) {
+	if sink, ok := j.mode.(*modeSink); ok {
+		registerer.MustRegister(sink.promBytesReceived)
+	}
+}
 
 func (j *PassiveSide) Run(ctx context.Context) {
 
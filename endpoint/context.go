@@ -2,6 +2,7 @@ package endpoint
 
 import (
 	"context"
+	"time"
 
 	"github.com/zrepl/zrepl/logger"
 )
@@ -11,6 +12,7 @@ type contextKey int
 const (
 	contextKeyLogger contextKey = iota
 	ClientIdentityKey
+	contextKeyReceiveProgress
 )
 
 type Logger = logger.Logger
@@ -25,3 +27,32 @@ func getLogger(ctx context.Context) Logger {
 	}
 	return logger.NewNullLogger()
 }
+
+// ReceiveProgressFunc is called with the number of bytes of the stream
+// received so far for filesystem fs (as named in the ReceiveReq).
+type ReceiveProgressFunc func(fs string, received int64)
+
+type receiveProgress struct {
+	every time.Duration
+	cb    ReceiveProgressFunc
+}
+
+// WithReceiveProgress makes Receiver.Receive report its progress to cb, at most once per interval.
+// Without it, Receive does not track progress at all.
+//
+// For a remote receiver, the RPC client forwards the interval to the receiving side
+// and invokes cb with the progress reports it sends back.
+func WithReceiveProgress(ctx context.Context, every time.Duration, cb ReceiveProgressFunc) context.Context {
+	return context.WithValue(ctx, contextKeyReceiveProgress, receiveProgress{every, cb})
+}
+
+func getReceiveProgress(ctx context.Context) (receiveProgress, bool) {
+	p, ok := ctx.Value(contextKeyReceiveProgress).(receiveProgress)
+	return p, ok
+}
+
+// ReceiveProgressFromContext returns the interval and callback set by WithReceiveProgress.
+func ReceiveProgressFromContext(ctx context.Context) (every time.Duration, cb ReceiveProgressFunc, ok bool) {
+	p, ok := getReceiveProgress(ctx)
+	return p.every, p.cb, ok
+}
@@ -5,11 +5,15 @@ import (
 	"context"
 	"fmt"
 	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/zrepl/zrepl/replication/logic/pdu"
-	"github.com/zrepl/zrepl/util/chainlock"
 	"github.com/zrepl/zrepl/util/envconst"
 	"github.com/zrepl/zrepl/util/semaphore"
 	"github.com/zrepl/zrepl/zfs"
@@ -18,12 +22,35 @@ import (
 // Sender implements replication.ReplicationEndpoint for a sending side
 type Sender struct {
 	FSFilter zfs.DatasetFilter
+	// If true, SendReqs that carry a ResumeToken are rejected with ErrResumeDisabled.
+	DisableResume bool
+
+	// if not nil, the peer sees the local filesystems under the names produced by fsMap
+	// and fsMapInv maps the peer's names back to the local ones (see NewMappingSender)
+	fsMap, fsMapInv FSMap
 }
 
+// ErrResumeDisabled is returned by a Sender with DisableResume set
+// for requests that involve a resume token.
+var ErrResumeDisabled = errors.New("resuming sends is disabled by policy, send from the beginning instead")
+
 func NewSender(fsf zfs.DatasetFilter) *Sender {
 	return &Sender{FSFilter: fsf}
 }
 
+// NewMappingSender returns a Sender that presents its filesystems to the peer
+// under the names produced by fsMap, e.g. tank/a as backup/a for `tank/a => backup/a`.
+// The peer's requests refer to the mapped names, which are mapped back using fsMap.Invert().
+// Filesystems without a mapping are not visible to the peer.
+func NewMappingSender(fsf zfs.DatasetFilter, fsMap FSMap) (*Sender, error) {
+	inv, err := fsMap.Invert()
+	if err != nil {
+		return nil, errors.Wrap(err, "sender filesystem mapping must be invertible")
+	}
+	return &Sender{FSFilter: fsf, fsMap: fsMap, fsMapInv: inv}, nil
+}
+
+// filterCheckFS returns the local path of fs, which is the name used by the peer.
 func (s *Sender) filterCheckFS(fs string) (*zfs.DatasetPath, error) {
 	dp, err := zfs.NewDatasetPath(fs)
 	if err != nil {
@@ -32,6 +59,22 @@ func (s *Sender) filterCheckFS(fs string) (*zfs.DatasetPath, error) {
 	if dp.Length() == 0 {
 		return nil, errors.New("empty filesystem not allowed")
 	}
+	if s.fsMapInv != nil {
+		local, err := s.fsMapInv.Map(dp)
+		if err != nil {
+			return nil, err
+		}
+		if local == nil {
+			return nil, fmt.Errorf("endpoint does not allow access to filesystem %s", fs)
+		}
+		// a more specific mapping might present local under a different name
+		if presented, err := s.fsMap.Map(local); err != nil {
+			return nil, err
+		} else if presented == nil || !presented.Equal(dp) {
+			return nil, fmt.Errorf("endpoint does not allow access to filesystem %s", fs)
+		}
+		dp = local
+	}
 	pass, err := s.FSFilter.Filter(dp)
 	if err != nil {
 		return nil, err
@@ -47,13 +90,22 @@ func (s *Sender) ListFilesystems(ctx context.Context, r *pdu.ListFilesystemReq)
 	if err != nil {
 		return nil, err
 	}
-	rfss := make([]*pdu.Filesystem, len(fss))
+	rfss := make([]*pdu.Filesystem, 0, len(fss))
 	for i := range fss {
-		rfss[i] = &pdu.Filesystem{
-			Path: fss[i].ToString(),
-			// FIXME: not supporting ResumeToken yet
-			IsPlaceholder: false, // sender FSs are never placeholders
+		p := fss[i]
+		if s.fsMap != nil {
+			p, err = s.fsMap.Map(fss[i])
+			if err != nil {
+				return nil, err
+			}
+			if p == nil {
+				continue // not visible to the peer
+			}
 		}
+		rfss = append(rfss, &pdu.Filesystem{
+			Path:          p.ToString(),
+			IsPlaceholder: false, // sender FSs are never placeholders
+		})
 	}
 	res := &pdu.ListFilesystemRes{Filesystems: rfss}
 	return res, nil
@@ -64,7 +116,7 @@ func (s *Sender) ListFilesystemVersions(ctx context.Context, r *pdu.ListFilesyst
 	if err != nil {
 		return nil, err
 	}
-	fsvs, err := zfs.ZFSListFilesystemVersions(lp, nil)
+	fsvs, err := zfs.ZFSListFilesystemVersions(ctx, lp, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -77,46 +129,223 @@ func (s *Sender) ListFilesystemVersions(ctx context.Context, r *pdu.ListFilesyst
 
 }
 
-var maxConcurrentZFSSendSemaphore = semaphore.New(envconst.Int64("ZREPL_ENDPOINT_MAX_CONCURRENT_SEND", 10))
+var maxConcurrentZFSSend = envconst.Int64("ZREPL_ENDPOINT_MAX_CONCURRENT_SEND", 10)
+var maxConcurrentZFSSendSemaphore = semaphore.New(maxConcurrentZFSSend)
+
+// ResourceExhaustedError is returned by Sender.Send for a SendReq with FailIfBusy set
+// if the sender already runs the maximum number of concurrent sends.
+// The client should back off and retry later.
+type ResourceExhaustedError struct {
+	Resource string
+	Max      int64
+}
+
+func (e *ResourceExhaustedError) Error() string {
+	return fmt.Sprintf("resource exhausted: maximum number of %s (%v) reached, retry later", e.Resource, e.Max)
+}
+
+// Note that the error is sent to the client as a string, it does not get
+// the status code semantics of gRPC because Send is a dataconn endpoint.
+func acquireSendSemaphore(ctx context.Context, failIfBusy bool) (*semaphore.AcquireGuard, error) {
+	if !failIfBusy {
+		return maxConcurrentZFSSendSemaphore.Acquire(ctx)
+	}
+	guard, ok := maxConcurrentZFSSendSemaphore.TryAcquire()
+	if !ok {
+		return nil, &ResourceExhaustedError{Resource: "concurrent sends", Max: maxConcurrentZFSSend}
+	}
+	return guard, nil
+}
 
 func (s *Sender) Send(ctx context.Context, r *pdu.SendReq) (*pdu.SendRes, zfs.StreamCopier, error) {
-	_, err := s.filterCheckFS(r.Filesystem)
+	lp, err := s.filterCheckFS(r.Filesystem)
 	if err != nil {
 		return nil, nil, err
 	}
+	if s.DisableResume && r.ResumeToken != "" {
+		return nil, nil, ErrResumeDisabled
+	}
 
-	getLogger(ctx).Debug("acquire concurrent send semaphore")
-	// TODO use try-acquire and fail with resource-exhaustion rpc status
-	// => would require handling on the client-side
-	// => this is a dataconn endpoint, doesn't have the status code semantics of gRPC
-	guard, err := maxConcurrentZFSSendSemaphore.Acquire(ctx)
+	if err := zfs.ZFSSendPreflightCheckNotReceiving(ctx, lp); err != nil {
+		if _, ok := err.(*zfs.ActiveReceiveError); ok {
+			return nil, nil, err
+		}
+		// e.g. the zfs version does not support receive_resume_token
+		getLogger(ctx).WithError(err).WithField("fs", lp.ToString()).
+			Warn("cannot check whether filesystem is being received into, continuing with send")
+	}
+
+	getLogger(ctx).WithField("fail_if_busy", r.FailIfBusy).Debug("acquire concurrent send semaphore")
+	guard, err := acquireSendSemaphore(ctx, r.FailIfBusy)
 	if err != nil {
 		return nil, nil, err
 	}
 	defer guard.Release()
 
-	si, err := zfs.ZFSSendDry(r.Filesystem, r.From, r.To, "")
+	plainSendArgs := zfs.ZFSSendArgs{
+		FS:            lp.ToString(),
+		From:          r.From, // may be empty
+		To:            r.To,
+		Intermediates: r.Intermediates,
+	}
+	sendArgs := plainSendArgs
+	usedResumeToken := false
+	if r.ResumeToken != "" {
+		if err := checkResumeTokenMatchesSendReq(ctx, lp, r); err != nil {
+			return nil, nil, err
+		}
+		sendArgs = zfs.ZFSSendArgs{
+			FS:          lp.ToString(),
+			ResumeToken: r.ResumeToken,
+		}
+		usedResumeToken = true
+	}
+
+	si, err := zfs.ZFSSendDry(ctx, sendArgs)
+	if _, ok := err.(*zfs.ZFSError); ok && usedResumeToken {
+		// e.g. the token refers to a send the zfs version cannot resume
+		getLogger(ctx).WithError(err).WithField("fs", r.Filesystem).
+			Warn("cannot resume send with resume token, sending from 'from' to 'to' instead")
+		sendArgs, usedResumeToken = plainSendArgs, false
+		si, err = zfs.ZFSSendDry(ctx, sendArgs)
+	}
 	if err != nil {
 		return nil, nil, err
 	}
 
-	var expSize int64 = 0      // protocol says 0 means no estimate
-	if si.SizeEstimate != -1 { // but si returns -1 for no size estimate
+	var expSize int64 = 0 // protocol says 0 means no estimate
+	if si.HasSizeEstimate() {
 		expSize = si.SizeEstimate
 	}
-	res := &pdu.SendRes{ExpectedSize: expSize}
+	if si.NothingToSend() {
+		// still send the stream: the receiver needs the 'to' snapshot
+		getLogger(ctx).WithField("fs", r.Filesystem).Debug("zfs send estimates an empty incremental stream")
+	}
+	res := &pdu.SendRes{ExpectedSize: expSize, UsedResumeToken: usedResumeToken}
 
 	if r.DryRun {
 		return res, nil, nil
 	}
 
-	streamCopier, err := zfs.ZFSSend(ctx, r.Filesystem, r.From, r.To, "")
+	sendOpts := zfs.SendOptions{
+		SizeEstimate: expSize,
+		OnSizeEstimateDivergence: func(estimate, actual int64) {
+			getLogger(ctx).
+				WithField("fs", r.Filesystem).
+				WithField("estimate", estimate).
+				WithField("actual", actual).
+				Warn("size of sent stream diverges significantly from estimate")
+		},
+	}
+	streamCopier, err := zfs.ZFSSend(ctx, sendArgs, sendOpts)
 	if err != nil {
 		return nil, nil, err
 	}
 	return res, streamCopier, nil
 }
 
+// SendReqFromResumeToken builds a SendReq for fs that resumes the partial receive
+// described by token, which is the receive_resume_token reported by the receiver
+// (see pdu.Filesystem.ResumeToken).
+// The GUIDs encoded in the token are resolved to this sender's versions of fs.
+// An error is returned if the token is stale, i.e. if those versions no longer exist.
+func (s *Sender) SendReqFromResumeToken(ctx context.Context, fs string, token string) (*pdu.SendReq, error) {
+	lp, err := s.filterCheckFS(fs)
+	if err != nil {
+		return nil, err
+	}
+	if s.DisableResume {
+		return nil, ErrResumeDisabled
+	}
+	rt, err := zfs.DecodeResumeToken(ctx, token)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parse resume token")
+	}
+	getLogger(ctx).WithField("resume_token", rt.Describe()).Debug("decoded resume token")
+	fsvs, err := zfs.ZFSListFilesystemVersions(ctx, lp, nil)
+	if err != nil {
+		return nil, err
+	}
+	return sendReqFromResumeToken(fs, token, rt, fsvs)
+}
+
+// checkResumeTokenMatchesSendReq enforces that the GUIDs of r.From and r.To
+// correspond to those encoded in r.ResumeToken, as required by the protocol.
+func checkResumeTokenMatchesSendReq(ctx context.Context, lp *zfs.DatasetPath, r *pdu.SendReq) error {
+	rt, err := zfs.DecodeResumeToken(ctx, r.ResumeToken)
+	if err != nil {
+		return errors.Wrap(err, "cannot parse resume token")
+	}
+	fsvs, err := zfs.ZFSListFilesystemVersions(ctx, lp, nil)
+	if err != nil {
+		return err
+	}
+	return resumeTokenMatchesSendReq(rt, r, fsvs)
+}
+
+func resumeTokenMatchesSendReq(rt *zfs.ResumeToken, r *pdu.SendReq, fsvs []zfs.FilesystemVersion) error {
+	guidOf := func(relName string) (uint64, bool) {
+		for i := range fsvs {
+			if fsvs[i].String() == relName {
+				return fsvs[i].Guid, true
+			}
+		}
+		return 0, false
+	}
+
+	if !rt.HasToGUID {
+		return errors.New("resume token does not contain 'to' GUID")
+	}
+	if guid, ok := guidOf(r.To); !ok || guid != rt.ToGUID {
+		return errors.Errorf("resume token does not match send request: 'to' %q does not have GUID %v", r.To, rt.ToGUID)
+	}
+	if rt.HasFromGUID != (r.From != "") {
+		return errors.Errorf("resume token does not match send request: incremental token requires 'from' and vice versa")
+	}
+	if rt.HasFromGUID {
+		if guid, ok := guidOf(r.From); !ok || guid != rt.FromGUID {
+			return errors.Errorf("resume token does not match send request: 'from' %q does not have GUID %v", r.From, rt.FromGUID)
+		}
+	}
+	return nil
+}
+
+func sendReqFromResumeToken(fs, token string, rt *zfs.ResumeToken, fsvs []zfs.FilesystemVersion) (*pdu.SendReq, error) {
+	findByGUID := func(t zfs.VersionType, guid uint64) *zfs.FilesystemVersion {
+		for i := range fsvs {
+			if fsvs[i].Type == t && fsvs[i].Guid == guid {
+				return &fsvs[i]
+			}
+		}
+		return nil
+	}
+
+	if !rt.HasToGUID {
+		return nil, errors.New("resume token does not contain 'to' GUID")
+	}
+	to := findByGUID(zfs.Snapshot, rt.ToGUID)
+	if to == nil {
+		return nil, errors.Errorf("stale resume token: 'to' snapshot with GUID %v no longer exists on filesystem %q", rt.ToGUID, fs)
+	}
+
+	req := &pdu.SendReq{
+		Filesystem:  fs,
+		To:          to.String(),
+		ResumeToken: token,
+	}
+	if rt.HasFromGUID {
+		from := findByGUID(zfs.Snapshot, rt.FromGUID)
+		if from == nil {
+			from = findByGUID(zfs.Bookmark, rt.FromGUID)
+		}
+		if from == nil {
+			return nil, errors.Errorf("stale resume token: 'from' version with GUID %v no longer exists on filesystem %q", rt.FromGUID, fs)
+		}
+		req.From = from.String()
+	}
+	return req, nil
+}
+
 func (p *Sender) DestroySnapshots(ctx context.Context, req *pdu.DestroySnapshotsReq) (*pdu.DestroySnapshotsRes, error) {
 	dp, err := p.filterCheckFS(req.Filesystem)
 	if err != nil {
@@ -148,7 +377,7 @@ func (p *Sender) ReplicationCursor(ctx context.Context, req *pdu.ReplicationCurs
 
 	switch op := req.Op.(type) {
 	case *pdu.ReplicationCursorReq_Get:
-		cursor, err := zfs.ZFSGetReplicationCursor(dp)
+		cursor, err := zfs.ZFSGetReplicationCursor(ctx, dp)
 		if err != nil {
 			return nil, err
 		}
@@ -157,7 +386,7 @@ func (p *Sender) ReplicationCursor(ctx context.Context, req *pdu.ReplicationCurs
 		}
 		return &pdu.ReplicationCursorRes{Result: &pdu.ReplicationCursorRes_Guid{Guid: cursor.Guid}}, nil
 	case *pdu.ReplicationCursorReq_Set:
-		guid, err := zfs.ZFSSetReplicationCursor(dp, op.Set.Snapshot)
+		guid, err := zfs.ZFSSetReplicationCursor(ctx, dp, op.Set.Snapshot)
 		if err != nil {
 			return nil, err
 		}
@@ -171,12 +400,15 @@ func (p *Sender) Receive(ctx context.Context, r *pdu.ReceiveReq, receive zfs.Str
 	return nil, fmt.Errorf("sender does not implement Receive()")
 }
 
-type FSFilter interface { // FIXME unused
+type FSFilter interface {
 	Filter(path *zfs.DatasetPath) (pass bool, err error)
 }
 
+// FSMap maps dataset paths, see NewMappingSender.
+// Map returns nil if there is no mapping for path.
+//
 // FIXME: can we get away without error types here?
-type FSMap interface { // FIXME unused
+type FSMap interface {
 	FSFilter
 	Map(path *zfs.DatasetPath) (*zfs.DatasetPath, error)
 	Invert() (FSMap, error)
@@ -188,7 +420,47 @@ type Receiver struct {
 	rootWithoutClientComponent *zfs.DatasetPath
 	appendClientIdentity       bool
 
-	recvParentCreationMtx *chainlock.L
+	// If not nil, the number of bytes received is accounted per client identity
+	// (label client_identity). Only used if the client identity is appended to the root dataset.
+	BytesReceived *prometheus.CounterVec
+
+	// If not nil, the client identity of every request is checked using ClientIdentityValidator
+	// before any ZFS operation is performed, and the request is rejected if it returns an error.
+	// Only used if the client identity is appended to the root dataset.
+	// See ClientIdentityAllowlist.
+	ClientIdentityValidator func(identity string) error
+
+	// If not nil, PostReceive is invoked after a (non-dry-run) receive into fs succeeded,
+	// e.g. to trigger downstream actions.
+	// It runs before the response is sent, with the request context limited to
+	// ZREPL_ENDPOINT_POST_RECEIVE_TIMEOUT, and must return when that context is done.
+	// Errors are logged but do not fail the receive.
+	PostReceive PostReceiveFunc
+
+	// If true, receives whose ReceiveReq.ExpectedSize exceeds the `available` property
+	// of the receiving filesystem (or its closest existing parent) are rejected
+	// with *ReceiveOutOfSpaceError before anything is modified.
+	// If `available` cannot be determined, the `free` property of the receiving pool is used instead.
+	// Note that the expected size is the size of the stream, which can differ from the
+	// space required on disk, e.g. due to compression.
+	CheckPoolFreeSpace bool
+
+	// If true, receives use `zfs recv -s`: an interrupted receive leaves a partially received state
+	// on the receiving filesystem, whose receive_resume_token is reported in *ReceiveError.
+	SavePartial bool
+
+	// The directory for the lock files that serialize receives into the same dataset
+	// across processes. DefaultRecvLockDir if empty.
+	// Must be set before the first call to Receive.
+	RecvLockDir string
+
+	// The user property that marks placeholder filesystems, zfs.PlaceholderPropertyName if empty.
+	// Must be valid according to zfs.ValidatePlaceholderPropertyName.
+	PlaceholderPropertyName string
+
+	recvParentCreationLocks *subtreeLocks
+	recvLocksOnce           sync.Once
+	recvLocks               *recvLocks
 }
 
 func NewReceiver(rootDataset *zfs.DatasetPath, appendClientIdentity bool) *Receiver {
@@ -198,15 +470,38 @@ func NewReceiver(rootDataset *zfs.DatasetPath, appendClientIdentity bool) *Recei
 	return &Receiver{
 		rootWithoutClientComponent: rootDataset.Copy(),
 		appendClientIdentity:       appendClientIdentity,
-		recvParentCreationMtx:      chainlock.New(),
+		recvParentCreationLocks:    newSubtreeLocks(),
 	}
 }
 
+func (s *Receiver) getRecvLocks() *recvLocks {
+	s.recvLocksOnce.Do(func() {
+		dir := s.RecvLockDir
+		if dir == "" {
+			dir = DefaultRecvLockDir
+		}
+		s.recvLocks = newRecvLocks(dir)
+	})
+	return s.recvLocks
+}
+
+func (s *Receiver) placeholderPropertyName() string {
+	if s.PlaceholderPropertyName == "" {
+		return zfs.PlaceholderPropertyName
+	}
+	return s.PlaceholderPropertyName
+}
+
 func TestClientIdentity(rootFS *zfs.DatasetPath, clientIdentity string) error {
 	_, err := clientRoot(rootFS, clientIdentity)
 	return err
 }
 
+// clientRoot validates clientIdentity and returns the dataset below rootFS
+// into which the client's filesystems are received.
+//
+// Besides being a single valid dataset path component, the identity must leave
+// room for the client's filesystems within the ZFS dataset name length limit.
 func clientRoot(rootFS *zfs.DatasetPath, clientIdentity string) (*zfs.DatasetPath, error) {
 	rootFSLen := rootFS.Length()
 	clientRootStr := path.Join(rootFS.ToString(), clientIdentity)
@@ -217,24 +512,68 @@ func clientRoot(rootFS *zfs.DatasetPath, clientIdentity string) (*zfs.DatasetPat
 	if rootFSLen+1 != clientRoot.Length() {
 		return nil, fmt.Errorf("client identity must be a single ZFS filesystem path component")
 	}
+	// at least "/" + a single-character filesystem name must fit below the client root
+	if len(clientRootStr)+2 > zfs.MaxDatasetNameLen {
+		return nil, fmt.Errorf("client identity is too long: %q would leave no room for filesystems within the ZFS limit of %d bytes", clientRootStr, zfs.MaxDatasetNameLen)
+	}
 	return clientRoot, nil
 }
 
-func (s *Receiver) clientRootFromCtx(ctx context.Context) *zfs.DatasetPath {
+// ClientIdentityNotAllowedError is returned by the Receiver's methods
+// if the client identity is rejected by Receiver.ClientIdentityValidator.
+type ClientIdentityNotAllowedError struct {
+	Identity string
+	Reason   error
+}
+
+func (e *ClientIdentityNotAllowedError) Error() string {
+	return fmt.Sprintf("client identity %q not allowed: %s", e.Identity, e.Reason)
+}
+
+// ClientIdentityAllowlist returns a Receiver.ClientIdentityValidator
+// that only accepts the given identities.
+func ClientIdentityAllowlist(identities ...string) func(identity string) error {
+	allowed := make(map[string]bool, len(identities))
+	for _, i := range identities {
+		allowed[i] = true
+	}
+	return func(identity string) error {
+		if !allowed[identity] {
+			return errors.New("not in allowlist")
+		}
+		return nil
+	}
+}
+
+func (s *Receiver) clientRootFromCtx(ctx context.Context) (*zfs.DatasetPath, error) {
 	if !s.appendClientIdentity {
-		return s.rootWithoutClientComponent.Copy()
+		return s.rootWithoutClientComponent.Copy(), nil
 	}
 
-	clientIdentity, ok := ctx.Value(ClientIdentityKey).(string)
+	clientRoot, _, err := s.clientFromCtx(ctx)
+	return clientRoot, err
+}
+
+// clientFromCtx must only be called if s.appendClientIdentity is true.
+// The returned identity is a valid single dataset path component
+// that has been accepted by s.ClientIdentityValidator.
+func (s *Receiver) clientFromCtx(ctx context.Context) (root *zfs.DatasetPath, identity string, err error) {
+	identity, ok := ctx.Value(ClientIdentityKey).(string)
 	if !ok {
-		panic(fmt.Sprintf("ClientIdentityKey context value must be set"))
+		return nil, "", errors.New("request has no client identity")
 	}
 
-	clientRoot, err := clientRoot(s.rootWithoutClientComponent, clientIdentity)
+	root, err = clientRoot(s.rootWithoutClientComponent, identity)
 	if err != nil {
-		panic(fmt.Sprintf("ClientIdentityContextKey must have been validated before invoking Receiver: %s", err))
+		return nil, "", errors.Wrapf(err, "invalid client identity %q", identity)
+	}
+	if s.ClientIdentityValidator != nil {
+		if err := s.ClientIdentityValidator(identity); err != nil {
+			getLogger(ctx).WithField("client_identity", identity).WithError(err).Error("rejecting request from client")
+			return nil, "", &ClientIdentityNotAllowedError{Identity: identity, Reason: err}
+		}
 	}
-	return clientRoot
+	return root, identity, nil
 }
 
 type subroot struct {
@@ -258,32 +597,42 @@ func (f subroot) MapToLocal(fs string) (*zfs.DatasetPath, error) {
 	}
 	c := f.localRoot.Copy()
 	c.Extend(p)
+	if err := c.ValidateLength(); err != nil {
+		return nil, err
+	}
 	return c, nil
 }
 
 func (s *Receiver) ListFilesystems(ctx context.Context, req *pdu.ListFilesystemReq) (*pdu.ListFilesystemRes, error) {
-	root := s.clientRootFromCtx(ctx)
+	root, err := s.clientRootFromCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
 	filtered, err := zfs.ZFSListMapping(ctx, subroot{root})
 	if err != nil {
 		return nil, err
 	}
 	// present filesystem without the root_fs prefix
+	phs, err := zfs.ZFSGetFilesystemPlaceholderStates(ctx, filtered, s.placeholderPropertyName())
+	if err != nil {
+		getLogger(ctx).WithError(err).Error("error getting placeholder states")
+		return nil, errors.Wrap(err, "cannot get placeholder states")
+	}
 	fss := make([]*pdu.Filesystem, 0, len(filtered))
 	for _, a := range filtered {
 		l := getLogger(ctx).WithField("fs", a)
-		ph, err := zfs.ZFSGetFilesystemPlaceholderState(a)
-		if err != nil {
-			l.WithError(err).Error("error getting placeholder state")
-			return nil, errors.Wrapf(err, "cannot get placeholder state for fs %q", a)
-		}
+		ph := phs[a.ToString()]
 		l.WithField("placeholder_state", fmt.Sprintf("%#v", ph)).Debug("placeholder state")
 		if !ph.FSExists {
 			l.Error("inconsistent placeholder state: filesystem must exists")
 			err := errors.Errorf("inconsistent placeholder state: filesystem %q must exist in this context", a.ToString())
 			return nil, err
 		}
-		a.TrimPrefix(root)
-		fss = append(fss, &pdu.Filesystem{Path: a.ToString(), IsPlaceholder: ph.IsPlaceholder})
+		rel, err := a.RelativeTo(root)
+		if err != nil {
+			return nil, errors.Wrap(err, "filesystem listed below root_fs is not below root_fs")
+		}
+		fss = append(fss, &pdu.Filesystem{Path: rel.ToString(), IsPlaceholder: ph.IsPlaceholder})
 	}
 	if len(fss) == 0 {
 		getLogger(ctx).Debug("no filesystems found")
@@ -293,13 +642,16 @@ func (s *Receiver) ListFilesystems(ctx context.Context, req *pdu.ListFilesystemR
 }
 
 func (s *Receiver) ListFilesystemVersions(ctx context.Context, req *pdu.ListFilesystemVersionsReq) (*pdu.ListFilesystemVersionsRes, error) {
-	root := s.clientRootFromCtx(ctx)
+	root, err := s.clientRootFromCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
 	lp, err := subroot{root}.MapToLocal(req.GetFilesystem())
 	if err != nil {
 		return nil, err
 	}
 
-	fsvs, err := zfs.ZFSListFilesystemVersions(lp, nil)
+	fsvs, err := zfs.ZFSListFilesystemVersions(ctx, lp, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -341,24 +693,47 @@ func (s *Receiver) Receive(ctx context.Context, req *pdu.ReceiveReq, receive zfs
 	getLogger(ctx).Debug("incoming Receive")
 	defer receive.Close()
 
-	root := s.clientRootFromCtx(ctx)
+	root, err := s.clientRootFromCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
 	lp, err := subroot{root}.MapToLocal(req.Filesystem)
 	if err != nil {
 		return nil, err
 	}
 
+	unlock, err := s.getRecvLocks().tryLock(ctx, lp.ToString())
+	if err != nil {
+		getLogger(ctx).WithError(err).Error("cannot acquire receive lock")
+		return nil, err
+	}
+	defer unlock()
+
+	if req.GetDryRun() {
+		return s.receiveDryRun(ctx, lp, receive)
+	}
+
+	if s.CheckPoolFreeSpace && req.GetExpectedSize() > 0 {
+		if err := checkReceiveFreeSpace(ctx, lp, req.GetExpectedSize()); err != nil {
+			getLogger(ctx).WithError(err).Error("rejecting receive")
+			return nil, err
+		}
+	}
+
 	// create placeholder parent filesystems as appropriate
 	//
-	// Manipulating the ZFS dataset hierarchy must happen exclusively.
-	// TODO: Use fine-grained locking to allow separate clients / requests to pass
-	// 		 through the following section concurrently when operating on disjoint
-	//       ZFS dataset hierarchy subtrees.
+	// Manipulating the ZFS dataset hierarchy must happen exclusively,
+	// but only within the subtree below root_fs that contains lp:
+	// receives into disjoint subtrees (e.g. different clients) proceed concurrently.
 	var visitErr error
 	func() {
-		getLogger(ctx).Debug("begin aquire recvParentCreationMtx")
-		defer s.recvParentCreationMtx.Lock().Unlock()
-		getLogger(ctx).Debug("end aquire recvParentCreationMtx")
-		defer getLogger(ctx).Debug("release recvParentCreationMtx")
+		lockKey := recvParentCreationLockKey(s.rootWithoutClientComponent, lp)
+		log := getLogger(ctx).WithField("lock_subtree", lockKey)
+		log.Debug("begin aquire recvParentCreationLock")
+		unlock := s.recvParentCreationLocks.lock(lockKey)
+		defer unlock()
+		log.Debug("end aquire recvParentCreationLock")
+		defer log.Debug("release recvParentCreationLock")
 
 		f := zfs.NewDatasetPathForest()
 		f.Add(lp)
@@ -367,7 +742,7 @@ func (s *Receiver) Receive(ctx context.Context, req *pdu.ReceiveReq, receive zfs
 			if v.Path.Equal(lp) {
 				return false
 			}
-			ph, err := zfs.ZFSGetFilesystemPlaceholderState(v.Path)
+			ph, err := zfs.ZFSGetFilesystemPlaceholderState(ctx, v.Path, s.placeholderPropertyName())
 			getLogger(ctx).
 				WithField("fs", v.Path.ToString()).
 				WithField("placeholder_state", fmt.Sprintf("%#v", ph)).
@@ -391,7 +766,7 @@ func (s *Receiver) Receive(ctx context.Context, req *pdu.ReceiveReq, receive zfs
 				}
 				l := getLogger(ctx).WithField("placeholder_fs", v.Path)
 				l.Debug("create placeholder filesystem")
-				err := zfs.ZFSCreatePlaceholderFilesystem(v.Path)
+				err := zfs.ZFSCreatePlaceholderFilesystem(v.Path, s.placeholderPropertyName())
 				if err != nil {
 					l.WithError(err).Error("cannot create placeholder filesystem")
 					visitErr = err
@@ -408,20 +783,35 @@ func (s *Receiver) Receive(ctx context.Context, req *pdu.ReceiveReq, receive zfs
 		return nil, visitErr
 	}
 
-	// determine whether we need to rollback the filesystem / change its placeholder state
-	var clearPlaceholderProperty bool
-	var recvOpts zfs.RecvOptions
-	ph, err := zfs.ZFSGetFilesystemPlaceholderState(lp)
-	if err == nil && ph.FSExists && ph.IsPlaceholder {
-		recvOpts.RollbackAndForceRecv = true
-		clearPlaceholderProperty = true
+	// Placeholders are always filesystems, but the parent might be a pre-existing volume.
+	// Volumes cannot have children, give a more helpful error than zfs recv would.
+	if lp.Length() > 1 {
+		parent := lp.Parent()
+		typ, err := zfs.ZFSGetDatasetType(ctx, parent)
+		if err != nil {
+			return nil, fmt.Errorf("cannot determine type of parent dataset %q: %s", parent.ToString(), err)
+		}
+		if typ != zfs.DatasetTypeFilesystem {
+			return nil, fmt.Errorf("cannot receive %q: parent dataset %q is a %s", lp.ToString(), parent.ToString(), typ)
+		}
 	}
+
+	recvOpts, clearPlaceholderProperty := recvOptionsForPlaceholderState(ctx, lp, s.placeholderPropertyName())
+	recvOpts.Verbose = true
+	recvOpts.SavePartial = s.SavePartial
 	if clearPlaceholderProperty {
-		if err := zfs.ZFSSetPlaceholder(lp, false); err != nil {
+		if err := zfs.ZFSClearPlaceholder(ctx, lp, s.placeholderPropertyName()); err != nil {
 			return nil, fmt.Errorf("cannot clear placeholder property for forced receive: %s", err)
 		}
 	}
 
+	if p, ok := getReceiveProgress(ctx); ok {
+		recvOpts.ProgressInterval = p.every
+		recvOpts.OnProgress = func(received int64) {
+			p.cb(req.Filesystem, received)
+		}
+	}
+
 	getLogger(ctx).Debug("acquire concurrent recv semaphore")
 	// TODO use try-acquire and fail with resource-exhaustion rpc status
 	// => would require handling on the client-side
@@ -432,20 +822,195 @@ func (s *Receiver) Receive(ctx context.Context, req *pdu.ReceiveReq, receive zfs
 	}
 	defer guard.Release()
 
+	if s.BytesReceived != nil && s.appendClientIdentity {
+		_, identity, err := s.clientFromCtx(ctx)
+		if err != nil {
+			return nil, err
+		}
+		receive = newPromCountingStreamCopier(receive, s.BytesReceived.WithLabelValues(identity))
+	}
+
 	getLogger(ctx).WithField("opts", fmt.Sprintf("%#v", recvOpts)).Debug("start receive command")
 
-	if err := zfs.ZFSRecv(ctx, lp.ToString(), receive, recvOpts); err != nil {
-		getLogger(ctx).
-			WithError(err).
-			WithField("opts", recvOpts).
-			Error("zfs receive failed")
+	recvRes, err := zfs.ZFSRecv(ctx, lp.ToString(), receive, recvOpts)
+	if err != nil {
+		log := getLogger(ctx).WithError(err).WithField("opts", recvOpts)
+		if recvRes != nil {
+			log = log.WithField("bytes_written", recvRes.BytesWritten)
+		}
+		log.Error("zfs receive failed")
+		return nil, newReceiveError(lp, recvRes, err)
+	}
+	s.runPostReceive(ctx, lp, recvRes)
+	return &pdu.ReceiveRes{
+		ResultingSnapshot: recvRes.ResultingSnapshot,
+		BytesReceived:     uint64(recvRes.BytesWritten),
+	}, nil
+}
+
+// ReceiveError is returned by Receiver.Receive if zfs recv failed.
+// It reports how far the receive got, which is also included in the error message
+// because only the message is transferred to RPC clients.
+type ReceiveError struct {
+	Filesystem    string
+	BytesReceived uint64
+	// The receive_resume_token of the partially received state,
+	// only set if Receiver.SavePartial is true and ZFS saved a partial state.
+	PartialResumeToken string
+	Err                error
+}
+
+func newReceiveError(lp *zfs.DatasetPath, res *zfs.RecvResult, err error) *ReceiveError {
+	e := &ReceiveError{Filesystem: lp.ToString(), Err: err}
+	if res != nil {
+		e.BytesReceived = uint64(res.BytesWritten)
+		e.PartialResumeToken = res.PartialResumeToken
+	}
+	return e
+}
+
+func (e *ReceiveError) Error() string {
+	msg := fmt.Sprintf("receive into %q failed after %v bytes: %s", e.Filesystem, e.BytesReceived, e.Err)
+	if e.PartialResumeToken != "" {
+		msg += fmt.Sprintf(" (partially received state saved, receive_resume_token %s)", e.PartialResumeToken)
+	}
+	return msg
+}
+
+// ReceiveOutOfSpaceError is returned by Receiver.Receive if Receiver.CheckPoolFreeSpace is set
+// and the expected size of the stream exceeds the space available to the receiving filesystem.
+type ReceiveOutOfSpaceError struct {
+	Filesystem string
+	// The dataset whose `available` property was checked,
+	// or the pool whose `free` property was checked if the former could not be determined.
+	SpaceOf      string
+	Available    uint64
+	ExpectedSize uint64
+}
+
+func (e *ReceiveOutOfSpaceError) Error() string {
+	return fmt.Sprintf("cannot receive into %q: expected stream size %v bytes exceeds available space of %q (%v bytes)",
+		e.Filesystem, e.ExpectedSize, e.SpaceOf, e.Available)
+}
+
+// checkReceiveFreeSpace compares expectedSize to the `available` property of lp
+// or, if lp does not exist yet, of its closest existing parent.
+// Unlike the pool's free space, `available` accounts for quotas and reservations.
+// If it cannot be determined, the pool's `free` property is used instead.
+// If neither can be determined, the check is skipped: zfs recv will fail if it runs out of space.
+func checkReceiveFreeSpace(ctx context.Context, lp *zfs.DatasetPath, expectedSize int64) error {
+	for ds := lp; !ds.Empty(); ds = ds.Parent() {
+		props, err := zfs.ZFSGet(ctx, ds, []string{"available"})
+		if _, ok := err.(*zfs.DatasetDoesNotExist); ok {
+			continue
+		}
+		var avail uint64
+		if err == nil {
+			avail, err = props.GetUint64("available")
+		}
+		if err != nil {
+			getLogger(ctx).WithError(err).WithField("dataset", ds.ToString()).Warn("cannot determine available space of dataset, falling back to free space of pool")
+			break
+		}
+		return receiveFreeSpaceError(lp, ds.ToString(), avail, expectedSize)
+	}
+
+	pool := strings.SplitN(lp.ToString(), "/", 2)[0]
+	props, err := zfs.ZPoolGetProps(ctx, pool, []string{"free"})
+	if err != nil {
+		getLogger(ctx).WithError(err).WithField("pool", pool).Warn("cannot determine free space of pool, skipping check")
+		return nil
+	}
+	free, err := strconv.ParseUint(props["free"], 10, 64)
+	if err != nil {
+		getLogger(ctx).WithError(err).WithField("pool", pool).Warn("cannot parse free space of pool, skipping check")
+		return nil
+	}
+	return receiveFreeSpaceError(lp, pool, free, expectedSize)
+}
+
+func receiveFreeSpaceError(lp *zfs.DatasetPath, spaceOf string, available uint64, expectedSize int64) error {
+	if expectedSize <= 0 || uint64(expectedSize) <= available {
+		return nil
+	}
+	return &ReceiveOutOfSpaceError{
+		Filesystem:   lp.ToString(),
+		SpaceOf:      spaceOf,
+		Available:    available,
+		ExpectedSize: uint64(expectedSize),
+	}
+}
+
+// PostReceiveFunc is the type of Receiver.PostReceive.
+type PostReceiveFunc func(ctx context.Context, fs *zfs.DatasetPath, res *zfs.RecvResult) error
+
+var postReceiveTimeout = envconst.Duration("ZREPL_ENDPOINT_POST_RECEIVE_TIMEOUT", 1*time.Minute)
+
+func (s *Receiver) runPostReceive(ctx context.Context, fs *zfs.DatasetPath, res *zfs.RecvResult) {
+	if s.PostReceive == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, postReceiveTimeout)
+	defer cancel()
+	log := getLogger(ctx).WithField("fs", fs.ToString())
+	log.Debug("run post-receive hook")
+	if err := s.PostReceive(ctx, fs, res); err != nil {
+		log.WithError(err).Error("post-receive hook failed, continuing")
+	}
+}
+
+// recvOptionsForPlaceholderState determines whether a receive into lp must rollback the filesystem
+// and whether its placeholder property propName must be cleared before a receive that is not a dry run.
+func recvOptionsForPlaceholderState(ctx context.Context, lp *zfs.DatasetPath, propName string) (recvOpts zfs.RecvOptions, clearPlaceholderProperty bool) {
+	ph, err := zfs.ZFSGetFilesystemPlaceholderState(ctx, lp, propName)
+	if err == nil && ph.FSExists && ph.IsPlaceholder {
+		recvOpts.RollbackAndForceRecv = true
+		clearPlaceholderProperty = true
+	}
+	return recvOpts, clearPlaceholderProperty
+}
+
+// receiveDryRun must not modify the receiving side
+func (s *Receiver) receiveDryRun(ctx context.Context, lp *zfs.DatasetPath, receive zfs.StreamCopier) (*pdu.ReceiveRes, error) {
+	guard, err := maxConcurrentZFSRecvSemaphore.Acquire(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return &pdu.ReceiveRes{}, nil
+	defer guard.Release()
+
+	// like Receive, but the placeholder property is left as is: a forced `zfs recv -n` modifies nothing
+	recvOpts, _ := recvOptionsForPlaceholderState(ctx, lp, s.placeholderPropertyName())
+
+	getLogger(ctx).Debug("start dry-run receive")
+	report, err := zfs.ZFSRecvDryRun(ctx, lp.ToString(), receive, recvOpts)
+	if err != nil {
+		getLogger(ctx).WithError(err).Error("dry-run receive failed")
+		return nil, err
+	}
+	return receiveResFromDryRunReport(report), nil
+}
+
+func receiveResFromDryRunReport(report *zfs.RecvDryRunReport) *pdu.ReceiveRes {
+	res := &pdu.ReceiveRes{
+		DryRunCompatible:          report.Compatible(),
+		DryRunFromGUID:            report.FromGUID,
+		DryRunToGUID:              report.ToGUID,
+		DryRunMissingPoolFeatures: report.MissingPoolFeatures,
+	}
+	if !res.DryRunCompatible {
+		res.DryRunError = report.String()
+	}
+	if report.WouldReceive != nil {
+		res.DryRunResultingSnapshot = report.WouldReceive.ResultingSnapshot
+	}
+	return res
 }
 
 func (s *Receiver) DestroySnapshots(ctx context.Context, req *pdu.DestroySnapshotsReq) (*pdu.DestroySnapshotsRes, error) {
-	root := s.clientRootFromCtx(ctx)
+	root, err := s.clientRootFromCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
 	lp, err := subroot{root}.MapToLocal(req.Filesystem)
 	if err != nil {
 		return nil, err
@@ -471,7 +1036,7 @@ func doDestroySnapshots(ctx context.Context, lp *zfs.DatasetPath, snaps []*pdu.F
 			ErrOut:     &errs[i],
 		}
 	}
-	zfs.ZFSDestroyFilesystemVersions(reqs)
+	zfs.ZFSDestroyFilesystemVersions(ctx, reqs)
 	for i := range reqs {
 		if errs[i] != nil {
 			if de, ok := errs[i].(*zfs.DestroySnapshotsError); ok && len(de.Reason) == 1 {
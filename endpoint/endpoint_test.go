@@ -0,0 +1,503 @@
+package endpoint
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/util/semaphore"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func TestSendReqFromResumeToken(t *testing.T) {
+	fsvs := []zfs.FilesystemVersion{
+		{Type: zfs.Bookmark, Name: "a", Guid: 1, CreateTXG: 10},
+		{Type: zfs.Snapshot, Name: "b", Guid: 2, CreateTXG: 20},
+		{Type: zfs.Snapshot, Name: "c", Guid: 3, CreateTXG: 30},
+	}
+
+	t.Run("incremental", func(t *testing.T) {
+		rt := &zfs.ResumeToken{HasFromGUID: true, FromGUID: 1, HasToGUID: true, ToGUID: 3}
+		req, err := sendReqFromResumeToken("pool/fs", "1-abc", rt, fsvs)
+		require.NoError(t, err)
+		assert.Equal(t, "pool/fs", req.Filesystem)
+		assert.Equal(t, "#a", req.From)
+		assert.Equal(t, "@c", req.To)
+		assert.Equal(t, "1-abc", req.ResumeToken)
+	})
+
+	t.Run("full", func(t *testing.T) {
+		rt := &zfs.ResumeToken{HasToGUID: true, ToGUID: 2}
+		req, err := sendReqFromResumeToken("pool/fs", "1-abc", rt, fsvs)
+		require.NoError(t, err)
+		assert.Equal(t, "", req.From)
+		assert.Equal(t, "@b", req.To)
+	})
+
+	t.Run("staleTo", func(t *testing.T) {
+		rt := &zfs.ResumeToken{HasFromGUID: true, FromGUID: 2, HasToGUID: true, ToGUID: 4}
+		_, err := sendReqFromResumeToken("pool/fs", "1-abc", rt, fsvs)
+		assert.Error(t, err)
+	})
+
+	t.Run("staleFrom", func(t *testing.T) {
+		rt := &zfs.ResumeToken{HasFromGUID: true, FromGUID: 5, HasToGUID: true, ToGUID: 3}
+		_, err := sendReqFromResumeToken("pool/fs", "1-abc", rt, fsvs)
+		assert.Error(t, err)
+	})
+
+	t.Run("toIsBookmark", func(t *testing.T) {
+		rt := &zfs.ResumeToken{HasToGUID: true, ToGUID: 1}
+		_, err := sendReqFromResumeToken("pool/fs", "1-abc", rt, fsvs)
+		assert.Error(t, err)
+	})
+}
+
+func TestResumeTokenMatchesSendReq(t *testing.T) {
+	fsvs := []zfs.FilesystemVersion{
+		{Type: zfs.Bookmark, Name: "a", Guid: 1, CreateTXG: 10},
+		{Type: zfs.Snapshot, Name: "b", Guid: 2, CreateTXG: 20},
+		{Type: zfs.Snapshot, Name: "c", Guid: 3, CreateTXG: 30},
+	}
+	incremental := &zfs.ResumeToken{HasFromGUID: true, FromGUID: 1, HasToGUID: true, ToGUID: 3}
+	full := &zfs.ResumeToken{HasToGUID: true, ToGUID: 2}
+
+	tcs := []struct {
+		rt       *zfs.ResumeToken
+		from, to string
+		ok       bool
+	}{
+		{incremental, "#a", "@c", true},
+		{full, "", "@b", true},
+		{incremental, "@b", "@c", false},
+		{incremental, "#a", "@b", false},
+		{incremental, "", "@c", false},
+		{full, "#a", "@b", false},
+		{full, "", "@nonexistent", false},
+		{&zfs.ResumeToken{}, "", "@b", false},
+	}
+	for _, tc := range tcs {
+		err := resumeTokenMatchesSendReq(tc.rt, &pdu.SendReq{From: tc.from, To: tc.to, ResumeToken: "1-abc"}, fsvs)
+		if tc.ok {
+			assert.NoError(t, err, "%s => %s", tc.from, tc.to)
+		} else {
+			assert.Error(t, err, "%s => %s", tc.from, tc.to)
+		}
+	}
+}
+
+func TestSenderDisableResumeRejectsResumeToken(t *testing.T) {
+	s := NewSender(zfs.NoFilter())
+	s.DisableResume = true
+
+	_, _, err := s.Send(context.Background(), &pdu.SendReq{
+		Filesystem:  "pool/fs",
+		From:        "@a",
+		To:          "@b",
+		ResumeToken: "1-abc",
+	})
+	assert.Equal(t, ErrResumeDisabled, err)
+
+	_, err = s.SendReqFromResumeToken(context.Background(), "pool/fs", "1-abc")
+	assert.Equal(t, ErrResumeDisabled, err)
+}
+
+func TestAcquireSendSemaphoreFailIfBusy(t *testing.T) {
+	var guards []*semaphore.AcquireGuard
+	defer func() {
+		for _, g := range guards {
+			g.Release()
+		}
+	}()
+	for i := int64(0); i < maxConcurrentZFSSend; i++ {
+		g, err := acquireSendSemaphore(context.Background(), true)
+		require.NoError(t, err)
+		guards = append(guards, g)
+	}
+
+	_, err := acquireSendSemaphore(context.Background(), true)
+	rerr, ok := err.(*ResourceExhaustedError)
+	require.True(t, ok, "%T %s", err, err)
+	assert.Equal(t, maxConcurrentZFSSend, rerr.Max)
+
+	// without FailIfBusy, we wait
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = acquireSendSemaphore(ctx, false)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestClientRootLengthLimit(t *testing.T) {
+	root, err := zfs.NewDatasetPath("pool/sink")
+	require.NoError(t, err)
+
+	_, err = clientRoot(root, "client1")
+	assert.NoError(t, err)
+	_, err = clientRoot(root, strings.Repeat("c", zfs.MaxDatasetNameLen))
+	assert.Error(t, err)
+	// fits, but leaves no room for filesystems below the client root
+	_, err = clientRoot(root, strings.Repeat("c", zfs.MaxDatasetNameLen-len("pool/sink/")))
+	assert.Error(t, err)
+
+	cr, err := clientRoot(root, "client1")
+	require.NoError(t, err)
+	_, err = subroot{cr}.MapToLocal("a/b")
+	assert.NoError(t, err)
+	_, err = subroot{cr}.MapToLocal(strings.Repeat("a", zfs.MaxDatasetNameLen-len("pool/sink/client1/")+1))
+	_, ok := err.(*zfs.DatasetNameTooLongError)
+	assert.True(t, ok, "%T %v", err, err)
+}
+
+func TestReceiverClientIdentityValidator(t *testing.T) {
+	root, err := zfs.NewDatasetPath("pool/sink")
+	require.NoError(t, err)
+	r := NewReceiver(root, true)
+	r.ClientIdentityValidator = ClientIdentityAllowlist("client1", "client2")
+
+	withIdentity := func(identity string) context.Context {
+		return context.WithValue(context.Background(), ClientIdentityKey, identity)
+	}
+
+	cr, err := r.clientRootFromCtx(withIdentity("client1"))
+	require.NoError(t, err)
+	assert.Equal(t, "pool/sink/client1", cr.ToString())
+
+	_, err = r.clientRootFromCtx(withIdentity("client3"))
+	nerr, ok := err.(*ClientIdentityNotAllowedError)
+	require.True(t, ok, "%T %v", err, err)
+	assert.Equal(t, "client3", nerr.Identity)
+
+	_, err = r.clientRootFromCtx(context.Background())
+	assert.Error(t, err)
+	_, err = r.clientRootFromCtx(withIdentity("a/b"))
+	assert.Error(t, err)
+
+	// rejected before any ZFS operation
+	_, err = r.ListFilesystems(withIdentity("client3"), &pdu.ListFilesystemReq{})
+	assert.IsType(t, &ClientIdentityNotAllowedError{}, err)
+	_, err = r.DestroySnapshots(withIdentity("client3"), &pdu.DestroySnapshotsReq{Filesystem: "fs"})
+	assert.IsType(t, &ClientIdentityNotAllowedError{}, err)
+
+	// without client identity, the validator is not used
+	r = NewReceiver(root, false)
+	r.ClientIdentityValidator = ClientIdentityAllowlist()
+	cr, err = r.clientRootFromCtx(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "pool/sink", cr.ToString())
+}
+
+func TestReceiverRunPostReceive(t *testing.T) {
+	root, err := zfs.NewDatasetPath("pool/sink")
+	require.NoError(t, err)
+	fs, err := zfs.NewDatasetPath("pool/sink/fs")
+	require.NoError(t, err)
+	res := &zfs.RecvResult{Filesystem: "pool/sink/fs", ResultingSnapshot: "pool/sink/fs@a"}
+
+	r := NewReceiver(root, false)
+	r.runPostReceive(context.Background(), fs, res) // no hook set
+
+	called := false
+	r.PostReceive = func(ctx context.Context, hookFS *zfs.DatasetPath, hookRes *zfs.RecvResult) error {
+		called = true
+		assert.True(t, hookFS.Equal(fs))
+		assert.Equal(t, res, hookRes)
+		_, hasDeadline := ctx.Deadline()
+		assert.True(t, hasDeadline)
+		return errors.New("hook failed")
+	}
+	r.runPostReceive(context.Background(), fs, res) // error is only logged
+	assert.True(t, called)
+}
+
+func TestReceiveFreeSpaceError(t *testing.T) {
+	lp, err := zfs.NewDatasetPath("pool/sink/fs")
+	require.NoError(t, err)
+
+	assert.NoError(t, receiveFreeSpaceError(lp, "pool/sink", 1000, 0))
+	assert.NoError(t, receiveFreeSpaceError(lp, "pool/sink", 1000, 1000))
+	err = receiveFreeSpaceError(lp, "pool/sink", 1000, 1001)
+	serr, ok := err.(*ReceiveOutOfSpaceError)
+	require.True(t, ok, "%T %v", err, err)
+	assert.Equal(t, "pool/sink/fs", serr.Filesystem)
+	assert.Equal(t, "pool/sink", serr.SpaceOf)
+	assert.Equal(t, uint64(1000), serr.Available)
+	assert.Equal(t, uint64(1001), serr.ExpectedSize)
+}
+
+func TestCheckReceiveFreeSpaceUsesClosestExistingParent(t *testing.T) {
+	// pool/sink/fs does not exist yet, pool/sink has a quota of 1000 bytes left
+	defer withFakeZFSBinary(t, `
+for last; do :; done
+case "$last" in
+pool/sink/fs)
+	echo "cannot open '$last': dataset does not exist" >&2
+	exit 1
+	;;
+pool/sink)
+	printf 'available\t1000\t-\n'
+	;;
+*)
+	echo "unexpected invocation: $*" >&2
+	exit 1
+	;;
+esac
+`)()
+
+	lp := mustDatasetPath(t, "pool/sink/fs")
+	assert.NoError(t, checkReceiveFreeSpace(context.Background(), lp, 1000))
+	err := checkReceiveFreeSpace(context.Background(), lp, 1001)
+	serr, ok := err.(*ReceiveOutOfSpaceError)
+	require.True(t, ok, "%T %v", err, err)
+	assert.Equal(t, "pool/sink", serr.SpaceOf)
+	assert.Equal(t, uint64(1000), serr.Available)
+}
+
+func TestReceiveResFromDryRunReport(t *testing.T) {
+	res := receiveResFromDryRunReport(&zfs.RecvDryRunReport{
+		Filesystem: "pool/sink/fs",
+		FromGUID:   1,
+		ToGUID:     2,
+		WouldReceive: &zfs.RecvDryRunWouldReceive{
+			Incremental:       true,
+			StreamSnapshot:    "pool/fs@b",
+			ResultingSnapshot: "pool/sink/fs@b",
+		},
+	})
+	assert.True(t, res.GetDryRunCompatible())
+	assert.Empty(t, res.GetDryRunError())
+	assert.Equal(t, uint64(1), res.GetDryRunFromGUID())
+	assert.Equal(t, uint64(2), res.GetDryRunToGUID())
+	assert.Equal(t, "pool/sink/fs@b", res.GetDryRunResultingSnapshot())
+
+	res = receiveResFromDryRunReport(&zfs.RecvDryRunReport{
+		Filesystem:           "pool/sink/fs",
+		RequiredPoolFeatures: []string{"large_blocks"},
+		MissingPoolFeatures:  []string{"large_blocks"},
+	})
+	assert.False(t, res.GetDryRunCompatible())
+	assert.Contains(t, res.GetDryRunError(), "large_blocks")
+	assert.Equal(t, []string{"large_blocks"}, res.GetDryRunMissingPoolFeatures())
+}
+
+// withFakeZFSBinary replaces zfs.ZFS_BINARY with a shell script that runs scriptBody.
+func withFakeZFSBinary(t *testing.T, scriptBody string) (restore func()) {
+	dir, err := ioutil.TempDir("", "zrepl-endpoint-test")
+	require.NoError(t, err)
+	fake := filepath.Join(dir, "zfs")
+	require.NoError(t, ioutil.WriteFile(fake, []byte("#!/bin/sh\n"+scriptBody), 0755))
+
+	prev := zfs.ZFS_BINARY
+	zfs.ZFS_BINARY = fake
+	return func() {
+		zfs.ZFS_BINARY = prev
+		os.RemoveAll(dir)
+	}
+}
+
+func TestReceiverReceiveReportsProgress(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 30) // bytesStreamCopier writes 3-byte chunks
+
+	// pool and pool/sink exist, pool/sink/fs is created by the receive
+	defer withFakeZFSBinary(t, fmt.Sprintf(`
+case "$1" in
+get)
+	for last; do :; done
+	if [ "$last" = "pool/sink/fs" ]; then
+		echo "cannot open '$last': dataset does not exist" >&2
+		exit 1
+	fi
+	case "$5" in
+	type) printf 'type\tfilesystem\t-\n';;
+	*) printf '%%s\t-\t-\n' "$5";;
+	esac
+	;;
+recv|receive)
+	head -c %d > /dev/null
+	;;
+*)
+	echo "unexpected invocation: $*" >&2
+	exit 1
+	;;
+esac
+`, len(data)))()
+
+	lockDir, err := ioutil.TempDir("", "zrepl-endpoint-recvlock")
+	require.NoError(t, err)
+	defer os.RemoveAll(lockDir)
+
+	r := NewReceiver(mustDatasetPath(t, "pool/sink"), false)
+	r.RecvLockDir = lockDir
+
+	var reports []int64
+	ctx := WithReceiveProgress(context.Background(), 0, func(fs string, received int64) {
+		assert.Equal(t, "fs", fs)
+		reports = append(reports, received)
+	})
+	res, err := r.Receive(ctx, &pdu.ReceiveReq{Filesystem: "fs"}, bytesStreamCopier{data})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(len(data)), res.GetBytesReceived())
+
+	// one report per chunk + the final one
+	require.Len(t, reports, len(data)/3+1)
+	for i := 0; i < len(data)/3; i++ {
+		assert.Equal(t, int64((i+1)*3), reports[i])
+	}
+	assert.Equal(t, int64(len(data)), reports[len(reports)-1])
+}
+
+func TestReceiverReceiveErrorReportsPartialState(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 30)
+
+	// pool/sink/fs exists, the receive fails after consuming the stream and leaves a partial state
+	defer withFakeZFSBinary(t, fmt.Sprintf(`
+case "$1" in
+get)
+	case "$5" in
+	type) printf 'type\tfilesystem\t-\n';;
+	receive_resume_token) printf 'receive_resume_token\t1-abc-def\t-\n';;
+	*) printf '%%s\t-\t-\n' "$5";;
+	esac
+	;;
+recv|receive)
+	case "$*" in
+	*" -s "*) ;;
+	*) echo "expected -s: $*" >&2; exit 2;;
+	esac
+	head -c %d > /dev/null
+	echo "cannot receive incremental stream: checksum mismatch or incomplete stream" >&2
+	exit 1
+	;;
+*)
+	echo "unexpected invocation: $*" >&2
+	exit 1
+	;;
+esac
+`, len(data)))()
+
+	lockDir, err := ioutil.TempDir("", "zrepl-endpoint-recvlock")
+	require.NoError(t, err)
+	defer os.RemoveAll(lockDir)
+
+	r := NewReceiver(mustDatasetPath(t, "pool/sink"), false)
+	r.RecvLockDir = lockDir
+	r.SavePartial = true
+
+	_, err = r.Receive(context.Background(), &pdu.ReceiveReq{Filesystem: "fs"}, bytesStreamCopier{data})
+	rerr, ok := err.(*ReceiveError)
+	require.True(t, ok, "%T %s", err, err)
+	assert.Equal(t, "pool/sink/fs", rerr.Filesystem)
+	assert.Equal(t, uint64(len(data)), rerr.BytesReceived)
+	assert.Equal(t, "1-abc-def", rerr.PartialResumeToken)
+	assert.Contains(t, rerr.Error(), "1-abc-def")
+	_, ok = rerr.Err.(*zfs.ZFSError)
+	assert.True(t, ok, "%T", rerr.Err)
+}
+
+func TestRecvOptionsForPlaceholderState(t *testing.T) {
+	defer withFakeZFSBinary(t, `
+for last; do :; done
+case "$last" in
+pool/sink/placeholder) test "$5" = zrepl:placeholder && printf '%s\ton\tlocal\n' "$5" || printf '%s\t-\t-\n' "$5";;
+pool/sink/fs) printf '%s\t-\t-\n' "$5";;
+*) echo "cannot open '$last': dataset does not exist" >&2; exit 1;;
+esac
+`)()
+
+	// Receive and receiveDryRun both replace placeholders, only Receive clears the property
+	opts, clear := recvOptionsForPlaceholderState(context.Background(), mustDatasetPath(t, "pool/sink/placeholder"), zfs.PlaceholderPropertyName)
+	assert.True(t, opts.RollbackAndForceRecv)
+	assert.True(t, clear)
+
+	opts, clear = recvOptionsForPlaceholderState(context.Background(), mustDatasetPath(t, "pool/sink/fs"), zfs.PlaceholderPropertyName)
+	assert.False(t, opts.RollbackAndForceRecv)
+	assert.False(t, clear)
+
+	opts, clear = recvOptionsForPlaceholderState(context.Background(), mustDatasetPath(t, "pool/sink/new"), zfs.PlaceholderPropertyName)
+	assert.False(t, opts.RollbackAndForceRecv)
+	assert.False(t, clear)
+
+	// placeholders marked by another deployment's property are regular filesystems
+	r := NewReceiver(mustDatasetPath(t, "pool/sink"), false)
+	assert.Equal(t, zfs.PlaceholderPropertyName, r.placeholderPropertyName())
+	r.PlaceholderPropertyName = "zrepl.sitea:placeholder"
+	opts, clear = recvOptionsForPlaceholderState(context.Background(), mustDatasetPath(t, "pool/sink/placeholder"), r.placeholderPropertyName())
+	assert.False(t, opts.RollbackAndForceRecv)
+	assert.False(t, clear)
+}
+
+func mustDatasetPath(t *testing.T, p string) *zfs.DatasetPath {
+	dp, err := zfs.NewDatasetPath(p)
+	require.NoError(t, err)
+	return dp
+}
+
+// staticFSMap maps exactly the paths in the map
+type staticFSMap map[string]string
+
+func (m staticFSMap) Map(path *zfs.DatasetPath) (*zfs.DatasetPath, error) {
+	if target, ok := m[path.ToString()]; ok {
+		return zfs.NewDatasetPath(target)
+	}
+	return nil, nil
+}
+
+func (m staticFSMap) Invert() (FSMap, error) {
+	inv := make(staticFSMap, len(m))
+	for source, target := range m {
+		if _, ok := inv[target]; ok {
+			return nil, fmt.Errorf("duplicate target %q", target)
+		}
+		inv[target] = source
+	}
+	return inv, nil
+}
+
+func (m staticFSMap) Filter(path *zfs.DatasetPath) (bool, error) {
+	_, ok := m[path.ToString()]
+	return ok, nil
+}
+
+func (m staticFSMap) AsFilter() FSFilter { return m }
+
+// inverse maps backup/a to tank/a, but the forward map presents tank/a as other/a
+type inconsistentFSMap struct{ staticFSMap }
+
+func (m inconsistentFSMap) Invert() (FSMap, error) {
+	return staticFSMap{"backup/a": "tank/a", "other/a": "tank/a", "backup/b": "tank/b"}, nil
+}
+
+func TestMappingSenderFilterCheckFS(t *testing.T) {
+	m := inconsistentFSMap{staticFSMap{"tank/a": "other/a", "tank/b": "backup/b"}}
+	s, err := NewMappingSender(zfs.NoFilter(), m)
+	require.NoError(t, err)
+
+	lp, err := s.filterCheckFS("backup/b")
+	require.NoError(t, err)
+	assert.Equal(t, "tank/b", lp.ToString())
+	lp, err = s.filterCheckFS("other/a")
+	require.NoError(t, err)
+	assert.Equal(t, "tank/a", lp.ToString())
+
+	// tank/a is presented as other/a only
+	_, err = s.filterCheckFS("backup/a")
+	assert.Error(t, err)
+	// local names are not visible to the peer
+	_, err = s.filterCheckFS("tank/b")
+	assert.Error(t, err)
+}
+
+func TestNewMappingSenderRequiresInvertibleMap(t *testing.T) {
+	_, err := NewMappingSender(zfs.NoFilter(), staticFSMap{"tank/a": "backup/a", "zroot/a": "backup/a"})
+	assert.Error(t, err)
+}
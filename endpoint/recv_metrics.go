@@ -0,0 +1,28 @@
+package endpoint
+
+import (
+	"io"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// promCountingStreamCopier adds the bytes written by the wrapped StreamCopier to counter
+// as they are copied, i.e., counter is up to date while the receive is still in progress.
+type promCountingStreamCopier struct {
+	sc      zfs.StreamCopier
+	counter prometheus.Counter
+}
+
+func newPromCountingStreamCopier(sc zfs.StreamCopier, counter prometheus.Counter) zfs.StreamCopier {
+	return &promCountingStreamCopier{sc, counter}
+}
+
+func (c *promCountingStreamCopier) WriteStreamTo(w io.Writer) zfs.StreamCopierError {
+	return c.sc.WriteStreamTo(zfs.NewPromCountingWriter(w, c.counter))
+}
+
+func (c *promCountingStreamCopier) Close() error {
+	return c.sc.Close()
+}
@@ -0,0 +1,56 @@
+package endpoint
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/zfs"
+)
+
+type bytesStreamCopier struct {
+	data []byte
+}
+
+func (c bytesStreamCopier) WriteStreamTo(w io.Writer) zfs.StreamCopierError {
+	// write in chunks to exercise accumulation
+	for i := 0; i < len(c.data); i += 3 {
+		end := i + 3
+		if end > len(c.data) {
+			end = len(c.data)
+		}
+		if _, err := w.Write(c.data[i:end]); err != nil {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (c bytesStreamCopier) Close() error { return nil }
+
+func TestPromCountingStreamCopier(t *testing.T) {
+	vec := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "bytes_received"}, []string{"client_identity"})
+
+	data := []byte("0123456789")
+	var buf bytes.Buffer
+	sc := newPromCountingStreamCopier(bytesStreamCopier{data}, vec.WithLabelValues("client1"))
+	require.Nil(t, sc.WriteStreamTo(&buf))
+	sc = newPromCountingStreamCopier(bytesStreamCopier{data[:4]}, vec.WithLabelValues("client1"))
+	require.Nil(t, sc.WriteStreamTo(&buf))
+	sc = newPromCountingStreamCopier(bytesStreamCopier{data[:1]}, vec.WithLabelValues("client2"))
+	require.Nil(t, sc.WriteStreamTo(&buf))
+	assert.Equal(t, 15, buf.Len())
+
+	value := func(client string) float64 {
+		var m dto.Metric
+		require.NoError(t, vec.WithLabelValues(client).Write(&m))
+		return m.GetCounter().GetValue()
+	}
+	assert.Equal(t, float64(14), value("client1"))
+	assert.Equal(t, float64(1), value("client2"))
+}
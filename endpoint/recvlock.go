@@ -0,0 +1,106 @@
+package endpoint
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// DefaultRecvLockDir is used by Receiver if Receiver.RecvLockDir is empty.
+const DefaultRecvLockDir = "/var/run/zrepl/recvlock"
+
+type RecvInProgressError struct {
+	Filesystem string
+}
+
+func (e *RecvInProgressError) Error() string {
+	return fmt.Sprintf("receive already in progress for dataset %q", e.Filesystem)
+}
+
+// recvLocks provides advisory per-dataset locks that serialize receives into the same dataset,
+// both between goroutines of this process and between processes (e.g. multiple zrepl daemons).
+//
+// Cross-process locking uses fcntl(2) record locks on a lock file per dataset in dir.
+// The kernel drops these locks when the holding process exits, so a crashed holder
+// never leaves behind a stale lock: the lock files themselves carry no state.
+// Since fcntl locks are per-process, receives within this process are tracked in held.
+//
+// If the lock file cannot be used (e.g. dir is not writable for a non-root daemon),
+// tryLock logs a warning and only serializes receives within this process.
+type recvLocks struct {
+	dir string
+
+	mtx  sync.Mutex
+	held map[string]bool
+}
+
+func newRecvLocks(dir string) *recvLocks {
+	return &recvLocks{dir: dir, held: make(map[string]bool)}
+}
+
+func (l *recvLocks) lockFilePath(fs string) string {
+	// '%' is not allowed in dataset names, hence the mapping is unambiguous
+	return filepath.Join(l.dir, strings.Replace(fs, "/", "%", -1)+".lock")
+}
+
+// tryLock does not block: if the lock for fs is held, it returns a *RecvInProgressError.
+// unlock must be called exactly once after a successful call.
+func (l *recvLocks) tryLock(ctx context.Context, fs string) (unlock func(), err error) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if l.held[fs] {
+		return nil, &RecvInProgressError{fs}
+	}
+
+	f, err := l.lockFile(fs)
+	if _, ok := err.(*RecvInProgressError); ok {
+		return nil, err
+	} else if err != nil {
+		getLogger(ctx).WithError(err).WithField("lock_dir", l.dir).
+			Warn("cannot use receive lock file, receives are only serialized within this process")
+		f = nil
+	}
+
+	l.held[fs] = true
+	return func() {
+		l.mtx.Lock()
+		defer l.mtx.Unlock()
+		if f != nil {
+			f.Close() // drops the fcntl lock
+		}
+		delete(l.held, fs)
+	}, nil
+}
+
+// lockFile returns the opened and fcntl-locked lock file for fs,
+// or *RecvInProgressError if another process holds the lock.
+func (l *recvLocks) lockFile(fs string) (*os.File, error) {
+	if err := os.MkdirAll(l.dir, 0700); err != nil {
+		return nil, fmt.Errorf("cannot create receive lock directory: %s", err)
+	}
+	// Never remove the lock file: another process might already have opened it
+	// and would then lock an orphaned inode.
+	f, err := os.OpenFile(l.lockFilePath(fs), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open receive lock file: %s", err)
+	}
+	flock := unix.Flock_t{Type: unix.F_WRLCK, Whence: 0, Start: 0, Len: 0}
+	if err := unix.FcntlFlock(f.Fd(), unix.F_SETLK, &flock); err != nil {
+		f.Close()
+		if err == unix.EAGAIN || err == unix.EACCES {
+			return nil, &RecvInProgressError{fs}
+		}
+		return nil, fmt.Errorf("cannot lock receive lock file: %s", err)
+	}
+	// for the admin's convenience, no correctness depends on it
+	if err := f.Truncate(0); err == nil {
+		fmt.Fprintf(f, "%d\n", os.Getpid())
+	}
+	return f, nil
+}
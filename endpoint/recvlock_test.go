@@ -0,0 +1,137 @@
+package endpoint
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecvLocksConcurrentReceives(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zrepl-endpoint-recvlock")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	l := newRecvLocks(dir)
+
+	const n = 2
+	var wg sync.WaitGroup
+	var hold sync.WaitGroup // keep winners holding the lock until all attempts are done
+	hold.Add(1)
+	errs := make([]error, n)
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			defer wg.Done()
+			unlock, err := l.tryLock(context.Background(), "pool/sink/fs")
+			errs[i] = err
+			if err == nil {
+				go func() {
+					hold.Wait()
+					unlock()
+				}()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var failed int
+	for _, err := range errs {
+		if err != nil {
+			failed++
+			_, ok := err.(*RecvInProgressError)
+			assert.True(t, ok, "%T %s", err, err)
+		}
+	}
+	assert.Equal(t, n-1, failed)
+
+	// disjoint datasets don't conflict
+	unlock, err := l.tryLock(context.Background(), "pool/sink/other")
+	require.NoError(t, err)
+	unlock()
+
+	hold.Done()
+}
+
+func TestRecvLocksRelock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zrepl-endpoint-recvlock")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	l := newRecvLocks(dir)
+
+	unlock, err := l.tryLock(context.Background(), "pool/fs")
+	require.NoError(t, err)
+	unlock()
+	unlock, err = l.tryLock(context.Background(), "pool/fs")
+	require.NoError(t, err)
+	unlock()
+}
+
+const recvLockHelperEnv = "ZREPL_ENDPOINT_TEST_RECVLOCK_HELPER_DIR"
+
+// TestRecvLocksHelperProcess is not a real test but a child process for TestRecvLocksOtherProcess.
+func TestRecvLocksHelperProcess(t *testing.T) {
+	dir := os.Getenv(recvLockHelperEnv)
+	if dir == "" {
+		return
+	}
+	_, err := newRecvLocks(dir).tryLock(context.Background(), "pool/fs")
+	if err != nil {
+		os.Exit(1)
+	}
+	os.Stdout.WriteString("locked\n")
+	// hold the lock until killed
+	select {}
+}
+
+func TestRecvLocksOtherProcess(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zrepl-endpoint-recvlock")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRecvLocksHelperProcess$")
+	cmd.Env = append(os.Environ(), recvLockHelperEnv+"="+dir)
+	stdout, err := cmd.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, cmd.Start())
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "locked\n", line)
+
+	l := newRecvLocks(dir)
+	_, err = l.tryLock(context.Background(), "pool/fs")
+	_, ok := err.(*RecvInProgressError)
+	require.True(t, ok, "%T %s", err, err)
+
+	// the lock of a crashed holder must not be stale
+	require.NoError(t, cmd.Process.Kill())
+	_ = cmd.Wait()
+	unlock, err := l.tryLock(context.Background(), "pool/fs")
+	require.NoError(t, err)
+	unlock()
+}
+
+func TestRecvLocksFallbackWithoutLockDir(t *testing.T) {
+	f, err := ioutil.TempFile("", "zrepl-endpoint-recvlock")
+	require.NoError(t, err)
+	f.Close()
+	defer os.Remove(f.Name())
+	// a regular file cannot be used as the lock directory
+	l := newRecvLocks(f.Name())
+
+	unlock, err := l.tryLock(context.Background(), "pool/fs")
+	require.NoError(t, err)
+	_, err = l.tryLock(context.Background(), "pool/fs")
+	_, ok := err.(*RecvInProgressError)
+	assert.True(t, ok, "%T %s", err, err)
+	unlock()
+
+	unlock, err = l.tryLock(context.Background(), "pool/fs")
+	require.NoError(t, err)
+	unlock()
+}
@@ -0,0 +1,67 @@
+package endpoint
+
+import (
+	"context"
+	"sync"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+type SendPlanResult struct {
+	Req *pdu.SendReq
+	// nil if Send failed
+	Res *pdu.SendRes
+	// error returned by Send or by the SendPlanConsumer
+	Err error
+}
+
+// SendPlanConsumer consumes the stream of a single send plan.
+// stream is nil for dry-run requests. The caller closes stream after SendPlanConsumer returned.
+type SendPlanConsumer func(ctx context.Context, req *pdu.SendReq, res *pdu.SendRes, stream zfs.StreamCopier) error
+
+// SendPlans executes the sends described by reqs through a worker pool of
+// the size of the concurrent send semaphore (ZREPL_ENDPOINT_MAX_CONCURRENT_SEND),
+// and invokes consume for each send's stream within the worker.
+// In contrast to calling Send concurrently, this bounds the number of streams
+// in flight, not just the number of sends being set up.
+//
+// The returned results are in the order of reqs, independent of completion order.
+// A failing send does not affect the others.
+func (s *Sender) SendPlans(ctx context.Context, reqs []*pdu.SendReq, consume SendPlanConsumer) []SendPlanResult {
+	return runSendPlans(ctx, int(maxConcurrentZFSSend), reqs, func(ctx context.Context, req *pdu.SendReq) (*pdu.SendRes, error) {
+		res, stream, err := s.Send(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		if stream != nil {
+			defer stream.Close()
+		}
+		return res, consume(ctx, req, res, stream)
+	})
+}
+
+func runSendPlans(ctx context.Context, workers int, reqs []*pdu.SendReq, do func(context.Context, *pdu.SendReq) (*pdu.SendRes, error)) []SendPlanResult {
+	if workers < 1 {
+		workers = 1
+	}
+	results := make([]SendPlanResult, len(reqs))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(reqs); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				res, err := do(ctx, reqs[i])
+				results[i] = SendPlanResult{Req: reqs[i], Res: res, Err: err}
+			}
+		}()
+	}
+	for i := range reqs {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,69 @@
+package endpoint
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+func TestRunSendPlansBoundedConcurrency(t *testing.T) {
+	const workers = 3
+	reqs := make([]*pdu.SendReq, 10)
+	for i := range reqs {
+		reqs[i] = &pdu.SendReq{Filesystem: fmt.Sprintf("pool/fs%d", i)}
+	}
+
+	var cur, max int32
+	results := runSendPlans(context.Background(), workers, reqs, func(ctx context.Context, req *pdu.SendReq) (*pdu.SendRes, error) {
+		c := atomic.AddInt32(&cur, 1)
+		defer atomic.AddInt32(&cur, -1)
+		for {
+			m := atomic.LoadInt32(&max)
+			if c <= m || atomic.CompareAndSwapInt32(&max, m, c) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		return &pdu.SendRes{}, nil
+	})
+	require.Len(t, results, len(reqs))
+	assert.Equal(t, int32(workers), atomic.LoadInt32(&max))
+}
+
+func TestRunSendPlansResultsInInputOrder(t *testing.T) {
+	reqs := make([]*pdu.SendReq, 5)
+	for i := range reqs {
+		reqs[i] = &pdu.SendReq{Filesystem: fmt.Sprintf("pool/fs%d", i)}
+	}
+
+	results := runSendPlans(context.Background(), 5, reqs, func(ctx context.Context, req *pdu.SendReq) (*pdu.SendRes, error) {
+		var i int
+		_, err := fmt.Sscanf(req.Filesystem, "pool/fs%d", &i)
+		require.NoError(t, err)
+		// complete in reverse order
+		time.Sleep(time.Duration(len(reqs)-i) * 10 * time.Millisecond)
+		if i == 2 {
+			return nil, fmt.Errorf("send failed")
+		}
+		return &pdu.SendRes{ExpectedSize: int64(i)}, nil
+	})
+
+	require.Len(t, results, len(reqs))
+	for i, r := range results {
+		assert.Equal(t, reqs[i], r.Req)
+		if i == 2 {
+			assert.Error(t, r.Err)
+			assert.Nil(t, r.Res)
+			continue
+		}
+		require.NoError(t, r.Err)
+		assert.Equal(t, int64(i), r.Res.ExpectedSize)
+	}
+}
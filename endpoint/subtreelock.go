@@ -0,0 +1,60 @@
+package endpoint
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/zrepl/zrepl/util/chainlock"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// subtreeLocks provides blocking mutual exclusion per key.
+// Lock entries are reference-counted and dropped once no goroutine holds or waits for them.
+type subtreeLocks struct {
+	mtx   sync.Mutex
+	locks map[string]*subtreeLock
+}
+
+type subtreeLock struct {
+	l    *chainlock.L
+	refs int
+}
+
+func newSubtreeLocks() *subtreeLocks {
+	return &subtreeLocks{locks: make(map[string]*subtreeLock)}
+}
+
+// lock blocks until the lock for key is acquired.
+// unlock must be called exactly once.
+func (s *subtreeLocks) lock(key string) (unlock func()) {
+	s.mtx.Lock()
+	l, ok := s.locks[key]
+	if !ok {
+		l = &subtreeLock{l: chainlock.New()}
+		s.locks[key] = l
+	}
+	l.refs++
+	s.mtx.Unlock()
+
+	l.l.Lock()
+	return func() {
+		l.l.Unlock()
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+		l.refs--
+		if l.refs == 0 {
+			delete(s.locks, key)
+		}
+	}
+}
+
+// recvParentCreationLockKey returns the subtree of lp whose dataset hierarchy
+// a receive into lp may manipulate: the first path component below root
+// (or lp itself if lp is not below root).
+func recvParentCreationLockKey(root, lp *zfs.DatasetPath) string {
+	if !lp.HasPrefix(root) || lp.Length() <= root.Length() {
+		return lp.ToString()
+	}
+	comps := strings.SplitN(lp.ToString(), "/", root.Length()+2)
+	return strings.Join(comps[:root.Length()+1], "/")
+}
@@ -0,0 +1,72 @@
+package endpoint
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func TestRecvParentCreationLockKey(t *testing.T) {
+	root, err := zfs.NewDatasetPath("pool/sink")
+	require.NoError(t, err)
+
+	tcs := map[string]string{
+		"pool/sink/a":      "pool/sink/a",
+		"pool/sink/a/b/c":  "pool/sink/a",
+		"pool/sink/b/c":    "pool/sink/b",
+		"pool/sink":        "pool/sink",
+		"pool/other/a/b":   "pool/other/a/b",
+		"pool/sinkother/a": "pool/sinkother/a",
+	}
+	for lp, expect := range tcs {
+		p, err := zfs.NewDatasetPath(lp)
+		require.NoError(t, err)
+		assert.Equal(t, expect, recvParentCreationLockKey(root, p), "lp=%s", lp)
+	}
+}
+
+// holdConcurrently locks each key in a separate goroutine, holds it for hold,
+// and returns the maximum number of simultaneous holders.
+func holdConcurrently(l *subtreeLocks, keys []string, hold time.Duration) int {
+	var mtx sync.Mutex
+	var cur, max int
+	var wg sync.WaitGroup
+	wg.Add(len(keys))
+	for _, key := range keys {
+		go func(key string) {
+			defer wg.Done()
+			defer l.lock(key)()
+			mtx.Lock()
+			cur++
+			if cur > max {
+				max = cur
+			}
+			mtx.Unlock()
+			time.Sleep(hold)
+			mtx.Lock()
+			cur--
+			mtx.Unlock()
+		}(key)
+	}
+	wg.Wait()
+	return max
+}
+
+func TestSubtreeLocksDisjointSubtreesOverlap(t *testing.T) {
+	l := newSubtreeLocks()
+	max := holdConcurrently(l, []string{"pool/sink/a", "pool/sink/b", "pool/sink/c"}, 200*time.Millisecond)
+	assert.Equal(t, 3, max)
+	assert.Empty(t, l.locks)
+}
+
+func TestSubtreeLocksSameSubtreeSerializes(t *testing.T) {
+	l := newSubtreeLocks()
+	max := holdConcurrently(l, []string{"pool/sink/a", "pool/sink/a", "pool/sink/a"}, 20*time.Millisecond)
+	assert.Equal(t, 1, max)
+	assert.Empty(t, l.locks)
+}
@@ -39,7 +39,7 @@ require (
 	github.com/pkg/profile v1.2.1
 	github.com/problame/go-netssh v0.0.0-20190110232351-09d6bc45d284
 	github.com/prometheus/client_golang v0.0.0-20180410130117-e11c6ff8170b
-	github.com/prometheus/client_model v0.0.0-20171117100541-99fa1f4be8e5 // indirect
+	github.com/prometheus/client_model v0.0.0-20171117100541-99fa1f4be8e5
 	github.com/prometheus/common v0.0.0-20180413074202-d0f7cd64bda4 // indirect
 	github.com/prometheus/procfs v0.0.0-20180408092902-8b1c2da0d56d // indirect
 	github.com/sergi/go-diff v1.0.0 // indirect
@@ -34,6 +34,9 @@ func (a ZpoolCreateArgs) Validate() error {
 	if a.PoolName == "" {
 		return errors.Errorf("PoolName must not be emtpy")
 	}
+	if err := zfs.ValidatePoolName(a.PoolName); err != nil {
+		return errors.Wrap(err, "PoolName")
+	}
 	return nil
 }
 
@@ -43,7 +46,7 @@ func CreateOrReplaceZpool(ctx context.Context, e Execer, args ZpoolCreateArgs) (
 	}
 
 	// export pool if it already exists (idempotence)
-	if _, err := zfs.ZFSGetRawAnySource(args.PoolName, []string{"name"}); err != nil {
+	if _, err := zfs.ZFSGetRawAnySource(ctx, args.PoolName, []string{"name"}); err != nil {
 		if _, ok := err.(*zfs.DatasetDoesNotExist); ok {
 			// we'll create it shortly
 		} else {
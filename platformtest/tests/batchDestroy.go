@@ -32,7 +32,7 @@ func BatchDestroy(ctx *platformtest.Context) {
 			Name:       "2",
 		},
 	}
-	zfs.ZFSDestroyFilesystemVersions(reqs)
+	zfs.ZFSDestroyFilesystemVersions(ctx, reqs)
 	if *reqs[0].ErrOut != nil {
 		panic("expecting no error")
 	}
@@ -45,7 +45,13 @@ func BatchDestroy(ctx *platformtest.Context) {
 	!N "foo bar@3"
 	!E "foo bar@1"
 	!E "foo bar@2"
-	R zfs release zrepl_platformtest "${ROOTDS}/foo bar@2"
+	`)
+
+	if err := zfs.ZFSRelease(ctx, "zrepl_platformtest", fmt.Sprintf("%s/foo bar", ctx.RootDataset), "2"); err != nil {
+		panic(err)
+	}
+
+	platformtest.Run(ctx, platformtest.PanicErr, ctx.RootDataset, `
 	-  "foo bar@2"
 	-  "foo bar@1"
 	-  "foo bar"
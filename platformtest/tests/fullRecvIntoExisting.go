@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"fmt"
+
+	"github.com/zrepl/zrepl/platformtest"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func fullRecvIntoExistingSetup(ctx *platformtest.Context) (sender, receiver string) {
+	platformtest.Run(ctx, platformtest.PanicErr, ctx.RootDataset, `
+		DESTROYROOT
+		CREATEROOT
+		+  "sender"
+		+  "sender@1"
+		+  "receiver"
+		+  "receiver@existing"
+	`)
+	return fmt.Sprintf("%s/sender", ctx.RootDataset), fmt.Sprintf("%s/receiver", ctx.RootDataset)
+}
+
+func fullRecvIntoExisting(ctx *platformtest.Context, sender, receiver string, policy zfs.FullRecvIntoExistingPolicy) error {
+	sendArgs := zfs.ZFSSendArgs{FS: sender, To: "@1"}
+	copier, err := zfs.ZFSSend(ctx, sendArgs, zfs.SendOptions{})
+	if err != nil {
+		panic(err)
+	}
+	defer copier.Close()
+	_, err = zfs.ZFSRecv(ctx, receiver, copier, zfs.RecvOptions{FullRecvIntoExisting: policy})
+	return err
+}
+
+func FullRecvIntoExistingReject(ctx *platformtest.Context) {
+	sender, receiver := fullRecvIntoExistingSetup(ctx)
+
+	err := fullRecvIntoExisting(ctx, sender, receiver, zfs.FullRecvIntoExistingReject)
+	if _, ok := err.(*zfs.RecvDestinationExistsError); !ok {
+		panic(fmt.Sprintf("expecting *RecvDestinationExistsError, got %T %v", err, err))
+	}
+
+	// the receiver must be untouched
+	if _, err := zfs.ZFSGetRawAnySource(ctx, receiver+"@existing", []string{"name"}); err != nil {
+		panic(err)
+	}
+}
+
+func FullRecvIntoExistingForceOverwrite(ctx *platformtest.Context) {
+	sender, receiver := fullRecvIntoExistingSetup(ctx)
+
+	err := fullRecvIntoExisting(ctx, sender, receiver, zfs.FullRecvIntoExistingForceOverwrite)
+	if err != nil {
+		panic(err)
+	}
+
+	sent, err := zfs.ZFSGetCreateTXGAndGuid(ctx, sender+"@1")
+	if err != nil {
+		panic(err)
+	}
+	received, err := zfs.ZFSGetCreateTXGAndGuid(ctx, receiver+"@1")
+	if err != nil {
+		panic(err)
+	}
+	if sent.Guid != received.Guid {
+		panic(fmt.Sprintf("guids do not match: %v != %v", sent.Guid, received.Guid))
+	}
+	_, err = zfs.ZFSGetRawAnySource(ctx, receiver+"@existing", []string{"name"})
+	if _, ok := err.(*zfs.DatasetDoesNotExist); !ok {
+		panic(fmt.Sprintf("expecting existing snapshot to be gone, got %T %v", err, err))
+	}
+}
+
+func FullRecvIntoExistingNewSibling(ctx *platformtest.Context) {
+	sender, receiver := fullRecvIntoExistingSetup(ctx)
+
+	sent, err := zfs.ZFSGetCreateTXGAndGuid(ctx, sender+"@1")
+	if err != nil {
+		panic(err)
+	}
+
+	err = fullRecvIntoExisting(ctx, sender, receiver, zfs.FullRecvIntoExistingNewSibling)
+	if err != nil {
+		panic(err)
+	}
+
+	sibling := zfs.FullRecvSiblingName(receiver, sent.Guid)
+	received, err := zfs.ZFSGetCreateTXGAndGuid(ctx, sibling+"@1")
+	if err != nil {
+		panic(err)
+	}
+	if sent.Guid != received.Guid {
+		panic(fmt.Sprintf("guids do not match: %v != %v", sent.Guid, received.Guid))
+	}
+	// the receiver must be untouched
+	if _, err := zfs.ZFSGetRawAnySource(ctx, receiver+"@existing", []string{"name"}); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,53 @@
+package tests
+
+import (
+	"fmt"
+
+	"github.com/zrepl/zrepl/platformtest"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func PlaceholderCanmount(ctx *platformtest.Context) {
+
+	platformtest.Run(ctx, platformtest.PanicErr, ctx.RootDataset, `
+		DESTROYROOT
+		CREATEROOT
+	`)
+
+	ph, err := zfs.NewDatasetPath(fmt.Sprintf("%s/placeholder", ctx.RootDataset))
+	if err != nil {
+		panic(err)
+	}
+	if err := zfs.ZFSCreatePlaceholderFilesystem(ph, zfs.PlaceholderPropertyName); err != nil {
+		panic(err)
+	}
+	props, err := zfs.ZFSGet(ctx, ph, []string{"canmount", "mounted"})
+	if err != nil {
+		panic(err)
+	}
+	if props.Get("canmount") != "off" {
+		panic(fmt.Sprintf("unexpected canmount value %q", props.Get("canmount")))
+	}
+	if props.Get("mounted") != "no" {
+		panic(fmt.Sprintf("placeholder %q is mounted", ph.ToString()))
+	}
+
+	// the local canmount=off must not persist when the placeholder becomes a regular filesystem
+	if err := zfs.ZFSClearPlaceholder(ctx, ph, zfs.PlaceholderPropertyName); err != nil {
+		panic(err)
+	}
+	props, err = zfs.ZFSGet(ctx, ph, []string{"canmount"})
+	if err != nil {
+		panic(err)
+	}
+	if props.Get("canmount") != "on" {
+		panic(fmt.Sprintf("unexpected canmount value %q after clearing placeholder", props.Get("canmount")))
+	}
+	st, err := zfs.ZFSGetFilesystemPlaceholderState(ctx, ph, zfs.PlaceholderPropertyName)
+	if err != nil {
+		panic(err)
+	}
+	if st.IsPlaceholder {
+		panic(fmt.Sprintf("%q is still a placeholder", ph.ToString()))
+	}
+}
@@ -0,0 +1,48 @@
+package tests
+
+import (
+	"fmt"
+
+	"github.com/zrepl/zrepl/platformtest"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func RecvNoAutoMount(ctx *platformtest.Context) {
+
+	platformtest.Run(ctx, platformtest.PanicErr, ctx.RootDataset, `
+		DESTROYROOT
+		CREATEROOT
+		+  "sender"
+		R  zfs set mountpoint="$(mktemp -d)" "$ROOTDS/sender"
+		+  "sender@1"
+	`)
+
+	sender := fmt.Sprintf("%s/sender", ctx.RootDataset)
+	receiver := fmt.Sprintf("%s/receiver", ctx.RootDataset)
+
+	// the received mountpoint property collides with the sender's mountpoint
+	copier, err := zfs.ZFSSend(ctx, zfs.ZFSSendArgs{FS: sender, To: "@1", Properties: true}, zfs.SendOptions{})
+	if err != nil {
+		panic(err)
+	}
+	defer copier.Close()
+	_, err = zfs.ZFSRecv(ctx, receiver, copier, zfs.RecvOptions{NoAutoMount: true})
+	if err != nil {
+		panic(err)
+	}
+
+	receiverPath, err := zfs.NewDatasetPath(receiver)
+	if err != nil {
+		panic(err)
+	}
+	props, err := zfs.ZFSGet(ctx, receiverPath, []string{"canmount", "mounted"})
+	if err != nil {
+		panic(err)
+	}
+	if props.Get("canmount") != "noauto" {
+		panic(fmt.Sprintf("unexpected canmount value %q", props.Get("canmount")))
+	}
+	if props.Get("mounted") != "no" {
+		panic(fmt.Sprintf("receiver %q is mounted", receiver))
+	}
+}
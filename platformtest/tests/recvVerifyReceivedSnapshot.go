@@ -0,0 +1,43 @@
+package tests
+
+import (
+	"fmt"
+
+	"github.com/zrepl/zrepl/platformtest"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func RecvVerifyReceivedSnapshot(ctx *platformtest.Context) {
+
+	platformtest.Run(ctx, platformtest.PanicErr, ctx.RootDataset, `
+		DESTROYROOT
+		CREATEROOT
+		+  "sender"
+		+  "sender@1"
+	`)
+
+	sender := fmt.Sprintf("%s/sender", ctx.RootDataset)
+	receiver := fmt.Sprintf("%s/receiver", ctx.RootDataset)
+
+	copier, err := zfs.ZFSSend(ctx, zfs.ZFSSendArgs{FS: sender, To: "@1"}, zfs.SendOptions{})
+	if err != nil {
+		panic(err)
+	}
+	defer copier.Close()
+	_, err = zfs.ZFSRecv(ctx, receiver, copier, zfs.RecvOptions{VerifyReceivedSnapshot: true})
+	if err != nil {
+		panic(err)
+	}
+
+	sent, err := zfs.ZFSGetCreateTXGAndGuid(ctx, sender+"@1")
+	if err != nil {
+		panic(err)
+	}
+	received, err := zfs.ZFSGetCreateTXGAndGuid(ctx, receiver+"@1")
+	if err != nil {
+		panic(err)
+	}
+	if sent.Guid != received.Guid {
+		panic(fmt.Sprintf("guids do not match: %v != %v", sent.Guid, received.Guid))
+	}
+}
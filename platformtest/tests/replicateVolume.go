@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"fmt"
+
+	"github.com/zrepl/zrepl/platformtest"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func ReplicateVolume(ctx *platformtest.Context) {
+	platformtest.Run(ctx, platformtest.PanicErr, ctx.RootDataset, `
+		DESTROYROOT
+		CREATEROOT
+		R zfs create -V 8M "$ROOTDS/vol"
+		+  "vol@1"
+		R dd if=/dev/urandom of="/dev/zvol/$ROOTDS/vol" bs=4096 count=16 conv=notrunc,fsync 2>/dev/null
+		+  "vol@2"
+		+  "sink"
+	`)
+
+	sender := fmt.Sprintf("%s/vol", ctx.RootDataset)
+	receiver := fmt.Sprintf("%s/sink/vol", ctx.RootDataset)
+
+	replicate := func(from, to string, opts zfs.RecvOptions) {
+		sendArgs := zfs.ZFSSendArgs{FS: sender, From: from, To: to}
+		copier, err := zfs.ZFSSend(ctx, sendArgs, zfs.SendOptions{})
+		if err != nil {
+			panic(err)
+		}
+		defer copier.Close()
+		if _, err := zfs.ZFSRecv(ctx, receiver, copier, opts); err != nil {
+			panic(err)
+		}
+	}
+	assertGUIDsMatch := func(snap string) {
+		sent, err := zfs.ZFSGetCreateTXGAndGuid(ctx, sender+snap)
+		if err != nil {
+			panic(err)
+		}
+		received, err := zfs.ZFSGetCreateTXGAndGuid(ctx, receiver+snap)
+		if err != nil {
+			panic(err)
+		}
+		if sent.Guid != received.Guid {
+			panic(fmt.Sprintf("guids of %q do not match: %v != %v", snap, sent.Guid, received.Guid))
+		}
+	}
+
+	// full, then incremental
+	replicate("", "@1", zfs.RecvOptions{})
+	replicate("@1", "@2", zfs.RecvOptions{})
+	assertGUIDsMatch("@1")
+	assertGUIDsMatch("@2")
+
+	receiverPath, err := zfs.NewDatasetPath(receiver)
+	if err != nil {
+		panic(err)
+	}
+	typ, err := zfs.ZFSGetDatasetType(ctx, receiverPath)
+	if err != nil {
+		panic(err)
+	}
+	if typ != zfs.DatasetTypeVolume {
+		panic(fmt.Sprintf("expecting received dataset to be a volume, got %q", typ))
+	}
+
+	// forced full receive into the existing volume rolls back its snapshots
+	replicate("", "@2", zfs.RecvOptions{RollbackAndForceRecv: true})
+	assertGUIDsMatch("@2")
+	_, err = zfs.ZFSGetRawAnySource(ctx, receiver+"@1", []string{"name"})
+	if _, ok := err.(*zfs.DatasetDoesNotExist); !ok {
+		panic(fmt.Sprintf("expecting @1 to be rolled back, got %T %v", err, err))
+	}
+}
@@ -13,17 +13,18 @@ func ReplicationCursor(ctx *platformtest.Context) {
 		CREATEROOT
 		+  "foo bar"
 		+  "foo bar@1 with space"
+		+  "foo bar@2"
 	`)
 
 	ds, err := zfs.NewDatasetPath(ctx.RootDataset + "/foo bar")
 	if err != nil {
 		panic(err)
 	}
-	guid, err := zfs.ZFSSetReplicationCursor(ds, "1 with space")
+	guid, err := zfs.ZFSSetReplicationCursor(ctx, ds, "1 with space")
 	if err != nil {
 		panic(err)
 	}
-	snapProps, err := zfs.ZFSGetCreateTXGAndGuid(ds.ToString() + "@1 with space")
+	snapProps, err := zfs.ZFSGetCreateTXGAndGuid(ctx, ds.ToString()+"@1 with space")
 	if err != nil {
 		panic(err)
 	}
@@ -31,7 +32,7 @@ func ReplicationCursor(ctx *platformtest.Context) {
 		panic(fmt.Sprintf("guids to not match: %v != %v", guid, snapProps.Guid))
 	}
 
-	bm, err := zfs.ZFSGetReplicationCursor(ds)
+	bm, err := zfs.ZFSGetReplicationCursor(ctx, ds)
 	if err != nil {
 		panic(err)
 	}
@@ -45,18 +46,47 @@ func ReplicationCursor(ctx *platformtest.Context) {
 		panic(fmt.Sprintf("guids do not match: %v != %v", bm.Guid, guid))
 	}
 
+	// move the cursor: ZFS cannot rename bookmarks, hence this must not depend on it
+	guid2, err := zfs.ZFSSetReplicationCursor(ctx, ds, "2")
+	if err != nil {
+		panic(err)
+	}
+	snap2Props, err := zfs.ZFSGetCreateTXGAndGuid(ctx, ds.ToString()+"@2")
+	if err != nil {
+		panic(err)
+	}
+	if guid2 != snap2Props.Guid {
+		panic(fmt.Sprintf("guids to not match: %v != %v", guid2, snap2Props.Guid))
+	}
+	bookmarks, err := zfs.ZFSListBookmarks(ctx, ds)
+	if err != nil {
+		panic(err)
+	}
+	if len(bookmarks) != 1 || bookmarks[0].Guid != guid2 {
+		panic(fmt.Sprintf("expecting only the bookmark of the new cursor position, got %v", bookmarks))
+	}
+	// moving it to the same snapshot again is a no-op
+	if _, err := zfs.ZFSSetReplicationCursor(ctx, ds, "2"); err != nil {
+		panic(err)
+	}
+	bm, err = zfs.ZFSGetReplicationCursor(ctx, ds)
+	if err != nil {
+		panic(err)
+	}
+	if bm.Guid != guid2 {
+		panic(fmt.Sprintf("guids do not match: %v != %v", bm.Guid, guid2))
+	}
+
 	// test nonexistent
-	err = zfs.ZFSDestroyFilesystemVersion(ds, bm)
+	err = zfs.ZFSDestroyFilesystemVersion(ctx, ds, bm)
 	if err != nil {
 		panic(err)
 	}
-	bm2, err := zfs.ZFSGetReplicationCursor(ds)
+	bm2, err := zfs.ZFSGetReplicationCursor(ctx, ds)
 	if bm2 != nil {
 		panic(fmt.Sprintf("expecting no replication cursor after deleting it, got %v", bm))
 	}
 	if err != nil {
 		panic(fmt.Sprintf("expecting no error for getting nonexistent replication cursor, bot %v", err))
 	}
-
-	// TODO test moving the replication cursor
 }
@@ -0,0 +1,47 @@
+package tests
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/zrepl/zrepl/platformtest"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func RollbackReportsDestroyed(ctx *platformtest.Context) {
+
+	platformtest.Run(ctx, platformtest.PanicErr, ctx.RootDataset, `
+		DESTROYROOT
+		CREATEROOT
+		+  "foo bar"
+		+  "foo bar@1"
+		+  "foo bar@2"
+		+  "foo bar@3"
+	`)
+
+	ds, err := zfs.NewDatasetPath(ctx.RootDataset + "/foo bar")
+	if err != nil {
+		panic(err)
+	}
+	snap1 := zfs.FilesystemVersion{Type: zfs.Snapshot, Name: "1"}
+
+	destroyed, err := zfs.ZFSRollback(ctx, ds, snap1, "-r")
+	if err != nil {
+		panic(err)
+	}
+
+	var names []string
+	for _, v := range destroyed {
+		names = append(names, v.String())
+	}
+	sort.Strings(names)
+	if len(names) != 2 || names[0] != "@2" || names[1] != "@3" {
+		panic(fmt.Sprintf("expecting @2 and @3 to be reported destroyed, got %v", names))
+	}
+
+	platformtest.Run(ctx, platformtest.PanicErr, ctx.RootDataset, `
+		!E "foo bar@1"
+		!N "foo bar@2"
+		!N "foo bar@3"
+	`)
+}
@@ -0,0 +1,43 @@
+package tests
+
+import (
+	"fmt"
+
+	"github.com/zrepl/zrepl/platformtest"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func SnapshotRecursive(ctx *platformtest.Context) {
+
+	platformtest.Run(ctx, platformtest.PanicErr, ctx.RootDataset, `
+		DESTROYROOT
+		CREATEROOT
+		+  "parent"
+		+  "parent/child1"
+		+  "parent/child1/grandchild"
+		+  "parent/child2"
+	`)
+
+	parent, err := zfs.NewDatasetPath(ctx.RootDataset + "/parent")
+	if err != nil {
+		panic(err)
+	}
+	if err := zfs.ZFSSnapshot(ctx, parent, "1", true, nil); err != nil {
+		panic(err)
+	}
+
+	parentSnap, err := zfs.ZFSGetCreateTXGAndGuid(ctx, parent.ToString()+"@1")
+	if err != nil {
+		panic(err)
+	}
+	for _, child := range []string{"child1", "child1/grandchild", "child2"} {
+		snap := fmt.Sprintf("%s/%s@1", parent.ToString(), child)
+		v, err := zfs.ZFSGetCreateTXGAndGuid(ctx, snap)
+		if err != nil {
+			panic(err)
+		}
+		if v.CreateTXG != parentSnap.CreateTXG {
+			panic(fmt.Sprintf("%q: createtxg %d does not match parent's %d", snap, v.CreateTXG, parentSnap.CreateTXG))
+		}
+	}
+}
@@ -18,4 +18,14 @@ var Cases = []Case{
 	UndestroyableSnapshotParsing,
 	GetNonexistent,
 	ReplicationCursor,
+	FullRecvIntoExistingReject,
+	FullRecvIntoExistingForceOverwrite,
+	FullRecvIntoExistingNewSibling,
+	RollbackReportsDestroyed,
+	RecvVerifyReceivedSnapshot,
+	RecvNoAutoMount,
+	PlaceholderCanmount,
+	SnapshotRecursive,
+	ReplicateVolume,
+	WrittenSince,
 }
@@ -0,0 +1,45 @@
+package tests
+
+import (
+	"fmt"
+
+	"github.com/zrepl/zrepl/platformtest"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func WrittenSince(ctx *platformtest.Context) {
+	// use a volume because the test pool's filesystems are not mounted
+	platformtest.Run(ctx, platformtest.PanicErr, ctx.RootDataset, `
+		DESTROYROOT
+		CREATEROOT
+		R zfs create -V 8M "$ROOTDS/vol"
+		+  "vol@1"
+		R dd if=/dev/urandom of="/dev/zvol/$ROOTDS/vol" bs=4096 count=64 conv=notrunc,fsync 2>/dev/null
+		+  "vol@2"
+	`)
+	vol, err := zfs.NewDatasetPath(fmt.Sprintf("%s/vol", ctx.RootDataset))
+	if err != nil {
+		panic(err)
+	}
+
+	written, err := zfs.ZFSGetWrittenSince(ctx, vol, "1")
+	if err != nil {
+		panic(err)
+	}
+	if written == 0 {
+		panic(fmt.Sprintf("expecting written@1 > 0 after writing data, got %v", written))
+	}
+
+	written, err = zfs.ZFSGetWrittenSince(ctx, vol, "2")
+	if err != nil {
+		panic(err)
+	}
+	if written != 0 {
+		panic(fmt.Sprintf("expecting written@2 == 0 for latest snapshot, got %v", written))
+	}
+
+	_, err = zfs.ZFSGetWrittenSince(ctx, vol, "nonexistent")
+	if _, ok := err.(*zfs.WrittenSinceSnapshotDoesNotExist); !ok {
+		panic(fmt.Sprintf("expecting *WrittenSinceSnapshotDoesNotExist, got %T %v", err, err))
+	}
+}
@@ -43,7 +43,7 @@ func (x FilesystemVersion_VersionType) String() string {
 	return proto.EnumName(FilesystemVersion_VersionType_name, int32(x))
 }
 func (FilesystemVersion_VersionType) EnumDescriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_83b7e2a28d820622, []int{5, 0}
+	return fileDescriptor_pdu_3f7ff292484a0669, []int{5, 0}
 }
 
 type ListFilesystemReq struct {
@@ -56,7 +56,7 @@ func (m *ListFilesystemReq) Reset()         { *m = ListFilesystemReq{} }
 func (m *ListFilesystemReq) String() string { return proto.CompactTextString(m) }
 func (*ListFilesystemReq) ProtoMessage()    {}
 func (*ListFilesystemReq) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_83b7e2a28d820622, []int{0}
+	return fileDescriptor_pdu_3f7ff292484a0669, []int{0}
 }
 func (m *ListFilesystemReq) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ListFilesystemReq.Unmarshal(m, b)
@@ -87,7 +87,7 @@ func (m *ListFilesystemRes) Reset()         { *m = ListFilesystemRes{} }
 func (m *ListFilesystemRes) String() string { return proto.CompactTextString(m) }
 func (*ListFilesystemRes) ProtoMessage()    {}
 func (*ListFilesystemRes) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_83b7e2a28d820622, []int{1}
+	return fileDescriptor_pdu_3f7ff292484a0669, []int{1}
 }
 func (m *ListFilesystemRes) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ListFilesystemRes.Unmarshal(m, b)
@@ -127,7 +127,7 @@ func (m *Filesystem) Reset()         { *m = Filesystem{} }
 func (m *Filesystem) String() string { return proto.CompactTextString(m) }
 func (*Filesystem) ProtoMessage()    {}
 func (*Filesystem) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_83b7e2a28d820622, []int{2}
+	return fileDescriptor_pdu_3f7ff292484a0669, []int{2}
 }
 func (m *Filesystem) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_Filesystem.Unmarshal(m, b)
@@ -179,7 +179,7 @@ func (m *ListFilesystemVersionsReq) Reset()         { *m = ListFilesystemVersion
 func (m *ListFilesystemVersionsReq) String() string { return proto.CompactTextString(m) }
 func (*ListFilesystemVersionsReq) ProtoMessage()    {}
 func (*ListFilesystemVersionsReq) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_83b7e2a28d820622, []int{3}
+	return fileDescriptor_pdu_3f7ff292484a0669, []int{3}
 }
 func (m *ListFilesystemVersionsReq) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ListFilesystemVersionsReq.Unmarshal(m, b)
@@ -217,7 +217,7 @@ func (m *ListFilesystemVersionsRes) Reset()         { *m = ListFilesystemVersion
 func (m *ListFilesystemVersionsRes) String() string { return proto.CompactTextString(m) }
 func (*ListFilesystemVersionsRes) ProtoMessage()    {}
 func (*ListFilesystemVersionsRes) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_83b7e2a28d820622, []int{4}
+	return fileDescriptor_pdu_3f7ff292484a0669, []int{4}
 }
 func (m *ListFilesystemVersionsRes) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ListFilesystemVersionsRes.Unmarshal(m, b)
@@ -259,7 +259,7 @@ func (m *FilesystemVersion) Reset()         { *m = FilesystemVersion{} }
 func (m *FilesystemVersion) String() string { return proto.CompactTextString(m) }
 func (*FilesystemVersion) ProtoMessage()    {}
 func (*FilesystemVersion) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_83b7e2a28d820622, []int{5}
+	return fileDescriptor_pdu_3f7ff292484a0669, []int{5}
 }
 func (m *FilesystemVersion) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_FilesystemVersion.Unmarshal(m, b)
@@ -326,10 +326,21 @@ type SendReq struct {
 	// If ResumeToken is not empty, the GUIDs of From and To
 	// MUST correspond to those encoded in the ResumeToken.
 	// Otherwise, the Sender MUST return an error.
-	ResumeToken          string   `protobuf:"bytes,4,opt,name=ResumeToken,proto3" json:"ResumeToken,omitempty"`
-	Compress             bool     `protobuf:"varint,5,opt,name=Compress,proto3" json:"Compress,omitempty"`
-	Dedup                bool     `protobuf:"varint,6,opt,name=Dedup,proto3" json:"Dedup,omitempty"`
-	DryRun               bool     `protobuf:"varint,7,opt,name=DryRun,proto3" json:"DryRun,omitempty"`
+	ResumeToken string `protobuf:"bytes,4,opt,name=ResumeToken,proto3" json:"ResumeToken,omitempty"`
+	Compress    bool   `protobuf:"varint,5,opt,name=Compress,proto3" json:"Compress,omitempty"`
+	Dedup       bool   `protobuf:"varint,6,opt,name=Dedup,proto3" json:"Dedup,omitempty"`
+	DryRun      bool   `protobuf:"varint,7,opt,name=DryRun,proto3" json:"DryRun,omitempty"`
+	// If true, the sender MUST send all snapshots between From and To
+	// in a single stream (zfs send -I).
+	// From MUST be a snapshot in that case.
+	// Senders that predate this field ignore it, so clients MUST only set it
+	// if the sender is known to support it.
+	Intermediates bool `protobuf:"varint,8,opt,name=Intermediates,proto3" json:"Intermediates,omitempty"`
+	// If true and the sender is already running its maximum number of
+	// concurrent sends, the sender MUST fail the request immediately
+	// (indicating resource exhaustion) instead of waiting for a free slot.
+	// Senders that predate this field ignore it and wait.
+	FailIfBusy           bool     `protobuf:"varint,9,opt,name=FailIfBusy,proto3" json:"FailIfBusy,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -339,7 +350,7 @@ func (m *SendReq) Reset()         { *m = SendReq{} }
 func (m *SendReq) String() string { return proto.CompactTextString(m) }
 func (*SendReq) ProtoMessage()    {}
 func (*SendReq) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_83b7e2a28d820622, []int{6}
+	return fileDescriptor_pdu_3f7ff292484a0669, []int{6}
 }
 func (m *SendReq) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_SendReq.Unmarshal(m, b)
@@ -408,6 +419,20 @@ func (m *SendReq) GetDryRun() bool {
 	return false
 }
 
+func (m *SendReq) GetIntermediates() bool {
+	if m != nil {
+		return m.Intermediates
+	}
+	return false
+}
+
+func (m *SendReq) GetFailIfBusy() bool {
+	if m != nil {
+		return m.FailIfBusy
+	}
+	return false
+}
+
 type Property struct {
 	Name                 string   `protobuf:"bytes,1,opt,name=Name,proto3" json:"Name,omitempty"`
 	Value                string   `protobuf:"bytes,2,opt,name=Value,proto3" json:"Value,omitempty"`
@@ -420,7 +445,7 @@ func (m *Property) Reset()         { *m = Property{} }
 func (m *Property) String() string { return proto.CompactTextString(m) }
 func (*Property) ProtoMessage()    {}
 func (*Property) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_83b7e2a28d820622, []int{7}
+	return fileDescriptor_pdu_3f7ff292484a0669, []int{7}
 }
 func (m *Property) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_Property.Unmarshal(m, b)
@@ -470,7 +495,7 @@ func (m *SendRes) Reset()         { *m = SendRes{} }
 func (m *SendRes) String() string { return proto.CompactTextString(m) }
 func (*SendRes) ProtoMessage()    {}
 func (*SendRes) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_83b7e2a28d820622, []int{8}
+	return fileDescriptor_pdu_3f7ff292484a0669, []int{8}
 }
 func (m *SendRes) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_SendRes.Unmarshal(m, b)
@@ -514,17 +539,26 @@ func (m *SendRes) GetProperties() []*Property {
 type ReceiveReq struct {
 	Filesystem string `protobuf:"bytes,1,opt,name=Filesystem,proto3" json:"Filesystem,omitempty"`
 	// If true, the receiver should clear the resume token before perfoming the zfs recv of the stream in the request
-	ClearResumeToken     bool     `protobuf:"varint,2,opt,name=ClearResumeToken,proto3" json:"ClearResumeToken,omitempty"`
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
+	ClearResumeToken bool `protobuf:"varint,2,opt,name=ClearResumeToken,proto3" json:"ClearResumeToken,omitempty"`
+	// If true, the receiver only checks whether the stream could be received (`zfs recv -n`)
+	// and reports the result in the DryRun fields of ReceiveRes.
+	// Nothing is modified on the receiving side, i.e. placeholder parents must already exist.
+	DryRun bool `protobuf:"varint,3,opt,name=DryRun,proto3" json:"DryRun,omitempty"`
+	// The size of the stream as estimated by the sender (SendRes.ExpectedSize), 0 if unknown.
+	ExpectedSize int64 `protobuf:"varint,4,opt,name=ExpectedSize,proto3" json:"ExpectedSize,omitempty"`
+	// If > 0, the receiver reports ReceiveProgress messages to the client at most this often
+	// while the stream is being received. Receivers that do not support it ignore this field.
+	ProgressIntervalMillis int64    `protobuf:"varint,5,opt,name=ProgressIntervalMillis,proto3" json:"ProgressIntervalMillis,omitempty"`
+	XXX_NoUnkeyedLiteral   struct{} `json:"-"`
+	XXX_unrecognized       []byte   `json:"-"`
+	XXX_sizecache          int32    `json:"-"`
 }
 
 func (m *ReceiveReq) Reset()         { *m = ReceiveReq{} }
 func (m *ReceiveReq) String() string { return proto.CompactTextString(m) }
 func (*ReceiveReq) ProtoMessage()    {}
 func (*ReceiveReq) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_83b7e2a28d820622, []int{9}
+	return fileDescriptor_pdu_3f7ff292484a0669, []int{9}
 }
 func (m *ReceiveReq) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ReceiveReq.Unmarshal(m, b)
@@ -558,7 +592,83 @@ func (m *ReceiveReq) GetClearResumeToken() bool {
 	return false
 }
 
+func (m *ReceiveReq) GetDryRun() bool {
+	if m != nil {
+		return m.DryRun
+	}
+	return false
+}
+
+func (m *ReceiveReq) GetExpectedSize() int64 {
+	if m != nil {
+		return m.ExpectedSize
+	}
+	return 0
+}
+
+func (m *ReceiveReq) GetProgressIntervalMillis() int64 {
+	if m != nil {
+		return m.ProgressIntervalMillis
+	}
+	return 0
+}
+
+// Sent by the receiver on the data connection before ReceiveRes if ReceiveReq.ProgressIntervalMillis > 0.
+type ReceiveProgress struct {
+	// The number of stream bytes written to zfs recv so far.
+	BytesReceived        uint64   `protobuf:"varint,1,opt,name=BytesReceived,proto3" json:"BytesReceived,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ReceiveProgress) Reset()         { *m = ReceiveProgress{} }
+func (m *ReceiveProgress) String() string { return proto.CompactTextString(m) }
+func (*ReceiveProgress) ProtoMessage()    {}
+func (*ReceiveProgress) Descriptor() ([]byte, []int) {
+	return fileDescriptor_pdu_3f7ff292484a0669, []int{10}
+}
+func (m *ReceiveProgress) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ReceiveProgress.Unmarshal(m, b)
+}
+func (m *ReceiveProgress) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ReceiveProgress.Marshal(b, m, deterministic)
+}
+func (dst *ReceiveProgress) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ReceiveProgress.Merge(dst, src)
+}
+func (m *ReceiveProgress) XXX_Size() int {
+	return xxx_messageInfo_ReceiveProgress.Size(m)
+}
+func (m *ReceiveProgress) XXX_DiscardUnknown() {
+	xxx_messageInfo_ReceiveProgress.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ReceiveProgress proto.InternalMessageInfo
+
+func (m *ReceiveProgress) GetBytesReceived() uint64 {
+	if m != nil {
+		return m.BytesReceived
+	}
+	return 0
+}
+
 type ReceiveRes struct {
+	// True if the stream can be received.
+	DryRunCompatible bool `protobuf:"varint,1,opt,name=DryRunCompatible,proto3" json:"DryRunCompatible,omitempty"`
+	// Human-readable reason if DryRunCompatible is false.
+	DryRunError string `protobuf:"bytes,2,opt,name=DryRunError,proto3" json:"DryRunError,omitempty"`
+	// From the stream header, DryRunFromGUID is 0 for a full stream.
+	DryRunFromGUID uint64 `protobuf:"varint,3,opt,name=DryRunFromGUID,proto3" json:"DryRunFromGUID,omitempty"`
+	DryRunToGUID   uint64 `protobuf:"varint,4,opt,name=DryRunToGUID,proto3" json:"DryRunToGUID,omitempty"`
+	// The snapshot that zfs recv reports it would create, empty if unknown.
+	DryRunResultingSnapshot string `protobuf:"bytes,5,opt,name=DryRunResultingSnapshot,proto3" json:"DryRunResultingSnapshot,omitempty"`
+	// Pool features required by the stream that are not enabled on the receiving pool.
+	DryRunMissingPoolFeatures []string `protobuf:"bytes,6,rep,name=DryRunMissingPoolFeatures,proto3" json:"DryRunMissingPoolFeatures,omitempty"`
+	// The snapshot created by the receive (absolute path on the receiving side), empty if unknown.
+	ResultingSnapshot string `protobuf:"bytes,7,opt,name=ResultingSnapshot,proto3" json:"ResultingSnapshot,omitempty"`
+	// The number of stream bytes written to zfs recv.
+	BytesReceived        uint64   `protobuf:"varint,8,opt,name=BytesReceived,proto3" json:"BytesReceived,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -568,7 +678,7 @@ func (m *ReceiveRes) Reset()         { *m = ReceiveRes{} }
 func (m *ReceiveRes) String() string { return proto.CompactTextString(m) }
 func (*ReceiveRes) ProtoMessage()    {}
 func (*ReceiveRes) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_83b7e2a28d820622, []int{10}
+	return fileDescriptor_pdu_3f7ff292484a0669, []int{11}
 }
 func (m *ReceiveRes) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ReceiveRes.Unmarshal(m, b)
@@ -588,6 +698,62 @@ func (m *ReceiveRes) XXX_DiscardUnknown() {
 
 var xxx_messageInfo_ReceiveRes proto.InternalMessageInfo
 
+func (m *ReceiveRes) GetDryRunCompatible() bool {
+	if m != nil {
+		return m.DryRunCompatible
+	}
+	return false
+}
+
+func (m *ReceiveRes) GetDryRunError() string {
+	if m != nil {
+		return m.DryRunError
+	}
+	return ""
+}
+
+func (m *ReceiveRes) GetDryRunFromGUID() uint64 {
+	if m != nil {
+		return m.DryRunFromGUID
+	}
+	return 0
+}
+
+func (m *ReceiveRes) GetDryRunToGUID() uint64 {
+	if m != nil {
+		return m.DryRunToGUID
+	}
+	return 0
+}
+
+func (m *ReceiveRes) GetDryRunResultingSnapshot() string {
+	if m != nil {
+		return m.DryRunResultingSnapshot
+	}
+	return ""
+}
+
+func (m *ReceiveRes) GetDryRunMissingPoolFeatures() []string {
+	if m != nil {
+		return m.DryRunMissingPoolFeatures
+	}
+	return nil
+}
+
+func (m *ReceiveRes) GetResultingSnapshot() string {
+	if m != nil {
+		return m.ResultingSnapshot
+	}
+	return ""
+}
+
+func (m *ReceiveRes) GetBytesReceived() uint64 {
+	if m != nil {
+		return m.BytesReceived
+	}
+	return 0
+}
+
 type DestroySnapshotsReq struct {
 	Filesystem string `protobuf:"bytes,1,opt,name=Filesystem,proto3" json:"Filesystem,omitempty"`
 	// Path to filesystem, snapshot or bookmark to be destroyed
@@ -601,7 +767,7 @@ func (m *DestroySnapshotsReq) Reset()         { *m = DestroySnapshotsReq{} }
 func (m *DestroySnapshotsReq) String() string { return proto.CompactTextString(m) }
 func (*DestroySnapshotsReq) ProtoMessage()    {}
 func (*DestroySnapshotsReq) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_83b7e2a28d820622, []int{11}
+	return fileDescriptor_pdu_3f7ff292484a0669, []int{12}
 }
 func (m *DestroySnapshotsReq) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_DestroySnapshotsReq.Unmarshal(m, b)
@@ -647,7 +813,7 @@ func (m *DestroySnapshotRes) Reset()         { *m = DestroySnapshotRes{} }
 func (m *DestroySnapshotRes) String() string { return proto.CompactTextString(m) }
 func (*DestroySnapshotRes) ProtoMessage()    {}
 func (*DestroySnapshotRes) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_83b7e2a28d820622, []int{12}
+	return fileDescriptor_pdu_3f7ff292484a0669, []int{13}
 }
 func (m *DestroySnapshotRes) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_DestroySnapshotRes.Unmarshal(m, b)
@@ -692,7 +858,7 @@ func (m *DestroySnapshotsRes) Reset()         { *m = DestroySnapshotsRes{} }
 func (m *DestroySnapshotsRes) String() string { return proto.CompactTextString(m) }
 func (*DestroySnapshotsRes) ProtoMessage()    {}
 func (*DestroySnapshotsRes) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_83b7e2a28d820622, []int{13}
+	return fileDescriptor_pdu_3f7ff292484a0669, []int{14}
 }
 func (m *DestroySnapshotsRes) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_DestroySnapshotsRes.Unmarshal(m, b)
@@ -734,7 +900,7 @@ func (m *ReplicationCursorReq) Reset()         { *m = ReplicationCursorReq{} }
 func (m *ReplicationCursorReq) String() string { return proto.CompactTextString(m) }
 func (*ReplicationCursorReq) ProtoMessage()    {}
 func (*ReplicationCursorReq) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_83b7e2a28d820622, []int{14}
+	return fileDescriptor_pdu_3f7ff292484a0669, []int{15}
 }
 func (m *ReplicationCursorReq) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ReplicationCursorReq.Unmarshal(m, b)
@@ -882,7 +1048,7 @@ func (m *ReplicationCursorReq_GetOp) Reset()         { *m = ReplicationCursorReq
 func (m *ReplicationCursorReq_GetOp) String() string { return proto.CompactTextString(m) }
 func (*ReplicationCursorReq_GetOp) ProtoMessage()    {}
 func (*ReplicationCursorReq_GetOp) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_83b7e2a28d820622, []int{14, 0}
+	return fileDescriptor_pdu_3f7ff292484a0669, []int{15, 0}
 }
 func (m *ReplicationCursorReq_GetOp) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ReplicationCursorReq_GetOp.Unmarshal(m, b)
@@ -913,7 +1079,7 @@ func (m *ReplicationCursorReq_SetOp) Reset()         { *m = ReplicationCursorReq
 func (m *ReplicationCursorReq_SetOp) String() string { return proto.CompactTextString(m) }
 func (*ReplicationCursorReq_SetOp) ProtoMessage()    {}
 func (*ReplicationCursorReq_SetOp) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_83b7e2a28d820622, []int{14, 1}
+	return fileDescriptor_pdu_3f7ff292484a0669, []int{15, 1}
 }
 func (m *ReplicationCursorReq_SetOp) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ReplicationCursorReq_SetOp.Unmarshal(m, b)
@@ -954,7 +1120,7 @@ func (m *ReplicationCursorRes) Reset()         { *m = ReplicationCursorRes{} }
 func (m *ReplicationCursorRes) String() string { return proto.CompactTextString(m) }
 func (*ReplicationCursorRes) ProtoMessage()    {}
 func (*ReplicationCursorRes) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_83b7e2a28d820622, []int{15}
+	return fileDescriptor_pdu_3f7ff292484a0669, []int{16}
 }
 func (m *ReplicationCursorRes) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ReplicationCursorRes.Unmarshal(m, b)
@@ -1090,7 +1256,7 @@ func (m *PingReq) Reset()         { *m = PingReq{} }
 func (m *PingReq) String() string { return proto.CompactTextString(m) }
 func (*PingReq) ProtoMessage()    {}
 func (*PingReq) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_83b7e2a28d820622, []int{16}
+	return fileDescriptor_pdu_3f7ff292484a0669, []int{17}
 }
 func (m *PingReq) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_PingReq.Unmarshal(m, b)
@@ -1129,7 +1295,7 @@ func (m *PingRes) Reset()         { *m = PingRes{} }
 func (m *PingRes) String() string { return proto.CompactTextString(m) }
 func (*PingRes) ProtoMessage()    {}
 func (*PingRes) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_83b7e2a28d820622, []int{17}
+	return fileDescriptor_pdu_3f7ff292484a0669, []int{18}
 }
 func (m *PingRes) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_PingRes.Unmarshal(m, b)
@@ -1167,6 +1333,7 @@ func init() {
 	proto.RegisterType((*Property)(nil), "Property")
 	proto.RegisterType((*SendRes)(nil), "SendRes")
 	proto.RegisterType((*ReceiveReq)(nil), "ReceiveReq")
+	proto.RegisterType((*ReceiveProgress)(nil), "ReceiveProgress")
 	proto.RegisterType((*ReceiveRes)(nil), "ReceiveRes")
 	proto.RegisterType((*DestroySnapshotsReq)(nil), "DestroySnapshotsReq")
 	proto.RegisterType((*DestroySnapshotRes)(nil), "DestroySnapshotRes")
@@ -1384,58 +1551,70 @@ var _Replication_serviceDesc = grpc.ServiceDesc{
 	Metadata: "pdu.proto",
 }
 
-func init() { proto.RegisterFile("pdu.proto", fileDescriptor_pdu_83b7e2a28d820622) }
-
-var fileDescriptor_pdu_83b7e2a28d820622 = []byte{
-	// 785 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x55, 0xd1, 0x8e, 0xe3, 0x34,
-	0x14, 0x9d, 0xb4, 0x69, 0x9b, 0xde, 0x0e, 0xbb, 0x1d, 0x4f, 0x59, 0x85, 0x00, 0xab, 0xca, 0xcb,
-	0x43, 0x17, 0x89, 0x80, 0x0a, 0x2f, 0x08, 0x09, 0x89, 0x4e, 0x67, 0x67, 0x10, 0xb0, 0x54, 0x6e,
-	0x59, 0xad, 0xf6, 0x2d, 0x34, 0x57, 0x6d, 0x34, 0x6d, 0x9d, 0xb5, 0x13, 0xb4, 0xe5, 0x91, 0xbf,
-	0x9a, 0x7f, 0xe0, 0x91, 0x0f, 0x42, 0x76, 0xe3, 0x34, 0x6d, 0x52, 0xa9, 0x4f, 0xf1, 0x39, 0xf7,
-	0xda, 0x3e, 0xf7, 0xd8, 0xd7, 0x81, 0x76, 0x1c, 0xa6, 0x7e, 0x2c, 0x78, 0xc2, 0xe9, 0x35, 0x5c,
-	0xfd, 0x1a, 0xc9, 0xe4, 0x55, 0xb4, 0x42, 0xb9, 0x95, 0x09, 0xae, 0x19, 0xbe, 0xa7, 0xa3, 0x32,
-	0x29, 0xc9, 0x57, 0xd0, 0xd9, 0x13, 0xd2, 0xb5, 0xfa, 0xf5, 0x41, 0x67, 0xd8, 0xf1, 0x0b, 0x49,
-	0xc5, 0x38, 0x5d, 0x02, 0xec, 0x21, 0x21, 0x60, 0x4f, 0x82, 0x64, 0xe9, 0x5a, 0x7d, 0x6b, 0xd0,
-	0x66, 0x7a, 0x4c, 0xfa, 0xd0, 0x61, 0x28, 0xd3, 0x35, 0xce, 0xf8, 0x03, 0x6e, 0xdc, 0x9a, 0x0e,
-	0x15, 0x29, 0xf2, 0x05, 0x7c, 0xf4, 0xb3, 0x9c, 0xac, 0x82, 0x39, 0x2e, 0xf9, 0x2a, 0x44, 0xe1,
-	0xd6, 0xfb, 0xd6, 0xc0, 0x61, 0x87, 0x24, 0xfd, 0x01, 0x3e, 0x39, 0x54, 0xfb, 0x06, 0x85, 0x8c,
-	0xf8, 0x46, 0x32, 0x7c, 0x4f, 0x9e, 0x17, 0x65, 0x64, 0xdb, 0x17, 0x18, 0xfa, 0xcb, 0xe9, 0xc9,
-	0x92, 0xf8, 0xe0, 0x18, 0x98, 0xd5, 0x4b, 0xfc, 0x52, 0x26, 0xcb, 0x73, 0xe8, 0x7f, 0x16, 0x5c,
-	0x95, 0xe2, 0x64, 0x08, 0xf6, 0x6c, 0x1b, 0xa3, 0xde, 0xfc, 0xc9, 0xf0, 0x79, 0x79, 0x05, 0x3f,
-	0xfb, 0xaa, 0x2c, 0xa6, 0x73, 0x95, 0x5f, 0xaf, 0x83, 0x35, 0x66, 0xa6, 0xe8, 0xb1, 0xe2, 0xee,
-	0xd2, 0x28, 0xd4, 0x26, 0xd8, 0x4c, 0x8f, 0xc9, 0x67, 0xd0, 0xbe, 0x11, 0x18, 0x24, 0x38, 0x7b,
-	0x7b, 0xe7, 0xda, 0x3a, 0xb0, 0x27, 0x88, 0x07, 0x8e, 0x06, 0x11, 0xdf, 0xb8, 0x0d, 0xbd, 0x52,
-	0x8e, 0xe9, 0x4b, 0xe8, 0x14, 0xb6, 0x25, 0x97, 0xe0, 0x4c, 0x37, 0x41, 0x2c, 0x97, 0x3c, 0xe9,
-	0x5e, 0x28, 0x34, 0xe2, 0xfc, 0x61, 0x1d, 0x88, 0x87, 0xae, 0x45, 0x1f, 0x2d, 0x68, 0x4d, 0x71,
-	0x13, 0x9e, 0xe1, 0xa7, 0x12, 0xf9, 0x4a, 0xf0, 0xb5, 0x11, 0xae, 0xc6, 0xe4, 0x09, 0xd4, 0x66,
-	0x5c, 0xcb, 0x6e, 0xb3, 0xda, 0x8c, 0x1f, 0x1f, 0xbc, 0x5d, 0x3e, 0x78, 0x25, 0x9c, 0xaf, 0x63,
-	0x81, 0x52, 0x6a, 0xe1, 0x0e, 0xcb, 0x31, 0xe9, 0x41, 0x63, 0x8c, 0x61, 0x1a, 0xbb, 0x4d, 0x1d,
-	0xd8, 0x01, 0xf2, 0x0c, 0x9a, 0x63, 0xb1, 0x65, 0xe9, 0xc6, 0x6d, 0x69, 0x3a, 0x43, 0xf4, 0x3b,
-	0x70, 0x26, 0x82, 0xc7, 0x28, 0x92, 0x6d, 0x6e, 0xaa, 0x55, 0x30, 0xb5, 0x07, 0x8d, 0x37, 0xc1,
-	0x2a, 0x35, 0x4e, 0xef, 0x00, 0xfd, 0x27, 0xaf, 0x58, 0x92, 0x01, 0x3c, 0xfd, 0x43, 0x62, 0x78,
-	0x7c, 0x55, 0x1d, 0x76, 0x4c, 0x13, 0x0a, 0x97, 0xb7, 0x1f, 0x62, 0x9c, 0x27, 0x18, 0x4e, 0xa3,
-	0xbf, 0x51, 0x57, 0x5c, 0x67, 0x07, 0x1c, 0x79, 0x09, 0x90, 0xe9, 0x89, 0x50, 0xba, 0xb6, 0xbe,
-	0x54, 0x6d, 0xdf, 0x48, 0x64, 0x85, 0x20, 0x7d, 0x0b, 0xc0, 0x70, 0x8e, 0xd1, 0x5f, 0x78, 0x8e,
-	0xf1, 0x5f, 0x42, 0xf7, 0x66, 0x85, 0x81, 0x28, 0xeb, 0x2c, 0xf1, 0xf4, 0xb2, 0xb0, 0xb2, 0xa4,
-	0x0b, 0xb8, 0x1e, 0xa3, 0x4c, 0x04, 0xdf, 0x9a, 0x1b, 0x70, 0x4e, 0xe7, 0x90, 0x6f, 0xa0, 0x9d,
-	0xe7, 0xbb, 0xb5, 0x93, 0xdd, 0xb1, 0x4f, 0xa2, 0xef, 0x80, 0x1c, 0x6d, 0x94, 0x35, 0x99, 0x81,
-	0x7a, 0x97, 0x13, 0x4d, 0x66, 0x72, 0xd4, 0x89, 0xdd, 0x0a, 0xc1, 0x85, 0x39, 0x31, 0x0d, 0xe8,
-	0xb8, 0xaa, 0x08, 0xf5, 0x68, 0xb5, 0x54, 0xe1, 0xab, 0xc4, 0x34, 0xf0, 0xb5, 0x5f, 0x96, 0xc0,
-	0x4c, 0x0e, 0xfd, 0xd7, 0x82, 0x1e, 0xc3, 0x78, 0x15, 0xcd, 0x75, 0x93, 0xdc, 0xa4, 0x42, 0x72,
-	0x71, 0x8e, 0x19, 0x5f, 0x43, 0x7d, 0x81, 0x89, 0x96, 0xd4, 0x19, 0x7e, 0xea, 0x57, 0xad, 0xe1,
-	0xdf, 0x61, 0xf2, 0x7b, 0x7c, 0x7f, 0xc1, 0x54, 0xa6, 0x9a, 0x20, 0x31, 0xd1, 0x57, 0xe4, 0xe4,
-	0x84, 0xa9, 0x99, 0x20, 0x31, 0xf1, 0x5a, 0xd0, 0xd0, 0x0b, 0x78, 0x2f, 0xa0, 0xa1, 0x03, 0xaa,
-	0x49, 0x72, 0xe3, 0x76, 0x5e, 0xe4, 0x78, 0x64, 0x43, 0x8d, 0xc7, 0x74, 0x56, 0x59, 0x8d, 0x6a,
-	0xa1, 0xdd, 0x4b, 0xa2, 0xea, 0xb0, 0xef, 0x2f, 0xf2, 0xb7, 0xc4, 0x79, 0xcd, 0x13, 0xfc, 0x10,
-	0xc9, 0xdd, 0x7a, 0xce, 0xfd, 0x05, 0xcb, 0x99, 0x91, 0x03, 0xcd, 0x9d, 0x4b, 0xf4, 0x05, 0xb4,
-	0x26, 0xd1, 0x66, 0xa1, 0x6c, 0x71, 0xa1, 0xf5, 0x1b, 0x4a, 0x19, 0x2c, 0x4c, 0x53, 0x19, 0x48,
-	0x3f, 0x37, 0x49, 0x52, 0xb5, 0xdd, 0xed, 0x7c, 0xc9, 0x4d, 0xdb, 0xa9, 0xf1, 0xf0, 0xb1, 0xa6,
-	0xde, 0x80, 0x5c, 0x1a, 0xf1, 0xc0, 0x56, 0xe9, 0xc4, 0xf1, 0xb3, 0xa5, 0x3d, 0x33, 0x92, 0xe4,
-	0x7b, 0x78, 0x7a, 0xf8, 0x44, 0x4b, 0x42, 0xfc, 0xd2, 0x4f, 0xcb, 0x2b, 0x73, 0x92, 0x4c, 0xe0,
-	0x59, 0xf5, 0xeb, 0x4e, 0x3c, 0xff, 0xe4, 0x3f, 0xc3, 0x3b, 0x1d, 0x93, 0xe4, 0x47, 0xe8, 0x1e,
-	0xdf, 0x33, 0xd2, 0xf3, 0x2b, 0xfa, 0xc7, 0xab, 0x62, 0x25, 0xf9, 0x09, 0xae, 0x4a, 0x47, 0x42,
-	0x3e, 0xae, 0x3c, 0x7f, 0xaf, 0x92, 0x96, 0xa3, 0xc6, 0xbb, 0x7a, 0x1c, 0xa6, 0x7f, 0x36, 0xf5,
-	0x0f, 0xfc, 0xdb, 0xff, 0x03, 0x00, 0x00, 0xff, 0xff, 0x37, 0x0e, 0xf2, 0xe4, 0xcd, 0x07, 0x00,
-	0x00,
+func init() { proto.RegisterFile("pdu.proto", fileDescriptor_pdu_3f7ff292484a0669) }
+
+var fileDescriptor_pdu_3f7ff292484a0669 = []byte{
+	// 982 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x56, 0x6d, 0x8f, 0xe3, 0x34,
+	0x10, 0xde, 0xb6, 0xe9, 0x36, 0x9d, 0x1e, 0xfb, 0xe2, 0x5d, 0x96, 0x5c, 0x80, 0x53, 0x95, 0x43,
+	0xa8, 0x87, 0x20, 0xa0, 0x82, 0x78, 0x11, 0x08, 0x89, 0x6e, 0xf7, 0x4d, 0xb0, 0x47, 0xe5, 0xed,
+	0x9d, 0xd0, 0x7d, 0xcb, 0x35, 0x43, 0x1b, 0x6d, 0x1a, 0xe7, 0x6c, 0xe7, 0x74, 0xe5, 0x23, 0xff,
+	0x8a, 0xff, 0xc0, 0x47, 0x7e, 0x09, 0x7f, 0x00, 0x64, 0xe7, 0x65, 0xd3, 0x26, 0x3d, 0xed, 0xa7,
+	0x78, 0x9e, 0x79, 0x6c, 0xcf, 0x3c, 0x63, 0x8f, 0x03, 0xdd, 0xd8, 0x4f, 0xdc, 0x98, 0x33, 0xc9,
+	0x9c, 0x23, 0x38, 0xfc, 0x25, 0x10, 0xf2, 0x3c, 0x08, 0x51, 0xac, 0x84, 0xc4, 0x25, 0xc5, 0x57,
+	0xce, 0xa8, 0x0a, 0x0a, 0xf2, 0x19, 0xf4, 0xee, 0x00, 0x61, 0x35, 0xfa, 0xad, 0x41, 0x6f, 0xd8,
+	0x73, 0x4b, 0xa4, 0xb2, 0xdf, 0x59, 0x00, 0xdc, 0x99, 0x84, 0x80, 0x31, 0xf1, 0xe4, 0xc2, 0x6a,
+	0xf4, 0x1b, 0x83, 0x2e, 0xd5, 0x63, 0xd2, 0x87, 0x1e, 0x45, 0x91, 0x2c, 0x71, 0xca, 0x6e, 0x31,
+	0xb2, 0x9a, 0xda, 0x55, 0x86, 0xc8, 0x47, 0xf0, 0xce, 0x95, 0x98, 0x84, 0xde, 0x0c, 0x17, 0x2c,
+	0xf4, 0x91, 0x5b, 0xad, 0x7e, 0x63, 0x60, 0xd2, 0x75, 0xd0, 0xf9, 0x1e, 0x1e, 0xae, 0x47, 0xfb,
+	0x1c, 0xb9, 0x08, 0x58, 0x24, 0x28, 0xbe, 0x22, 0x8f, 0xca, 0x61, 0x64, 0xdb, 0x97, 0x10, 0xe7,
+	0xe7, 0xed, 0x93, 0x05, 0x71, 0xc1, 0xcc, 0xcd, 0x2c, 0x5f, 0xe2, 0x56, 0x98, 0xb4, 0xe0, 0x38,
+	0xff, 0x34, 0xe0, 0xb0, 0xe2, 0x27, 0x43, 0x30, 0xa6, 0xab, 0x18, 0xf5, 0xe6, 0x7b, 0xc3, 0x47,
+	0xd5, 0x15, 0xdc, 0xec, 0xab, 0x58, 0x54, 0x73, 0x95, 0x5e, 0x4f, 0xbd, 0x25, 0x66, 0xa2, 0xe8,
+	0xb1, 0xc2, 0x2e, 0x92, 0xc0, 0xd7, 0x22, 0x18, 0x54, 0x8f, 0xc9, 0x07, 0xd0, 0x3d, 0xe5, 0xe8,
+	0x49, 0x9c, 0xfe, 0x76, 0x61, 0x19, 0xda, 0x71, 0x07, 0x10, 0x1b, 0x4c, 0x6d, 0x04, 0x2c, 0xb2,
+	0xda, 0x7a, 0xa5, 0xc2, 0x76, 0x9e, 0x40, 0xaf, 0xb4, 0x2d, 0x79, 0x00, 0xe6, 0x4d, 0xe4, 0xc5,
+	0x62, 0xc1, 0xe4, 0xc1, 0x8e, 0xb2, 0x46, 0x8c, 0xdd, 0x2e, 0x3d, 0x7e, 0x7b, 0xd0, 0x70, 0xfe,
+	0x6b, 0x40, 0xe7, 0x06, 0x23, 0xff, 0x1e, 0x7a, 0xaa, 0x20, 0xcf, 0x39, 0x5b, 0xe6, 0x81, 0xab,
+	0x31, 0xd9, 0x83, 0xe6, 0x94, 0xe9, 0xb0, 0xbb, 0xb4, 0x39, 0x65, 0x9b, 0x85, 0x37, 0xaa, 0x85,
+	0x57, 0x81, 0xb3, 0x65, 0xcc, 0x51, 0x08, 0x1d, 0xb8, 0x49, 0x0b, 0x9b, 0x1c, 0x43, 0x7b, 0x8c,
+	0x7e, 0x12, 0x5b, 0xbb, 0xda, 0x91, 0x1a, 0xe4, 0x04, 0x76, 0xc7, 0x7c, 0x45, 0x93, 0xc8, 0xea,
+	0x68, 0x38, 0xb3, 0xf4, 0x11, 0x8a, 0x24, 0xf2, 0x25, 0xfa, 0x81, 0x27, 0x51, 0x58, 0x66, 0x76,
+	0x84, 0xca, 0xa0, 0xce, 0xca, 0x0b, 0xc2, 0xab, 0xdf, 0x47, 0x89, 0x58, 0x59, 0x5d, 0x4d, 0x29,
+	0x21, 0xce, 0x57, 0x60, 0x4e, 0x38, 0x8b, 0x91, 0xcb, 0x55, 0x51, 0x9a, 0x46, 0xa9, 0x34, 0xc7,
+	0xd0, 0x7e, 0xee, 0x85, 0x49, 0x5e, 0xaf, 0xd4, 0x70, 0xfe, 0x2c, 0x74, 0x13, 0x64, 0x00, 0xfb,
+	0xcf, 0x04, 0xfa, 0x9b, 0x07, 0xde, 0xa4, 0x9b, 0x30, 0x71, 0xe0, 0xc1, 0xd9, 0x9b, 0x18, 0x67,
+	0x12, 0xfd, 0x9b, 0xe0, 0x0f, 0xd4, 0xba, 0xb5, 0xe8, 0x1a, 0x46, 0x9e, 0x00, 0x64, 0xf1, 0x04,
+	0x28, 0x2c, 0x43, 0x1f, 0xcd, 0xae, 0x9b, 0x87, 0x48, 0x4b, 0x4e, 0xe7, 0xef, 0x06, 0x00, 0xc5,
+	0x19, 0x06, 0xaf, 0xf1, 0x3e, 0xf5, 0xfb, 0x04, 0x0e, 0x4e, 0x43, 0xf4, 0x78, 0x35, 0xd0, 0x0a,
+	0x5e, 0xd2, 0xbc, 0xb5, 0xa6, 0xf9, 0x66, 0x06, 0x46, 0x4d, 0x06, 0x5f, 0xc3, 0xc9, 0x84, 0xb3,
+	0xb9, 0xaa, 0xa8, 0x2e, 0xc5, 0x6b, 0x2f, 0xbc, 0x0e, 0xc2, 0x30, 0x48, 0xeb, 0xdd, 0xa2, 0x5b,
+	0xbc, 0xce, 0x37, 0xb0, 0x9f, 0x65, 0x93, 0x13, 0x54, 0x89, 0x47, 0x2b, 0x89, 0x22, 0xc3, 0x7d,
+	0x9d, 0x95, 0x41, 0xd7, 0x41, 0xe7, 0xdf, 0x66, 0x49, 0x07, 0xa1, 0xf2, 0x4c, 0xa3, 0x55, 0xe7,
+	0xca, 0x93, 0xc1, 0xcb, 0x30, 0xad, 0xa8, 0x49, 0x2b, 0xb8, 0x3a, 0xaf, 0x29, 0x76, 0xc6, 0x39,
+	0xe3, 0x79, 0xa3, 0x2a, 0x41, 0xe4, 0x63, 0xd8, 0x4b, 0x4d, 0x75, 0xde, 0x2f, 0x9e, 0x5d, 0x8d,
+	0xb3, 0x4b, 0xba, 0x81, 0x2a, 0x65, 0x52, 0x64, 0xca, 0x34, 0x2b, 0xbd, 0xb1, 0x6b, 0x18, 0xf9,
+	0x16, 0xde, 0x4b, 0x6d, 0x25, 0x75, 0x28, 0x83, 0x68, 0x9e, 0x5f, 0xcc, 0xec, 0x0e, 0x6f, 0x73,
+	0x93, 0x1f, 0xe0, 0x61, 0xea, 0xba, 0x0e, 0x84, 0x08, 0xa2, 0xf9, 0x84, 0xb1, 0xf0, 0x1c, 0x3d,
+	0x99, 0x70, 0x14, 0xd6, 0x6e, 0xbf, 0x35, 0xe8, 0xd2, 0xed, 0x04, 0xf2, 0x29, 0x1c, 0x56, 0x77,
+	0xec, 0xe8, 0x1d, 0xab, 0x8e, 0xaa, 0xe8, 0x66, 0x9d, 0xe8, 0x73, 0x38, 0x1a, 0xa3, 0x90, 0x9c,
+	0xad, 0xf2, 0x89, 0xf7, 0x69, 0xca, 0xe4, 0x0b, 0xe8, 0x16, 0x7c, 0xab, 0xb9, 0xb5, 0xf1, 0xde,
+	0x91, 0x9c, 0x17, 0x40, 0x36, 0x36, 0xca, 0xfa, 0x77, 0x91, 0x89, 0xda, 0x65, 0x4b, 0xff, 0x2e,
+	0x92, 0x3a, 0x86, 0x76, 0xb9, 0xc4, 0xa9, 0xe1, 0x8c, 0xeb, 0x92, 0x50, 0xef, 0x61, 0x27, 0x95,
+	0x25, 0x7f, 0x1b, 0x8e, 0xdc, 0x6a, 0x08, 0x34, 0xe7, 0xa8, 0x7b, 0x78, 0x4c, 0x31, 0x0e, 0x83,
+	0x99, 0xee, 0xbf, 0xa7, 0x09, 0x17, 0x8c, 0xdf, 0x47, 0x8c, 0xcf, 0xa1, 0x35, 0x47, 0xa9, 0x43,
+	0xea, 0x0d, 0xdf, 0x77, 0xeb, 0xd6, 0x70, 0x2f, 0x50, 0xfe, 0x1a, 0x5f, 0xee, 0x50, 0xc5, 0x54,
+	0x13, 0x04, 0x4a, 0xab, 0xf5, 0xb6, 0x09, 0x37, 0xf9, 0x04, 0x81, 0xd2, 0xee, 0x40, 0x5b, 0x2f,
+	0x60, 0x3f, 0x86, 0xb6, 0x76, 0xa8, 0xfe, 0x5b, 0x08, 0x97, 0x6a, 0x51, 0xd8, 0x23, 0x03, 0x9a,
+	0x2c, 0x76, 0xa6, 0xb5, 0xd9, 0xa8, 0xee, 0x9c, 0x3e, 0x52, 0xfa, 0x0e, 0x5e, 0xee, 0x14, 0xcf,
+	0x94, 0xf9, 0x94, 0x49, 0x7c, 0x13, 0x88, 0x74, 0x3d, 0xf3, 0x72, 0x87, 0x16, 0xc8, 0xc8, 0x84,
+	0xdd, 0x54, 0x25, 0xe7, 0x31, 0x74, 0x26, 0x41, 0x34, 0x57, 0xb2, 0x58, 0xd0, 0xb9, 0x46, 0x21,
+	0xbc, 0x79, 0xde, 0x69, 0x73, 0xd3, 0xf9, 0x30, 0x27, 0x09, 0xd5, 0x8b, 0xcf, 0x66, 0x0b, 0x96,
+	0xf7, 0x62, 0x35, 0x1e, 0xfe, 0xd5, 0x84, 0x5e, 0x29, 0x34, 0x62, 0x83, 0xa1, 0xe8, 0xc4, 0x74,
+	0xb3, 0xa5, 0xed, 0x7c, 0x24, 0xc8, 0x77, 0xb0, 0xbf, 0xfe, 0xfa, 0x0b, 0x42, 0xdc, 0xca, 0xff,
+	0x90, 0x5d, 0xc5, 0x04, 0x99, 0xc0, 0x49, 0xfd, 0x8f, 0x03, 0xb1, 0xdd, 0xad, 0xbf, 0x23, 0xf6,
+	0x76, 0x9f, 0x20, 0x3f, 0xc2, 0xc1, 0xe6, 0x39, 0x23, 0xc7, 0x6e, 0xcd, 0xfd, 0xb1, 0xeb, 0x50,
+	0x41, 0x7e, 0x82, 0xc3, 0x52, 0xde, 0x69, 0x49, 0xc8, 0xbb, 0xb5, 0xf5, 0xb7, 0x6b, 0x61, 0x31,
+	0x6a, 0xbf, 0x68, 0xc5, 0x7e, 0xf2, 0x72, 0x57, 0xff, 0x1b, 0x7e, 0xf9, 0xff, 0x00, 0x6d, 0x15,
+	0x7b, 0x65, 0x28, 0x0a, 0x00, 0x00,
 }
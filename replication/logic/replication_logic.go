@@ -147,6 +147,8 @@ type Step struct {
 
 	parent   *Filesystem
 	from, to *pdu.FilesystemVersion // compat
+	// send all snapshots between from and to in a single stream (zfs send -I)
+	intermediates bool
 
 	expectedSize int64 // 0 means no size estimate present / possible
 
@@ -165,7 +167,8 @@ func (s *Step) TargetEquals(other driver.Step) bool {
 		panic("Step interface promise broken: parent filesystems must be same")
 	}
 	return s.from.GetGuid() == t.from.GetGuid() &&
-		s.to.GetGuid() == t.to.GetGuid()
+		s.to.GetGuid() == t.to.GetGuid() &&
+		s.intermediates == t.intermediates
 }
 
 func (s *Step) TargetDate() time.Time {
@@ -322,26 +325,18 @@ func (fs *Filesystem) doPlanning(ctx context.Context) ([]*Step, error) {
 		return nil, conflict
 	}
 
-	steps := make([]*Step, 0, len(path))
-	// FIXME unify struct declarations => initializer?
-	if len(path) == 1 {
+	useIntermediates := sendIntermediates && fs.receiverFS.GetResumeToken() == ""
+	stepPlans := planSteps(path, useIntermediates)
+	steps := make([]*Step, 0, len(stepPlans))
+	for _, sp := range stepPlans {
 		steps = append(steps, &Step{
-			parent:   fs,
-			sender:   fs.sender,
-			receiver: fs.receiver,
-			from:     nil,
-			to:       path[0],
+			parent:        fs,
+			sender:        fs.sender,
+			receiver:      fs.receiver,
+			from:          sp.from,
+			to:            sp.to,
+			intermediates: sp.intermediates,
 		})
-	} else {
-		for i := 0; i < len(path)-1; i++ {
-			steps = append(steps, &Step{
-				parent:   fs,
-				sender:   fs.sender,
-				receiver: fs.receiver,
-				from:     path[i],
-				to:       path[i+1],
-			})
-		}
 	}
 
 	log.Debug("compute send size estimate")
@@ -412,6 +407,42 @@ func (fs *Filesystem) doPlanning(ctx context.Context) ([]*Step, error) {
 // 	return fmt.Sprintf("%s could not be replicated: %s", fsstr, errorStr)
 // }
 
+// If true, the planner replicates a chain of incremental steps with a single
+// send that includes all intermediate snapshots (SendReq.Intermediates).
+// Only enable this if all senders support SendReq.Intermediates.
+var sendIntermediates = envconst.Bool("ZREPL_REPLICATION_EXPERIMENTAL_SEND_INTERMEDIATES", false)
+
+type stepPlan struct {
+	from, to      *pdu.FilesystemVersion // from is nil for a full send
+	intermediates bool
+}
+
+// planSteps computes the steps that replicate path, as returned by IncrementalPath.
+//
+// If useIntermediates is true and path is a chain of snapshots, a single step
+// with intermediates is returned instead of one step per hop.
+func planSteps(path []*pdu.FilesystemVersion, useIntermediates bool) []stepPlan {
+	if len(path) == 1 {
+		return []stepPlan{{from: nil, to: path[0]}}
+	}
+	if useIntermediates && len(path) > 2 {
+		// -I requires a snapshot as the incremental source,
+		// and the chain must not skip any snapshots of the sender, which IncrementalPath guarantees
+		contiguous := true
+		for _, v := range path {
+			contiguous = contiguous && v.Type == pdu.FilesystemVersion_Snapshot
+		}
+		if contiguous {
+			return []stepPlan{{from: path[0], to: path[len(path)-1], intermediates: true}}
+		}
+	}
+	steps := make([]stepPlan, 0, len(path)-1)
+	for i := 0; i < len(path)-1; i++ {
+		steps = append(steps, stepPlan{from: path[i], to: path[i+1]})
+	}
+	return steps
+}
+
 func (s *Step) updateSizeEstimate(ctx context.Context) error {
 
 	log := getLogger(ctx)
@@ -438,10 +469,11 @@ func (s *Step) buildSendRequest(dryRun bool) (sr *pdu.SendReq) {
 		}
 	} else {
 		sr = &pdu.SendReq{
-			Filesystem: fs,
-			From:       s.from.RelName(),
-			To:         s.to.RelName(),
-			DryRun:     dryRun,
+			Filesystem:    fs,
+			From:          s.from.RelName(),
+			To:            s.to.RelName(),
+			Intermediates: s.intermediates,
+			DryRun:        dryRun,
 		}
 	}
 	return sr
@@ -479,6 +511,7 @@ func (s *Step) doReplication(ctx context.Context) error {
 	rr := &pdu.ReceiveReq{
 		Filesystem:       fs,
 		ClearResumeToken: !sres.UsedResumeToken,
+		ExpectedSize:     sres.ExpectedSize,
 	}
 	log.Debug("initiate receive request")
 	_, err = s.receiver.Receive(ctx, rr, byteCountingStream)
@@ -521,6 +554,9 @@ func (s *Step) String() string {
 	if s.from == nil { // FIXME: ZFS semantics are that to is nil on non-incremental send
 		return fmt.Sprintf("%s%s (full)", s.parent.Path, s.to.RelName())
 	} else {
+		if s.intermediates {
+			return fmt.Sprintf("%s(%s => ... => %s)", s.parent.Path, s.from.RelName(), s.to.RelName())
+		}
 		return fmt.Sprintf("%s(%s => %s)", s.parent.Path, s.from.RelName(), s.to.RelName())
 	}
 }
@@ -0,0 +1,47 @@
+package logic
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+func TestPlanSteps(t *testing.T) {
+	snap := func(name string, guid uint64) *pdu.FilesystemVersion {
+		return &pdu.FilesystemVersion{Type: pdu.FilesystemVersion_Snapshot, Name: name, Guid: guid}
+	}
+	book := func(name string, guid uint64) *pdu.FilesystemVersion {
+		return &pdu.FilesystemVersion{Type: pdu.FilesystemVersion_Bookmark, Name: name, Guid: guid}
+	}
+	a, b, c, d := snap("a", 1), snap("b", 2), snap("c", 3), snap("d", 4)
+
+	t.Run("contiguous chain uses intermediates", func(t *testing.T) {
+		steps := planSteps([]*pdu.FilesystemVersion{a, b, c, d}, true)
+		require.Len(t, steps, 1)
+		assert.Equal(t, stepPlan{from: a, to: d, intermediates: true}, steps[0])
+	})
+
+	t.Run("per hop if intermediates are not used", func(t *testing.T) {
+		steps := planSteps([]*pdu.FilesystemVersion{a, b, c, d}, false)
+		assert.Equal(t, []stepPlan{{from: a, to: b}, {from: b, to: c}, {from: c, to: d}}, steps)
+	})
+
+	t.Run("per hop if chain starts at bookmark", func(t *testing.T) {
+		bm := book("a", 1)
+		steps := planSteps([]*pdu.FilesystemVersion{bm, b, c}, true)
+		assert.Equal(t, []stepPlan{{from: bm, to: b}, {from: b, to: c}}, steps)
+	})
+
+	t.Run("single hop", func(t *testing.T) {
+		steps := planSteps([]*pdu.FilesystemVersion{a, b}, true)
+		assert.Equal(t, []stepPlan{{from: a, to: b}}, steps)
+	})
+
+	t.Run("full send", func(t *testing.T) {
+		steps := planSteps([]*pdu.FilesystemVersion{a}, true)
+		assert.Equal(t, []stepPlan{{from: nil, to: a}}, steps)
+	})
+}
@@ -5,9 +5,11 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 
+	"github.com/zrepl/zrepl/endpoint"
 	"github.com/zrepl/zrepl/replication/logic/pdu"
 	"github.com/zrepl/zrepl/rpc/dataconn/stream"
 	"github.com/zrepl/zrepl/transport"
@@ -66,16 +68,29 @@ type ProtocolError struct {
 }
 
 func (e *ProtocolError) Error() string {
-	return fmt.Sprintf("protocol error: %s", e)
+	return fmt.Sprintf("protocol error: %s", e.cause)
 }
 
-func (c *Client) recv(ctx context.Context, conn *stream.Conn, res proto.Message) error {
+// recv reads the response to a request.
+// If progress is not nil, it is invoked for every progress report that precedes the response header.
+func (c *Client) recv(ctx context.Context, conn *stream.Conn, res proto.Message, progress func(received int64)) error {
 
-	headerBuf, err := conn.ReadStreamedMessage(ctx, ResponseHeaderMaxSize, ResHeader)
-	if err != nil {
-		return err
+	var header string
+	for {
+		headerBuf, err := conn.ReadStreamedMessage(ctx, ResponseHeaderMaxSize, ResHeader)
+		if err != nil {
+			return err
+		}
+		header = string(headerBuf)
+		if progress == nil || !strings.HasPrefix(header, responseHeaderHandlerProgressPrefix) {
+			break
+		}
+		var p pdu.ReceiveProgress
+		if err := proto.Unmarshal(headerBuf[len(responseHeaderHandlerProgressPrefix):], &p); err != nil {
+			return &ProtocolError{fmt.Errorf("cannot unmarshal progress report: %s", err)}
+		}
+		progress(int64(p.GetBytesReceived()))
 	}
-	header := string(headerBuf)
 	if strings.HasPrefix(header, responseHeaderHandlerErrorPrefix) {
 		// FIXME distinguishable error type
 		return &RemoteHandlerError{strings.TrimPrefix(header, responseHeaderHandlerErrorPrefix)}
@@ -126,7 +141,7 @@ func (c *Client) ReqSend(ctx context.Context, req *pdu.SendReq) (*pdu.SendRes, z
 	}
 
 	var res pdu.SendRes
-	if err := c.recv(ctx, conn, &res); err != nil {
+	if err := c.recv(ctx, conn, &res, nil); err != nil {
 		return nil, nil, err
 	}
 
@@ -142,6 +157,20 @@ func (c *Client) ReqSend(ctx context.Context, req *pdu.SendReq) (*pdu.SendRes, z
 func (c *Client) ReqRecv(ctx context.Context, req *pdu.ReceiveReq, streamCopier zfs.StreamCopier) (*pdu.ReceiveRes, error) {
 
 	defer c.log.Debug("ReqRecv returns")
+
+	var progress func(received int64)
+	if every, cb, ok := endpoint.ReceiveProgressFromContext(ctx); ok {
+		// the server only reports progress if asked to, and only in whole milliseconds
+		interval := int64(every / time.Millisecond)
+		if interval < 1 {
+			interval = 1
+		}
+		req = proto.Clone(req).(*pdu.ReceiveReq) // don't modify the caller's request
+		req.ProgressIntervalMillis = interval
+		fs := req.GetFilesystem()
+		progress = func(received int64) { cb(fs, received) }
+	}
+
 	conn, err := c.getWire(ctx)
 	if err != nil {
 		return nil, err
@@ -157,7 +186,7 @@ func (c *Client) ReqRecv(ctx context.Context, req *pdu.ReceiveReq, streamCopier
 	recvErrChan := make(chan recvRes)
 	go func() {
 		res := &pdu.ReceiveRes{}
-		if err := c.recv(ctx, conn, res); err != nil {
+		if err := c.recv(ctx, conn, res, progress); err != nil {
 			recvErrChan <- recvRes{res, err}
 		} else {
 			recvErrChan <- recvRes{res, nil}
@@ -227,7 +256,7 @@ func (c *Client) ReqPing(ctx context.Context, req *pdu.PingReq) (*pdu.PingRes, e
 	}
 
 	var res pdu.PingRes
-	if err := c.recv(ctx, conn, &res); err != nil {
+	if err := c.recv(ctx, conn, &res, nil); err != nil {
 		return nil, err
 	}
 
@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 
+	"github.com/zrepl/zrepl/endpoint"
 	"github.com/zrepl/zrepl/logger"
 	"github.com/zrepl/zrepl/replication/logic/pdu"
 	"github.com/zrepl/zrepl/rpc/dataconn/stream"
@@ -100,7 +102,7 @@ func (s *Server) serveConn(nc *transport.AuthConn) {
 		s.log.WithError(err).Error("error reading structured part")
 		return
 	}
-	endpoint := string(header)
+	endpointName := string(header)
 
 	reqStructured, err := c.ReadStreamedMessage(ctx, RequestStructuredMaxSize, ReqStructured)
 	if err != nil {
@@ -108,12 +110,12 @@ func (s *Server) serveConn(nc *transport.AuthConn) {
 		return
 	}
 
-	s.log.WithField("endpoint", endpoint).Debug("calling handler")
+	s.log.WithField("endpoint", endpointName).Debug("calling handler")
 
 	var res proto.Message
 	var sendStream zfs.StreamCopier
 	var handlerErr error
-	switch endpoint {
+	switch endpointName {
 	case EndpointSend:
 		var req pdu.SendReq
 		if err := proto.Unmarshal(reqStructured, &req); err != nil {
@@ -127,6 +129,9 @@ func (s *Server) serveConn(nc *transport.AuthConn) {
 			s.log.WithError(err).Error("cannot unmarshal receive request")
 			return
 		}
+		if interval := req.GetProgressIntervalMillis(); interval > 0 {
+			ctx = endpoint.WithReceiveProgress(ctx, time.Duration(interval)*time.Millisecond, s.receiveProgressWriter(ctx, c))
+		}
 		res, handlerErr = s.h.Receive(ctx, &req, &streamCopier{streamConn: c, closeStreamOnClose: false}) // SHADOWING
 	case EndpointPing:
 		var req pdu.PingReq
@@ -136,18 +141,18 @@ func (s *Server) serveConn(nc *transport.AuthConn) {
 		}
 		res, handlerErr = s.h.PingDataconn(ctx, &req) // SHADOWING
 	default:
-		s.log.WithField("endpoint", endpoint).Error("unknown endpoint")
+		s.log.WithField("endpoint", endpointName).Error("unknown endpoint")
 		handlerErr = fmt.Errorf("requested endpoint does not exist")
 	}
 
-	s.log.WithField("endpoint", endpoint).WithField("errType", fmt.Sprintf("%T", handlerErr)).Debug("handler returned")
+	s.log.WithField("endpoint", endpointName).WithField("errType", fmt.Sprintf("%T", handlerErr)).Debug("handler returned")
 
 	// prepare protobuf now to return the protobuf error in the header
 	// if marshaling fails. We consider failed marshaling a handler error
 	var protobuf *bytes.Buffer
 	if handlerErr == nil {
 		if res == nil {
-			handlerErr = fmt.Errorf("implementation error: handler for endpoint %q returns nil error and nil result", endpoint)
+			handlerErr = fmt.Errorf("implementation error: handler for endpoint %q returns nil error and nil result", endpointName)
 			s.log.WithError(err).Error("handle implementation error")
 		} else {
 			protobufBytes, err := proto.Marshal(res)
@@ -188,3 +193,26 @@ func (s *Server) serveConn(nc *transport.AuthConn) {
 		}
 	}
 }
+
+// receiveProgressWriter returns an endpoint.ReceiveProgressFunc that forwards
+// progress reports to the client as intermediate response headers.
+// Reporting stops at the first write error, which also breaks the final response.
+func (s *Server) receiveProgressWriter(ctx context.Context, c *stream.Conn) endpoint.ReceiveProgressFunc {
+	broken := false
+	return func(fs string, received int64) {
+		if broken {
+			return
+		}
+		progressBytes, err := proto.Marshal(&pdu.ReceiveProgress{BytesReceived: uint64(received)})
+		if err != nil {
+			panic(err)
+		}
+		var buf bytes.Buffer
+		buf.WriteString(responseHeaderHandlerProgressPrefix)
+		buf.Write(progressBytes)
+		if err := c.WriteStreamedMessage(ctx, &buf, ResHeader); err != nil {
+			s.log.WithError(err).WithField("fs", fs).Error("cannot write receive progress")
+			broken = true
+		}
+	}
+}
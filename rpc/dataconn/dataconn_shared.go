@@ -38,6 +38,8 @@ const (
 const (
 	responseHeaderHandlerOk          = "HANDLER OK\n"
 	responseHeaderHandlerErrorPrefix = "HANDLER ERROR:\n"
+	// followed by a marshaled pdu.ReceiveProgress, only sent if requested in pdu.ReceiveReq
+	responseHeaderHandlerProgressPrefix = "HANDLER PROGRESS:\n"
 )
 
 type streamCopier struct {
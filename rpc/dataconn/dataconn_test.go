@@ -1 +1,130 @@
 package dataconn
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/endpoint"
+	"github.com/zrepl/zrepl/logger"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/transport"
+	"github.com/zrepl/zrepl/util/socketpair"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+type bytesStreamCopier struct{ *bytes.Reader }
+
+func (bytesStreamCopier) Close() error { return nil }
+
+type bytesStreamCopierErr struct{ error }
+
+func (bytesStreamCopierErr) IsReadError() bool  { return false }
+func (bytesStreamCopierErr) IsWriteError() bool { return true }
+
+func (c bytesStreamCopier) WriteStreamTo(w io.Writer) zfs.StreamCopierError {
+	if _, err := io.Copy(w, c.Reader); err != nil {
+		return bytesStreamCopierErr{err}
+	}
+	return nil
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+// progressHandler reports progress the way endpoint.Receiver does: through the callback in ctx.
+type progressHandler struct {
+	hadProgress bool
+}
+
+func (h *progressHandler) Send(ctx context.Context, r *pdu.SendReq) (*pdu.SendRes, zfs.StreamCopier, error) {
+	panic("not implemented")
+}
+
+func (h *progressHandler) Receive(ctx context.Context, r *pdu.ReceiveReq, receive zfs.StreamCopier) (*pdu.ReceiveRes, error) {
+	_, cb, ok := endpoint.ReceiveProgressFromContext(ctx)
+	h.hadProgress = ok
+	var received int64
+	err := receive.WriteStreamTo(writerFunc(func(p []byte) (int, error) {
+		received += int64(len(p))
+		if ok {
+			cb(r.GetFilesystem(), received)
+		}
+		return len(p), nil
+	}))
+	if err != nil {
+		return nil, err
+	}
+	return &pdu.ReceiveRes{BytesReceived: uint64(received)}, nil
+}
+
+func (h *progressHandler) PingDataconn(ctx context.Context, r *pdu.PingReq) (*pdu.PingRes, error) {
+	panic("not implemented")
+}
+
+type wireConnecter struct{ w transport.Wire }
+
+func (c wireConnecter) Connect(ctx context.Context) (transport.Wire, error) { return c.w, nil }
+
+func reqRecvOverSocketPair(t *testing.T, ctx context.Context, h Handler, req *pdu.ReceiveReq, stream []byte) *pdu.ReceiveRes {
+	a, b, err := socketpair.SocketPair()
+	require.NoError(t, err)
+
+	log := logger.NewNullLogger()
+	server := NewServer(nil, log, h)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		server.serveConn(transport.NewAuthConn(b, "client"))
+	}()
+
+	client := NewClient(wireConnecter{a}, log)
+	res, err := client.ReqRecv(ctx, req, bytesStreamCopier{bytes.NewReader(stream)})
+	require.NoError(t, err)
+	wg.Wait()
+	return res
+}
+
+func TestReqRecvProgress(t *testing.T) {
+	stream := bytes.Repeat([]byte{0x23}, 3<<20)
+
+	var mtx sync.Mutex
+	var reports []int64
+	ctx := endpoint.WithReceiveProgress(context.Background(), time.Millisecond, func(fs string, received int64) {
+		assert.Equal(t, "pool/fs", fs)
+		mtx.Lock()
+		defer mtx.Unlock()
+		reports = append(reports, received)
+	})
+
+	h := &progressHandler{}
+	req := &pdu.ReceiveReq{Filesystem: "pool/fs"}
+	res := reqRecvOverSocketPair(t, ctx, h, req, stream)
+
+	assert.True(t, h.hadProgress)
+	assert.EqualValues(t, len(stream), res.GetBytesReceived())
+	assert.Zero(t, req.GetProgressIntervalMillis(), "caller's request must not be modified")
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	require.NotEmpty(t, reports)
+	for i := 1; i < len(reports); i++ {
+		assert.True(t, reports[i-1] < reports[i], "progress must increase: %v", reports)
+	}
+	assert.EqualValues(t, len(stream), reports[len(reports)-1])
+}
+
+func TestReqRecvWithoutProgress(t *testing.T) {
+	h := &progressHandler{}
+	res := reqRecvOverSocketPair(t, context.Background(), h, &pdu.ReceiveReq{Filesystem: "pool/fs"}, []byte("stream"))
+	assert.False(t, h.hadProgress)
+	assert.EqualValues(t, len("stream"), res.GetBytesReceived())
+}
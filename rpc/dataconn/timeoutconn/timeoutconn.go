@@ -9,12 +9,12 @@ package timeoutconn
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"net"
 	"sync/atomic"
 	"syscall"
 	"time"
-	"unsafe"
 )
 
 type Wire interface {
@@ -58,12 +58,47 @@ type Conn struct {
 	Wire
 	renewDeadlinesDisabled int32
 	idleTimeout            time.Duration
+	transferTimeout        time.Duration
 }
 
 func Wrap(conn Wire, idleTimeout time.Duration) Conn {
 	return Conn{Wire: conn, idleTimeout: idleTimeout}
 }
 
+// WithIdleTimeout returns a copy of c that fails reads and writes
+// if no bytes were transferred for idleTimeout.
+// Use it to override the timeout passed to Wrap for individual calls, e.g.
+//
+//   c.WithIdleTimeout(10*time.Minute).ReadvFull(bufs)
+func (c Conn) WithIdleTimeout(idleTimeout time.Duration) Conn {
+	c.idleTimeout = idleTimeout
+	return c
+}
+
+// WithTransferTimeout returns a copy of c whose ReadvFull calls fail with
+// a *TransferTimeoutError if they take longer than transferTimeout in total,
+// regardless of forward progress.
+// A zero transferTimeout (the default) only applies the idle timeout.
+func (c Conn) WithTransferTimeout(transferTimeout time.Duration) Conn {
+	c.transferTimeout = transferTimeout
+	return c
+}
+
+// TransferTimeoutError is returned if a transfer exceeded the timeout set by WithTransferTimeout.
+// In contrast, an exceeded idle timeout produces the net.Error of the underlying Wire.
+type TransferTimeoutError struct {
+	TransferTimeout time.Duration
+}
+
+var _ net.Error = (*TransferTimeoutError)(nil)
+
+func (e *TransferTimeoutError) Error() string {
+	return fmt.Sprintf("transfer exceeded timeout of %s", e.TransferTimeout)
+}
+
+func (e *TransferTimeoutError) Timeout() bool   { return true }
+func (e *TransferTimeoutError) Temporary() bool { return false }
+
 // DisableTimeouts disables the idle timeout behavior provided by this package.
 // Existing deadlines are cleared iff the call is the first call to this method.
 func (c *Conn) DisableTimeouts() error {
@@ -74,10 +109,37 @@ func (c *Conn) DisableTimeouts() error {
 }
 
 func (c *Conn) renewReadDeadline() error {
+	return c.renewReadDeadlineBefore(time.Time{})
+}
+
+// like renewReadDeadline, but the deadline is not moved past transferDeadline (unless it is zero)
+func (c *Conn) renewReadDeadlineBefore(transferDeadline time.Time) error {
 	if atomic.LoadInt32(&c.renewDeadlinesDisabled) != 0 {
 		return nil
 	}
-	return c.SetReadDeadline(time.Now().Add(c.idleTimeout))
+	deadline := time.Now().Add(c.idleTimeout)
+	if !transferDeadline.IsZero() && transferDeadline.Before(deadline) {
+		deadline = transferDeadline
+	}
+	return c.SetReadDeadline(deadline)
+}
+
+func (c *Conn) transferDeadline() time.Time {
+	if c.transferTimeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(c.transferTimeout)
+}
+
+// replaces timeout errors with *TransferTimeoutError if they were caused by transferDeadline
+func (c *Conn) checkTransferDeadline(transferDeadline time.Time, err error) error {
+	if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() || transferDeadline.IsZero() {
+		return err
+	}
+	if time.Now().Before(transferDeadline) {
+		return err
+	}
+	return &TransferTimeoutError{c.transferTimeout}
 }
 
 func (c *Conn) RenewWriteDeadline() error {
@@ -97,7 +159,7 @@ restart:
 	var nCurRead int
 	nCurRead, err = c.Wire.Read(p[n:])
 	n += nCurRead
-	if netErr, ok := err.(net.Error); ok && netErr.Timeout() && nCurRead > 0 {
+	if readProgressedBeforeTimeout(int64(nCurRead), err) {
 		err = nil
 		goto restart
 	}
@@ -163,9 +225,8 @@ func buildIovecs(buffers net.Buffers) (totalLen int64, vecs []syscall.Iovec) {
 			continue
 		}
 
-		v := syscall.Iovec{
-			Base: &buffers[i][0],
-		}
+		var v syscall.Iovec
+		iovecSetBase(&v, &buffers[i][0])
 		// syscall.Iovec.Len has platform-dependent size, thus use SetLen
 		v.SetLen(len(buffers[i]))
 
@@ -183,41 +244,49 @@ func buildIovecs(buffers net.Buffers) (totalLen int64, vecs []syscall.Iovec) {
 // If the connection returned io.EOF, the number of bytes up ritten until
 // then + io.EOF is returned. This behavior is different to io.ReadFull
 // which returns io.ErrUnexpectedEOF.
+//
+// The idle timeout is renewed whenever bytes are read. See WithTransferTimeout
+// for limiting the total duration of the call.
 func (c Conn) ReadvFull(buffers net.Buffers) (n int64, err error) {
 	totalLen, iovecs := buildIovecs(buffers)
 	if debugReadvNoShortReadsAssertEnable {
 		defer debugReadvNoShortReadsAssert(totalLen, n, err)
 	}
+	transferDeadline := c.transferDeadline()
+	defer func() {
+		err = c.checkTransferDeadline(transferDeadline, err)
+	}()
 	scc, ok := c.Wire.(SyscallConner)
 	if !ok {
-		return c.readvFallback(buffers)
+		return c.readvFallback(buffers, transferDeadline)
 	}
 	raw, err := scc.SyscallConn()
 	if err == SyscallConnNotSupported {
-		return c.readvFallback(buffers)
+		return c.readvFallback(buffers, transferDeadline)
 	}
 	if err != nil {
 		return 0, err
 	}
-	n, err = c.readv(raw, iovecs)
+	n, err = c.readv(raw, iovecs, transferDeadline)
 	return
 }
 
-func (c Conn) readvFallback(nbuffers net.Buffers) (n int64, err error) {
+func (c Conn) readvFallback(nbuffers net.Buffers, transferDeadline time.Time) (n int64, err error) {
 	buffers := [][]byte(nbuffers)
 	for i := range buffers {
 		curBuf := buffers[i]
 	inner:
 		for len(curBuf) > 0 {
-			if err := c.renewReadDeadline(); err != nil {
+			if err := c.renewReadDeadlineBefore(transferDeadline); err != nil {
 				return n, err
 			}
 			var oneN int
-			oneN, err = c.Read(curBuf[:]) // WE WANT NO SHADOWING
+			// not c.Read, it would renew the deadline past transferDeadline
+			oneN, err = c.Wire.Read(curBuf[:]) // WE WANT NO SHADOWING
 			curBuf = curBuf[oneN:]
 			n += int64(oneN)
 			if err != nil {
-				if netErr, ok := err.(net.Error); ok && netErr.Timeout() && oneN > 0 {
+				if readProgressedBeforeTimeout(int64(oneN), err) {
 					continue inner
 				}
 				return n, err
@@ -227,16 +296,16 @@ func (c Conn) readvFallback(nbuffers net.Buffers) (n int64, err error) {
 	return n, nil
 }
 
-func (c Conn) readv(rawConn syscall.RawConn, iovecs []syscall.Iovec) (n int64, err error) {
+func (c Conn) readv(rawConn syscall.RawConn, iovecs []syscall.Iovec, transferDeadline time.Time) (n int64, err error) {
 	for len(iovecs) > 0 {
-		if err := c.renewReadDeadline(); err != nil {
+		if err := c.renewReadDeadlineBefore(transferDeadline); err != nil {
 			return n, err
 		}
 		oneN, oneErr := c.doOneReadv(rawConn, &iovecs)
 		n += oneN
-		if netErr, ok := oneErr.(net.Error); ok && netErr.Timeout() && oneN > 0 { // TODO likely not working
+		if oneErr == nil && oneN > 0 {
 			continue
-		} else if oneErr == nil && oneN > 0 {
+		} else if readProgressedBeforeTimeout(oneN, oneErr) {
 			continue
 		} else {
 			return n, oneErr
@@ -245,23 +314,25 @@ func (c Conn) readv(rawConn syscall.RawConn, iovecs []syscall.Iovec) (n int64, e
 	return n, nil
 }
 
+// readProgressedBeforeTimeout reports whether a read that returned err
+// has transferred n > 0 bytes before running into the read deadline.
+// That's forward progress: the caller must renew the idle deadline and continue
+// reading instead of returning the timeout error.
+// Renewing must happen before the next read, otherwise that read fails
+// immediately because the deadline is already in the past.
+func readProgressedBeforeTimeout(n int64, err error) bool {
+	if n <= 0 {
+		return false
+	}
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
+
 func (c Conn) doOneReadv(rawConn syscall.RawConn, iovecs *[]syscall.Iovec) (n int64, err error) {
 	rawReadErr := rawConn.Read(func(fd uintptr) (done bool) {
 		// iovecs, n and err must not be shadowed!
 
-		// NOTE: unsafe.Pointer safety rules
-		// 		https://tip.golang.org/pkg/unsafe/#Pointer
-		//
-		//		(4) Conversion of a Pointer to a uintptr when calling syscall.Syscall.
-		// 		...
-		//		uintptr() conversions must appear within the syscall.Syscall argument list.
-		//      (even though we are not the escape analysis Likely not )
-		thisReadN, _, errno := syscall.Syscall(
-			syscall.SYS_READV,
-			fd,
-			uintptr(unsafe.Pointer(&(*iovecs)[0])),
-			uintptr(len(*iovecs)),
-		)
+		thisReadN, errno := readvSyscall(fd, *iovecs)
 		if thisReadN == ^uintptr(0) {
 			if errno == syscall.EAGAIN {
 				return false
@@ -287,14 +358,7 @@ func (c Conn) doOneReadv(rawConn syscall.RawConn, iovecs *[]syscall.Iovec) (n in
 				*iovecs = (*iovecs)[1:]
 			} else {
 				// trim this iovec to remaining length
-
-				// NOTE: unsafe.Pointer safety rules
-				// 		https://tip.golang.org/pkg/unsafe/#Pointer
-				// 		(3) Conversion of a Pointer to a uintptr and back, with arithmetic.
-				// 		...
-				//		Note that both conversions must appear in the same expression,
-				//		with only the intervening arithmetic between them:
-				(*iovecs)[0].Base = (*byte)(unsafe.Pointer(uintptr(unsafe.Pointer((*iovecs)[0].Base)) + uintptr(left)))
+				iovecAdvanceBase(&(*iovecs)[0], left)
 				curVecNewLength := uint((*iovecs)[0].Len) - uint(left) // casts to uint do not change value
 				(*iovecs)[0].SetLen(int(curVecNewLength))              // int and uint have the same size, no change of value
 
@@ -0,0 +1,23 @@
+// +build !solaris
+
+package timeoutconn
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+func iovecSetBase(v *syscall.Iovec, base *byte) {
+	v.Base = base
+}
+
+// iovecAdvanceBase moves the start of v forward by n bytes, it does not change v.Len.
+func iovecAdvanceBase(v *syscall.Iovec, n int) {
+	// NOTE: unsafe.Pointer safety rules
+	// 		https://tip.golang.org/pkg/unsafe/#Pointer
+	// 		(3) Conversion of a Pointer to a uintptr and back, with arithmetic.
+	// 		...
+	//		Note that both conversions must appear in the same expression,
+	//		with only the intervening arithmetic between them:
+	v.Base = (*byte)(unsafe.Pointer(uintptr(unsafe.Pointer(v.Base)) + uintptr(n)))
+}
@@ -0,0 +1,20 @@
+// +build solaris
+
+package timeoutconn
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// On Solaris and illumos, syscall.Iovec.Base is an *int8.
+
+func iovecSetBase(v *syscall.Iovec, base *byte) {
+	v.Base = (*int8)(unsafe.Pointer(base))
+}
+
+// iovecAdvanceBase moves the start of v forward by n bytes, it does not change v.Len.
+func iovecAdvanceBase(v *syscall.Iovec, n int) {
+	// NOTE: unsafe.Pointer safety rules: see timeoutconn_iovec_byte.go
+	v.Base = (*int8)(unsafe.Pointer(uintptr(unsafe.Pointer(v.Base)) + uintptr(n)))
+}
@@ -0,0 +1,31 @@
+package timeoutconn
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// Go's syscall package does not provide SYS_READV on Solaris and illumos,
+// system calls go through libc instead.
+// This mirrors what golang.org/x/sys/unix does for its libc wrappers.
+
+//go:cgo_import_dynamic libc_readv readv "libc.so"
+
+//go:linkname procreadv libc_readv
+var procreadv uintptr
+
+// implemented in timeoutconn_solaris_amd64.s
+func sysvicall6(trap, nargs, a1, a2, a3, a4, a5, a6 uintptr) (r1, r2 uintptr, err syscall.Errno)
+
+// readvSyscall returns ^uintptr(0) and the errno on error.
+func readvSyscall(fd uintptr, iovecs []syscall.Iovec) (n uintptr, errno syscall.Errno) {
+	n, _, errno = sysvicall6(
+		uintptr(unsafe.Pointer(&procreadv)),
+		3,
+		fd,
+		uintptr(unsafe.Pointer(&iovecs[0])),
+		uintptr(len(iovecs)),
+		0, 0, 0,
+	)
+	return n, errno
+}
@@ -0,0 +1,26 @@
+// +build !solaris
+
+package timeoutconn
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// readvSyscall returns ^uintptr(0) and the errno on error.
+func readvSyscall(fd uintptr, iovecs []syscall.Iovec) (n uintptr, errno syscall.Errno) {
+	// NOTE: unsafe.Pointer safety rules
+	// 		https://tip.golang.org/pkg/unsafe/#Pointer
+	//
+	//		(4) Conversion of a Pointer to a uintptr when calling syscall.Syscall.
+	// 		...
+	//		uintptr() conversions must appear within the syscall.Syscall argument list.
+	//      (even though we are not the escape analysis Likely not )
+	n, _, errno = syscall.Syscall(
+		syscall.SYS_READV,
+		fd,
+		uintptr(unsafe.Pointer(&iovecs[0])),
+		uintptr(len(iovecs)),
+	)
+	return n, errno
+}
@@ -189,3 +189,171 @@ func TestIovecLenFieldIsMachineUint(t *testing.T) {
 	// ssize_t is defined to be the signed version of size_t,
 	// so we know sizeof(ssize_t) == sizeof(int)
 }
+
+// writes chunks of 4 bytes to w with the given gap between them
+// stops at the first error, e.g., if the test has closed w
+func writeChunksWithGaps(w io.Writer, chunks int, gap time.Duration) {
+	for i := 0; i < chunks; i++ {
+		time.Sleep(gap)
+		if _, err := w.Write([]byte{byte(i), byte(i), byte(i), byte(i)}); err != nil {
+			return
+		}
+	}
+}
+
+func TestReadvFullWithIdleTimeout(t *testing.T) {
+	a, b, err := socketpair.SocketPair()
+	require.NoError(t, err)
+	defer a.Close()
+	defer b.Close()
+
+	const chunks = 5
+	go writeChunksWithGaps(a, chunks, 50*time.Millisecond)
+
+	// the per-call idle timeout overrides the one passed to Wrap,
+	// and the transfer takes longer than the idle timeout
+	conn := Wrap(b, 10*time.Millisecond).WithIdleTimeout(100 * time.Millisecond)
+	bufs := net.Buffers{make([]byte, 2*4), make([]byte, (chunks-2)*4)}
+	n, err := conn.ReadvFull(bufs)
+	require.NoError(t, err)
+	assert.Equal(t, int64(chunks*4), n)
+}
+
+func TestReadvFullWithTransferTimeout(t *testing.T) {
+	a, b, err := socketpair.SocketPair()
+	require.NoError(t, err)
+	defer a.Close()
+	defer b.Close()
+
+	const chunks = 5
+	go writeChunksWithGaps(a, chunks, 50*time.Millisecond)
+
+	conn := Wrap(b, 100*time.Millisecond).WithTransferTimeout(120 * time.Millisecond)
+	bufs := net.Buffers{make([]byte, chunks*4)}
+	begin := time.Now()
+	n, err := conn.ReadvFull(bufs)
+	d := time.Since(begin)
+	assert.True(t, n > 0 && n < chunks*4, "n=%v", n)
+	_, ok := err.(*TransferTimeoutError)
+	require.True(t, ok, "%T %s", err, err)
+	assert.True(t, err.(net.Error).Timeout())
+	assert.True(t, d < 200*time.Millisecond, "%s", d)
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// chunkedWire is a Wire that delivers chunks with a gap between them and honors the read deadline.
+// Every read that delivers data also returns a timeout error,
+// i.e., it simulates the deadline passing right after the data arrived.
+// chunkedWire does not implement SyscallConner, thus ReadvFull uses the fallback implementation.
+type chunkedWire struct {
+	net.Conn // to satisfy interface
+	chunks   [][]byte
+	gap      time.Duration
+	deadline time.Time
+}
+
+func (w *chunkedWire) SetReadDeadline(t time.Time) error {
+	w.deadline = t
+	return nil
+}
+
+func (w *chunkedWire) Read(p []byte) (int, error) {
+	if len(w.chunks) == 0 {
+		return 0, io.EOF
+	}
+	if !w.deadline.IsZero() && time.Until(w.deadline) < w.gap {
+		time.Sleep(time.Until(w.deadline))
+		return 0, timeoutError{}
+	}
+	time.Sleep(w.gap)
+	n := copy(p, w.chunks[0])
+	w.chunks[0] = w.chunks[0][n:]
+	if len(w.chunks[0]) == 0 {
+		w.chunks = w.chunks[1:]
+	}
+	return n, timeoutError{}
+}
+
+func (w *chunkedWire) CloseWrite() error { return nil }
+
+func TestReadvFullPartialProgressRenewsIdleDeadline(t *testing.T) {
+	w := &chunkedWire{
+		chunks: [][]byte{{1, 2}, {3, 4, 5}, {6}, {7, 8}, {9, 10}},
+		gap:    30 * time.Millisecond,
+	}
+	// the transfer takes ~150ms, but no gap exceeds the idle timeout
+	conn := Wrap(w, 50*time.Millisecond)
+	bufs := net.Buffers{make([]byte, 4), make([]byte, 6)}
+	n, err := conn.ReadvFull(bufs)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), n)
+	assert.Equal(t, net.Buffers{{1, 2, 3, 4}, {5, 6, 7, 8, 9, 10}}, bufs)
+}
+
+func TestReadvFullNoProgressTimesOut(t *testing.T) {
+	w := &chunkedWire{
+		chunks: [][]byte{{1, 2}, {3, 4}},
+		gap:    100 * time.Millisecond,
+	}
+	conn := Wrap(w, 50*time.Millisecond)
+	n, err := conn.ReadvFull(net.Buffers{make([]byte, 4)})
+	assert.Equal(t, int64(0), n)
+	netErr, ok := err.(net.Error)
+	require.True(t, ok, "%T %s", err, err)
+	assert.True(t, netErr.Timeout())
+}
+
+// deadlineAfterReadWire exercises the readv implementation on a real socket,
+// but its RawConn reports a timeout after every successful read callback,
+// i.e., it simulates the deadline passing right after readv returned data.
+type deadlineAfterReadWire struct {
+	*net.UnixConn
+	timeouts *int
+}
+
+func (w deadlineAfterReadWire) SyscallConn() (syscall.RawConn, error) {
+	raw, err := w.UnixConn.SyscallConn()
+	return deadlineAfterReadRawConn{raw, w.timeouts}, err
+}
+
+type deadlineAfterReadRawConn struct {
+	syscall.RawConn
+	timeouts *int
+}
+
+func (c deadlineAfterReadRawConn) Read(f func(fd uintptr) (done bool)) error {
+	if err := c.RawConn.Read(f); err != nil {
+		return err
+	}
+	*c.timeouts++
+	return timeoutError{}
+}
+
+func TestReadvFullSyscallPartialProgressRenewsIdleDeadline(t *testing.T) {
+	a, b, err := socketpair.SocketPair()
+	require.NoError(t, err)
+	defer a.Close()
+	defer b.Close()
+
+	const chunks = 5
+	go writeChunksWithGaps(a, chunks, 30*time.Millisecond)
+
+	// the transfer takes ~150ms, but no gap exceeds the idle timeout
+	var timeouts int
+	conn := Wrap(deadlineAfterReadWire{b, &timeouts}, 50*time.Millisecond)
+	bufs := net.Buffers{make([]byte, 2*4), make([]byte, (chunks-2)*4)}
+	n, err := conn.ReadvFull(bufs)
+	require.NoError(t, err)
+	assert.Equal(t, int64(chunks*4), n)
+	assert.True(t, timeouts > 0)
+	var expected []byte
+	for i := 0; i < chunks; i++ {
+		expected = append(expected, byte(i), byte(i), byte(i), byte(i))
+	}
+	assert.Equal(t, expected, append(bufs[0], bufs[1]...))
+}
@@ -29,6 +29,16 @@ func (s *S) Acquire(ctx context.Context) (*AcquireGuard, error) {
 	return &AcquireGuard{s, false}, nil
 }
 
+// TryAcquire acquires the semaphore without blocking.
+// It returns false if the semaphore is already held by max acquirers.
+// The returned AcquireGuard is not goroutine-safe.
+func (s *S) TryAcquire() (*AcquireGuard, bool) {
+	if !s.ws.TryAcquire(1) {
+		return nil, false
+	}
+	return &AcquireGuard{s, false}, true
+}
+
 func (g *AcquireGuard) Release() {
 	if g == nil || g.released {
 		return
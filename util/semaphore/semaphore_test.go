@@ -47,3 +47,17 @@ func TestSemaphore(t *testing.T) {
 	assert.True(t, aquisitions.afterT == numGoroutines-concurrentSemaphore)
 
 }
+
+func TestSemaphoreTryAcquire(t *testing.T) {
+	sem := New(1)
+
+	g, ok := sem.TryAcquire()
+	require.True(t, ok)
+	_, ok = sem.TryAcquire()
+	assert.False(t, ok)
+
+	g.Release()
+	g2, ok := sem.TryAcquire()
+	require.True(t, ok)
+	g2.Release()
+}
@@ -0,0 +1,74 @@
+package zfs
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/zrepl/zrepl/util/envconst"
+)
+
+var bookmarkCopySupport cachedProbe
+
+// BookmarkCopySupported reports whether the zfs binary can create a bookmark from
+// an existing bookmark (`zfs bookmark fs#a fs#b`).
+// The result of a successful feature check is cached for the lifetime of the process,
+// a failed check is retried on the next call.
+func BookmarkCopySupported(ctx context.Context) (bool, error) {
+	return bookmarkCopySupport.get(nil, func() (bool, error) {
+		// "feature discovery": the usage text of versions that support it
+		// lists <snapshot|bookmark> as the source argument
+		cmd := exec.CommandContext(ctx, ZFS_BINARY, "bookmark")
+		output, err := cmd.CombinedOutput()
+		if _, ok := err.(*exec.ExitError); err != nil && !ok {
+			debug("bookmark copy feature check failed: %T %s", err, err)
+			return false, err
+		}
+		def := strings.Contains(string(output), "<snapshot|bookmark>")
+		supported := envconst.Bool("ZREPL_EXPERIMENTAL_ZFS_BOOKMARK_COPY_SUPPORTED", def)
+		debug("bookmark copy feature check complete: supported=%v", supported)
+		return supported, nil
+	})
+}
+
+type BookmarkCopyNotSupportedError struct {
+	Source, Bookmark string
+}
+
+func (e *BookmarkCopyNotSupportedError) Error() string {
+	return fmt.Sprintf("cannot create bookmark %q from bookmark %q: this version of ZFS does not support bookmark copying", e.Bookmark, e.Source)
+}
+
+// ZFSBookmarkFromBookmark creates bookmark fs#bookmark from the existing bookmark fs#source.
+// source may be given with or without the '#' prefix.
+//
+// The new bookmark refers to the same snapshot as source, which allows advancing
+// bookmark-based state (e.g. a replication cursor) after the snapshot was destroyed.
+//
+// Returns *BookmarkCopyNotSupportedError if the zfs binary does not support bookmark copying,
+// so that callers can fall back to bookmarking a snapshot.
+func ZFSBookmarkFromBookmark(ctx context.Context, fs *DatasetPath, source, bookmark string) error {
+	source = strings.TrimPrefix(source, "#")
+	if source == "" || bookmark == "" {
+		return fmt.Errorf("bookmark: source and target bookmark names must not be empty")
+	}
+
+	supported, err := BookmarkCopySupported(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot determine bookmark copy support: %s", err)
+	}
+	if !supported {
+		return &BookmarkCopyNotSupportedError{
+			Source:   zfsBuildBookmarkName(fs, source),
+			Bookmark: zfsBuildBookmarkName(fs, bookmark),
+		}
+	}
+
+	promTimer := prometheus.NewTimer(prom.ZFSBookmarkDuration.WithLabelValues(fs.ToString()))
+	defer promTimer.ObserveDuration()
+
+	return zfsBookmark(ctx, zfsBuildBookmarkName(fs, source), zfsBuildBookmarkName(fs, bookmark))
+}
@@ -0,0 +1,60 @@
+package zfs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func resetBookmarkCopySupport() {
+	bookmarkCopySupport.invalidate(nil)
+}
+
+func TestZFSBookmarkFromBookmark(t *testing.T) {
+	defer resetBookmarkCopySupport()
+
+	dir, err := ioutil.TempDir("", "zrepl-zfs-test-bookmark-copy")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+
+	defer withFakeZFSBinary(t, `
+if [ $# -eq 1 ]; then
+	echo "usage:" >&2
+	echo "	bookmark <snapshot|bookmark> <newbookmark>" >&2
+	exit 2
+fi
+echo "$@" > `+out+"\n")()
+
+	fs, err := NewDatasetPath("pool/fs")
+	require.NoError(t, err)
+	require.NoError(t, ZFSBookmarkFromBookmark(context.Background(), fs, "#zrepl_replication_cursor", "new"))
+	args, err := ioutil.ReadFile(out)
+	require.NoError(t, err)
+	assert.Equal(t, "bookmark pool/fs#zrepl_replication_cursor pool/fs#new\n", string(args))
+}
+
+func TestZFSBookmarkFromBookmarkNotSupported(t *testing.T) {
+	defer resetBookmarkCopySupport()
+
+	defer withFakeZFSBinary(t, `
+if [ $# -eq 1 ]; then
+	echo "usage:" >&2
+	echo "	bookmark <snapshot> <bookmark>" >&2
+	exit 2
+fi
+echo "must not be called" >&2
+exit 1
+`)()
+
+	fs, err := NewDatasetPath("pool/fs")
+	require.NoError(t, err)
+	err = ZFSBookmarkFromBookmark(context.Background(), fs, "a", "b")
+	_, ok := err.(*BookmarkCopyNotSupportedError)
+	assert.True(t, ok, "%T %s", err, err)
+}
@@ -0,0 +1,44 @@
+package zfs
+
+import "sync"
+
+// cachedProbe caches the results of feature probes, keyed by what was probed
+// (e.g. nil for a property of the zfs binary, a pool name for pool features).
+//
+// A successful result is cached until it is invalidated,
+// a failed probe is not cached and thus retried on the next call.
+type cachedProbe struct {
+	mtx sync.Mutex
+	m   map[interface{}]bool
+}
+
+// get returns the cached result for key or runs probe to determine it.
+// Concurrent calls are serialized so that each key is probed at most once at a time.
+func (c *cachedProbe) get(key interface{}, probe func() (bool, error)) (bool, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if v, ok := c.m[key]; ok {
+		return v, nil
+	}
+	v, err := probe()
+	if err != nil {
+		return false, err
+	}
+	if c.m == nil {
+		c.m = make(map[interface{}]bool)
+	}
+	c.m[key] = v
+	return v, nil
+}
+
+// invalidate drops the cached results of all keys for which match returns true,
+// or all cached results if match is nil.
+func (c *cachedProbe) invalidate(match func(key interface{}) bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for k := range c.m {
+		if match == nil || match(k) {
+			delete(c.m, k)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package zfs
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachedProbe(t *testing.T) {
+	var c cachedProbe
+	probes := 0
+	probe := func(v bool, err error) func() (bool, error) {
+		return func() (bool, error) {
+			probes++
+			return v, err
+		}
+	}
+
+	// failed probes are not cached
+	_, err := c.get("a", probe(true, fmt.Errorf("probe failed")))
+	require.Error(t, err)
+	v, err := c.get("a", probe(true, nil))
+	require.NoError(t, err)
+	assert.True(t, v)
+	assert.Equal(t, 2, probes)
+
+	// successful probes are cached per key
+	v, err = c.get("a", probe(false, nil))
+	require.NoError(t, err)
+	assert.True(t, v)
+	v, err = c.get("b", probe(false, nil))
+	require.NoError(t, err)
+	assert.False(t, v)
+	assert.Equal(t, 3, probes)
+
+	c.invalidate(func(key interface{}) bool { return key == "a" })
+	v, err = c.get("a", probe(false, nil))
+	require.NoError(t, err)
+	assert.False(t, v)
+	v, err = c.get("b", probe(true, nil))
+	require.NoError(t, err)
+	assert.False(t, v)
+	assert.Equal(t, 4, probes)
+
+	c.invalidate(nil)
+	c.get("a", probe(true, nil))
+	c.get("b", probe(true, nil))
+	assert.Equal(t, 6, probes)
+}
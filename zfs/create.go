@@ -0,0 +1,79 @@
+package zfs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+)
+
+type DatasetAlreadyExistsError struct {
+	Path string
+}
+
+func (e *DatasetAlreadyExistsError) Error() string {
+	return fmt.Sprintf("cannot create %q: dataset already exists", e.Path)
+}
+
+var zfsCreateDatasetExistsRegexp = regexp.MustCompile(`^cannot create '([^']+)': dataset already exists`)
+
+// ZFSCreate creates filesystem fs (`zfs create`), e.g. to pre-provision a receive target
+// with properties that can only be set at creation time (such as encryption).
+//
+// props may be nil. If createParents is true, missing parent filesystems are created (`-p`).
+// Returns *DatasetAlreadyExistsError if fs already exists.
+func ZFSCreate(ctx context.Context, fs *DatasetPath, props *ZFSProperties, createParents bool) error {
+	args := []string{"create"}
+	if createParents {
+		args = append(args, "-p")
+	}
+	return zfsCreate(ctx, fs, props, args)
+}
+
+// ZFSCreateVolume creates volume fs of size bytes (`zfs create -V size`).
+// If sparse is true, no reservation is made for the volume (`-s`).
+//
+// props may be nil.
+// Returns *DatasetAlreadyExistsError if fs already exists.
+func ZFSCreateVolume(ctx context.Context, fs *DatasetPath, size uint64, props *ZFSProperties, sparse bool) error {
+	if size == 0 {
+		return fmt.Errorf("cannot create volume %q: size must be greater than 0", fs.ToString())
+	}
+	args := []string{"create"}
+	if sparse {
+		args = append(args, "-s")
+	}
+	args = append(args, "-V", strconv.FormatUint(size, 10))
+	return zfsCreate(ctx, fs, props, args)
+}
+
+func zfsCreate(ctx context.Context, fs *DatasetPath, props *ZFSProperties, args []string) error {
+	if fs.Length() <= 1 {
+		return fmt.Errorf("cannot create %q: pools cannot be created with zfs create", fs.ToString())
+	}
+	if err := fs.ValidateLength(); err != nil {
+		return err
+	}
+	if props != nil {
+		if err := props.appendOptionArgs(&args); err != nil {
+			return err
+		}
+	}
+	args = append(args, fs.ToString())
+
+	cmd := exec.CommandContext(ctx, ZFS_BINARY, args...)
+	stderr := bytes.NewBuffer(make([]byte, 0, 1024))
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		if sm := zfsCreateDatasetExistsRegexp.FindSubmatch(stderr.Bytes()); sm != nil && string(sm[1]) == fs.ToString() {
+			return &DatasetAlreadyExistsError{fs.ToString()}
+		}
+		return &ZFSError{
+			Stderr:  stderr.Bytes(),
+			WaitErr: err,
+		}
+	}
+	return nil
+}
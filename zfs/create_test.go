@@ -0,0 +1,44 @@
+package zfs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZFSCreate(t *testing.T) {
+	defer withFakeZFSBinary(t, `
+case "$*" in
+"create -p -o compression=lz4 -o recordsize=1048576 pool/a/b") ;;
+"create pool/plain") ;;
+"create -s -V 8388608 -o volblocksize=16384 pool/vol") ;;
+"create -V 4096 pool/vol2") ;;
+"create pool/exists") echo "cannot create 'pool/exists': dataset already exists" >&2; exit 1;;
+*) echo "unexpected: $*" >&2; exit 23;;
+esac
+`)()
+	ctx := context.Background()
+
+	props := NewZFSProperties()
+	props.Set("recordsize", "1048576")
+	props.Set("compression", "lz4")
+	require.NoError(t, ZFSCreate(ctx, toDatasetPath("pool/a/b"), props, true))
+	require.NoError(t, ZFSCreate(ctx, toDatasetPath("pool/plain"), nil, false))
+
+	err := ZFSCreate(ctx, toDatasetPath("pool/exists"), nil, false)
+	eerr, ok := err.(*DatasetAlreadyExistsError)
+	require.True(t, ok, "%T %s", err, err)
+	assert.Equal(t, "pool/exists", eerr.Path)
+
+	_, ok = ZFSCreate(ctx, toDatasetPath("pool/other"), nil, false).(*ZFSError)
+	assert.True(t, ok)
+	assert.Error(t, ZFSCreate(ctx, toDatasetPath("pool"), nil, false))
+
+	volProps := NewZFSProperties()
+	volProps.Set("volblocksize", "16384")
+	require.NoError(t, ZFSCreateVolume(ctx, toDatasetPath("pool/vol"), 8<<20, volProps, true))
+	require.NoError(t, ZFSCreateVolume(ctx, toDatasetPath("pool/vol2"), 4096, nil, false))
+	assert.Error(t, ZFSCreateVolume(ctx, toDatasetPath("pool/vol3"), 0, nil, false))
+}
@@ -49,6 +49,16 @@ func (f *DatasetPathForest) WalkTopDown(visitor DatasetPathsVisitor) {
 
 }
 
+// Traverse a list of DatasetPaths, visiting only terminal nodes, i.e. those without children.
+// Datasets that are a prefix of another dataset in the forest (e.g. a/b if a/b/c was added)
+// are not visited, nor are the gaps filled in by WalkTopDown.
+// Leaves are visited in the same order as by WalkTopDown.
+func (f *DatasetPathForest) WalkLeaves(visitor func(v DatasetPathVisit)) {
+	for _, r := range f.roots {
+		r.WalkLeaves([]string{}, visitor)
+	}
+}
+
 /* PRIVATE IMPLEMENTATION */
 
 type datasetPathTree struct {
@@ -106,6 +116,26 @@ func (t *datasetPathTree) WalkTopDown(parent []string, visitor DatasetPathsVisit
 
 }
 
+func (t *datasetPathTree) WalkLeaves(parent []string, visitor func(v DatasetPathVisit)) {
+
+	this := make([]string, len(parent)+1)
+	copy(this, parent)
+	this[len(parent)] = t.Component
+
+	if len(t.Children) == 0 {
+		visitor(DatasetPathVisit{
+			&DatasetPath{this},
+			t.FilledIn,
+		})
+		return
+	}
+
+	for _, c := range t.Children {
+		c.WalkLeaves(this, visitor)
+	}
+
+}
+
 func newDatasetPathTree(initialComps []string) (t *datasetPathTree) {
 	t = &datasetPathTree{}
 	cur := t
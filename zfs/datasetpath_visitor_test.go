@@ -94,3 +94,29 @@ func TestDatasetPathWalkTopDownWorksUnordered(t *testing.T) {
 	assert.Equal(t, expectedVisists, rec.visits)
 
 }
+
+func TestDatasetPathForestWalkLeaves(t *testing.T) {
+
+	paths := []*DatasetPath{
+		toDatasetPath("pool1"),
+		toDatasetPath("pool1/foo/bar"),
+		toDatasetPath("pool1/foo/bar/looloo"),
+		toDatasetPath("pool1/foo/baz"),
+		toDatasetPath("pool1/foo/bar/lalala"),
+		toDatasetPath("pool2/test/bar"),
+	}
+
+	var visits []DatasetPathVisit
+	buildForest(paths).WalkLeaves(func(v DatasetPathVisit) {
+		visits = append(visits, v)
+	})
+
+	expectedVisists := []DatasetPathVisit{
+		{toDatasetPath("pool1/foo/bar/looloo"), false},
+		{toDatasetPath("pool1/foo/bar/lalala"), false},
+		{toDatasetPath("pool1/foo/baz"), false},
+		{toDatasetPath("pool2/test/bar"), false},
+	}
+	assert.Equal(t, expectedVisists, visits)
+
+}
@@ -0,0 +1,410 @@
+package zfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/zrepl/zrepl/util/envconst"
+)
+
+var encryptionCLISupport cachedProbe
+
+// EncryptionCLISupported reports whether the zfs binary supports native encryption,
+// i.e., has the load-key / unload-key subcommands.
+// The result of a successful feature check is cached for the lifetime of the process,
+// a failed check is retried on the next call.
+func EncryptionCLISupported(ctx context.Context) (bool, error) {
+	return encryptionCLISupport.get(nil, func() (bool, error) {
+		// "feature discovery"
+		cmd := exec.CommandContext(ctx, ZFS_BINARY, "load-key")
+		output, err := cmd.CombinedOutput()
+		if _, ok := err.(*exec.ExitError); err != nil && !ok {
+			debug("encryption cli feature check failed: %T %s", err, err)
+			return false, err
+		}
+		def := strings.Contains(string(output), "load-key") && strings.Contains(string(output), "keylocation")
+		supported := envconst.Bool("ZREPL_EXPERIMENTAL_ZFS_ENCRYPTION_CLI_SUPPORTED", def)
+		debug("encryption cli feature check complete: supported=%v", supported)
+		return supported, nil
+	})
+}
+
+type EncryptionCLINotSupportedError struct {
+	Subcommand string
+}
+
+func (e *EncryptionCLINotSupportedError) Error() string {
+	return fmt.Sprintf("zfs %s: this version of ZFS does not support native encryption", e.Subcommand)
+}
+
+func requireEncryptionCLISupport(ctx context.Context, subcommand string) error {
+	supported, err := EncryptionCLISupported(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot determine encryption support: %s", err)
+	}
+	if !supported {
+		return &EncryptionCLINotSupportedError{subcommand}
+	}
+	return nil
+}
+
+// ZFSGetEncryptionEnabled reports whether fs is an encrypted dataset.
+func ZFSGetEncryptionEnabled(ctx context.Context, fs string) (enabled bool, err error) {
+	if err := requireEncryptionCLISupport(ctx, "get encryption"); err != nil {
+		return false, err
+	}
+	if err := validateZFSFilesystem(fs); err != nil {
+		return false, err
+	}
+	props, err := zfsGet(ctx, fs, []string{"encryption"}, sourceAny)
+	if err != nil {
+		return false, err
+	}
+	val := props.Get("encryption")
+	switch val {
+	case "":
+		return false, fmt.Errorf("zfs get did not return a value for property %q", "encryption")
+	case "off", "-":
+		return false, nil
+	default:
+		return true, nil
+	}
+}
+
+// ZFSGetEncryptionEnabledMulti is like ZFSGetEncryptionEnabled for all of fss,
+// but uses a single `zfs get` invocation.
+// The returned map contains an entry for each filesystem in fss.
+func ZFSGetEncryptionEnabledMulti(ctx context.Context, fss []string) (map[string]bool, error) {
+	if err := requireEncryptionCLISupport(ctx, "get encryption"); err != nil {
+		return nil, err
+	}
+	if len(fss) == 0 {
+		return map[string]bool{}, nil
+	}
+	for _, fs := range fss {
+		if err := validateZFSFilesystem(fs); err != nil {
+			return nil, err
+		}
+	}
+
+	args := []string{"get", "-H", "-p", "-o", "name,value", "encryption"}
+	args = append(args, fss...)
+	guard, err := acquireZFSListGetSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, ZFS_BINARY, args...)
+	stderr := bytes.NewBuffer(make([]byte, 0, 1024))
+	cmd.Stderr = stderr
+	stdout, err := cmd.Output()
+	guard.Release()
+	if err != nil {
+		if sm := zfsGetDatasetDoesNotExistRegexp.FindSubmatch(stderr.Bytes()); sm != nil {
+			return nil, &DatasetDoesNotExist{string(sm[1])}
+		}
+		return nil, &ZFSError{
+			Stderr:  stderr.Bytes(),
+			WaitErr: err,
+		}
+	}
+	return parseEncryptionEnabledMulti(fss, stdout)
+}
+
+// output of `zfs get -H -p -o name,value encryption` looks like this (tab-separated):
+//   pool/plain	off
+//   pool/enc	aes-256-gcm
+func parseEncryptionEnabledMulti(fss []string, output []byte) (map[string]bool, error) {
+	res := make(map[string]bool, len(fss))
+	s := bufio.NewScanner(bytes.NewReader(output))
+	for s.Scan() {
+		fields := strings.Split(s.Text(), "\t")
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("zfs get: unexpected output line %q", s.Text())
+		}
+		res[fields[0]] = fields[1] != "off" && fields[1] != "-"
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	for _, fs := range fss {
+		if _, ok := res[fs]; !ok {
+			return nil, fmt.Errorf("zfs get did not return encryption property for %q", fs)
+		}
+	}
+	return res, nil
+}
+
+// KeyAlreadyLoaded is returned by ZFSLoadKey if the key of the filesystem
+// had already been loaded. Callers that only need the key to be available
+// can treat it as success.
+type KeyAlreadyLoaded struct {
+	Filesystem string
+}
+
+func (e *KeyAlreadyLoaded) Error() string {
+	return fmt.Sprintf("key for %q is already loaded", e.Filesystem)
+}
+
+const KeyLocationPrompt = "prompt"
+
+var zfsLoadKeyAlreadyLoadedRegexp = regexp.MustCompile(`Key already loaded for '([^']+)'`)
+
+// ZFSLoadKey loads the encryption key of fs (`zfs load-key`).
+//
+// If keylocation is "", the keylocation property of fs is used,
+// otherwise it is passed to `zfs load-key -L`.
+// If keylocation is KeyLocationPrompt, the passphrase is read from stdinKey.
+// (stdinKey is ignored for all other key locations.)
+//
+// Returns *KeyAlreadyLoaded if the key was already loaded.
+func ZFSLoadKey(ctx context.Context, fs string, keylocation string, stdinKey io.Reader) error {
+	if err := requireEncryptionCLISupport(ctx, "load-key"); err != nil {
+		return err
+	}
+	if err := validateZFSFilesystem(fs); err != nil {
+		return err
+	}
+	if keylocation == KeyLocationPrompt && stdinKey == nil {
+		return fmt.Errorf("load-key: keylocation %q requires a key on stdin", KeyLocationPrompt)
+	}
+
+	args := []string{"load-key"}
+	if keylocation != "" {
+		args = append(args, "-L", keylocation)
+	}
+	args = append(args, fs)
+
+	cmd := exec.CommandContext(ctx, ZFS_BINARY, args...)
+	if keylocation == KeyLocationPrompt {
+		cmd.Stdin = stdinKey
+	}
+	stderr := bytes.NewBuffer(make([]byte, 0, 1024))
+	cmd.Stderr = stderr
+	cmd.Stdout = stderr
+	if err := cmd.Run(); err != nil {
+		if sm := zfsLoadKeyAlreadyLoadedRegexp.FindSubmatch(stderr.Bytes()); sm != nil && string(sm[1]) == fs {
+			return &KeyAlreadyLoaded{fs}
+		}
+		return &ZFSError{
+			Stderr:  stderr.Bytes(),
+			WaitErr: err,
+		}
+	}
+	return nil
+}
+
+// ZFSGetKeyStatus reports whether the key of the encrypted filesystem fs is loaded,
+// i.e., whether its keystatus property is "available".
+func ZFSGetKeyStatus(ctx context.Context, fs string) (available bool, err error) {
+	if err := requireEncryptionCLISupport(ctx, "get keystatus"); err != nil {
+		return false, err
+	}
+	if err := validateZFSFilesystem(fs); err != nil {
+		return false, err
+	}
+	props, err := zfsGet(ctx, fs, []string{"keystatus"}, sourceAny)
+	if err != nil {
+		return false, err
+	}
+	switch val := props.Get("keystatus"); val {
+	case "available":
+		return true, nil
+	case "unavailable":
+		return false, nil
+	default:
+		return false, fmt.Errorf("unexpected keystatus %q for %q (is it encrypted?)", val, fs)
+	}
+}
+
+// ZFSUnloadKey unloads the encryption key of fs (`zfs unload-key`).
+// It is not an error if the key is not loaded.
+func ZFSUnloadKey(ctx context.Context, fs string) error {
+	available, err := ZFSGetKeyStatus(ctx, fs)
+	if err != nil {
+		return err
+	}
+	if !available {
+		return nil
+	}
+
+	cmd := exec.CommandContext(ctx, ZFS_BINARY, "unload-key", fs)
+	stderr := bytes.NewBuffer(make([]byte, 0, 1024))
+	cmd.Stderr = stderr
+	cmd.Stdout = stderr
+	if err := cmd.Run(); err != nil {
+		return &ZFSError{
+			Stderr:  stderr.Bytes(),
+			WaitErr: err,
+		}
+	}
+	return nil
+}
+
+type NotAnEncryptionRootError struct {
+	Filesystem     string
+	EncryptionRoot string
+}
+
+func (e *NotAnEncryptionRootError) Error() string {
+	return fmt.Sprintf("%q is not an encryption root, it inherits its key from %q (change the key there instead)", e.Filesystem, e.EncryptionRoot)
+}
+
+// ZFSChangeKey changes the encryption key of fs (`zfs change-key`).
+// fs must be an encryption root and its current key must be loaded.
+//
+// If newKeyLocation is not "", it becomes the new keylocation property of fs.
+// If newKeyLocation is KeyLocationPrompt, the new passphrase is read from stdinKey.
+// (stdinKey is ignored for all other key locations.)
+//
+// Returns *NotAnEncryptionRootError if fs inherits its key from another dataset.
+func ZFSChangeKey(ctx context.Context, fs string, newKeyLocation string, stdinKey io.Reader) error {
+	if err := requireEncryptionCLISupport(ctx, "change-key"); err != nil {
+		return err
+	}
+	if err := validateZFSFilesystem(fs); err != nil {
+		return err
+	}
+	if newKeyLocation == KeyLocationPrompt && stdinKey == nil {
+		return fmt.Errorf("change-key: keylocation %q requires a key on stdin", KeyLocationPrompt)
+	}
+
+	props, err := zfsGet(ctx, fs, []string{"encryptionroot", "keystatus"}, sourceAny)
+	if err != nil {
+		return err
+	}
+	switch root := props.Get("encryptionroot"); root {
+	case fs:
+	case "", "-":
+		return fmt.Errorf("change-key: %q is not encrypted", fs)
+	default:
+		return &NotAnEncryptionRootError{Filesystem: fs, EncryptionRoot: root}
+	}
+	if props.Get("keystatus") != "available" {
+		return fmt.Errorf("change-key: key of %q must be loaded", fs)
+	}
+
+	args := []string{"change-key"}
+	if newKeyLocation != "" {
+		args = append(args, "-o", fmt.Sprintf("keylocation=%s", newKeyLocation))
+	}
+	args = append(args, fs)
+
+	cmd := exec.CommandContext(ctx, ZFS_BINARY, args...)
+	if newKeyLocation == KeyLocationPrompt {
+		cmd.Stdin = stdinKey
+	}
+	stderr := bytes.NewBuffer(make([]byte, 0, 1024))
+	cmd.Stderr = stderr
+	cmd.Stdout = stderr
+	if err := cmd.Run(); err != nil {
+		return &ZFSError{
+			Stderr:  stderr.Bytes(),
+			WaitErr: err,
+		}
+	}
+	return nil
+}
+
+type KeyStatus string
+
+const (
+	KeyStatusAvailable   KeyStatus = "available"
+	KeyStatusUnavailable KeyStatus = "unavailable"
+	KeyStatusNone        KeyStatus = "-" // filesystem is not encrypted
+)
+
+type EncryptionInfo struct {
+	// The value of the encryption property, "off" if the filesystem is not encrypted.
+	Cipher string
+	// nil if the filesystem is not encrypted.
+	EncryptionRoot *DatasetPath
+	KeyStatus      KeyStatus
+}
+
+func (i *EncryptionInfo) Encrypted() bool {
+	return i.Cipher != "off"
+}
+
+// ZFSGetEncryptionInfo returns the encryption-related properties of fs.
+//
+// Returns nil (and no error) if this version of ZFS does not support native encryption.
+func ZFSGetEncryptionInfo(ctx context.Context, fs string) (*EncryptionInfo, error) {
+	supported, err := EncryptionCLISupported(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine encryption support: %s", err)
+	}
+	if !supported {
+		return nil, nil
+	}
+	if err := validateZFSFilesystem(fs); err != nil {
+		return nil, err
+	}
+	props, err := zfsGet(ctx, fs, []string{"encryption", "encryptionroot", "keystatus"}, sourceAny)
+	if err != nil {
+		return nil, err
+	}
+	return parseEncryptionInfo(fs, props)
+}
+
+func parseEncryptionInfo(fs string, props *ZFSProperties) (*EncryptionInfo, error) {
+	info := &EncryptionInfo{
+		Cipher:    props.Get("encryption"),
+		KeyStatus: KeyStatus(props.Get("keystatus")),
+	}
+	if info.Cipher == "" {
+		return nil, fmt.Errorf("zfs get did not return a value for property %q", "encryption")
+	}
+	if !info.Encrypted() {
+		info.KeyStatus = KeyStatusNone
+		return info, nil
+	}
+	switch info.KeyStatus {
+	case KeyStatusAvailable, KeyStatusUnavailable:
+	default:
+		return nil, fmt.Errorf("unexpected keystatus %q for encrypted filesystem %q", info.KeyStatus, fs)
+	}
+	root, err := NewDatasetPath(props.Get("encryptionroot"))
+	if err != nil || root.Empty() {
+		return nil, fmt.Errorf("invalid encryptionroot %q for encrypted filesystem %q", props.Get("encryptionroot"), fs)
+	}
+	info.EncryptionRoot = root
+	return info, nil
+}
+
+type EncryptedSendKeyUnavailableError struct {
+	Filesystem     string
+	EncryptionRoot string
+}
+
+func (e *EncryptedSendKeyUnavailableError) Error() string {
+	return fmt.Sprintf("cannot send encrypted filesystem %q without raw send: key is not loaded (load the key of encryption root %q or use raw send)", e.Filesystem, e.EncryptionRoot)
+}
+
+// validateKeyLoadedForNonRawSend turns the late failure of a non-raw send of an
+// encrypted filesystem whose key is not loaded into an early *EncryptedSendKeyUnavailableError.
+//
+// If the encryption status cannot be determined, the check is skipped and zfs send
+// itself will fail if the key is required.
+func (a *ZFSSendArgs) validateKeyLoadedForNonRawSend(ctx context.Context) error {
+	if a.Raw || a.FS == "" {
+		return nil
+	}
+	info, err := ZFSGetEncryptionInfo(ctx, a.FS)
+	if err != nil {
+		debug("send: cannot determine encryption status of %q, skipping key status check: %s", a.FS, err)
+		return nil
+	}
+	if info == nil || !info.Encrypted() || info.KeyStatus == KeyStatusAvailable {
+		return nil
+	}
+	return &EncryptedSendKeyUnavailableError{
+		Filesystem:     a.FS,
+		EncryptionRoot: info.EncryptionRoot.ToString(),
+	}
+}
@@ -0,0 +1,255 @@
+package zfs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withEncryptionCLISupport fakes the result of the EncryptionCLISupported feature check.
+// The returned function resets it and must be deferred by the caller.
+func withEncryptionCLISupport(supported bool) (reset func()) {
+	encryptionCLISupport.invalidate(nil)
+	encryptionCLISupport.get(nil, func() (bool, error) { return supported, nil })
+	return func() { encryptionCLISupport.invalidate(nil) }
+}
+
+func TestZFSLoadKeyPrompt(t *testing.T) {
+	defer withEncryptionCLISupport(true)()
+
+	dir, err := ioutil.TempDir("", "zrepl-zfs-test-load-key")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+
+	defer withFakeZFSBinary(t, `echo "$@" > `+out+`; cat >> `+out+"\n")()
+
+	err = ZFSLoadKey(context.Background(), "pool/fs", KeyLocationPrompt, strings.NewReader("secret\n"))
+	require.NoError(t, err)
+	o, err := ioutil.ReadFile(out)
+	require.NoError(t, err)
+	assert.Equal(t, "load-key -L prompt pool/fs\nsecret\n", string(o))
+}
+
+func TestZFSLoadKeyAlreadyLoaded(t *testing.T) {
+	defer withEncryptionCLISupport(true)()
+	defer withFakeZFSBinary(t, `echo "Key load error: Key already loaded for 'pool/fs'." >&2; exit 255`)()
+
+	err := ZFSLoadKey(context.Background(), "pool/fs", "", nil)
+	kal, ok := err.(*KeyAlreadyLoaded)
+	require.True(t, ok, "%T %s", err, err)
+	assert.Equal(t, "pool/fs", kal.Filesystem)
+}
+
+func TestZFSLoadKeyNotSupported(t *testing.T) {
+	defer withEncryptionCLISupport(false)()
+	err := ZFSLoadKey(context.Background(), "pool/fs", "", nil)
+	_, ok := err.(*EncryptionCLINotSupportedError)
+	assert.True(t, ok, "%T %s", err, err)
+}
+
+func TestZFSUnloadKeyNoopIfUnavailable(t *testing.T) {
+	defer withEncryptionCLISupport(true)()
+	defer withFakeZFSBinary(t, `
+case "$1" in
+get)
+	printf 'keystatus\tunavailable\t-\n'
+	;;
+*)
+	echo "unexpected invocation: $*" >&2
+	exit 1
+	;;
+esac
+`)()
+
+	err := ZFSUnloadKey(context.Background(), "pool/fs")
+	assert.NoError(t, err)
+}
+
+func TestZFSGetKeyStatus(t *testing.T) {
+	defer withEncryptionCLISupport(true)()
+	defer withFakeZFSBinary(t, `printf 'keystatus\tavailable\t-\n'`)()
+
+	available, err := ZFSGetKeyStatus(context.Background(), "pool/fs")
+	require.NoError(t, err)
+	assert.True(t, available)
+}
+
+func TestZFSGetKeyStatusNotSupported(t *testing.T) {
+	defer withEncryptionCLISupport(false)()
+	_, err := ZFSGetKeyStatus(context.Background(), "pool/fs")
+	_, ok := err.(*EncryptionCLINotSupportedError)
+	assert.True(t, ok, "%T %s", err, err)
+}
+
+func TestZFSChangeKeyRefusesInheritingChild(t *testing.T) {
+	defer withEncryptionCLISupport(true)()
+	defer withFakeZFSBinary(t, `
+case "$1" in
+get)
+	printf 'encryptionroot\tpool/enc\t-\nkeystatus\tavailable\t-\n'
+	;;
+*)
+	echo "unexpected invocation: $*" >&2
+	exit 1
+	;;
+esac
+`)()
+
+	err := ZFSChangeKey(context.Background(), "pool/enc/child", "", nil)
+	nerr, ok := err.(*NotAnEncryptionRootError)
+	require.True(t, ok, "%T %s", err, err)
+	assert.Equal(t, "pool/enc", nerr.EncryptionRoot)
+	assert.Contains(t, nerr.Error(), "pool/enc")
+}
+
+func TestZFSChangeKey(t *testing.T) {
+	defer withEncryptionCLISupport(true)()
+
+	dir, err := ioutil.TempDir("", "zrepl-zfs-test-change-key")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+
+	defer withFakeZFSBinary(t, `
+case "$1" in
+get)
+	printf 'encryptionroot\tpool/enc\t-\nkeystatus\tavailable\t-\n'
+	;;
+change-key)
+	echo "$@" > `+out+`
+	cat >> `+out+`
+	;;
+esac
+`)()
+
+	err = ZFSChangeKey(context.Background(), "pool/enc", KeyLocationPrompt, strings.NewReader("new secret\n"))
+	require.NoError(t, err)
+	o, err := ioutil.ReadFile(out)
+	require.NoError(t, err)
+	assert.Equal(t, "change-key -o keylocation=prompt pool/enc\nnew secret\n", string(o))
+}
+
+func TestParseEncryptionInfo(t *testing.T) {
+	props := func(kv ...string) *ZFSProperties {
+		p := NewZFSProperties()
+		for i := 0; i < len(kv); i += 2 {
+			p.Set(kv[i], kv[i+1])
+		}
+		return p
+	}
+
+	info, err := parseEncryptionInfo("pool/enc/child", props("encryption", "aes-256-gcm", "encryptionroot", "pool/enc", "keystatus", "unavailable"))
+	require.NoError(t, err)
+	assert.True(t, info.Encrypted())
+	assert.Equal(t, "aes-256-gcm", info.Cipher)
+	assert.Equal(t, "pool/enc", info.EncryptionRoot.ToString())
+	assert.Equal(t, KeyStatusUnavailable, info.KeyStatus)
+
+	info, err = parseEncryptionInfo("pool/plain", props("encryption", "off", "encryptionroot", "-", "keystatus", "-"))
+	require.NoError(t, err)
+	assert.False(t, info.Encrypted())
+	assert.Nil(t, info.EncryptionRoot)
+	assert.Equal(t, KeyStatusNone, info.KeyStatus)
+
+	_, err = parseEncryptionInfo("pool/enc", props("encryption", "aes-256-gcm", "encryptionroot", "pool/enc", "keystatus", "-"))
+	assert.Error(t, err)
+}
+
+func TestZFSGetEncryptionInfoNotSupported(t *testing.T) {
+	defer withEncryptionCLISupport(false)()
+	info, err := ZFSGetEncryptionInfo(context.Background(), "pool/fs")
+	assert.NoError(t, err)
+	assert.Nil(t, info)
+}
+
+func TestZFSGetEncryptionEnabledMulti(t *testing.T) {
+	defer withEncryptionCLISupport(true)()
+	defer withFakeZFSBinary(t, `
+test "$*" = "get -H -p -o name,value encryption pool/plain pool/enc pool/enc/child" || exit 1
+printf 'pool/plain\toff\npool/enc\taes-256-gcm\npool/enc/child\taes-256-gcm\n'
+`)()
+
+	res, err := ZFSGetEncryptionEnabledMulti(context.Background(), []string{"pool/plain", "pool/enc", "pool/enc/child"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{
+		"pool/plain":     false,
+		"pool/enc":       true,
+		"pool/enc/child": true,
+	}, res)
+}
+
+func TestParseEncryptionEnabledMultiMissingFilesystem(t *testing.T) {
+	_, err := parseEncryptionEnabledMulti([]string{"pool/a", "pool/b"}, []byte("pool/a\toff\n"))
+	assert.Error(t, err)
+}
+
+func TestValidateKeyLoadedForNonRawSend(t *testing.T) {
+	defer withEncryptionCLISupport(true)()
+
+	locked := `printf 'encryption\taes-256-gcm\t-\nencryptionroot\tpool/enc\t-\nkeystatus\tunavailable\t-\n'`
+	unlocked := `printf 'encryption\taes-256-gcm\t-\nencryptionroot\tpool/enc\t-\nkeystatus\tavailable\t-\n'`
+
+	t.Run("lockedNonRaw", func(t *testing.T) {
+		defer withFakeZFSBinary(t, locked)()
+		a := ZFSSendArgs{FS: "pool/enc/child", To: "@1"}
+		err := a.validateKeyLoadedForNonRawSend(context.Background())
+		kerr, ok := err.(*EncryptedSendKeyUnavailableError)
+		require.True(t, ok, "%T %s", err, err)
+		assert.Equal(t, "pool/enc", kerr.EncryptionRoot)
+		assert.Contains(t, kerr.Error(), "raw send")
+	})
+
+	t.Run("lockedRaw", func(t *testing.T) {
+		defer withFakeZFSBinary(t, locked)()
+		a := ZFSSendArgs{FS: "pool/enc/child", To: "@1", Raw: true}
+		assert.NoError(t, a.validateKeyLoadedForNonRawSend(context.Background()))
+	})
+
+	t.Run("unlockedNonRaw", func(t *testing.T) {
+		defer withFakeZFSBinary(t, unlocked)()
+		a := ZFSSendArgs{FS: "pool/enc/child", To: "@1"}
+		assert.NoError(t, a.validateKeyLoadedForNonRawSend(context.Background()))
+	})
+
+	t.Run("unencryptedRaw", func(t *testing.T) {
+		// raw send does not depend on encryption, zfs must not even be asked
+		defer withFakeZFSBinary(t, `exit 23`)()
+		a := ZFSSendArgs{FS: "pool/plain", To: "@1", Raw: true}
+		assert.NoError(t, a.validateKeyLoadedForNonRawSend(context.Background()))
+		args, err := a.buildCommonSendArgs()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"-w", "pool/plain@1"}, args)
+	})
+
+	t.Run("unencryptedNonRaw", func(t *testing.T) {
+		defer withFakeZFSBinary(t, `printf 'encryption\toff\t-\nencryptionroot\t-\t-\nkeystatus\t-\t-\n'`)()
+		a := ZFSSendArgs{FS: "pool/plain", To: "@1"}
+		assert.NoError(t, a.validateKeyLoadedForNonRawSend(context.Background()))
+	})
+}
+
+func TestZFSSendRejectsNonRawSendOfLockedFilesystem(t *testing.T) {
+	defer withEncryptionCLISupport(true)()
+	defer withFakeZFSBinary(t, `
+case "$1" in
+get)
+	printf 'encryption\taes-256-gcm\t-\nencryptionroot\tpool/enc\t-\nkeystatus\tunavailable\t-\n'
+	;;
+*)
+	echo "unexpected invocation: $*" >&2
+	exit 1
+	;;
+esac
+`)()
+
+	_, err := ZFSSend(context.Background(), ZFSSendArgs{FS: "pool/enc", To: "@1"}, SendOptions{})
+	_, ok := err.(*EncryptedSendKeyUnavailableError)
+	assert.True(t, ok, "%T %s", err, err)
+}
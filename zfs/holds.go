@@ -0,0 +1,134 @@
+package zfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// ZFSHolds returns the tags of the user holds on snapshot fs@snap.
+//
+// Returns *DatasetDoesNotExist if the snapshot does not exist
+// and an empty slice if the snapshot has no holds.
+func ZFSHolds(ctx context.Context, fs, snap string) ([]string, error) {
+	if err := validateZFSFilesystem(fs); err != nil {
+		return nil, err
+	}
+	if snap == "" {
+		return nil, fmt.Errorf("snapshot name must not be empty")
+	}
+	path := fmt.Sprintf("%s@%s", fs, snap)
+
+	cmd := exec.CommandContext(ctx, ZFS_BINARY, "holds", "-H", path)
+	stderr := bytes.NewBuffer(make([]byte, 0, 1024))
+	cmd.Stderr = stderr
+	stdout, err := cmd.Output()
+	if err != nil {
+		if sm := zfsGetDatasetDoesNotExistRegexp.FindSubmatch(stderr.Bytes()); sm != nil && string(sm[1]) == path {
+			return nil, &DatasetDoesNotExist{path}
+		}
+		return nil, &ZFSError{
+			Stderr:  stderr.Bytes(),
+			WaitErr: err,
+		}
+	}
+	return parseHoldsOutput(path, stdout)
+}
+
+// output of `zfs holds -H` looks like this (tab-separated):
+//   pool/fs@snap	tag1	Thu Oct 10 13:37:00 2019
+//   pool/fs@snap	tag2	Thu Oct 10 13:37:01 2019
+func parseHoldsOutput(path string, output []byte) ([]string, error) {
+	tags := []string{}
+	s := bufio.NewScanner(bytes.NewReader(output))
+	for s.Scan() {
+		fields := strings.SplitN(s.Text(), "\t", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("zfs holds: unexpected output line %q", s.Text())
+		}
+		if fields[0] != path {
+			return nil, fmt.Errorf("zfs holds: unexpected snapshot %q in output, expected %q", fields[0], path)
+		}
+		tags = append(tags, fields[1])
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+var (
+	zfsHoldTagExistsRegexp    = regexp.MustCompile(`^cannot hold snapshot '[^']+': tag already exists on this dataset$`)
+	zfsReleaseNoSuchTagRegexp = regexp.MustCompile(`^cannot release hold from snapshot '[^']+': no such tag on this dataset$`)
+)
+
+// ZFSHold places a user hold with the given tag on snapshots fs@snap for all snaps
+// in a single `zfs hold` invocation.
+//
+// Holding a snapshot that already has a hold with the same tag is not an error.
+func ZFSHold(ctx context.Context, tag, fs string, snaps ...string) error {
+	return zfsHoldOrRelease(ctx, "hold", zfsHoldTagExistsRegexp, tag, fs, snaps)
+}
+
+// ZFSRelease releases the user hold with the given tag from snapshots fs@snap for all snaps
+// in a single `zfs release` invocation.
+//
+// Releasing a tag that is not held on a snapshot is not an error.
+func ZFSRelease(ctx context.Context, tag, fs string, snaps ...string) error {
+	return zfsHoldOrRelease(ctx, "release", zfsReleaseNoSuchTagRegexp, tag, fs, snaps)
+}
+
+// idempotentLine matches the lines on stderr that do not constitute an error.
+func zfsHoldOrRelease(ctx context.Context, subcommand string, idempotentLine *regexp.Regexp, tag, fs string, snaps []string) error {
+	if err := validateZFSFilesystem(fs); err != nil {
+		return err
+	}
+	if tag == "" {
+		return fmt.Errorf("%s: tag must not be empty", subcommand)
+	}
+	if len(snaps) == 0 {
+		return nil
+	}
+	args := []string{subcommand, tag}
+	for _, snap := range snaps {
+		if snap == "" {
+			return fmt.Errorf("%s: snapshot name must not be empty", subcommand)
+		}
+		args = append(args, fmt.Sprintf("%s@%s", fs, snap))
+	}
+
+	cmd := exec.CommandContext(ctx, ZFS_BINARY, args...)
+	stderr := bytes.NewBuffer(make([]byte, 0, 1024))
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); ok && onlyIdempotentLines(stderr.Bytes(), idempotentLine) {
+			return nil
+		}
+		return &ZFSError{
+			Stderr:  stderr.Bytes(),
+			WaitErr: err,
+		}
+	}
+	return nil
+}
+
+// zfs hold / release report every snapshot they fail on, but keep going
+func onlyIdempotentLines(stderr []byte, idempotentLine *regexp.Regexp) bool {
+	s := bufio.NewScanner(bytes.NewReader(stderr))
+	sawLine := false
+	for s.Scan() {
+		l := strings.TrimSpace(s.Text())
+		if l == "" {
+			continue
+		}
+		if !idempotentLine.MatchString(l) {
+			return false
+		}
+		sawLine = true
+	}
+	return s.Err() == nil && sawLine
+}
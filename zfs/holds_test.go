@@ -0,0 +1,74 @@
+package zfs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHoldsOutput(t *testing.T) {
+	tags, err := parseHoldsOutput("pool/fs@snap", []byte(""))
+	require.NoError(t, err)
+	assert.NotNil(t, tags)
+	assert.Empty(t, tags)
+
+	out := "pool/fs@snap\ttag1\tThu Oct 10 13:37 2019\npool/fs@snap\ttag with spaces\tThu Oct 10 13:38 2019\n"
+	tags, err = parseHoldsOutput("pool/fs@snap", []byte(out))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tag1", "tag with spaces"}, tags)
+
+	_, err = parseHoldsOutput("pool/fs@snap", []byte("pool/fs@other\ttag1\tThu Oct 10 13:37 2019\n"))
+	assert.Error(t, err)
+	_, err = parseHoldsOutput("pool/fs@snap", []byte("garbage\n"))
+	assert.Error(t, err)
+}
+
+func TestZFSHoldsDatasetDoesNotExist(t *testing.T) {
+	defer withFakeZFSBinary(t, `echo "cannot open '$3': dataset does not exist" >&2; exit 1`)()
+	_, err := ZFSHolds(context.Background(), "pool/fs", "snap")
+	dne, ok := err.(*DatasetDoesNotExist)
+	require.True(t, ok, "%T %s", err, err)
+	assert.Equal(t, "pool/fs@snap", dne.Path)
+}
+
+func TestZFSReleaseIdempotent(t *testing.T) {
+	defer withFakeZFSBinary(t, `
+echo "cannot release hold from snapshot '$3': no such tag on this dataset" >&2
+echo "cannot release hold from snapshot '$4': no such tag on this dataset" >&2
+exit 1
+`)()
+	err := ZFSRelease(context.Background(), "zrepl", "pool/fs", "a", "b")
+	assert.NoError(t, err)
+}
+
+func TestZFSReleaseBatchesSnapshots(t *testing.T) {
+	defer withFakeZFSBinary(t, `
+test "$*" = "release zrepl pool/fs@a pool/fs@b" && exit 0
+echo "unexpected args $*" >&2
+exit 1
+`)()
+	err := ZFSRelease(context.Background(), "zrepl", "pool/fs", "a", "b")
+	assert.NoError(t, err)
+}
+
+func TestZFSReleaseError(t *testing.T) {
+	defer withFakeZFSBinary(t, `
+echo "cannot release hold from snapshot '$3': no such tag on this dataset" >&2
+echo "cannot release hold from snapshot '$4': dataset does not exist" >&2
+exit 1
+`)()
+	err := ZFSRelease(context.Background(), "zrepl", "pool/fs", "a", "b")
+	_, ok := err.(*ZFSError)
+	assert.True(t, ok, "%T %s", err, err)
+}
+
+func TestZFSHoldIdempotent(t *testing.T) {
+	defer withFakeZFSBinary(t, `
+echo "cannot hold snapshot '$3': tag already exists on this dataset" >&2
+exit 1
+`)()
+	err := ZFSHold(context.Background(), "zrepl", "pool/fs", "a")
+	assert.NoError(t, err)
+}
@@ -3,6 +3,7 @@ package zfs
 import (
 	"context"
 	"fmt"
+	"sort"
 )
 
 type DatasetFilter interface {
@@ -20,6 +21,8 @@ var _ DatasetFilter = noFilter{}
 
 func (noFilter) Filter(p *DatasetPath) (pass bool, err error) { return true, nil }
 
+// ZFSListMapping returns the filesystems and volumes that pass filter,
+// sorted by DatasetPath.Less, i.e. the order does not depend on the output order of `zfs list`.
 func ZFSListMapping(ctx context.Context, filter DatasetFilter) (datasets []*DatasetPath, err error) {
 	res, err := ZFSListMappingProperties(ctx, filter, nil)
 	if err != nil {
@@ -39,6 +42,8 @@ type ZFSListMappingPropertiesResult struct {
 }
 
 // properties must not contain 'name'
+//
+// The result is sorted by Path (see DatasetPath.Less).
 func ZFSListMappingProperties(ctx context.Context, filter DatasetFilter, properties []string) (datasets []ZFSListMappingPropertiesResult, err error) {
 
 	if filter == nil {
@@ -87,5 +92,54 @@ func ZFSListMappingProperties(ctx context.Context, filter DatasetFilter, propert
 
 	}
 
+	sort.SliceStable(datasets, func(i, j int) bool {
+		return datasets[i].Path.Less(datasets[j].Path)
+	})
 	return
 }
+
+type DatasetType string
+
+const (
+	DatasetTypeFilesystem DatasetType = "filesystem"
+	DatasetTypeVolume     DatasetType = "volume"
+)
+
+type DatasetWithType struct {
+	Path *DatasetPath
+	Type DatasetType
+}
+
+// ZFSListMappingTyped is like ZFSListMapping, but also returns whether each dataset
+// is a filesystem or a volume (without an additional zfs get per dataset).
+func ZFSListMappingTyped(ctx context.Context, filter DatasetFilter) ([]DatasetWithType, error) {
+	res, err := ZFSListMappingProperties(ctx, filter, []string{"type"})
+	if err != nil {
+		return nil, err
+	}
+	datasets := make([]DatasetWithType, len(res))
+	for i, r := range res {
+		t := DatasetType(r.Fields[0])
+		switch t {
+		case DatasetTypeFilesystem, DatasetTypeVolume:
+		default:
+			return nil, fmt.Errorf("unexpected type %q of dataset %q", r.Fields[0], r.Path.ToString())
+		}
+		datasets[i] = DatasetWithType{Path: r.Path, Type: t}
+	}
+	return datasets, nil
+}
+
+func ZFSGetDatasetType(ctx context.Context, p *DatasetPath) (DatasetType, error) {
+	props, err := zfsGet(ctx, p.ToString(), []string{"type"}, sourceAny)
+	if err != nil {
+		return "", err
+	}
+	t := DatasetType(props.Get("type"))
+	switch t {
+	case DatasetTypeFilesystem, DatasetTypeVolume:
+		return t, nil
+	default:
+		return "", fmt.Errorf("unexpected type %q of dataset %q", t, p.ToString())
+	}
+}
@@ -0,0 +1,51 @@
+package zfs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZFSListMappingIsSorted(t *testing.T) {
+	defer withFakeZFSBinary(t, `printf 'pool/b\npool-x\npool/a/c\npool\npool/a\npool/a-b\n'`)()
+
+	fss, err := ZFSListMapping(context.Background(), NoFilter())
+	require.NoError(t, err)
+	names := make([]string, len(fss))
+	for i := range fss {
+		names[i] = fss[i].ToString()
+	}
+	assert.Equal(t, []string{"pool", "pool/a", "pool/a/c", "pool/a-b", "pool/b", "pool-x"}, names)
+}
+
+func TestZFSListMappingTyped(t *testing.T) {
+	defer withFakeZFSBinary(t, `
+test "$*" = "list -H -p -o name,type -r -t filesystem,volume" || exit 1
+printf 'pool\tfilesystem\npool/vol\tvolume\npool/fs\tfilesystem\n'
+`)()
+
+	dss, err := ZFSListMappingTyped(context.Background(), NoFilter())
+	require.NoError(t, err)
+	require.Len(t, dss, 3)
+	assert.Equal(t, "pool", dss[0].Path.ToString())
+	assert.Equal(t, DatasetTypeFilesystem, dss[0].Type)
+	assert.Equal(t, "pool/fs", dss[1].Path.ToString())
+	assert.Equal(t, DatasetTypeFilesystem, dss[1].Type)
+	assert.Equal(t, "pool/vol", dss[2].Path.ToString())
+	assert.Equal(t, DatasetTypeVolume, dss[2].Type)
+}
+
+func TestZFSGetDatasetType(t *testing.T) {
+	defer withFakeZFSBinary(t, `
+test "$*" = "get -Hp -o property,value,source type pool/vol" || exit 1
+printf 'type\tvolume\t-\n'
+`)()
+
+	p, err := NewDatasetPath("pool/vol")
+	require.NoError(t, err)
+	typ, err := ZFSGetDatasetType(context.Background(), p)
+	require.NoError(t, err)
+	assert.Equal(t, DatasetTypeVolume, typ)
+}
@@ -0,0 +1,81 @@
+package zfs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+)
+
+var (
+	zfsMountAlreadyMountedRegexp  = regexp.MustCompile(`cannot mount '([^']+)': filesystem already mounted`)
+	zfsMountKeyNotLoadedRegexp    = regexp.MustCompile(`cannot mount '([^']+)': encryption key not loaded`)
+	zfsUnmountNotMountedRegexp    = regexp.MustCompile(`cannot unmount '([^']+)': not currently mounted`)
+	zfsUnmountNotMountedRegexpAlt = regexp.MustCompile(`cannot unmount '([^']+)': not a mountpoint`)
+)
+
+type MountKeyNotLoadedError struct {
+	Filesystem string
+}
+
+func (e *MountKeyNotLoadedError) Error() string {
+	return fmt.Sprintf("cannot mount %q: encryption key is not loaded (load it first using `zfs load-key`)", e.Filesystem)
+}
+
+func matchesFS(re *regexp.Regexp, stderr []byte, fs string) bool {
+	sm := re.FindSubmatch(stderr)
+	return sm != nil && string(sm[1]) == fs
+}
+
+// ZFSMount mounts fs (`zfs mount`), e.g. to verify a received filesystem.
+// It is not an error if fs is already mounted.
+// If fs is encrypted and its key is not loaded, *MountKeyNotLoadedError is returned.
+func ZFSMount(ctx context.Context, fs *DatasetPath) error {
+	if fs.Empty() {
+		return fmt.Errorf("mount: filesystem path must not be empty")
+	}
+	name := fs.ToString()
+	stderr, err := runZFSMountCommand(ctx, "mount", name)
+	if err == nil {
+		return nil
+	}
+	if matchesFS(zfsMountAlreadyMountedRegexp, stderr, name) {
+		return nil
+	}
+	if matchesFS(zfsMountKeyNotLoadedRegexp, stderr, name) {
+		return &MountKeyNotLoadedError{name}
+	}
+	return &ZFSError{Stderr: stderr, WaitErr: err}
+}
+
+// ZFSUnmount unmounts fs (`zfs unmount`), forcibly if force is true (`-f`).
+// It is not an error if fs is not mounted.
+func ZFSUnmount(ctx context.Context, fs *DatasetPath, force bool) error {
+	if fs.Empty() {
+		return fmt.Errorf("unmount: filesystem path must not be empty")
+	}
+	name := fs.ToString()
+	args := []string{"unmount"}
+	if force {
+		args = append(args, "-f")
+	}
+	args = append(args, name)
+	stderr, err := runZFSMountCommand(ctx, args...)
+	if err == nil {
+		return nil
+	}
+	if matchesFS(zfsUnmountNotMountedRegexp, stderr, name) || matchesFS(zfsUnmountNotMountedRegexpAlt, stderr, name) {
+		return nil
+	}
+	return &ZFSError{Stderr: stderr, WaitErr: err}
+}
+
+func runZFSMountCommand(ctx context.Context, args ...string) (stderr []byte, err error) {
+	cmd := exec.CommandContext(ctx, ZFS_BINARY, args...)
+	var buf bytes.Buffer
+	cmd.Stderr = &buf
+	cmd.Stdout = &buf
+	err = cmd.Run()
+	return buf.Bytes(), err
+}
@@ -0,0 +1,52 @@
+package zfs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZFSMount(t *testing.T) {
+	defer withFakeZFSBinary(t, `
+test "$1" = "mount" || exit 23
+case "$2" in
+pool/ok) ;;
+pool/mounted) echo "cannot mount 'pool/mounted': filesystem already mounted" >&2; exit 1;;
+pool/enc) echo "cannot mount 'pool/enc': encryption key not loaded" >&2; exit 1;;
+*) echo "cannot mount '$2': permission denied" >&2; exit 1;;
+esac
+`)()
+	ctx := context.Background()
+
+	assert.NoError(t, ZFSMount(ctx, toDatasetPath("pool/ok")))
+	assert.NoError(t, ZFSMount(ctx, toDatasetPath("pool/mounted")))
+
+	err := ZFSMount(ctx, toDatasetPath("pool/enc"))
+	kerr, ok := err.(*MountKeyNotLoadedError)
+	require.True(t, ok, "%T %s", err, err)
+	assert.Equal(t, "pool/enc", kerr.Filesystem)
+	assert.Contains(t, kerr.Error(), "load-key")
+
+	err = ZFSMount(ctx, toDatasetPath("pool/other"))
+	_, ok = err.(*ZFSError)
+	assert.True(t, ok, "%T %s", err, err)
+}
+
+func TestZFSUnmount(t *testing.T) {
+	defer withFakeZFSBinary(t, `
+case "$*" in
+"unmount pool/ok"|"unmount -f pool/busy") ;;
+"unmount pool/busy") echo "cannot unmount '/pool/busy': pool or dataset is busy" >&2; exit 1;;
+"unmount pool/unmounted") echo "cannot unmount 'pool/unmounted': not currently mounted" >&2; exit 1;;
+*) exit 23;;
+esac
+`)()
+	ctx := context.Background()
+
+	assert.NoError(t, ZFSUnmount(ctx, toDatasetPath("pool/ok"), false))
+	assert.NoError(t, ZFSUnmount(ctx, toDatasetPath("pool/unmounted"), false))
+	assert.Error(t, ZFSUnmount(ctx, toDatasetPath("pool/busy"), false))
+	assert.NoError(t, ZFSUnmount(ctx, toDatasetPath("pool/busy"), true))
+}
@@ -2,10 +2,12 @@ package zfs
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha512"
 	"encoding/hex"
 	"fmt"
 	"os/exec"
+	"regexp"
 )
 
 const (
@@ -16,6 +18,22 @@ const (
 	placeholderPropertyOff  string = "off"
 )
 
+// ZFS user property names: lowercase alphanumerics and ':+._-', containing a ':', at most 256 characters
+var userPropertyNameRegexp = regexp.MustCompile(`^[a-z0-9:+._-]*:[a-z0-9:+._-]*$`)
+
+// ValidatePlaceholderPropertyName returns an error if name cannot be used as placeholder property,
+// i.e., is not a ZFS user property name.
+//
+// The placeholder functions take the property name as an argument. PlaceholderPropertyName is the default,
+// multiple independent zrepl deployments can use distinct ones (e.g. "zrepl.sitea:placeholder")
+// to keep from interpreting each other's placeholders.
+func ValidatePlaceholderPropertyName(name string) error {
+	if len(name) > 256 || !userPropertyNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid placeholder property name %q: must be a ZFS user property name (lowercase, containing a ':')", name)
+	}
+	return nil
+}
+
 // computeLegacyPlaceholderPropertyValue is a legacy-compatibility function.
 //
 // In the 0.0.x series, the value stored in the PlaceholderPropertyName user property
@@ -60,29 +78,73 @@ type FilesystemPlaceholderState struct {
 // ZFSGetFilesystemPlaceholderState is the authoritative way to determine whether a filesystem
 // is a placeholder. Note that the property source must be `local` for the returned value to be valid.
 //
+// propName is the placeholder property, usually PlaceholderPropertyName.
 // For nonexistent FS, err == nil and state.FSExists == false
-func ZFSGetFilesystemPlaceholderState(p *DatasetPath) (state *FilesystemPlaceholderState, err error) {
+func ZFSGetFilesystemPlaceholderState(ctx context.Context, p *DatasetPath, propName string) (state *FilesystemPlaceholderState, err error) {
 	state = &FilesystemPlaceholderState{FS: p.ToString()}
 	state.FS = p.ToString()
-	props, err := zfsGet(p.ToString(), []string{PlaceholderPropertyName}, sourceLocal)
+	props, err := zfsGet(ctx, p.ToString(), []string{propName}, sourceLocal)
 	var _ error = (*DatasetDoesNotExist)(nil) // weak assertion on zfsGet's interface
 	if _, ok := err.(*DatasetDoesNotExist); ok {
 		return state, nil
 	} else if err != nil {
 		return state, err
 	}
+	state.setFromLocalProps(p, propName, props)
+	return state, nil
+}
+
+// props must only contain local property values
+func (state *FilesystemPlaceholderState) setFromLocalProps(p *DatasetPath, propName string, props *ZFSProperties) {
 	state.FSExists = true
-	state.RawLocalPropertyValue = props.Get(PlaceholderPropertyName)
+	state.RawLocalPropertyValue = props.Get(propName)
 	state.IsPlaceholder = isLocalPlaceholderPropertyValuePlaceholder(p, state.RawLocalPropertyValue)
-	return state, nil
 }
 
-func ZFSCreatePlaceholderFilesystem(p *DatasetPath) (err error) {
+// ZFSGetFilesystemPlaceholderStates is ZFSGetFilesystemPlaceholderState for all of paths,
+// using a single `zfs get` invocation.
+//
+// The returned map is keyed by DatasetPath.ToString() and has an entry for each of paths.
+func ZFSGetFilesystemPlaceholderStates(ctx context.Context, paths []*DatasetPath, propName string) (map[string]*FilesystemPlaceholderState, error) {
+	names := make([]string, len(paths))
+	for i, p := range paths {
+		names[i] = p.ToString()
+	}
+	multi, err := zfsGetMulti(ctx, names, []string{propName}, sourceLocal)
+	if err != nil {
+		return nil, err
+	}
+	states := make(map[string]*FilesystemPlaceholderState, len(paths))
+	for i, p := range paths {
+		state := &FilesystemPlaceholderState{FS: names[i]}
+		r := multi[names[i]]
+		if _, ok := r.Err.(*DatasetDoesNotExist); ok {
+			// FSExists == false
+		} else if r.Err != nil {
+			return nil, r.Err
+		} else {
+			state.setFromLocalProps(p, propName, r.Props)
+		}
+		states[names[i]] = state
+	}
+	return states, nil
+}
+
+// ZFSCreatePlaceholderFilesystem creates p as a placeholder filesystem, marked by property propName.
+//
+// Placeholders are created with canmount=off and mountpoint=none, hence they are never mounted
+// and do not collide with any mountpoint (compare RecvOptions.NoAutoMount for received filesystems).
+// Use ZFSClearPlaceholder to turn a placeholder into a regular filesystem.
+func ZFSCreatePlaceholderFilesystem(p *DatasetPath, propName string) (err error) {
 	if p.Length() == 1 {
 		return fmt.Errorf("cannot create %q: pools cannot be created with zfs create", p.ToString())
 	}
+	if err := ValidatePlaceholderPropertyName(propName); err != nil {
+		return err
+	}
 	cmd := exec.Command(ZFS_BINARY, "create",
-		"-o", fmt.Sprintf("%s=%s", PlaceholderPropertyName, placeholderPropertyOn),
+		"-o", fmt.Sprintf("%s=%s", propName, placeholderPropertyOn),
+		"-o", "canmount=off",
 		"-o", "mountpoint=none",
 		p.ToString())
 
@@ -103,14 +165,30 @@ func ZFSCreatePlaceholderFilesystem(p *DatasetPath) (err error) {
 	return
 }
 
-func ZFSSetPlaceholder(p *DatasetPath, isPlaceholder bool) error {
+func ZFSSetPlaceholder(ctx context.Context, p *DatasetPath, propName string, isPlaceholder bool) error {
+	if err := ValidatePlaceholderPropertyName(propName); err != nil {
+		return err
+	}
 	props := NewZFSProperties()
 	prop := placeholderPropertyOff
 	if isPlaceholder {
 		prop = placeholderPropertyOn
 	}
-	props.Set(PlaceholderPropertyName, prop)
-	return zfsSet(p.ToString(), props)
+	props.Set(propName, prop)
+	return zfsSet(ctx, p.ToString(), props)
+}
+
+// ZFSClearPlaceholder turns placeholder p into a regular filesystem, e.g. before a forced receive into it.
+//
+// In addition to clearing the placeholder property, it removes the local canmount=off
+// that ZFSCreatePlaceholderFilesystem sets, which would otherwise persist through the receive.
+// canmount is not inheritable, thus `zfs inherit -S` is used: canmount reverts to the received
+// value if there is one and to its default otherwise.
+func ZFSClearPlaceholder(ctx context.Context, p *DatasetPath, propName string) error {
+	if err := ZFSSetPlaceholder(ctx, p, propName, false); err != nil {
+		return err
+	}
+	return ZFSInherit(ctx, p, "canmount", true)
 }
 
 type MigrateHashBasedPlaceholderReport struct {
@@ -118,9 +196,11 @@ type MigrateHashBasedPlaceholderReport struct {
 	NeedsModification bool
 }
 
+// Hash-based placeholders predate configurable property names, thus only PlaceholderPropertyName is migrated.
+//
 // fs must exist, will panic otherwise
-func ZFSMigrateHashBasedPlaceholderToCurrent(fs *DatasetPath, dryRun bool) (*MigrateHashBasedPlaceholderReport, error) {
-	st, err := ZFSGetFilesystemPlaceholderState(fs)
+func ZFSMigrateHashBasedPlaceholderToCurrent(ctx context.Context, fs *DatasetPath, dryRun bool) (*MigrateHashBasedPlaceholderReport, error) {
+	st, err := ZFSGetFilesystemPlaceholderState(ctx, fs, PlaceholderPropertyName)
 	if err != nil {
 		return nil, fmt.Errorf("error getting placeholder state: %s", err)
 	}
@@ -137,7 +217,7 @@ func ZFSMigrateHashBasedPlaceholderToCurrent(fs *DatasetPath, dryRun bool) (*Mig
 		return &report, nil
 	}
 
-	err = ZFSSetPlaceholder(fs, st.IsPlaceholder)
+	err = ZFSSetPlaceholder(ctx, fs, PlaceholderPropertyName, st.IsPlaceholder)
 	if err != nil {
 		return nil, fmt.Errorf("error re-writing placeholder property: %s", err)
 	}
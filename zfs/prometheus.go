@@ -1,12 +1,19 @@
 package zfs
 
-import "github.com/prometheus/client_golang/prometheus"
+import (
+	"io"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
 
 var prom struct {
 	ZFSListFilesystemVersionDuration *prometheus.HistogramVec
 	ZFSSnapshotDuration              *prometheus.HistogramVec
 	ZFSBookmarkDuration              *prometheus.HistogramVec
 	ZFSDestroyDuration               *prometheus.HistogramVec
+	ZFSSendBytes                     *prometheus.CounterVec
+	ZFSRecvBytes                     *prometheus.CounterVec
+	ZFSSendSizeEstimateDivergences   *prometheus.CounterVec
 }
 
 func init() {
@@ -34,6 +41,24 @@ func init() {
 		Name:      "destroy_duration",
 		Help:      "Duration it took to destroy a dataset",
 	}, []string{"dataset_type", "filesystem"})
+	prom.ZFSSendBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "zrepl",
+		Subsystem: "zfs",
+		Name:      "send_bytes",
+		Help:      "Number of bytes read from zfs send for a given filesystem",
+	}, []string{"filesystem"})
+	prom.ZFSRecvBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "zrepl",
+		Subsystem: "zfs",
+		Name:      "recv_bytes",
+		Help:      "Number of bytes written to zfs recv for a given filesystem",
+	}, []string{"filesystem"})
+	prom.ZFSSendSizeEstimateDivergences = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "zrepl",
+		Subsystem: "zfs",
+		Name:      "send_size_estimate_divergences",
+		Help:      "Number of sends of a given filesystem whose actual size diverged significantly from the dry-run estimate",
+	}, []string{"filesystem"})
 }
 
 func PrometheusRegister(registry prometheus.Registerer) error {
@@ -49,5 +74,33 @@ func PrometheusRegister(registry prometheus.Registerer) error {
 	if err := registry.Register(prom.ZFSDestroyDuration); err != nil {
 		return err
 	}
+	if err := registry.Register(prom.ZFSSendBytes); err != nil {
+		return err
+	}
+	if err := registry.Register(prom.ZFSRecvBytes); err != nil {
+		return err
+	}
+	if err := registry.Register(prom.ZFSSendSizeEstimateDivergences); err != nil {
+		return err
+	}
 	return nil
 }
+
+// PromCountingWriter adds the number of bytes written through it to a counter,
+// i.e. the counter is incremented during the copy, not only on completion.
+type PromCountingWriter struct {
+	w       io.Writer
+	counter prometheus.Counter
+}
+
+func NewPromCountingWriter(w io.Writer, counter prometheus.Counter) PromCountingWriter {
+	return PromCountingWriter{w, counter}
+}
+
+func (w PromCountingWriter) Write(p []byte) (n int, err error) {
+	n, err = w.w.Write(p)
+	if n > 0 {
+		w.counter.Add(float64(n))
+	}
+	return n, err
+}
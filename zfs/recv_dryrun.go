@@ -0,0 +1,109 @@
+package zfs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// RecvDryRunReport describes whether a stream can be received into a filesystem.
+type RecvDryRunReport struct {
+	Filesystem string
+	// The pool features that the stream requires on the receiving pool, e.g. "large_blocks".
+	RequiredPoolFeatures []string
+	// The subset of RequiredPoolFeatures that is not enabled or active on the receiving pool.
+	MissingPoolFeatures []string
+	// The error returned by `zfs recv -n`, nil if the dry-run succeeded.
+	// MissingPoolFeatures is usually the more actionable information.
+	RecvErr error
+	// From the stream header, FromGUID is 0 for a full stream.
+	FromGUID, ToGUID uint64
+	// What `zfs recv -n -v` reported it would receive.
+	// nil if the dry-run failed or the output was not understood.
+	WouldReceive *RecvDryRunWouldReceive
+}
+
+// RecvDryRunWouldReceive is the parsed output of `zfs recv -n -v`, e.g.
+//   would receive incremental stream of pool/src@b into pool/dst@b
+type RecvDryRunWouldReceive struct {
+	Incremental bool
+	// The snapshot as named in the stream.
+	StreamSnapshot string
+	// The snapshot that would be created by the receive.
+	ResultingSnapshot string
+}
+
+func (r *RecvDryRunReport) Compatible() bool {
+	return len(r.MissingPoolFeatures) == 0 && r.RecvErr == nil
+}
+
+func (r *RecvDryRunReport) String() string {
+	if r.Compatible() {
+		return fmt.Sprintf("stream can be received into %q", r.Filesystem)
+	}
+	var reasons []string
+	if len(r.MissingPoolFeatures) > 0 {
+		reasons = append(reasons, fmt.Sprintf("pool features not enabled: %s", strings.Join(r.MissingPoolFeatures, ", ")))
+	}
+	if r.RecvErr != nil {
+		reasons = append(reasons, r.RecvErr.Error())
+	}
+	return fmt.Sprintf("stream cannot be received into %q: %s", r.Filesystem, strings.Join(reasons, "; "))
+}
+
+// ZFSRecvDryRun dry-run-receives the stream into fs using `zfs recv -n -v`
+// and determines whether the receiving pool supports the pool features required by the stream.
+// opts.DryRun is implied.
+//
+// Failure of `zfs recv -n` is reported in RecvDryRunReport.RecvErr.
+// An error is returned if the report could not be created, e.g. because the stream is not a valid send stream.
+func ZFSRecvDryRun(ctx context.Context, fs string, streamCopier StreamCopier, opts RecvOptions) (*RecvDryRunReport, error) {
+	fsdp, err := NewDatasetPath(fs)
+	if err != nil {
+		return nil, err
+	}
+	if fsdp.Empty() {
+		return nil, fmt.Errorf("filesystem path must have length > 0")
+	}
+
+	var header *sendStreamBeginHeader
+	opts.DryRun = true
+	opts.onHeader = func(h *sendStreamBeginHeader) { header = h }
+	res, recvErr := ZFSRecv(ctx, fs, streamCopier, opts)
+	if header == nil {
+		if recvErr != nil {
+			return nil, recvErr
+		}
+		return nil, fmt.Errorf("stream ended before its header could be read")
+	}
+
+	report := &RecvDryRunReport{
+		Filesystem:           fs,
+		RequiredPoolFeatures: header.RequiredPoolFeatures(),
+		RecvErr:              recvErr,
+		FromGUID:             header.FromGUID,
+		ToGUID:               header.ToGUID,
+	}
+	if recvErr == nil && res != nil && res.ResultingSnapshot != "" {
+		report.WouldReceive = &RecvDryRunWouldReceive{
+			Incremental:       res.Incremental,
+			StreamSnapshot:    res.StreamSnapshot,
+			ResultingSnapshot: res.ResultingSnapshot,
+		}
+	}
+	if len(report.RequiredPoolFeatures) == 0 {
+		return report, nil
+	}
+	poolFeatures, err := ZPoolGetFeatures(ctx, fsdp.comps[0])
+	if err != nil {
+		return nil, fmt.Errorf("cannot get pool features: %s", err)
+	}
+	for _, f := range report.RequiredPoolFeatures {
+		switch poolFeatures[f] {
+		case "enabled", "active":
+		default: // "disabled" or not supported by the pool's ZFS version
+			report.MissingPoolFeatures = append(report.MissingPoolFeatures, f)
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,86 @@
+package zfs
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeLargeBlocksStream() []byte {
+	b := makeSendStreamBeginHeader(binary.LittleEndian, 0x2342, 0)
+	const largeBlocks = 1 << 19
+	binary.LittleEndian.PutUint64(b[16:24], largeBlocks<<2|1)
+	return b
+}
+
+func TestSendStreamBeginHeaderRequiredPoolFeatures(t *testing.T) {
+	h, err := parseSendStreamBeginHeader(makeLargeBlocksStream())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"large_blocks"}, h.RequiredPoolFeatures())
+
+	h, err = parseSendStreamBeginHeader(makeSendStreamBeginHeader(binary.LittleEndian, 1, 0))
+	require.NoError(t, err)
+	assert.Empty(t, h.RequiredPoolFeatures())
+}
+
+func TestZFSRecvDryRunLargeBlocks(t *testing.T) {
+	stream := makeLargeBlocksStream()
+
+	// zfs recv -n consumes the stream and fails if the pool lacks the feature
+	defer withFakeZFSBinary(t, fmt.Sprintf(`
+test "$*" = "recv -n -v pool/fs" || exit 1
+head -c %d > /dev/null
+test "$LARGE_BLOCKS" = "enabled" || { echo "cannot receive: pool must be upgraded to receive this stream." >&2; exit 1; }
+echo "would receive full stream of src/fs@a into pool/fs@a"
+`, len(stream)))()
+	defer withFakeZPoolBinary(t, `
+test "$*" = "get -H -p -o property,value all pool" || exit 1
+printf 'size\t1073741824\nfeature@lz4_compress\tactive\nfeature@large_blocks\t%s\n' "$LARGE_BLOCKS"
+`)()
+
+	t.Run("withFeature", func(t *testing.T) {
+		defer setenv(t, "LARGE_BLOCKS", "enabled")()
+		report, err := ZFSRecvDryRun(context.Background(), "pool/fs", &bytesStreamCopier{stream}, RecvOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"large_blocks"}, report.RequiredPoolFeatures)
+		assert.Empty(t, report.MissingPoolFeatures)
+		assert.NoError(t, report.RecvErr)
+		assert.True(t, report.Compatible())
+		assert.Equal(t, uint64(0x2342), report.ToGUID)
+		assert.Equal(t, &RecvDryRunWouldReceive{false, "src/fs@a", "pool/fs@a"}, report.WouldReceive)
+	})
+
+	t.Run("withoutFeature", func(t *testing.T) {
+		defer setenv(t, "LARGE_BLOCKS", "disabled")()
+		report, err := ZFSRecvDryRun(context.Background(), "pool/fs", &bytesStreamCopier{stream}, RecvOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"large_blocks"}, report.MissingPoolFeatures)
+		assert.Error(t, report.RecvErr)
+		assert.False(t, report.Compatible())
+		assert.Contains(t, report.String(), "large_blocks")
+		assert.Nil(t, report.WouldReceive)
+	})
+}
+
+func setenv(t *testing.T, key, value string) (restore func()) {
+	prev, had := os.LookupEnv(key)
+	require.NoError(t, os.Setenv(key, value))
+	return func() {
+		if had {
+			os.Setenv(key, prev)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+func TestParseZPoolGetFeatures(t *testing.T) {
+	features, err := parseZPoolGetFeatures([]byte("size\t100\nfeature@async_destroy\tenabled\nfeature@large_blocks\tdisabled\n"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"async_destroy": "enabled", "large_blocks": "disabled"}, features)
+}
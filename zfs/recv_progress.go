@@ -0,0 +1,37 @@
+package zfs
+
+import (
+	"io"
+	"time"
+)
+
+// recvProgressWriter counts the bytes written through it and reports
+// the running total to cb at most once per interval.
+// It is not goroutine-safe.
+type recvProgressWriter struct {
+	w        io.Writer
+	cb       func(received int64)
+	every    time.Duration
+	lastCbAt time.Time
+	total    int64
+}
+
+func newRecvProgressWriter(w io.Writer, every time.Duration, cb func(received int64)) *recvProgressWriter {
+	return &recvProgressWriter{w: w, cb: cb, every: every}
+}
+
+func (w *recvProgressWriter) Write(p []byte) (n int, err error) {
+	n, err = w.w.Write(p)
+	w.total += int64(n)
+	now := time.Now()
+	if now.Sub(w.lastCbAt) >= w.every {
+		w.cb(w.total)
+		w.lastCbAt = now
+	}
+	return n, err
+}
+
+// finish reports the final total
+func (w *recvProgressWriter) finish() {
+	w.cb(w.total)
+}
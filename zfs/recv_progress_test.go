@@ -0,0 +1,51 @@
+package zfs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type chunkedStreamCopier struct {
+	chunks, chunkSize int
+}
+
+func (c *chunkedStreamCopier) WriteStreamTo(w io.Writer) StreamCopierError {
+	buf := make([]byte, c.chunkSize)
+	for i := 0; i < c.chunks; i++ {
+		if _, err := w.Write(buf); err != nil {
+			return sendStreamCopierError{isReadErr: false, err: err}
+		}
+	}
+	return nil
+}
+
+func (c *chunkedStreamCopier) Close() error { return nil }
+
+func TestZFSRecvReportsProgress(t *testing.T) {
+	const chunks, chunkSize = 16, 1 << 12
+
+	// like zfs recv, exit after the end of the stream without waiting for EOF
+	defer withFakeZFSBinary(t, fmt.Sprintf("head -c %d > /dev/null\n", chunks*chunkSize))()
+
+	var reports []int64
+	opts := RecvOptions{
+		OnProgress: func(received int64) {
+			reports = append(reports, received)
+		},
+		ProgressInterval: 0, // report on every write
+	}
+	_, err := ZFSRecv(context.Background(), "pool/fs", &chunkedStreamCopier{chunks, chunkSize}, opts)
+	require.NoError(t, err)
+
+	// one report per chunk + the final one
+	require.Len(t, reports, chunks+1)
+	for i := 0; i < chunks; i++ {
+		assert.Equal(t, int64((i+1)*chunkSize), reports[i])
+	}
+	assert.Equal(t, int64(chunks*chunkSize), reports[chunks])
+}
@@ -0,0 +1,78 @@
+package zfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// RecvResult describes what ZFSRecv did.
+type RecvResult struct {
+	// The filesystem that was received into.
+	// Differs from the filesystem passed to ZFSRecv if RecvOptions.FullRecvIntoExisting
+	// is FullRecvIntoExistingNewSibling and a new sibling was created.
+	Filesystem string
+	// The number of stream bytes written to `zfs recv`.
+	// Counted by zrepl, hence exact and available irrespective of RecvOptions.Verbose.
+	BytesWritten int64
+
+	// Parsed from the output of `zfs recv -v`, i.e., only set if RecvOptions.Verbose or DryRun was set.
+	Incremental bool
+	// The snapshot as named in the stream.
+	StreamSnapshot string
+	// The snapshot created by the receive.
+	ResultingSnapshot string
+
+	// Only set if RecvOptions.SavePartial was set and the receive failed:
+	// the receive_resume_token of the partially received state,
+	// empty if ZFS did not save any (e.g., because the stream did not get past its first record).
+	PartialResumeToken string
+
+	started bool
+}
+
+var recvVerboseOutputRegex = regexp.MustCompile(`^(?:would receive|receiving) (full|incremental) stream of (\S+@\S+) into (\S+@\S+)$`)
+
+func (r *RecvResult) setFromVerboseOutput(output []byte) {
+	s := bufio.NewScanner(bytes.NewReader(output))
+	for s.Scan() {
+		m := recvVerboseOutputRegex.FindStringSubmatch(strings.TrimSpace(s.Text()))
+		if m == nil {
+			continue
+		}
+		r.Incremental = m[1] == "incremental"
+		r.StreamSnapshot = m[2]
+		r.ResultingSnapshot = m[3]
+		return
+	}
+	debug("recv: no stream info in verbose output %q", output)
+}
+
+type recvResultCountingWriter struct {
+	w   io.Writer
+	res *RecvResult
+}
+
+func (w *recvResultCountingWriter) Write(p []byte) (n int, err error) {
+	n, err = w.w.Write(p)
+	atomic.AddInt64(&w.res.BytesWritten, int64(n))
+	return n, err
+}
+
+// returns "" if fs has no receive_resume_token or it cannot be determined
+func recvPartialResumeToken(ctx context.Context, fs string) string {
+	fsdp, err := NewDatasetPath(fs)
+	if err != nil {
+		return ""
+	}
+	token, err := ZFSGetReceiveResumeToken(ctx, fsdp)
+	if err != nil {
+		debug("recv: cannot get receive_resume_token of %q after failed receive: %s", fs, err)
+		return ""
+	}
+	return token
+}
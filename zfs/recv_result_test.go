@@ -0,0 +1,68 @@
+package zfs
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZFSRecvResultVerbose(t *testing.T) {
+	stream := makeSendStreamBeginHeader(binary.LittleEndian, 0x2342, 0x2323)
+
+	defer withFakeZFSBinary(t, fmt.Sprintf(`
+test "$*" = "recv -v pool/fs" || exit 1
+head -c %d > /dev/null
+echo "receiving incremental stream of src/fs@b into pool/fs@b"
+echo "received %dB stream in 1 seconds (%dB/sec)"
+`, len(stream), len(stream), len(stream)))()
+
+	res, err := ZFSRecv(context.Background(), "pool/fs", &bytesStreamCopier{stream}, RecvOptions{Verbose: true})
+	require.NoError(t, err)
+	assert.Equal(t, &RecvResult{
+		Filesystem:        "pool/fs",
+		BytesWritten:      int64(len(stream)),
+		Incremental:       true,
+		StreamSnapshot:    "src/fs@b",
+		ResultingSnapshot: "pool/fs@b",
+		started:           true,
+	}, res)
+}
+
+func TestZFSRecvResultSavePartial(t *testing.T) {
+	stream := makeSendStreamBeginHeader(binary.LittleEndian, 0x2342, 0)
+
+	defer withFakeZFSBinary(t, fmt.Sprintf(`
+case "$1" in
+recv)
+	test "$*" = "recv -s pool/fs" || exit 1
+	head -c %d > /dev/null
+	echo "cannot receive new filesystem stream: checksum mismatch or incomplete stream." >&2
+	echo "Partially received snapshot is saved." >&2
+	exit 1
+	;;
+get)
+	printf 'receive_resume_token\t1-abc-def\t-\n'
+	;;
+esac
+`, len(stream)))()
+
+	res, err := ZFSRecv(context.Background(), "pool/fs", &bytesStreamCopier{stream}, RecvOptions{SavePartial: true})
+	require.Error(t, err)
+	require.NotNil(t, res)
+	assert.Equal(t, "1-abc-def", res.PartialResumeToken)
+	assert.Equal(t, int64(len(stream)), res.BytesWritten)
+}
+
+func TestRecvResultSetFromVerboseOutput(t *testing.T) {
+	var r RecvResult
+	r.setFromVerboseOutput([]byte("would receive full stream of pool/src@a into pool/dst@a\n"))
+	assert.Equal(t, RecvResult{Incremental: false, StreamSnapshot: "pool/src@a", ResultingSnapshot: "pool/dst@a"}, r)
+
+	r = RecvResult{}
+	r.setFromVerboseOutput([]byte("something else\n"))
+	assert.Equal(t, RecvResult{}, r)
+}
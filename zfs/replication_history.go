@@ -1,50 +1,180 @@
 package zfs
 
 import (
+	"context"
 	"fmt"
+	"regexp"
+	"strings"
 
 	"github.com/pkg/errors"
 )
 
+// ReplicationCursorBookmarkName is the name of the default replication cursor.
+// Use ReplicationCursorBookmarkNameForJob if multiple jobs replicate the same filesystem.
 const ReplicationCursorBookmarkName = "zrepl_replication_cursor"
 
+// valid characters for the job id component of a replication cursor name (subset of ZFS's bookmark name charset)
+var replicationCursorJobIDRegex = regexp.MustCompile(`^[a-zA-Z0-9_.:-]+$`)
+
+// The bookmarks of a replication cursor are named <cursor name>_G<guid of the snapshot, 16 hex digits>.
+// Older versions of zrepl used the plain cursor name, which is still recognized.
+var replicationCursorGUIDSuffixRegex = regexp.MustCompile(`_G[0-9a-f]{16}$`)
+
+// ReplicationCursorBookmarkNameForJob returns the name of the replication cursor
+// for jobID, i.e. zrepl_replication_cursor_<jobID>.
+// Returns an error if jobID contains characters that are not valid in bookmark names
+// or if the cursor's bookmarks could be confused with those of another cursor.
+func ReplicationCursorBookmarkNameForJob(jobID string) (string, error) {
+	if !replicationCursorJobIDRegex.MatchString(jobID) {
+		return "", fmt.Errorf("invalid job id for replication cursor name: %q", jobID)
+	}
+	if replicationCursorGUIDSuffixRegex.MatchString("_" + jobID) {
+		return "", fmt.Errorf("job id for replication cursor name must not end in %q: %q", "_G<16 hex digits>", jobID)
+	}
+	return ReplicationCursorBookmarkName + "_" + jobID, nil
+}
+
+// IsReplicationCursorBookmarkName returns true for the names of the bookmarks
+// of the default replication cursor and the cursors named by ReplicationCursorBookmarkNameForJob.
+func IsReplicationCursorBookmarkName(name string) bool {
+	return name == ReplicationCursorBookmarkName ||
+		strings.HasPrefix(name, ReplicationCursorBookmarkName+"_")
+}
+
+func replicationCursorBookmarkName(name string, guid uint64) string {
+	return fmt.Sprintf("%s_G%016x", name, guid)
+}
+
+// whether bookmark is a bookmark of the replication cursor name
+func isReplicationCursorBookmarkOf(name, bookmark string) bool {
+	if bookmark == name {
+		return true // created by older versions of zrepl
+	}
+	return strings.HasPrefix(bookmark, name) &&
+		replicationCursorGUIDSuffixRegex.MatchString(bookmark) &&
+		len(bookmark) == len(replicationCursorBookmarkName(name, 0))
+}
+
 // may return nil for both values, indicating there is no cursor
-func ZFSGetReplicationCursor(fs *DatasetPath) (*FilesystemVersion, error) {
-	versions, err := ZFSListFilesystemVersions(fs, nil)
+func ZFSGetReplicationCursor(ctx context.Context, fs *DatasetPath) (*FilesystemVersion, error) {
+	return ZFSGetReplicationCursorByName(ctx, fs, ReplicationCursorBookmarkName)
+}
+
+// may return nil for both values, indicating there is no cursor
+//
+// If a previous ZFSSetReplicationCursorByName was interrupted before destroying the old cursor's bookmark,
+// the cursor is the newest of the remaining bookmarks.
+func ZFSGetReplicationCursorByName(ctx context.Context, fs *DatasetPath, name string) (*FilesystemVersion, error) {
+	return getReplicationCursor(ctx, zfsReplicationCursorOps{}, fs, name)
+}
+
+func ZFSSetReplicationCursor(ctx context.Context, fs *DatasetPath, snapname string) (guid uint64, err error) {
+	return ZFSSetReplicationCursorByName(ctx, fs, ReplicationCursorBookmarkName, snapname)
+}
+
+// ZFSSetReplicationCursorByName moves the replication cursor name to snapshot snapname.
+//
+// ZFS cannot rename bookmarks, hence the cursor is moved by creating a new bookmark
+// whose name contains the snapshot's GUID (see replicationCursorBookmarkName)
+// and destroying the bookmarks of the old position afterwards.
+// If the update is interrupted at any point, either the old or the new bookmark
+// remains available, and the next call to this function destroys the leftovers.
+func ZFSSetReplicationCursorByName(ctx context.Context, fs *DatasetPath, name, snapname string) (guid uint64, err error) {
+	return setReplicationCursor(ctx, zfsReplicationCursorOps{}, fs, name, snapname)
+}
+
+// replicationCursorOps are the ZFS operations required to maintain a replication cursor.
+// Abstracted for testing.
+type replicationCursorOps interface {
+	ListBookmarks(ctx context.Context, fs *DatasetPath) ([]FilesystemVersion, error)
+	GetCreateTXGAndGuid(ctx context.Context, ds string) (ZFSPropCreateTxgAndGuidProps, error)
+	Bookmark(ctx context.Context, fs *DatasetPath, snapshot, bookmark string) error
+	Destroy(ctx context.Context, ds string) error
+}
+
+type zfsReplicationCursorOps struct{}
+
+func (zfsReplicationCursorOps) ListBookmarks(ctx context.Context, fs *DatasetPath) ([]FilesystemVersion, error) {
+	return ZFSListBookmarks(ctx, fs)
+}
+
+func (zfsReplicationCursorOps) GetCreateTXGAndGuid(ctx context.Context, ds string) (ZFSPropCreateTxgAndGuidProps, error) {
+	return ZFSGetCreateTXGAndGuid(ctx, ds)
+}
+
+func (zfsReplicationCursorOps) Bookmark(ctx context.Context, fs *DatasetPath, snapshot, bookmark string) error {
+	return ZFSBookmark(ctx, fs, snapshot, bookmark)
+}
+
+func (zfsReplicationCursorOps) Destroy(ctx context.Context, ds string) error { return ZFSDestroy(ctx, ds) }
+
+// returns the bookmarks of the replication cursor name and the newest of them, which is the cursor
+func listReplicationCursorBookmarks(ctx context.Context, ops replicationCursorOps, fs *DatasetPath, name string) (bookmarks []FilesystemVersion, newest *FilesystemVersion, err error) {
+	all, err := ops.ListBookmarks(ctx, fs)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	for _, v := range all {
+		if isReplicationCursorBookmarkOf(name, v.Name) {
+			bookmarks = append(bookmarks, v)
+		}
 	}
-	for _, v := range versions {
-		if v.Type == Bookmark && v.Name == ReplicationCursorBookmarkName {
-			return &v, nil
+	for i := range bookmarks {
+		if newest == nil || bookmarks[i].CreateTXG > newest.CreateTXG {
+			newest = &bookmarks[i]
 		}
 	}
-	return nil, nil
+	return bookmarks, newest, nil
 }
 
-func ZFSSetReplicationCursor(fs *DatasetPath, snapname string) (guid uint64, err error) {
+func getReplicationCursor(ctx context.Context, ops replicationCursorOps, fs *DatasetPath, name string) (*FilesystemVersion, error) {
+	bookmarks, cursor, err := listReplicationCursorBookmarks(ctx, ops, fs, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(bookmarks) > 1 {
+		debug("replication cursor: %d bookmarks left by interrupted update, using newest %q", len(bookmarks), cursor.Name)
+	}
+	return cursor, nil
+}
+
+func setReplicationCursor(ctx context.Context, ops replicationCursorOps, fs *DatasetPath, name, snapname string) (guid uint64, err error) {
+	if !IsReplicationCursorBookmarkName(name) || replicationCursorGUIDSuffixRegex.MatchString(name) {
+		return 0, fmt.Errorf("zfs: replication cursor: invalid cursor name %q", name)
+	}
 	snapPath := fmt.Sprintf("%s@%s", fs.ToString(), snapname)
 	debug("replication cursor: snap path %q", snapPath)
-	snapProps, err := ZFSGetCreateTXGAndGuid(snapPath)
+	snapProps, err := ops.GetCreateTXGAndGuid(ctx, snapPath)
 	if err != nil {
 		return 0, errors.Wrapf(err, "get properties of %q", snapPath)
 	}
-	bookmarkPath := fmt.Sprintf("%s#%s", fs.ToString(), ReplicationCursorBookmarkName)
-	propsBookmark, err := ZFSGetCreateTXGAndGuid(bookmarkPath)
-	_, bookmarkNotExistErr := err.(*DatasetDoesNotExist)
-	if err != nil && !bookmarkNotExistErr {
-		return 0, errors.Wrap(err, "zfs: replication cursor: get bookmark txg")
+
+	bookmarks, cursor, err := listReplicationCursorBookmarks(ctx, ops, fs, name)
+	if err != nil {
+		return 0, errors.Wrap(err, "zfs: replication cursor: list bookmarks")
+	}
+	if cursor != nil && snapProps.CreateTXG < cursor.CreateTXG {
+		return 0, errors.New("zfs: replication cursor: can only be advanced, not set back")
 	}
-	if err == nil {
-		if snapProps.CreateTXG < propsBookmark.CreateTXG {
-			return 0, errors.New("zfs: replication cursor: can only be advanced, not set back")
-		}
-		if err := ZFSDestroy(bookmarkPath); err != nil { // FIXME make safer by using new temporary bookmark, then rename, possible with channel programs
-			return 0, errors.Wrap(err, "zfs: replication cursor: destroy current cursor")
+
+	newName := replicationCursorBookmarkName(name, snapProps.Guid)
+	exists := false
+	for _, v := range bookmarks {
+		exists = exists || v.Name == newName
+	}
+	if !exists {
+		if err := ops.Bookmark(ctx, fs, snapname, newName); err != nil {
+			return 0, errors.Wrapf(err, "zfs: replication cursor: create bookmark")
 		}
 	}
-	if err := ZFSBookmark(fs, snapname, ReplicationCursorBookmarkName); err != nil {
-		return 0, errors.Wrapf(err, "zfs: replication cursor: create bookmark")
+	// the new bookmark exists, the old ones can go
+	for _, v := range bookmarks {
+		if v.Name == newName {
+			continue
+		}
+		if err := ops.Destroy(ctx, zfsBuildBookmarkName(fs, v.Name)); err != nil {
+			return 0, errors.Wrap(err, "zfs: replication cursor: destroy bookmark of previous cursor position")
+		}
 	}
 	return snapProps.Guid, nil
 }
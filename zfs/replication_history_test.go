@@ -0,0 +1,188 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errFakeCrash = errors.New("crash")
+
+// fakeReplicationCursorOps keeps the snapshots and bookmarks of a single filesystem in memory.
+// If crashAfter is >= 0, the mutating operation after crashAfter successful ones fails with errFakeCrash.
+type fakeReplicationCursorOps struct {
+	snaps      map[string]FilesystemVersion
+	bookmarks  map[string]FilesystemVersion
+	crashAfter int
+}
+
+func (o *fakeReplicationCursorOps) mutate() error {
+	if o.crashAfter == 0 {
+		return errFakeCrash
+	}
+	o.crashAfter--
+	return nil
+}
+
+func (o *fakeReplicationCursorOps) ListBookmarks(ctx context.Context, fs *DatasetPath) ([]FilesystemVersion, error) {
+	var vs []FilesystemVersion
+	for _, v := range o.bookmarks {
+		vs = append(vs, v)
+	}
+	return vs, nil
+}
+
+func (o *fakeReplicationCursorOps) GetCreateTXGAndGuid(ctx context.Context, ds string) (ZFSPropCreateTxgAndGuidProps, error) {
+	var v FilesystemVersion
+	var ok bool
+	if i := strings.IndexAny(ds, "@#"); i != -1 && ds[i] == '@' {
+		v, ok = o.snaps[ds[i+1:]]
+	} else if i != -1 {
+		v, ok = o.bookmarks[ds[i+1:]]
+	}
+	if !ok {
+		return ZFSPropCreateTxgAndGuidProps{}, &DatasetDoesNotExist{ds}
+	}
+	return ZFSPropCreateTxgAndGuidProps{CreateTXG: v.CreateTXG, Guid: v.Guid}, nil
+}
+
+func (o *fakeReplicationCursorOps) Bookmark(ctx context.Context, fs *DatasetPath, snapshot, bookmark string) error {
+	if err := o.mutate(); err != nil {
+		return err
+	}
+	s, ok := o.snaps[snapshot]
+	if !ok {
+		return fmt.Errorf("snapshot %q does not exist", snapshot)
+	}
+	if _, ok := o.bookmarks[bookmark]; ok {
+		return fmt.Errorf("bookmark %q exists", bookmark)
+	}
+	s.Type, s.Name = Bookmark, bookmark
+	o.bookmarks[bookmark] = s
+	return nil
+}
+
+func (o *fakeReplicationCursorOps) Destroy(ctx context.Context, ds string) error {
+	if err := o.mutate(); err != nil {
+		return err
+	}
+	name := ds[strings.Index(ds, "#")+1:]
+	if _, ok := o.bookmarks[name]; !ok {
+		return &DatasetDoesNotExist{ds}
+	}
+	delete(o.bookmarks, name)
+	return nil
+}
+
+func TestSetReplicationCursorInterrupted(t *testing.T) {
+	fs, err := NewDatasetPath("pool/fs")
+	require.NoError(t, err)
+
+	newOps := func() *fakeReplicationCursorOps {
+		return &fakeReplicationCursorOps{
+			snaps: map[string]FilesystemVersion{
+				"a": {Type: Snapshot, Name: "a", Guid: 1, CreateTXG: 10},
+				"b": {Type: Snapshot, Name: "b", Guid: 2, CreateTXG: 20},
+			},
+			bookmarks:  map[string]FilesystemVersion{},
+			crashAfter: -1,
+		}
+	}
+
+	for crashAfter := 0; ; crashAfter++ {
+		ops := newOps()
+		_, err := setReplicationCursor(context.Background(), ops, fs, ReplicationCursorBookmarkName, "a")
+		require.NoError(t, err)
+
+		ops.crashAfter = crashAfter
+		_, err = setReplicationCursor(context.Background(), ops, fs, ReplicationCursorBookmarkName, "b")
+		if err == nil {
+			// all steps were executed
+			assert.Equal(t, []string{replicationCursorBookmarkName(ReplicationCursorBookmarkName, 2)}, bookmarkNames(ops))
+			break
+		}
+		require.Contains(t, err.Error(), errFakeCrash.Error())
+
+		cursor, err := getReplicationCursor(context.Background(), ops, fs, ReplicationCursorBookmarkName)
+		require.NoError(t, err)
+		require.NotNil(t, cursor, "crash after %d steps: no cursor", crashAfter)
+		assert.Contains(t, []uint64{1, 2}, cursor.Guid, "crash after %d steps", crashAfter)
+
+		// the next update recovers from the interrupted one
+		ops.crashAfter = -1
+		guid, err := setReplicationCursor(context.Background(), ops, fs, ReplicationCursorBookmarkName, "b")
+		require.NoError(t, err, "crash after %d steps", crashAfter)
+		assert.Equal(t, uint64(2), guid)
+		cursor, err = getReplicationCursor(context.Background(), ops, fs, ReplicationCursorBookmarkName)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), cursor.Guid)
+		assert.Equal(t, []string{replicationCursorBookmarkName(ReplicationCursorBookmarkName, 2)}, bookmarkNames(ops))
+	}
+}
+
+func TestSetReplicationCursorCannotSetBack(t *testing.T) {
+	fs, err := NewDatasetPath("pool/fs")
+	require.NoError(t, err)
+	ops := &fakeReplicationCursorOps{
+		snaps: map[string]FilesystemVersion{
+			"a": {Type: Snapshot, Name: "a", Guid: 1, CreateTXG: 10},
+			"b": {Type: Snapshot, Name: "b", Guid: 2, CreateTXG: 20},
+		},
+		bookmarks:  map[string]FilesystemVersion{},
+		crashAfter: -1,
+	}
+	_, err = setReplicationCursor(context.Background(), ops, fs, ReplicationCursorBookmarkName, "b")
+	require.NoError(t, err)
+	_, err = setReplicationCursor(context.Background(), ops, fs, ReplicationCursorBookmarkName, "a")
+	assert.Error(t, err)
+	cursor, err := getReplicationCursor(context.Background(), ops, fs, ReplicationCursorBookmarkName)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), cursor.Guid)
+}
+
+func bookmarkNames(ops *fakeReplicationCursorOps) (names []string) {
+	for name := range ops.bookmarks {
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestReplicationCursorBookmarkNames(t *testing.T) {
+	name := ReplicationCursorBookmarkName
+	jobName, err := ReplicationCursorBookmarkNameForJob("job1")
+	require.NoError(t, err)
+
+	assert.Equal(t, "zrepl_replication_cursor_G00000000000000ff", replicationCursorBookmarkName(name, 0xff))
+	assert.True(t, isReplicationCursorBookmarkOf(name, name), "bookmarks created by older versions")
+	assert.True(t, isReplicationCursorBookmarkOf(name, replicationCursorBookmarkName(name, 23)))
+	assert.True(t, isReplicationCursorBookmarkOf(jobName, replicationCursorBookmarkName(jobName, 23)))
+	assert.False(t, isReplicationCursorBookmarkOf(name, jobName))
+	assert.False(t, isReplicationCursorBookmarkOf(name, replicationCursorBookmarkName(jobName, 23)))
+	assert.False(t, isReplicationCursorBookmarkOf(jobName, replicationCursorBookmarkName(name, 23)))
+}
+
+func TestSetReplicationCursorReplacesLegacyBookmark(t *testing.T) {
+	fs, err := NewDatasetPath("pool/fs")
+	require.NoError(t, err)
+	ops := &fakeReplicationCursorOps{
+		snaps: map[string]FilesystemVersion{
+			"b": {Type: Snapshot, Name: "b", Guid: 2, CreateTXG: 20},
+		},
+		bookmarks: map[string]FilesystemVersion{
+			ReplicationCursorBookmarkName: {Type: Bookmark, Name: ReplicationCursorBookmarkName, Guid: 1, CreateTXG: 10},
+		},
+		crashAfter: -1,
+	}
+	cursor, err := getReplicationCursor(context.Background(), ops, fs, ReplicationCursorBookmarkName)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), cursor.Guid)
+
+	_, err = setReplicationCursor(context.Background(), ops, fs, ReplicationCursorBookmarkName, "b")
+	require.NoError(t, err)
+	assert.Equal(t, []string{replicationCursorBookmarkName(ReplicationCursorBookmarkName, 2)}, bookmarkNames(ops))
+}
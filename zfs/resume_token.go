@@ -3,18 +3,42 @@ package zfs
 import (
 	"context"
 	"errors"
+	"fmt"
 	"os/exec"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type ResumeToken struct {
 	HasFromGUID, HasToGUID bool
 	FromGUID, ToGUID       uint64
+	ToName                 string
+	// flags of the interrupted send, i.e., the resumed send will use them as well
+	RawOK, CompressOK, EmbedOK, LargeBlockOK bool
 	// no support for other fields
 }
 
+// Describe renders t in a human-readable form for logging, e.g.
+//   incremental fromguid=0x1 toguid=0x2 toname=pool/fs@b rawok=false compressok=true
+func (t *ResumeToken) Describe() string {
+	var b strings.Builder
+	if t.HasFromGUID {
+		fmt.Fprintf(&b, "incremental fromguid=%#x", t.FromGUID)
+	} else {
+		b.WriteString("full")
+	}
+	if t.HasToGUID {
+		fmt.Fprintf(&b, " toguid=%#x", t.ToGUID)
+	}
+	if t.ToName != "" {
+		fmt.Fprintf(&b, " toname=%s", t.ToName)
+	}
+	fmt.Fprintf(&b, " rawok=%v compressok=%v", t.RawOK, t.CompressOK)
+	return b.String()
+}
+
 var resumeTokenNVListRE = regexp.MustCompile(`\t(\S+) = (.*)`)
 var resumeTokenContentsRE = regexp.MustCompile(`resume token contents:\nnvlist version: 0`)
 var resumeTokenIsCorruptRE = regexp.MustCompile(`resume token is corrupt`)
@@ -23,10 +47,10 @@ var ResumeTokenCorruptError = errors.New("resume token is corrupt")
 var ResumeTokenDecodingNotSupported = errors.New("zfs binary does not allow decoding resume token or zrepl cannot scrape zfs output")
 var ResumeTokenParsingError = errors.New("zrepl cannot parse resume token values")
 
-// Abuse 'zfs send' to decode the resume token
+// DecodeResumeToken decodes a receive_resume_token by abusing 'zfs send -nvt'.
 //
 // FIXME: implement nvlist unpacking in Go and read through libzfs_sendrecv.c
-func ParseResumeToken(ctx context.Context, token string) (*ResumeToken, error) {
+func DecodeResumeToken(ctx context.Context, token string) (*ResumeToken, error) {
 
 	// Example resume tokens:
 	//
@@ -46,6 +70,7 @@ func ParseResumeToken(ctx context.Context, token string) (*ResumeToken, error) {
 	//	bytes = 0x0
 	//	toguid = 0x854f02a2dd32cf0d
 	//	toname = pool1/test@b
+	//	compressok = 1
 	//cannot resume send: 'pool1/test@b' used in the initial send no longer exists
 
 	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
@@ -64,6 +89,11 @@ func ParseResumeToken(ctx context.Context, token string) (*ResumeToken, error) {
 			return nil, err
 		}
 	}
+	return parseResumeTokenOutput(output)
+}
+
+func parseResumeTokenOutput(output []byte) (*ResumeToken, error) {
+	var err error
 
 	if !resumeTokenContentsRE.Match(output) {
 		if resumeTokenIsCorruptRE.Match(output) {
@@ -94,6 +124,17 @@ func ParseResumeToken(ctx context.Context, token string) (*ResumeToken, error) {
 				return nil, ResumeTokenParsingError
 			}
 			rt.HasToGUID = true
+		case "toname":
+			rt.ToName = val
+		// boolean nvpairs are only present if set
+		case "rawok":
+			rt.RawOK = true
+		case "compressok":
+			rt.CompressOK = true
+		case "embedok":
+			rt.EmbedOK = true
+		case "largeblockok":
+			rt.LargeBlockOK = true
 		}
 	}
 
@@ -105,9 +146,9 @@ func ParseResumeToken(ctx context.Context, token string) (*ResumeToken, error) {
 
 }
 
-func ZFSGetReceiveResumeToken(fs *DatasetPath) (string, error) {
+func ZFSGetReceiveResumeToken(ctx context.Context, fs *DatasetPath) (string, error) {
 	const prop_receive_resume_token = "receive_resume_token"
-	props, err := ZFSGet(fs, []string{prop_receive_resume_token})
+	props, err := ZFSGet(ctx, fs, []string{prop_receive_resume_token})
 	if err != nil {
 		return "", err
 	}
@@ -119,3 +160,33 @@ func ZFSGetReceiveResumeToken(fs *DatasetPath) (string, error) {
 	}
 
 }
+
+// ActiveReceiveError is returned by ZFSSendPreflightCheckNotReceiving
+// if the filesystem has a partially received state.
+type ActiveReceiveError struct {
+	Filesystem  string
+	ResumeToken string
+}
+
+func (e *ActiveReceiveError) Error() string {
+	return fmt.Sprintf("filesystem %q is in the middle of a receive (has receive_resume_token), refusing to send from it", e.Filesystem)
+}
+
+// ZFSSendPreflightCheckNotReceiving is a best-effort check that fs is not being received into.
+// Sending from a filesystem with a partial receive could capture an inconsistent state,
+// e.g. in bidirectional setups.
+//
+// Returns *ActiveReceiveError if fs has a receive_resume_token.
+// Any other error means that the check could not be performed
+// (e.g. because the platform does not support receive_resume_token);
+// callers should not treat it as a reason to abort the send.
+func ZFSSendPreflightCheckNotReceiving(ctx context.Context, fs *DatasetPath) error {
+	token, err := ZFSGetReceiveResumeToken(ctx, fs)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		return &ActiveReceiveError{Filesystem: fs.ToString(), ResumeToken: token}
+	}
+	return nil
+}
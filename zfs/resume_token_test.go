@@ -18,7 +18,7 @@ type ResumeTokenTest struct {
 
 func (rtt *ResumeTokenTest) Test(t *testing.T) {
 	t.Log(rtt.Msg)
-	res, err := zfs.ParseResumeToken(context.TODO(), rtt.Token)
+	res, err := zfs.DecodeResumeToken(context.TODO(), rtt.Token)
 
 	if rtt.ExpectError != nil {
 		assert.EqualValues(t, rtt.ExpectError, err)
@@ -31,7 +31,7 @@ func (rtt *ResumeTokenTest) Test(t *testing.T) {
 	}
 }
 
-func TestParseResumeToken(t *testing.T) {
+func TestDecodeResumeToken(t *testing.T) {
 
 	t.SkipNow() // FIXME not compatible with docker
 
@@ -0,0 +1,32 @@
+package zfs
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+
+	"github.com/zrepl/zrepl/util/envconst"
+)
+
+var bookmarkSizeEstimateSupport cachedProbe
+
+// BookmarkSizeEstimateSupported reports whether the zfs binary can estimate the size
+// of an incremental send whose source is a bookmark (`zfs send -n -P -i fs#bm fs@snap`).
+// The result of a successful feature check is cached for the lifetime of the process,
+// a failed check is retried on the next call.
+func BookmarkSizeEstimateSupported(ctx context.Context) (bool, error) {
+	return bookmarkSizeEstimateSupport.get(nil, func() (bool, error) {
+		// "feature discovery": estimation from bookmarks was introduced
+		// together with redacted send, whose --redact flag is listed in the usage text
+		cmd := exec.CommandContext(ctx, ZFS_BINARY, "send")
+		output, err := cmd.CombinedOutput()
+		if _, ok := err.(*exec.ExitError); err != nil && !ok {
+			debug("bookmark size estimate feature check failed: %T %s", err, err)
+			return false, err
+		}
+		def := strings.Contains(string(output), "--redact")
+		supported := envconst.Bool("ZREPL_EXPERIMENTAL_ZFS_SEND_SIZE_ESTIMATE_FROM_BOOKMARK_SUPPORTED", def)
+		debug("bookmark size estimate feature check complete: supported=%v", supported)
+		return supported, nil
+	})
+}
@@ -0,0 +1,83 @@
+package zfs
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SendProgressFunc is invoked for every progress line emitted by `zfs send -v -P`.
+// total is the size estimate printed by zfs send before the stream starts,
+// or -1 if no estimate has been seen (yet).
+type SendProgressFunc func(sent, total int64)
+
+// `zfs send -v -P` progress lines look like this (tab-separated):
+//
+//	11:48:03	1402168	zroot/test/a@2
+var sendProgressLineRegex = regexp.MustCompile(`^[0-9]{2}:[0-9]{2}:[0-9]{2}\t([0-9]+)\t[^\t]+$`)
+
+// lines longer than this are certainly not progress lines and are discarded
+const sendProgressParserMaxLineLength = 4096
+
+// sendProgressParser is an io.Writer that is used as (part of) the stderr of
+// `zfs send -v -P`. It splits the output into lines, picks up the size estimate
+// from the info lines and invokes cb for each progress line.
+type sendProgressParser struct {
+	cb SendProgressFunc
+
+	mtx      sync.Mutex
+	total    int64
+	buf      bytes.Buffer
+	overlong bool // the line currently in buf exceeded sendProgressParserMaxLineLength
+}
+
+func newSendProgressParser(cb SendProgressFunc) *sendProgressParser {
+	return &sendProgressParser{cb: cb, total: -1}
+}
+
+func (p *sendProgressParser) Write(data []byte) (int, error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	for _, c := range data {
+		if c != '\n' {
+			if p.buf.Len() < sendProgressParserMaxLineLength {
+				p.buf.WriteByte(c)
+			} else {
+				p.overlong = true
+			}
+			continue
+		}
+		if !p.overlong {
+			p.parseLine(p.buf.String())
+		}
+		p.buf.Reset()
+		p.overlong = false
+	}
+	return len(data), nil
+}
+
+func (p *sendProgressParser) parseLine(l string) {
+	if m := sendProgressLineRegex.FindStringSubmatch(l); m != nil {
+		sent, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			debug("send progress: cannot parse progress line %q: %s", l, err)
+			return
+		}
+		p.cb(sent, p.total)
+		return
+	}
+	// `size` is printed after the full / incremental info lines, but if it's
+	// not there (older ZFS versions), the info line's estimate is good enough
+	fields := strings.Split(l, "\t")
+	switch fields[0] {
+	case "size", "full", "incremental":
+		total, err := strconv.ParseInt(fields[len(fields)-1], 10, 64)
+		if err != nil {
+			debug("send progress: cannot parse size estimate in line %q: %s", l, err)
+			return
+		}
+		p.total = total
+	}
+}
@@ -0,0 +1,84 @@
+package zfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendProgressParser(t *testing.T) {
+
+	type progress struct{ sent, total int64 }
+
+	tcs := []struct {
+		name   string
+		writes []string
+		exp    []progress
+	}{
+		{
+			name: "full",
+			writes: []string{
+				"full\tzroot/test/a@1\t5389768\n",
+				"size\t5389768\n",
+				"11:48:03\t1402168\tzroot/test/a@1\n",
+				"11:48:04\t4718592\tzroot/test/a@1\n",
+			},
+			exp: []progress{{1402168, 5389768}, {4718592, 5389768}},
+		},
+		{
+			name: "incrementalWithSpaces",
+			writes: []string{
+				"incremental\tblaffoo\tpool1/otherjob/ds with spaces@blaffoo2\t624\n",
+				"11:48:03\t312\tpool1/otherjob/ds with spaces@blaffoo2\n",
+			},
+			exp: []progress{{312, 624}},
+		},
+		{
+			name: "noSizeEstimate",
+			writes: []string{
+				"11:48:03\t1024\tzroot/test/a@1\n",
+			},
+			exp: []progress{{1024, -1}},
+		},
+		{
+			name: "linesSplitAcrossWrites",
+			writes: []string{
+				"size\t20",
+				"48\n11:48",
+				":03\t1024\tzroot/test/a@1",
+				"\n",
+			},
+			exp: []progress{{1024, 2048}},
+		},
+		{
+			name: "incompleteLineIsNotParsed",
+			writes: []string{
+				"11:48:03\t1024\tzroot/test/a@1",
+			},
+			exp: nil,
+		},
+		{
+			name: "unrelatedOutput",
+			writes: []string{
+				"cannot send 'zroot/test/a@1': dataset does not exist\n",
+			},
+			exp: nil,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			var res []progress
+			p := newSendProgressParser(func(sent, total int64) {
+				res = append(res, progress{sent, total})
+			})
+			for _, w := range tc.writes {
+				n, err := p.Write([]byte(w))
+				assert.NoError(t, err)
+				assert.Equal(t, len(w), n)
+			}
+			assert.Equal(t, tc.exp, res)
+		})
+	}
+
+}
@@ -0,0 +1,114 @@
+package zfs
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// SnapSpec identifies a snapshot to be created by ZFSSnapshotMany.
+type SnapSpec struct {
+	FS   *DatasetPath
+	Name string
+}
+
+func (s SnapSpec) String() string { return zfsBuildSnapName(s.FS, s.Name) }
+
+// SnapshotManyFailure is the reason why ZFS refused to create a single snapshot of a ZFSSnapshotMany call.
+type SnapshotManyFailure struct {
+	Snapshot string
+	Reason   string
+}
+
+// SnapshotManyError is returned by ZFSSnapshotMany if ZFS reported per-snapshot failures.
+// Note that none of the snapshots were created in that case.
+type SnapshotManyError struct {
+	Failures []SnapshotManyFailure
+	ZFSError *ZFSError
+}
+
+func (e *SnapshotManyError) Error() string {
+	msgs := make([]string, len(e.Failures))
+	for i, f := range e.Failures {
+		msgs[i] = fmt.Sprintf("%s: %s", f.Snapshot, f.Reason)
+	}
+	return fmt.Sprintf("zfs snapshot failed: %s", strings.Join(msgs, "; "))
+}
+
+var snapshotManyFailureRegexp = regexp.MustCompile(`^cannot create snapshot '([^']+@[^']+)': (.*)$`)
+
+func tryParseSnapshotManyError(zfsErr *ZFSError) *SnapshotManyError {
+	var failures []SnapshotManyFailure
+	lines := bufio.NewScanner(bytes.NewReader(zfsErr.Stderr))
+	for lines.Scan() {
+		m := snapshotManyFailureRegexp.FindStringSubmatch(lines.Text())
+		if m == nil {
+			continue
+		}
+		failures = append(failures, SnapshotManyFailure{Snapshot: m[1], Reason: m[2]})
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+	return &SnapshotManyError{Failures: failures, ZFSError: zfsErr}
+}
+
+// ZFSSnapshotMany creates all snaps with a single `zfs snapshot` invocation,
+// i.e., atomically in the same txg. In contrast to ZFSSnapshot(recursive=true),
+// the filesystems do not need to share a common parent.
+// Either all or none of the snapshots are created.
+//
+// If ZFS reports which snapshots could not be created, the returned error is a *SnapshotManyError.
+func ZFSSnapshotMany(snaps []SnapSpec) (err error) {
+	if len(snaps) == 0 {
+		return nil
+	}
+
+	args := []string{"snapshot"}
+	seen := make(map[string]bool, len(snaps))
+	for _, s := range snaps {
+		if s.FS == nil || s.FS.Empty() {
+			return fmt.Errorf("snapshot filesystem must not be empty")
+		}
+		if s.Name == "" || strings.ContainsAny(s.Name, "@#") {
+			return fmt.Errorf("invalid snapshot name %q", s.Name)
+		}
+		snapname := s.String()
+		if seen[snapname] {
+			return fmt.Errorf("duplicate snapshot %q", snapname)
+		}
+		seen[snapname] = true
+		args = append(args, snapname)
+	}
+
+	for _, s := range snaps {
+		promTimer := prometheus.NewTimer(prom.ZFSSnapshotDuration.WithLabelValues(s.FS.ToString()))
+		defer promTimer.ObserveDuration()
+	}
+
+	cmd := exec.Command(ZFS_BINARY, args...)
+	stderr := bytes.NewBuffer(make([]byte, 0, 1024))
+	cmd.Stderr = stderr
+
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+
+	if err = cmd.Wait(); err != nil {
+		zfsErr := &ZFSError{
+			Stderr:  stderr.Bytes(),
+			WaitErr: err,
+		}
+		if serr := tryParseSnapshotManyError(zfsErr); serr != nil {
+			return serr
+		}
+		return zfsErr
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package zfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZFSSnapshotMany(t *testing.T) {
+	snaps := []SnapSpec{
+		{toDatasetPath("pool/a"), "1"},
+		{toDatasetPath("other/b/c"), "1"},
+	}
+
+	restore := withFakeZFSBinary(t, `
+test "$*" = "snapshot pool/a@1 other/b/c@1" || exit 1
+`)
+	err := ZFSSnapshotMany(snaps)
+	restore()
+	require.NoError(t, err)
+
+	restore = withFakeZFSBinary(t, `
+echo "cannot create snapshot 'other/b/c@1': dataset already exists" >&2
+echo "no snapshots were created" >&2
+exit 1
+`)
+	err = ZFSSnapshotMany(snaps)
+	restore()
+	serr, ok := err.(*SnapshotManyError)
+	require.True(t, ok, "%T %s", err, err)
+	assert.Equal(t, []SnapshotManyFailure{{"other/b/c@1", "dataset already exists"}}, serr.Failures)
+
+	restore = withFakeZFSBinary(t, `
+echo "permission denied" >&2
+exit 1
+`)
+	err = ZFSSnapshotMany(snaps)
+	restore()
+	_, ok = err.(*ZFSError)
+	assert.True(t, ok, "%T %s", err, err)
+
+	dup := append(snaps, SnapSpec{toDatasetPath("pool/a"), "1"})
+	assert.Error(t, ZFSSnapshotMany(dup))
+	assert.Error(t, ZFSSnapshotMany([]SnapSpec{{toDatasetPath("pool/a"), "x@y"}}))
+	assert.NoError(t, ZFSSnapshotMany(nil))
+}
@@ -0,0 +1,225 @@
+package zfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Checksummed streams wrap the bytes of a send stream in frames:
+//
+//   magic (8 bytes)
+//   frame*: length (uint32, > 0) | payload (length bytes) | crc32c(payload) (uint32)
+//   trailer: 0 (uint32) | total payload length (uint64) | crc32c of all payloads (uint32)
+//
+// All integers are big endian.
+// The per-frame checksums locate corruption, the trailer detects truncation
+// and reordering of frames.
+var streamChecksumMagic = [8]byte{'Z', 'R', 'E', 'P', 'L', 'C', 'K', '1'}
+
+const streamChecksumMaxFrameLen = 1 << 20
+
+var streamChecksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+// StreamChecksumMismatchError is returned by the StreamCopier returned from
+// NewChecksumVerifyingStreamCopier if the checksum of a frame or of the entire stream does not match.
+type StreamChecksumMismatchError struct {
+	// The index of the frame and the offset of its first byte in the unframed stream.
+	// If Trailer is true, the cumulative checksum of the stream did not match.
+	Frame            uint64
+	Offset           int64
+	Trailer          bool
+	Expected, Actual uint32
+}
+
+func (e *StreamChecksumMismatchError) Error() string {
+	if e.Trailer {
+		return fmt.Sprintf("stream checksum mismatch: checksum over entire stream is %#08x, expected %#08x", e.Actual, e.Expected)
+	}
+	return fmt.Sprintf("stream checksum mismatch in frame %d at stream offset %d: checksum is %#08x, expected %#08x", e.Frame, e.Offset, e.Actual, e.Expected)
+}
+
+// The data was corrupted before it reached the verifier
+func (e *StreamChecksumMismatchError) IsReadError() bool  { return true }
+func (e *StreamChecksumMismatchError) IsWriteError() bool { return false }
+
+var _ StreamCopierError = (*StreamChecksumMismatchError)(nil)
+
+type checksumFramingStreamCopier struct {
+	sc StreamCopier
+}
+
+// NewChecksumFramingStreamCopier returns a StreamCopier that writes the stream of sc
+// in checksummed frames. The receiving side must unwrap it using NewChecksumVerifyingStreamCopier.
+func NewChecksumFramingStreamCopier(sc StreamCopier) StreamCopier {
+	return &checksumFramingStreamCopier{sc}
+}
+
+type checksumFramingWriter struct {
+	w     io.Writer
+	total uint64
+	crc   uint32
+	hdr   [4]byte
+}
+
+func (f *checksumFramingWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		frame := p
+		if len(frame) > streamChecksumMaxFrameLen {
+			frame = frame[:streamChecksumMaxFrameLen]
+		}
+		binary.BigEndian.PutUint32(f.hdr[:], uint32(len(frame)))
+		if _, err := f.w.Write(f.hdr[:]); err != nil {
+			return n, err
+		}
+		if _, err := f.w.Write(frame); err != nil {
+			return n, err
+		}
+		binary.BigEndian.PutUint32(f.hdr[:], crc32.Checksum(frame, streamChecksumTable))
+		if _, err := f.w.Write(f.hdr[:]); err != nil {
+			return n, err
+		}
+		f.crc = crc32.Update(f.crc, streamChecksumTable, frame)
+		f.total += uint64(len(frame))
+		n += len(frame)
+		p = p[len(frame):]
+	}
+	return n, nil
+}
+
+func (c *checksumFramingStreamCopier) WriteStreamTo(w io.Writer) StreamCopierError {
+	if _, err := w.Write(streamChecksumMagic[:]); err != nil {
+		return sendStreamCopierError{isReadErr: false, err: err}
+	}
+	fw := &checksumFramingWriter{w: w}
+	if err := c.sc.WriteStreamTo(fw); err != nil {
+		return err
+	}
+	var trailer [16]byte
+	binary.BigEndian.PutUint64(trailer[4:12], fw.total)
+	binary.BigEndian.PutUint32(trailer[12:16], fw.crc)
+	if _, err := w.Write(trailer[:]); err != nil {
+		return sendStreamCopierError{isReadErr: false, err: err}
+	}
+	return nil
+}
+
+func (c *checksumFramingStreamCopier) Close() error {
+	return c.sc.Close()
+}
+
+type checksumVerifyingStreamCopier struct {
+	sc StreamCopier
+}
+
+// NewChecksumVerifyingStreamCopier returns a StreamCopier that unwraps the checksummed frames
+// produced by NewChecksumFramingStreamCopier and verifies their checksums.
+// A mismatch is returned as *StreamChecksumMismatchError.
+//
+// Note that the payload of a frame is only written after its checksum has been verified,
+// but the frames before the corrupted one have already been written.
+func NewChecksumVerifyingStreamCopier(sc StreamCopier) StreamCopier {
+	return &checksumVerifyingStreamCopier{sc}
+}
+
+func (c *checksumVerifyingStreamCopier) WriteStreamTo(w io.Writer) StreamCopierError {
+	pr, pw := io.Pipe()
+	scErr := make(chan StreamCopierError, 1)
+	go func() {
+		err := c.sc.WriteStreamTo(pw)
+		if err != nil {
+			pw.CloseWithError(err)
+		} else {
+			pw.Close()
+		}
+		scErr <- err
+	}()
+
+	err := verifyChecksumFrames(pr, w)
+	if err != nil {
+		// unblock c.sc if we stopped reading early
+		pr.CloseWithError(err)
+	}
+	// an error of c.sc is the root cause for our own read error
+	if err := <-scErr; err != nil && err.IsReadError() {
+		return err
+	}
+	return err
+}
+
+func (c *checksumVerifyingStreamCopier) Close() error {
+	return c.sc.Close()
+}
+
+func verifyChecksumFrames(r io.Reader, w io.Writer) StreamCopierError {
+	readErr := func(what string, err error) StreamCopierError {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return sendStreamCopierError{isReadErr: true, err: fmt.Errorf("checksummed stream: %s: %s", what, err)}
+	}
+
+	var magic [8]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return readErr("read magic", err)
+	}
+	if !bytes.Equal(magic[:], streamChecksumMagic[:]) {
+		return readErr("invalid magic", fmt.Errorf("%q", magic))
+	}
+
+	var (
+		hdr    [4]byte
+		buf    = make([]byte, streamChecksumMaxFrameLen)
+		frame  uint64
+		offset int64
+		crc    uint32
+	)
+	for ; ; frame++ {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return readErr("read frame length", err)
+		}
+		l := binary.BigEndian.Uint32(hdr[:])
+		if l == 0 {
+			break // trailer
+		}
+		if l > streamChecksumMaxFrameLen {
+			return readErr("invalid frame length", fmt.Errorf("%d", l))
+		}
+		payload := buf[:l]
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return readErr("read frame", err)
+		}
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return readErr("read frame checksum", err)
+		}
+		expected, actual := binary.BigEndian.Uint32(hdr[:]), crc32.Checksum(payload, streamChecksumTable)
+		if expected != actual {
+			return &StreamChecksumMismatchError{Frame: frame, Offset: offset, Expected: expected, Actual: actual}
+		}
+		if _, err := w.Write(payload); err != nil {
+			return sendStreamCopierError{isReadErr: false, err: err}
+		}
+		crc = crc32.Update(crc, streamChecksumTable, payload)
+		offset += int64(l)
+	}
+
+	var trailer [12]byte
+	if _, err := io.ReadFull(r, trailer[:]); err != nil {
+		return readErr("read trailer", err)
+	}
+	if total := binary.BigEndian.Uint64(trailer[0:8]); total != uint64(offset) {
+		return readErr("trailer", fmt.Errorf("stream length is %d, expected %d", offset, total))
+	}
+	if expected := binary.BigEndian.Uint32(trailer[8:12]); expected != crc {
+		return &StreamChecksumMismatchError{Trailer: true, Expected: expected, Actual: crc}
+	}
+	// there must be nothing after the trailer
+	if n, err := io.ReadFull(r, buf[:1]); n != 0 {
+		return readErr("trailer", fmt.Errorf("unexpected data after trailer"))
+	} else if err != io.EOF {
+		return readErr("read after trailer", err)
+	}
+	return nil
+}
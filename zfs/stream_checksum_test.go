@@ -0,0 +1,85 @@
+package zfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func checksumFramed(t *testing.T, chunks ...[]byte) []byte {
+	var framed bytes.Buffer
+	err := NewChecksumFramingStreamCopier(&teeTestStreamCopier{chunks: chunks}).WriteStreamTo(&framed)
+	require.Nil(t, err)
+	return framed.Bytes()
+}
+
+func TestStreamChecksumRoundtrip(t *testing.T) {
+	large := bytes.Repeat([]byte("0123456789abcdef"), (streamChecksumMaxFrameLen/16)+1)
+	framed := checksumFramed(t, []byte("abc"), large, []byte("def"))
+
+	var out bytes.Buffer
+	err := NewChecksumVerifyingStreamCopier(&bytesStreamCopier{framed}).WriteStreamTo(&out)
+	require.Nil(t, err)
+	assert.Equal(t, append(append([]byte("abc"), large...), "def"...), out.Bytes())
+
+	framed = checksumFramed(t)
+	out.Reset()
+	err = NewChecksumVerifyingStreamCopier(&bytesStreamCopier{framed}).WriteStreamTo(&out)
+	require.Nil(t, err)
+	assert.Equal(t, 0, out.Len())
+}
+
+func TestStreamChecksumMismatch(t *testing.T) {
+	framed := checksumFramed(t, []byte("abc"), []byte("defg"))
+
+	// flip a bit in the payload of the second frame
+	corrupted := append([]byte{}, framed...)
+	corrupted[len(streamChecksumMagic)+4+3+4+4+1] ^= 0x1
+	var out bytes.Buffer
+	err := NewChecksumVerifyingStreamCopier(&bytesStreamCopier{corrupted}).WriteStreamTo(&out)
+	merr, ok := err.(*StreamChecksumMismatchError)
+	require.True(t, ok, "%T %s", err, err)
+	assert.Equal(t, uint64(1), merr.Frame)
+	assert.Equal(t, int64(3), merr.Offset)
+	assert.True(t, merr.IsReadError())
+	assert.Equal(t, "abc", out.String(), "verified frames are written")
+
+	// truncation is detected
+	truncated := framed[:len(framed)-4]
+	err = NewChecksumVerifyingStreamCopier(&bytesStreamCopier{truncated}).WriteStreamTo(&out)
+	require.NotNil(t, err)
+	assert.True(t, err.IsReadError())
+	assert.Contains(t, err.Error(), "trailer")
+
+	// streams without framing are rejected
+	err = NewChecksumVerifyingStreamCopier(&bytesStreamCopier{[]byte("not a framed stream")}).WriteStreamTo(&out)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "magic")
+}
+
+func TestStreamChecksumPropagatesUnderlyingReadError(t *testing.T) {
+	framed := checksumFramed(t, []byte("abc"))
+	sc := &teeTestStreamCopier{chunks: [][]byte{framed[:10]}, readErr: errors.New("connection reset")}
+	var out bytes.Buffer
+	err := NewChecksumVerifyingStreamCopier(sc).WriteStreamTo(&out)
+	require.NotNil(t, err)
+	assert.True(t, err.IsReadError())
+	assert.Contains(t, err.Error(), "connection reset")
+}
+
+func TestZFSRecvStreamChecksum(t *testing.T) {
+	stream := makeSendStreamBeginHeader(binary.LittleEndian, 0x2342, 0)
+	defer withFakeZFSBinary(t, fmt.Sprintf(`
+head -c %d > /dev/null
+`, len(stream)))()
+
+	framed := checksumFramed(t, stream)
+	_, err := ZFSRecv(context.Background(), "pool/fs", &bytesStreamCopier{framed}, RecvOptions{StreamChecksum: true})
+	require.NoError(t, err)
+}
@@ -0,0 +1,123 @@
+package zfs
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type StreamEventType int
+
+const (
+	// The send / recv operation has started.
+	StreamEventStart StreamEventType = iota
+	// The first bytes of the stream have been transferred.
+	StreamEventFirstByte
+	// The operation has completed, successfully if StreamEvent.Err is nil.
+	StreamEventDone
+)
+
+func (t StreamEventType) String() string {
+	switch t {
+	case StreamEventStart:
+		return "start"
+	case StreamEventFirstByte:
+		return "first-byte"
+	case StreamEventDone:
+		return "done"
+	default:
+		return fmt.Sprintf("StreamEventType(%d)", int(t))
+	}
+}
+
+// StreamEvent describes a point in the lifecycle of a ZFSSend or ZFSRecv stream.
+type StreamEvent struct {
+	Type       StreamEventType
+	Filesystem string
+	Time       time.Time
+	// Time elapsed since the StreamEventStart event.
+	SinceStart time.Duration
+	// Number of bytes transferred up to this event.
+	Bytes int64
+	// Only set for StreamEventDone.
+	Err error
+}
+
+// StreamEventFunc is invoked for every StreamEvent of a stream, in the order of StreamEventType.
+// It may be called from different goroutines, but never concurrently for the same stream.
+type StreamEventFunc func(StreamEvent)
+
+// streamEvents emits the StreamEvents of a single stream.
+// All methods are no-ops on a nil *streamEvents.
+type streamEvents struct {
+	bytes int64 // atomic, first field to guarantee 64-bit alignment
+
+	fs        string
+	cb        StreamEventFunc
+	start     time.Time
+	firstByte sync.Once
+	done      sync.Once
+	mtx       sync.Mutex // serializes calls to cb
+}
+
+// returns nil if cb is nil
+func newStreamEvents(fs string, cb StreamEventFunc) *streamEvents {
+	if cb == nil {
+		return nil
+	}
+	return &streamEvents{fs: fs, cb: cb}
+}
+
+func (e *streamEvents) emit(t StreamEventType, now time.Time, err error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.cb(StreamEvent{
+		Type:       t,
+		Filesystem: e.fs,
+		Time:       now,
+		SinceStart: now.Sub(e.start),
+		Bytes:      atomic.LoadInt64(&e.bytes),
+		Err:        err,
+	})
+}
+
+func (e *streamEvents) started() {
+	if e == nil {
+		return
+	}
+	e.start = time.Now()
+	e.emit(StreamEventStart, e.start, nil)
+}
+
+func (e *streamEvents) transferred(n int) {
+	if e == nil || n <= 0 {
+		return
+	}
+	atomic.AddInt64(&e.bytes, int64(n))
+	e.firstByte.Do(func() {
+		e.emit(StreamEventFirstByte, time.Now(), nil)
+	})
+}
+
+// only the first call has an effect
+func (e *streamEvents) finished(err error) {
+	if e == nil {
+		return
+	}
+	e.done.Do(func() {
+		e.emit(StreamEventDone, time.Now(), err)
+	})
+}
+
+type streamEventsWriter struct {
+	w      io.Writer
+	events *streamEvents
+}
+
+func (w streamEventsWriter) Write(p []byte) (n int, err error) {
+	n, err = w.w.Write(p)
+	w.events.transferred(n)
+	return n, err
+}
@@ -0,0 +1,71 @@
+package zfs
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func requireStreamEventsInOrder(t *testing.T, events []StreamEvent, fs string, bytes int64) {
+	require.Len(t, events, 3)
+	for i, typ := range []StreamEventType{StreamEventStart, StreamEventFirstByte, StreamEventDone} {
+		assert.Equal(t, typ, events[i].Type)
+		assert.Equal(t, fs, events[i].Filesystem)
+		if i > 0 {
+			assert.False(t, events[i].Time.Before(events[i-1].Time))
+			assert.True(t, events[i].SinceStart >= events[i-1].SinceStart)
+		}
+	}
+	assert.Equal(t, int64(0), events[0].Bytes)
+	assert.Equal(t, time.Duration(0), events[0].SinceStart)
+	assert.True(t, events[1].Bytes > 0)
+	assert.Equal(t, bytes, events[2].Bytes)
+}
+
+func TestZFSSendEvents(t *testing.T) {
+	const size = 1 << 16
+	defer withFakeZFSBinary(t, fmt.Sprintf("head -c %d /dev/zero\n", size))()
+
+	var events []StreamEvent
+	copier, err := ZFSSend(context.Background(), ZFSSendArgs{FS: "pool/fs", To: "@snap"}, SendOptions{
+		OnEvent: func(e StreamEvent) { events = append(events, e) },
+	})
+	require.NoError(t, err)
+	defer copier.Close()
+	require.NoError(t, copier.WriteStreamTo(ioutil.Discard))
+
+	requireStreamEventsInOrder(t, events, "pool/fs", size)
+	assert.NoError(t, events[2].Err)
+}
+
+func TestZFSRecvEvents(t *testing.T) {
+	const chunks, chunkSize = 4, 1 << 12
+	defer withFakeZFSBinary(t, fmt.Sprintf("head -c %d > /dev/null\n", chunks*chunkSize))()
+
+	var events []StreamEvent
+	_, err := ZFSRecv(context.Background(), "pool/fs", &chunkedStreamCopier{chunks, chunkSize}, RecvOptions{
+		OnEvent: func(e StreamEvent) { events = append(events, e) },
+	})
+	require.NoError(t, err)
+
+	requireStreamEventsInOrder(t, events, "pool/fs", chunks*chunkSize)
+	assert.NoError(t, events[2].Err)
+}
+
+func TestZFSRecvEventsFailure(t *testing.T) {
+	defer withFakeZFSBinary(t, "head -c 1 > /dev/null; echo failure >&2; exit 1\n")()
+
+	var events []StreamEvent
+	_, err := ZFSRecv(context.Background(), "pool/fs", &chunkedStreamCopier{1, 1}, RecvOptions{
+		OnEvent: func(e StreamEvent) { events = append(events, e) },
+	})
+	require.Error(t, err)
+
+	requireStreamEventsInOrder(t, events, "pool/fs", 1)
+	assert.Equal(t, err, events[2].Err)
+}
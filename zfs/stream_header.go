@@ -0,0 +1,148 @@
+package zfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DMU_BACKUP_MAGIC in the ZFS source code
+const sendStreamMagic uint64 = 0x2F5bacbac
+
+// Length of the prefix of a send stream's DRR_BEGIN record that contains
+// all fields up to and including drr_toname.
+//
+//   struct dmu_replay_record {
+//       uint32_t drr_type;       // 0, DRR_BEGIN == 0
+//       uint32_t drr_payloadlen; // 4
+//       struct drr_begin {
+//           uint64_t drr_magic;         // 8
+//           uint64_t drr_versioninfo;   // 16
+//           uint64_t drr_creation_time; // 24
+//           uint32_t drr_type;          // 32 (dmu_objset_type_t)
+//           uint32_t drr_flags;         // 36
+//           uint64_t drr_toguid;        // 40
+//           uint64_t drr_fromguid;      // 48
+//           char drr_toname[MAXNAMELEN];  // 56, MAXNAMELEN == 256
+//       } drr_begin;
+//       ...
+const sendStreamBeginHeaderLen = 312
+
+const sendStreamToNameOffset = 56
+
+// dmu_objset_type_t in the ZFS source code
+const (
+	dmuObjsetTypeZVOL uint32 = 1
+	dmuObjsetTypeZFS  uint32 = 2
+)
+
+type sendStreamBeginHeader struct {
+	VersionInfo      uint64
+	ObjsetType       uint32
+	ToGUID, FromGUID uint64
+	// The name of the sent snapshot on the sending side (fs@snap), as recorded by zfs send.
+	ToName string
+}
+
+// ToSnapshotName returns the snapshot component of ToName, or "" if ToName is not a snapshot.
+func (h *sendStreamBeginHeader) ToSnapshotName() string {
+	i := strings.IndexByte(h.ToName, '@')
+	if i == -1 {
+		return ""
+	}
+	return h.ToName[i+1:]
+}
+
+func (h *sendStreamBeginHeader) IsFull() bool { return h.FromGUID == 0 }
+
+func (h *sendStreamBeginHeader) IsFilesystem() bool { return h.ObjsetType == dmuObjsetTypeZFS }
+
+// DMU_GET_FEATUREFLAGS in the ZFS source code: bits 2 to 31 of drr_versioninfo
+func (h *sendStreamBeginHeader) FeatureFlags() uint32 {
+	return uint32((h.VersionInfo >> 2) & (1<<30 - 1))
+}
+
+// DMU_BACKUP_FEATURE_* in the ZFS source code that require a pool feature on the receiving side
+var sendStreamFeaturePoolFeatures = []struct {
+	flag        uint32
+	poolFeature string
+}{
+	{1 << 16, "embedded_data"},
+	{1 << 17, "lz4_compress"},
+	{1 << 19, "large_blocks"},
+	{1 << 23, "large_dnode"},
+	{1 << 24, "encryption"},
+	{1 << 25, "zstd_compress"},
+}
+
+// RequiredPoolFeatures returns the names of the pool features
+// that must be enabled on the receiving pool to receive the stream.
+func (h *sendStreamBeginHeader) RequiredPoolFeatures() []string {
+	flags := h.FeatureFlags()
+	var features []string
+	for _, f := range sendStreamFeaturePoolFeatures {
+		if flags&f.flag != 0 {
+			features = append(features, f.poolFeature)
+		}
+	}
+	return features
+}
+
+// The stream is in the sender's native byte order, which we detect using the magic number.
+func parseSendStreamBeginHeader(b []byte) (*sendStreamBeginHeader, error) {
+	if len(b) < sendStreamBeginHeaderLen {
+		return nil, fmt.Errorf("send stream header too short: %v bytes", len(b))
+	}
+	var bo binary.ByteOrder
+	switch {
+	case binary.LittleEndian.Uint64(b[8:16]) == sendStreamMagic:
+		bo = binary.LittleEndian
+	case binary.BigEndian.Uint64(b[8:16]) == sendStreamMagic:
+		bo = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("not a zfs send stream: invalid magic number")
+	}
+	if t := bo.Uint32(b[0:4]); t != 0 {
+		return nil, fmt.Errorf("send stream does not start with a DRR_BEGIN record (type %v)", t)
+	}
+	toName := b[sendStreamToNameOffset:sendStreamBeginHeaderLen]
+	if i := bytes.IndexByte(toName, 0); i != -1 {
+		toName = toName[:i]
+	}
+	return &sendStreamBeginHeader{
+		VersionInfo: bo.Uint64(b[16:24]),
+		ObjsetType:  bo.Uint32(b[32:36]),
+		ToGUID:      bo.Uint64(b[40:48]),
+		FromGUID:    bo.Uint64(b[48:56]),
+		ToName:      string(toName),
+	}, nil
+}
+
+// streamHeaderPeeker passes all writes through to w and records the first n bytes.
+// done is closed once n bytes have been recorded, and buf must not be accessed before.
+type streamHeaderPeeker struct {
+	w    io.Writer
+	n    int
+	buf  []byte
+	done chan struct{}
+}
+
+func newStreamHeaderPeeker(w io.Writer, n int) *streamHeaderPeeker {
+	return &streamHeaderPeeker{w: w, n: n, buf: make([]byte, 0, n), done: make(chan struct{})}
+}
+
+func (p *streamHeaderPeeker) Write(b []byte) (int, error) {
+	if len(p.buf) < p.n {
+		take := p.n - len(p.buf)
+		if take > len(b) {
+			take = len(b)
+		}
+		p.buf = append(p.buf, b[:take]...)
+		if len(p.buf) == p.n {
+			close(p.done)
+		}
+	}
+	return p.w.Write(b)
+}
@@ -0,0 +1,378 @@
+package zfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeSendStreamBeginHeader(bo binary.ByteOrder, toGUID, fromGUID uint64) []byte {
+	b := make([]byte, sendStreamBeginHeaderLen)
+	bo.PutUint64(b[8:16], sendStreamMagic)
+	bo.PutUint64(b[40:48], toGUID)
+	bo.PutUint64(b[48:56], fromGUID)
+	return b
+}
+
+func setSendStreamToName(b []byte, toName string) []byte {
+	copy(b[sendStreamToNameOffset:sendStreamBeginHeaderLen], toName)
+	return b
+}
+
+func TestParseSendStreamBeginHeader(t *testing.T) {
+
+	for _, bo := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		h, err := parseSendStreamBeginHeader(makeSendStreamBeginHeader(bo, 0xdeadbeef, 0))
+		require.NoError(t, err, "%s", bo)
+		assert.Equal(t, uint64(0xdeadbeef), h.ToGUID)
+		assert.True(t, h.IsFull())
+
+		h, err = parseSendStreamBeginHeader(makeSendStreamBeginHeader(bo, 2, 1))
+		require.NoError(t, err, "%s", bo)
+		assert.Equal(t, uint64(1), h.FromGUID)
+		assert.False(t, h.IsFull())
+		assert.Equal(t, "", h.ToName)
+
+		h, err = parseSendStreamBeginHeader(setSendStreamToName(makeSendStreamBeginHeader(bo, 2, 1), "pool/fs@snap"))
+		require.NoError(t, err, "%s", bo)
+		assert.Equal(t, "pool/fs@snap", h.ToName)
+		assert.Equal(t, "snap", h.ToSnapshotName())
+	}
+
+	_, err := parseSendStreamBeginHeader(makeSendStreamBeginHeader(binary.LittleEndian, 1, 0)[:20])
+	assert.Error(t, err)
+
+	_, err = parseSendStreamBeginHeader(make([]byte, sendStreamBeginHeaderLen))
+	assert.Error(t, err)
+
+	notBegin := makeSendStreamBeginHeader(binary.LittleEndian, 1, 0)
+	notBegin[0] = 1
+	_, err = parseSendStreamBeginHeader(notBegin)
+	assert.Error(t, err)
+}
+
+func TestStreamHeaderPeeker(t *testing.T) {
+	var out bytes.Buffer
+	p := newStreamHeaderPeeker(&out, 4)
+
+	_, err := p.Write([]byte("ab"))
+	require.NoError(t, err)
+	select {
+	case <-p.done:
+		t.Fatal("done closed too early")
+	default:
+	}
+
+	_, err = p.Write([]byte("cdef"))
+	require.NoError(t, err)
+	<-p.done
+	assert.Equal(t, []byte("abcd"), p.buf)
+
+	_, err = p.Write([]byte("gh"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("abcd"), p.buf)
+	assert.Equal(t, "abcdefgh", out.String())
+}
+
+type bytesStreamCopier struct {
+	b []byte
+}
+
+func (c *bytesStreamCopier) WriteStreamTo(w io.Writer) StreamCopierError {
+	if _, err := w.Write(c.b); err != nil {
+		return sendStreamCopierError{isReadErr: false, err: err}
+	}
+	return nil
+}
+
+func (c *bytesStreamCopier) Close() error { return nil }
+
+func TestZFSRecvFullRecvIntoExistingPolicy(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "zrepl-zfs-test-recv-args")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	argsFile := filepath.Join(dir, "args")
+
+	stream := makeSendStreamBeginHeader(binary.LittleEndian, 0x2342, 0)
+
+	// `zfs get` reports the target as existing, `zfs recv` records its arguments
+	defer withFakeZFSBinary(t, fmt.Sprintf(`
+case "$1" in
+get)
+	printf 'guid\t1234\t-\n'
+	;;
+recv)
+	echo "$@" > %q
+	head -c %d > /dev/null
+	;;
+esac
+`, argsFile, len(stream)))()
+
+	_, err = ZFSRecv(context.Background(), "pool/fs", &bytesStreamCopier{stream}, RecvOptions{
+		FullRecvIntoExisting: FullRecvIntoExistingNewSibling,
+	})
+	require.NoError(t, err)
+	args, err := ioutil.ReadFile(argsFile)
+	require.NoError(t, err)
+	assert.Equal(t, "recv "+FullRecvSiblingName("pool/fs", 0x2342)+"\n", string(args))
+
+	// incremental streams are received into the target
+	stream = makeSendStreamBeginHeader(binary.LittleEndian, 0x2342, 0x2323)
+	_, err = ZFSRecv(context.Background(), "pool/fs", &bytesStreamCopier{stream}, RecvOptions{
+		FullRecvIntoExisting: FullRecvIntoExistingNewSibling,
+	})
+	require.NoError(t, err)
+	args, err = ioutil.ReadFile(argsFile)
+	require.NoError(t, err)
+	assert.Equal(t, "recv pool/fs\n", string(args))
+}
+
+func TestZFSRecvDestinationExistsError(t *testing.T) {
+	defer withFakeZFSBinary(t, `
+head -c 56 > /dev/null
+echo "cannot receive new filesystem stream: destination 'pool/fs' exists" >&2
+echo "must specify -F to overwrite it" >&2
+exit 1
+`)()
+
+	stream := makeSendStreamBeginHeader(binary.LittleEndian, 0x2342, 0)
+	_, err := ZFSRecv(context.Background(), "pool/fs", &bytesStreamCopier{stream}, RecvOptions{})
+	require.Error(t, err)
+	dee, ok := err.(*RecvDestinationExistsError)
+	require.True(t, ok, "%T %s", err, err)
+	assert.Equal(t, "pool/fs", dee.Filesystem)
+}
+
+func TestZFSRecvOutOfSpaceError(t *testing.T) {
+	stream := makeSendStreamBeginHeader(binary.LittleEndian, 0x2342, 0x2323)
+	for _, stderr := range []string{
+		"cannot receive incremental stream: out of space",
+		"cannot receive new filesystem stream: No space left on device",
+	} {
+		restore := withFakeZFSBinary(t, fmt.Sprintf(`
+head -c %d > /dev/null
+echo %q >&2
+exit 1
+`, len(stream), stderr))
+		_, err := ZFSRecv(context.Background(), "pool/fs", &bytesStreamCopier{stream}, RecvOptions{})
+		restore()
+		oerr, ok := err.(*RecvOutOfSpaceError)
+		if assert.True(t, ok, "%q: %T %s", stderr, err, err) {
+			assert.Equal(t, "pool/fs", oerr.Filesystem)
+		}
+	}
+}
+
+func TestZFSRecvIncrementalSourceMismatchError(t *testing.T) {
+	stderrs := []string{
+		"cannot receive incremental stream: most recent snapshot of pool/fs does not\nmatch incremental source",
+		"cannot receive incremental stream: incremental source (pool/fs@a) does not exist",
+	}
+	stream := makeSendStreamBeginHeader(binary.LittleEndian, 0x2342, 0x2323)
+	for _, stderr := range stderrs {
+		restore := withFakeZFSBinary(t, fmt.Sprintf(`
+head -c %d > /dev/null
+printf %q >&2
+exit 1
+`, len(stream), stderr))
+		_, err := ZFSRecv(context.Background(), "pool/fs", &bytesStreamCopier{stream}, RecvOptions{})
+		restore()
+		merr, ok := err.(*RecvIncrementalSourceMismatchError)
+		if assert.True(t, ok, "%q: %T %s", stderr, err, err) {
+			assert.Equal(t, "pool/fs", merr.Filesystem)
+			assert.NotContains(t, merr.Reason, "\n")
+		}
+	}
+
+	// a modified destination is not a source mismatch
+	restore := withFakeZFSBinary(t, fmt.Sprintf(`
+head -c %d > /dev/null
+printf 'cannot receive incremental stream: destination pool/fs has been modified\nsince most recent snapshot\n' >&2
+exit 1
+`, len(stream)))
+	_, err := ZFSRecv(context.Background(), "pool/fs", &bytesStreamCopier{stream}, RecvOptions{})
+	restore()
+	derr, ok := err.(*RecvDestinationModifiedError)
+	if assert.True(t, ok, "%T %s", err, err) {
+		assert.Equal(t, "pool/fs", derr.Filesystem)
+	}
+
+	// other errors are passed through
+	defer withFakeZFSBinary(t, fmt.Sprintf(`
+head -c %d > /dev/null
+echo "cannot receive incremental stream: permission denied" >&2
+exit 1
+`, len(stream)))()
+	_, err = ZFSRecv(context.Background(), "pool/fs", &bytesStreamCopier{stream}, RecvOptions{})
+	_, ok = err.(*ZFSError)
+	assert.True(t, ok, "%T %s", err, err)
+}
+
+func TestZFSRecvSnapshotNameTooLong(t *testing.T) {
+	defer withFakeZFSBinary(t, `echo "unexpected invocation: $*" >&2; exit 1`)()
+
+	fs := "pool/" + strings.Repeat("a", 240)
+	stream := setSendStreamToName(makeSendStreamBeginHeader(binary.LittleEndian, 0x2342, 0x2323), "src/fs@"+strings.Repeat("s", 20))
+	res, err := ZFSRecv(context.Background(), fs, &bytesStreamCopier{stream}, RecvOptions{})
+	assert.Nil(t, res)
+	nerr, ok := err.(*DatasetNameTooLongError)
+	if assert.True(t, ok, "%T %s", err, err) {
+		assert.Equal(t, fs+"@"+strings.Repeat("s", 20), nerr.Name)
+	}
+}
+
+func TestZFSRecvVerifyReceivedSnapshot(t *testing.T) {
+	stream := makeSendStreamBeginHeader(binary.LittleEndian, 0x2342, 0)
+
+	fakeZFS := func(listedGUID uint64) string {
+		return fmt.Sprintf(`
+case "$1" in
+list)
+	printf 'pool/fs@snap\t%d\t1\t1500000000\n'
+	;;
+recv)
+	head -c %d > /dev/null
+	;;
+esac
+`, listedGUID, len(stream))
+	}
+
+	opts := RecvOptions{VerifyReceivedSnapshot: true}
+
+	restore := withFakeZFSBinary(t, fakeZFS(0x2342))
+	_, err := ZFSRecv(context.Background(), "pool/fs", &bytesStreamCopier{stream}, opts)
+	restore()
+	require.NoError(t, err)
+
+	restore = withFakeZFSBinary(t, fakeZFS(0x2323))
+	_, err = ZFSRecv(context.Background(), "pool/fs", &bytesStreamCopier{stream}, opts)
+	restore()
+	verr, ok := err.(*RecvVerificationError)
+	require.True(t, ok, "%T %s", err, err)
+	assert.Equal(t, "pool/fs", verr.Filesystem)
+	assert.Equal(t, uint64(0x2342), verr.GUID)
+}
+
+func TestZFSRecvPropertyOverridesAndExcludes(t *testing.T) {
+	stream := makeSendStreamBeginHeader(binary.LittleEndian, 0x2342, 0x2323)
+	defer withFakeZFSBinary(t, fmt.Sprintf(`
+test "$*" = "recv -o canmount=off -o mountpoint=none -x compression -x zrepl:foo pool/fs" || exit 1
+head -c %d > /dev/null
+`, len(stream)))()
+
+	opts := RecvOptions{
+		Overrides: map[string]string{"mountpoint": "none", "canmount": "off"},
+		Excludes:  []string{"compression", "zrepl:foo"},
+	}
+	_, err := ZFSRecv(context.Background(), "pool/fs", &bytesStreamCopier{stream}, opts)
+	require.NoError(t, err)
+
+	for _, invalid := range []RecvOptions{
+		{Overrides: map[string]string{"a=b": "c"}},
+		{Excludes: []string{"a=b"}},
+		{Excludes: []string{""}},
+		{Overrides: map[string]string{"canmount": "off"}, Excludes: []string{"canmount"}},
+	} {
+		res, err := ZFSRecv(context.Background(), "pool/fs", &bytesStreamCopier{stream}, invalid)
+		assert.Error(t, err, "%#v", invalid)
+		assert.Nil(t, res)
+	}
+}
+
+func TestZFSRecvNoAutoMount(t *testing.T) {
+	fsStream := makeSendStreamBeginHeader(binary.LittleEndian, 0x2342, 0)
+	binary.LittleEndian.PutUint32(fsStream[32:36], dmuObjsetTypeZFS)
+	volStream := makeSendStreamBeginHeader(binary.LittleEndian, 0x2342, 0)
+	binary.LittleEndian.PutUint32(volStream[32:36], dmuObjsetTypeZVOL)
+
+	fakeZFS := func(expectArgs string) string {
+		return fmt.Sprintf(`
+test "$*" = %q || exit 1
+head -c %d > /dev/null
+`, expectArgs, sendStreamBeginHeaderLen)
+	}
+	opts := RecvOptions{NoAutoMount: true}
+
+	restore := withFakeZFSBinary(t, fakeZFS("recv -o canmount=noauto pool/fs"))
+	_, err := ZFSRecv(context.Background(), "pool/fs", &bytesStreamCopier{fsStream}, opts)
+	restore()
+	require.NoError(t, err)
+
+	// volumes have no canmount property
+	restore = withFakeZFSBinary(t, fakeZFS("recv pool/vol"))
+	_, err = ZFSRecv(context.Background(), "pool/vol", &bytesStreamCopier{volStream}, opts)
+	restore()
+	require.NoError(t, err)
+
+	for _, invalid := range []RecvOptions{
+		{NoAutoMount: true, Overrides: map[string]string{"canmount": "on"}},
+		{NoAutoMount: true, Excludes: []string{"canmount"}},
+	} {
+		res, err := ZFSRecv(context.Background(), "pool/fs", &bytesStreamCopier{fsStream}, invalid)
+		assert.Error(t, err, "%#v", invalid)
+		assert.Nil(t, res)
+	}
+}
+
+func TestZFSRecvOrigin(t *testing.T) {
+	stream := makeSendStreamBeginHeader(binary.LittleEndian, 0x2342, 0)
+
+	defer withFakeZFSBinary(t, fmt.Sprintf(`
+case "$1" in
+get)
+	case "$6" in
+	pool/fs@a) printf 'guid\t1234\t-\n';;
+	pool/fs) printf 'guid\t5678\t-\n';;
+	*) echo "cannot open '$6': dataset does not exist" >&2; exit 1;;
+	esac
+	;;
+recv)
+	test "$*" = "recv -o origin=pool/fs@a pool/clone" || exit 1
+	head -c %d > /dev/null
+	;;
+*)
+	exit 23
+	;;
+esac
+`, sendStreamBeginHeaderLen))()
+
+	_, err := ZFSRecv(context.Background(), "pool/clone", &bytesStreamCopier{stream}, RecvOptions{Origin: "pool/fs@a"})
+	require.NoError(t, err)
+
+	res, err := ZFSRecv(context.Background(), "pool/clone", &bytesStreamCopier{stream}, RecvOptions{Origin: "pool/fs@b"})
+	assert.Nil(t, res)
+	oerr, ok := err.(*RecvOriginDoesNotExistError)
+	require.True(t, ok, "%T %s", err, err)
+	assert.Equal(t, "pool/fs@b", oerr.Origin)
+
+	for _, invalid := range []RecvOptions{
+		{Origin: "pool/fs"},
+		{Origin: "pool/fs#a"},
+		{Origin: "pool/fs@a", RollbackAndForceRecv: true},
+		{Origin: "pool/fs@a", Overrides: map[string]string{"origin": "pool/fs@a"}},
+		{Origin: "pool/fs@a", Excludes: []string{"origin"}},
+	} {
+		res, err := ZFSRecv(context.Background(), "pool/clone", &bytesStreamCopier{stream}, invalid)
+		assert.Error(t, err, "%#v", invalid)
+		assert.Nil(t, res)
+	}
+
+	// overwriting the existing pool/fs would require recv -F
+	res, err = ZFSRecv(context.Background(), "pool/fs", &bytesStreamCopier{stream}, RecvOptions{
+		Origin:               "pool/fs@a",
+		FullRecvIntoExisting: FullRecvIntoExistingForceOverwrite,
+	})
+	assert.Error(t, err)
+	assert.Nil(t, res)
+}
@@ -0,0 +1,52 @@
+package zfs
+
+import (
+	"fmt"
+	"io"
+)
+
+type teeStreamCopier struct {
+	sc  StreamCopier
+	tee io.Writer
+}
+
+// TeeStreamCopier returns a StreamCopier that writes the stream of sc to both
+// the writer passed to WriteStreamTo and to tee, e.g., a file that captures
+// the exact bytes of a stream for later inspection or a manual `zfs recv`.
+//
+// tee receives exactly the bytes that were accepted by the primary writer.
+// A write error of tee aborts the stream and is returned as a write error.
+// Closing the returned StreamCopier closes sc, but not tee.
+func TeeStreamCopier(sc StreamCopier, tee io.Writer) StreamCopier {
+	return &teeStreamCopier{sc, tee}
+}
+
+type teeWriter struct {
+	w, tee io.Writer
+	teeErr error
+}
+
+func (t *teeWriter) Write(p []byte) (n int, err error) {
+	n, err = t.w.Write(p)
+	if n > 0 {
+		if _, teeErr := t.tee.Write(p[:n]); teeErr != nil {
+			t.teeErr = teeErr
+			return n, teeErr
+		}
+	}
+	return n, err
+}
+
+func (c *teeStreamCopier) WriteStreamTo(w io.Writer) StreamCopierError {
+	tw := &teeWriter{w: w, tee: c.tee}
+	err := c.sc.WriteStreamTo(tw)
+	if tw.teeErr != nil {
+		// the copy was aborted because of tee, no matter how sc reports it
+		return sendStreamCopierError{isReadErr: false, err: fmt.Errorf("tee: %s", tw.teeErr)}
+	}
+	return err
+}
+
+func (c *teeStreamCopier) Close() error {
+	return c.sc.Close()
+}
@@ -0,0 +1,131 @@
+package zfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type failingWriter struct {
+	failAfter int
+	written   bytes.Buffer
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.written.Len()+len(p) > w.failAfter {
+		n := w.failAfter - w.written.Len()
+		w.written.Write(p[:n])
+		return n, errors.New("writer failed")
+	}
+	return w.written.Write(p)
+}
+
+type teeTestStreamCopier struct {
+	chunks  [][]byte
+	readErr error
+}
+
+func (c *teeTestStreamCopier) WriteStreamTo(w io.Writer) StreamCopierError {
+	for _, chunk := range c.chunks {
+		if _, err := w.Write(chunk); err != nil {
+			return sendStreamCopierError{isReadErr: false, err: err}
+		}
+	}
+	if c.readErr != nil {
+		return sendStreamCopierError{isReadErr: true, err: c.readErr}
+	}
+	return nil
+}
+
+func (c *teeTestStreamCopier) Close() error { return nil }
+
+func TestTeeStreamCopier(t *testing.T) {
+	chunks := [][]byte{[]byte("abc"), []byte("def"), []byte("ghi")}
+
+	t.Run("success", func(t *testing.T) {
+		var out, tee bytes.Buffer
+		err := TeeStreamCopier(&teeTestStreamCopier{chunks: chunks}, &tee).WriteStreamTo(&out)
+		require.Nil(t, err)
+		assert.Equal(t, "abcdefghi", out.String())
+		assert.Equal(t, "abcdefghi", tee.String())
+	})
+
+	t.Run("readError", func(t *testing.T) {
+		var out, tee bytes.Buffer
+		err := TeeStreamCopier(&teeTestStreamCopier{chunks: chunks, readErr: errors.New("conn reset")}, &tee).WriteStreamTo(&out)
+		require.NotNil(t, err)
+		assert.True(t, err.IsReadError())
+		assert.Equal(t, "abcdefghi", tee.String())
+	})
+
+	t.Run("primaryWriterError", func(t *testing.T) {
+		out := &failingWriter{failAfter: 4}
+		var tee bytes.Buffer
+		err := TeeStreamCopier(&teeTestStreamCopier{chunks: chunks}, &tee).WriteStreamTo(out)
+		require.NotNil(t, err)
+		assert.True(t, err.IsWriteError())
+		assert.NotContains(t, err.Error(), "tee")
+		// tee only sees what the primary writer accepted
+		assert.Equal(t, "abcd", tee.String())
+	})
+
+	t.Run("teeError", func(t *testing.T) {
+		var out bytes.Buffer
+		tee := &failingWriter{failAfter: 4}
+		err := TeeStreamCopier(&teeTestStreamCopier{chunks: chunks}, tee).WriteStreamTo(&out)
+		require.NotNil(t, err)
+		assert.True(t, err.IsWriteError())
+		assert.Contains(t, err.Error(), "tee: writer failed")
+		assert.Equal(t, "abcdef", out.String())
+	})
+}
+
+type errReadCloser struct {
+	data   []byte
+	err    error
+	closed bool
+}
+
+func (r *errReadCloser) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func (r *errReadCloser) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestFileStreamCopier(t *testing.T) {
+	// a stream captured by TeeStreamCopier can be replayed
+	var out, captured bytes.Buffer
+	chunks := [][]byte{[]byte("abc"), []byte("def")}
+	require.Nil(t, TeeStreamCopier(&teeTestStreamCopier{chunks: chunks}, &captured).WriteStreamTo(&out))
+
+	f := &errReadCloser{data: captured.Bytes(), err: io.EOF}
+	sc := NewFileStreamCopier(f)
+	var replayed bytes.Buffer
+	require.Nil(t, sc.WriteStreamTo(&replayed))
+	assert.Equal(t, "abcdef", replayed.String())
+	require.NoError(t, sc.Close())
+	assert.True(t, f.closed)
+
+	sc = NewFileStreamCopier(&errReadCloser{data: []byte("abc"), err: errors.New("media error")})
+	err := sc.WriteStreamTo(&replayed)
+	require.NotNil(t, err)
+	assert.True(t, err.IsReadError())
+	assert.Contains(t, err.Error(), "media error")
+
+	sc = NewFileStreamCopier(&errReadCloser{data: []byte("abcdef"), err: io.EOF})
+	err = sc.WriteStreamTo(&failingWriter{failAfter: 2})
+	require.NotNil(t, err)
+	assert.True(t, err.IsWriteError())
+}
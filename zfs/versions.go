@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"hash/fnv"
 	"io"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -88,18 +90,55 @@ type FilesystemVersionFilter interface {
 	Filter(t VersionType, name string) (accept bool, err error)
 }
 
-func ZFSListFilesystemVersions(fs *DatasetPath, filter FilesystemVersionFilter) (res []FilesystemVersion, err error) {
+// FilesystemVersionFilterFunc adapts a predicate to a FilesystemVersionFilter.
+type FilesystemVersionFilterFunc func(t VersionType, name string) (accept bool, err error)
+
+func (f FilesystemVersionFilterFunc) Filter(t VersionType, name string) (accept bool, err error) {
+	return f(t, name)
+}
+
+// FilesystemVersionTypeFilter may be implemented by a FilesystemVersionFilter
+// that only ever accepts versions of some types.
+// ZFSListFilesystemVersions then only lists those types, reducing the output of zfs list.
+type FilesystemVersionTypeFilter interface {
+	FilesystemVersionFilter
+	// An empty slice means all types.
+	AcceptedVersionTypes() []VersionType
+}
+
+func listFilesystemVersionsTypeArg(filter FilesystemVersionFilter) string {
+	if tf, ok := filter.(FilesystemVersionTypeFilter); ok {
+		types := tf.AcceptedVersionTypes()
+		if len(types) > 0 {
+			strs := make([]string, len(types))
+			for i, t := range types {
+				strs[i] = t.String()
+			}
+			return strings.Join(strs, ",")
+		}
+	}
+	return "bookmark,snapshot"
+}
+
+// ZFSListFilesystemVersions lists the snapshots and bookmarks of fs that are accepted by filter,
+// sorted by createtxg. A nil filter accepts all versions.
+//
+// zfs list cannot match dataset names (-o only selects columns), so name filters such as
+// a prefix match cannot be pushed down to it: only a FilesystemVersionTypeFilter narrows
+// what zfs lists. Each listed version is filtered by name before its remaining fields
+// are parsed, and rejected versions are not retained.
+func ZFSListFilesystemVersions(ctx context.Context, fs *DatasetPath, filter FilesystemVersionFilter) (res []FilesystemVersion, err error) {
 	listResults := make(chan ZFSListResult)
 
 	promTimer := prometheus.NewTimer(prom.ZFSListFilesystemVersionDuration.WithLabelValues(fs.ToString()))
 	defer promTimer.ObserveDuration()
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 	go ZFSListChan(ctx, listResults,
 		[]string{"name", "guid", "createtxg", "creation"},
 		"-r", "-d", "1",
-		"-t", "bookmark,snapshot",
+		"-t", listFilesystemVersionsTypeArg(filter),
 		"-s", "createtxg", fs.ToString())
 
 	res = make([]FilesystemVersion, 0)
@@ -121,6 +160,18 @@ func ZFSListFilesystemVersions(fs *DatasetPath, filter FilesystemVersionFilter)
 			return nil, err
 		}
 
+		// filter before parsing the remaining fields, we might not need them
+		if filter != nil {
+			accept, err := filter.Filter(v.Type, v.Name)
+			if err != nil {
+				err = fmt.Errorf("error executing filter: %s", err)
+				return nil, err
+			}
+			if !accept {
+				continue
+			}
+		}
+
 		if v.Guid, err = strconv.ParseUint(line[1], 10, 64); err != nil {
 			err = errors.Wrap(err, "cannot parse GUID")
 			return
@@ -139,18 +190,295 @@ func ZFSListFilesystemVersions(fs *DatasetPath, filter FilesystemVersionFilter)
 			v.Creation = time.Unix(creationUnix, 0)
 		}
 
-		accept := true
-		if filter != nil {
-			accept, err = filter.Filter(v.Type, v.Name)
-			if err != nil {
-				err = fmt.Errorf("error executing filter: %s", err)
-				return nil, err
-			}
+		res = append(res, v)
+
+	}
+	return
+}
+
+type bookmarksOnlyFilter struct{}
+
+var _ FilesystemVersionTypeFilter = bookmarksOnlyFilter{}
+
+func (bookmarksOnlyFilter) Filter(t VersionType, name string) (bool, error) {
+	return t == Bookmark, nil
+}
+
+func (bookmarksOnlyFilter) AcceptedVersionTypes() []VersionType { return []VersionType{Bookmark} }
+
+// ZFSListBookmarks returns the bookmarks of fs, sorted by createtxg.
+// Snapshots are not enumerated at all, which matters for filesystems with many snapshots.
+func ZFSListBookmarks(ctx context.Context, fs *DatasetPath) ([]FilesystemVersion, error) {
+	return ZFSListFilesystemVersions(ctx, fs, bookmarksOnlyFilter{})
+}
+
+type GUIDNotFoundError struct {
+	Filesystem string
+	GUID       uint64
+}
+
+func (e *GUIDNotFoundError) Error() string {
+	return fmt.Sprintf("filesystem %q has no snapshot or bookmark with GUID %v", e.Filesystem, e.GUID)
+}
+
+// ZFSListFilesystemVersionsSinceGUID is like ZFSListFilesystemVersions, but only returns
+// the versions with a higher createtxg than the version with GUID sinceGUID.
+// The version with sinceGUID must exist on fs (irrespective of filter),
+// otherwise *GUIDNotFoundError is returned.
+func ZFSListFilesystemVersionsSinceGUID(ctx context.Context, fs *DatasetPath, filter FilesystemVersionFilter, sinceGUID uint64) ([]FilesystemVersion, error) {
+	// filter after determining the since-version, filter might not accept it
+	all, err := ZFSListFilesystemVersions(ctx, fs, nil)
+	if err != nil {
+		return nil, err
+	}
+	since, err := filesystemVersionsSinceGUID(fs.ToString(), all, sinceGUID)
+	if err != nil {
+		return nil, err
+	}
+	if filter == nil {
+		return since, nil
+	}
+	res := since[:0]
+	for _, v := range since {
+		accept, err := filter.Filter(v.Type, v.Name)
+		if err != nil {
+			return nil, fmt.Errorf("error executing filter: %s", err)
 		}
 		if accept {
 			res = append(res, v)
 		}
+	}
+	return res, nil
+}
 
+// ZFSResolveGUID returns the version of fs with the given GUID.
+// A bookmark has the same GUID as the snapshot it was created from: if both exist, the snapshot is returned.
+// If no version matches, *GUIDNotFoundError is returned.
+func ZFSResolveGUID(ctx context.Context, fs *DatasetPath, guid uint64) (*FilesystemVersion, error) {
+	versions, err := ZFSListFilesystemVersions(ctx, fs, nil)
+	if err != nil {
+		return nil, err
 	}
-	return
+	return resolveGUID(fs.ToString(), versions, guid)
+}
+
+func resolveGUID(fs string, versions []FilesystemVersion, guid uint64) (*FilesystemVersion, error) {
+	var res *FilesystemVersion
+	for i := range versions {
+		v := &versions[i]
+		if v.Guid != guid {
+			continue
+		}
+		if v.Type == Snapshot {
+			return v, nil
+		}
+		res = v
+	}
+	if res == nil {
+		return nil, &GUIDNotFoundError{fs, guid}
+	}
+	return res, nil
+}
+
+type snapshotsOnlyFilter struct{}
+
+var _ FilesystemVersionTypeFilter = snapshotsOnlyFilter{}
+
+func (snapshotsOnlyFilter) Filter(t VersionType, name string) (bool, error) {
+	return t == Snapshot, nil
+}
+
+func (snapshotsOnlyFilter) AcceptedVersionTypes() []VersionType { return []VersionType{Snapshot} }
+
+// ZFSListSnapshotsSince returns the snapshots of fs that are newer (by createtxg) than
+// the snapshot or bookmark with GUID sinceGUID, e.g. the replication cursor, sorted by createtxg.
+// If there is no version with sinceGUID on fs, *GUIDNotFoundError is returned,
+// and the caller should fall back to a full send.
+func ZFSListSnapshotsSince(ctx context.Context, fs *DatasetPath, sinceGUID uint64) ([]FilesystemVersion, error) {
+	return ZFSListFilesystemVersionsSinceGUID(ctx, fs, snapshotsOnlyFilter{}, sinceGUID)
+}
+
+func filesystemVersionsSinceGUID(fs string, versions []FilesystemVersion, sinceGUID uint64) ([]FilesystemVersion, error) {
+	var sinceTXG uint64
+	found := false
+	for _, v := range versions {
+		if v.Guid == sinceGUID {
+			sinceTXG = v.CreateTXG
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, &GUIDNotFoundError{fs, sinceGUID}
+	}
+	res := make([]FilesystemVersion, 0, len(versions))
+	for _, v := range versions {
+		if v.CreateTXG > sinceTXG {
+			res = append(res, v)
+		}
+	}
+	return res, nil
+}
+
+// FilesystemVersionsHash returns a hash of the set of versions,
+// e.g. to detect whether the versions of a filesystem changed between two listings.
+// The hash covers type, name and GUID of each version and does not depend on the order of versions.
+func FilesystemVersionsHash(versions []FilesystemVersion) uint64 {
+	keys := make([]string, len(versions))
+	for i, v := range versions {
+		keys[i] = fmt.Sprintf("%s%s\x00%d", v.Type.DelimiterChar(), v.Name, v.Guid)
+	}
+	sort.Strings(keys)
+	h := fnv.New64a()
+	for _, k := range keys {
+		h.Write([]byte(k))
+		h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
+
+// FindBookmarkByGUID returns the bookmark in versions that has the given GUID,
+// i.e., a bookmark that was created from the snapshot with that GUID.
+// If there are multiple such bookmarks, the one with the highest CreateTXG is returned.
+// Returns nil if there is no such bookmark.
+func FindBookmarkByGUID(versions []FilesystemVersion, guid uint64) *FilesystemVersion {
+	var res *FilesystemVersion
+	for i := range versions {
+		v := &versions[i]
+		if v.Type != Bookmark || v.Guid != guid {
+			continue
+		}
+		if res == nil || v.CreateTXG > res.CreateTXG {
+			res = v
+		}
+	}
+	return res
+}
+
+// ZFSGetBookmarkByGUID lists the versions of fs and applies FindBookmarkByGUID.
+// Returns nil for both values if there is no matching bookmark.
+func ZFSGetBookmarkByGUID(ctx context.Context, fs *DatasetPath, guid uint64) (*FilesystemVersion, error) {
+	versions, err := ZFSListFilesystemVersions(ctx, fs, nil)
+	if err != nil {
+		return nil, err
+	}
+	return FindBookmarkByGUID(versions, guid), nil
+}
+
+// VersionOrderError is returned by ZFSSendPreflightCheckOrder if From
+// does not precede To on the filesystem, i.e. an incremental send from From to To is impossible.
+type VersionOrderError struct {
+	Filesystem string
+	From, To   FilesystemVersion
+	Reason     string
+}
+
+func (e *VersionOrderError) Error() string {
+	return fmt.Sprintf("%s%s does not precede %s%s: %s", e.Filesystem, e.From, e.Filesystem, e.To, e.Reason)
+}
+
+func findVersionByGUID(versions []FilesystemVersion, t VersionType, guid uint64) *FilesystemVersion {
+	for i := range versions {
+		if versions[i].Type == t && versions[i].Guid == guid {
+			return &versions[i]
+		}
+	}
+	return nil
+}
+
+func findVersionByName(versions []FilesystemVersion, t VersionType, name string) *FilesystemVersion {
+	for i := range versions {
+		if versions[i].Type == t && versions[i].Name == name {
+			return &versions[i]
+		}
+	}
+	return nil
+}
+
+// checkFromPrecedesTo expects versions to be the versions of filesystem fs.
+// from and to are identified by type and GUID, the name is only used for diagnostics.
+// See ZFSSendPreflightCheckOrder for what the check can and cannot detect.
+func checkFromPrecedesTo(fs string, versions []FilesystemVersion, from, to FilesystemVersion) error {
+	if to.Type != Snapshot {
+		return fmt.Errorf("'to' must be a snapshot, got %s%s", fs, to)
+	}
+	orderErr := func(reason string) error {
+		return &VersionOrderError{Filesystem: fs, From: from, To: to, Reason: reason}
+	}
+
+	toV := findVersionByGUID(versions, Snapshot, to.Guid)
+	if toV == nil {
+		if findVersionByName(versions, Snapshot, to.Name) != nil {
+			return orderErr("'to' has been replaced by a snapshot with the same name but different GUID")
+		}
+		return fmt.Errorf("'to' %s%s does not exist", fs, to)
+	}
+
+	fromV := findVersionByGUID(versions, from.Type, from.Guid)
+	if fromV == nil {
+		if findVersionByName(versions, from.Type, from.Name) != nil {
+			return orderErr("'from' has been replaced by a version with the same name but different GUID (diverged history, e.g. after a rollback)")
+		}
+		return orderErr("'from' GUID does not exist on the filesystem")
+	}
+
+	if fromV.CreateTXG >= toV.CreateTXG {
+		return orderErr(fmt.Sprintf("'from' createtxg %v is not older than 'to' createtxg %v", fromV.CreateTXG, toV.CreateTXG))
+	}
+	return nil
+}
+
+// ZFSSendPreflightCheckOrder verifies that from and to exist on fs (by GUID)
+// and that from is older than to (by createtxg) before an incremental send is attempted.
+//
+// This is a createtxg order check, not a full ancestry check:
+// if from is a snapshot or a bookmark whose snapshot still exists, order implies ancestry
+// because a rollback destroys all snapshots after the rollback target.
+// However, a bookmark of a snapshot that was destroyed by a rollback still precedes
+// snapshots created after the rollback, although they do not contain its changes.
+// Neither the version list nor `zfs send` (which performs the same txg comparison)
+// can detect that case.
+//
+// Returns *VersionOrderError if from does not precede to, e.g. if from was replaced
+// by a version with the same name but a different GUID.
+func ZFSSendPreflightCheckOrder(ctx context.Context, fs *DatasetPath, from, to FilesystemVersion) error {
+	versions, err := ZFSListFilesystemVersions(ctx, fs, nil)
+	if err != nil {
+		return err
+	}
+	return checkFromPrecedesTo(fs.ToString(), versions, from, to)
+}
+
+// IsInternalVersionName returns true if name is reserved for versions
+// that zrepl manages itself, i.e. the replication cursor bookmarks.
+// (Holds are tags on snapshots, not versions, hence never listed.)
+func IsInternalVersionName(t VersionType, name string) bool {
+	return t == Bookmark && IsReplicationCursorBookmarkName(name)
+}
+
+// InternalVersionsFilter wraps Inner and rejects zrepl-internal versions (see IsInternalVersionName).
+// The zero value rejects internal versions and accepts all others.
+// Maintenance tooling can set IncludeInternal to get the unfiltered view.
+type InternalVersionsFilter struct {
+	Inner           FilesystemVersionFilter // may be nil
+	IncludeInternal bool
+}
+
+var _ FilesystemVersionTypeFilter = InternalVersionsFilter{}
+
+func (f InternalVersionsFilter) Filter(t VersionType, name string) (accept bool, err error) {
+	if !f.IncludeInternal && IsInternalVersionName(t, name) {
+		return false, nil
+	}
+	if f.Inner == nil {
+		return true, nil
+	}
+	return f.Inner.Filter(t, name)
+}
+
+func (f InternalVersionsFilter) AcceptedVersionTypes() []VersionType {
+	if tf, ok := f.Inner.(FilesystemVersionTypeFilter); ok {
+		return tf.AcceptedVersionTypes()
+	}
+	return nil
 }
@@ -28,7 +28,7 @@ func (m *mockBatchDestroy) DestroySnapshotsCommaSyntaxSupported() (bool, error)
 	return !m.commaUnsupported, nil
 }
 
-func (m *mockBatchDestroy) Destroy(args []string) error {
+func (m *mockBatchDestroy) Destroy(ctx context.Context, args []string) error {
 	defer m.mtx.Lock().Unlock()
 	if len(args) != 1 {
 		panic("unexpected use of Destroy")
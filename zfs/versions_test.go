@@ -0,0 +1,278 @@
+package zfs
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindBookmarkByGUID(t *testing.T) {
+	versions := []FilesystemVersion{
+		{Type: Snapshot, Name: "a", Guid: 1, CreateTXG: 10},
+		{Type: Bookmark, Name: "a", Guid: 1, CreateTXG: 10},
+		{Type: Bookmark, Name: "a_later", Guid: 1, CreateTXG: 12},
+		{Type: Snapshot, Name: "b", Guid: 2, CreateTXG: 20},
+	}
+
+	bm := FindBookmarkByGUID(versions, 1)
+	if assert.NotNil(t, bm) {
+		assert.Equal(t, Bookmark, bm.Type)
+		assert.Equal(t, "a_later", bm.Name)
+	}
+
+	// a snapshot with matching GUID is not a bookmark
+	assert.Nil(t, FindBookmarkByGUID(versions, 2))
+	assert.Nil(t, FindBookmarkByGUID(versions, 3))
+	assert.Nil(t, FindBookmarkByGUID(nil, 1))
+}
+
+func TestCheckFromPrecedesTo(t *testing.T) {
+	a := FilesystemVersion{Type: Snapshot, Name: "a", Guid: 1, CreateTXG: 10}
+	aBookmark := FilesystemVersion{Type: Bookmark, Name: "a", Guid: 1, CreateTXG: 10}
+	b := FilesystemVersion{Type: Snapshot, Name: "b", Guid: 2, CreateTXG: 20}
+	c := FilesystemVersion{Type: Snapshot, Name: "c", Guid: 3, CreateTXG: 30}
+	// b after rollback to a and re-creation of b
+	bDiverged := FilesystemVersion{Type: Snapshot, Name: "b", Guid: 4, CreateTXG: 40}
+
+	linear := []FilesystemVersion{a, aBookmark, b, c}
+	diverged := []FilesystemVersion{a, aBookmark, bDiverged}
+
+	assert.NoError(t, checkFromPrecedesTo("pool/fs", linear, a, c))
+	assert.NoError(t, checkFromPrecedesTo("pool/fs", linear, aBookmark, b))
+	assert.NoError(t, checkFromPrecedesTo("pool/fs", diverged, a, bDiverged))
+
+	isVersionOrderErr := func(err error) bool {
+		_, ok := err.(*VersionOrderError)
+		return ok
+	}
+
+	// wrong order
+	err := checkFromPrecedesTo("pool/fs", linear, c, b)
+	assert.True(t, isVersionOrderErr(err), "%T %s", err, err)
+	// from was replaced by diverged snapshot with the same name
+	err = checkFromPrecedesTo("pool/fs", append(diverged, c), b, c)
+	assert.True(t, isVersionOrderErr(err), "%T %s", err, err)
+	// from no longer exists at all
+	err = checkFromPrecedesTo("pool/fs", []FilesystemVersion{c}, a, c)
+	assert.True(t, isVersionOrderErr(err), "%T %s", err, err)
+	// to does not exist
+	err = checkFromPrecedesTo("pool/fs", diverged, a, c)
+	assert.Error(t, err)
+	assert.False(t, isVersionOrderErr(err))
+	// to must be a snapshot
+	assert.Error(t, checkFromPrecedesTo("pool/fs", linear, a, aBookmark))
+}
+
+type typeFilter []VersionType
+
+func (f typeFilter) Filter(t VersionType, name string) (bool, error) {
+	for _, ft := range f {
+		if ft == t {
+			return true, nil
+		}
+	}
+	return len(f) == 0, nil
+}
+
+func (f typeFilter) AcceptedVersionTypes() []VersionType { return f }
+
+type nameFilter struct{}
+
+func (nameFilter) Filter(t VersionType, name string) (bool, error) { return true, nil }
+
+func TestListFilesystemVersionsTypeArg(t *testing.T) {
+	assert.Equal(t, "bookmark,snapshot", listFilesystemVersionsTypeArg(nil))
+	assert.Equal(t, "bookmark,snapshot", listFilesystemVersionsTypeArg(nameFilter{}))
+	assert.Equal(t, "bookmark,snapshot", listFilesystemVersionsTypeArg(typeFilter{}))
+	assert.Equal(t, "snapshot", listFilesystemVersionsTypeArg(typeFilter{Snapshot}))
+	assert.Equal(t, "bookmark", listFilesystemVersionsTypeArg(typeFilter{Bookmark}))
+}
+
+func TestZFSListFilesystemVersionsNamePrefix(t *testing.T) {
+	// rejected versions have unparseable fields to show that they are filtered before parsing
+	defer withFakeZFSBinary(t, `
+case "$*" in
+	*"-t bookmark,snapshot -s createtxg pool/fs") ;;
+	*) echo "unexpected arguments: $*" >&2; exit 1 ;;
+esac
+printf 'pool/fs@other_1\tx\tx\tx\n'
+printf 'pool/fs@zrepl_1\t1\t10\t100\n'
+printf 'pool/fs#other_2\tx\tx\tx\n'
+printf 'pool/fs#zrepl_2\t2\t20\t200\n'
+`)()
+
+	prefix := FilesystemVersionFilterFunc(func(t VersionType, name string) (bool, error) {
+		return strings.HasPrefix(name, "zrepl_"), nil
+	})
+	fs := toDatasetPath("pool/fs")
+	versions, err := ZFSListFilesystemVersions(context.Background(), fs, prefix)
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	assert.Equal(t, "pool/fs@zrepl_1", versions[0].ToAbsPath(fs))
+	assert.Equal(t, uint64(10), versions[0].CreateTXG)
+	assert.Equal(t, "pool/fs#zrepl_2", versions[1].ToAbsPath(fs))
+	assert.Equal(t, uint64(2), versions[1].Guid)
+}
+
+func TestInternalVersionsFilter(t *testing.T) {
+	type v struct {
+		t    VersionType
+		name string
+	}
+	internal := []v{
+		{Bookmark, ReplicationCursorBookmarkName},
+		{Bookmark, ReplicationCursorBookmarkName + "_job1"},
+		{Bookmark, replicationCursorBookmarkName(ReplicationCursorBookmarkName, 0xff)},
+	}
+	user := []v{
+		{Snapshot, "zrepl_20190101_000000_000"},
+		{Bookmark, "zrepl_20190101_000000_000"},
+		// the cursor name is only reserved for bookmarks
+		{Snapshot, ReplicationCursorBookmarkName},
+		{Snapshot, ReplicationCursorBookmarkName + "_job1"},
+	}
+
+	check := func(f FilesystemVersionFilter, vs []v, exp bool) {
+		for _, v := range vs {
+			accept, err := f.Filter(v.t, v.name)
+			assert.NoError(t, err)
+			assert.Equal(t, exp, accept, "%#v", v)
+		}
+	}
+
+	// excluded by default
+	check(InternalVersionsFilter{}, internal, false)
+	check(InternalVersionsFilter{}, user, true)
+
+	// included when requested
+	check(InternalVersionsFilter{IncludeInternal: true}, internal, true)
+	check(InternalVersionsFilter{IncludeInternal: true}, user, true)
+
+	// inner filter is applied
+	onlyBookmarks := InternalVersionsFilter{Inner: typeFilter{Bookmark}}
+	check(onlyBookmarks, []v{{Snapshot, "foo"}}, false)
+	check(onlyBookmarks, []v{{Bookmark, "foo"}}, true)
+	assert.Equal(t, []VersionType{Bookmark}, onlyBookmarks.AcceptedVersionTypes())
+	assert.Nil(t, InternalVersionsFilter{}.AcceptedVersionTypes())
+}
+
+func TestFilesystemVersionsHash(t *testing.T) {
+	a := FilesystemVersion{Type: Snapshot, Name: "a", Guid: 1}
+	b := FilesystemVersion{Type: Snapshot, Name: "b", Guid: 2}
+	bBookmark := FilesystemVersion{Type: Bookmark, Name: "b", Guid: 2}
+
+	h := FilesystemVersionsHash([]FilesystemVersion{a, b})
+	assert.Equal(t, h, FilesystemVersionsHash([]FilesystemVersion{b, a}), "must be independent of order")
+	assert.NotEqual(t, h, FilesystemVersionsHash([]FilesystemVersion{a}), "must change if a version is removed")
+	assert.NotEqual(t, h, FilesystemVersionsHash([]FilesystemVersion{a, b, bBookmark}), "must change if a version is added")
+	assert.NotEqual(t, h, FilesystemVersionsHash([]FilesystemVersion{a, bBookmark}), "must distinguish snapshots and bookmarks")
+	assert.Equal(t, FilesystemVersionsHash(nil), FilesystemVersionsHash([]FilesystemVersion{}))
+}
+
+func TestFilesystemVersionsSinceGUID(t *testing.T) {
+	versions := []FilesystemVersion{
+		{Type: Snapshot, Name: "a", Guid: 1, CreateTXG: 10},
+		{Type: Bookmark, Name: "a", Guid: 1, CreateTXG: 10},
+		{Type: Snapshot, Name: "b", Guid: 2, CreateTXG: 20},
+		{Type: Snapshot, Name: "c", Guid: 3, CreateTXG: 30},
+	}
+
+	since, err := filesystemVersionsSinceGUID("pool/fs", versions, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, versions[2:], since)
+
+	// newest GUID
+	since, err = filesystemVersionsSinceGUID("pool/fs", versions, 3)
+	assert.NoError(t, err)
+	assert.Empty(t, since)
+
+	_, err = filesystemVersionsSinceGUID("pool/fs", versions, 4)
+	nerr, ok := err.(*GUIDNotFoundError)
+	if assert.True(t, ok, "%T %s", err, err) {
+		assert.Equal(t, uint64(4), nerr.GUID)
+	}
+}
+
+func TestZFSListSnapshotsSince(t *testing.T) {
+	defer withFakeZFSBinary(t, `
+test "$*" = "list -H -p -o name,guid,createtxg,creation -r -d 1 -t bookmark,snapshot -s createtxg pool/fs" || exit 1
+printf 'pool/fs@a\t1\t10\t1500000000\n'
+printf 'pool/fs#zrepl_replication_cursor\t2\t20\t1500000000\n'
+printf 'pool/fs@c\t3\t30\t1500000000\n'
+printf 'pool/fs#other\t4\t40\t1500000000\n'
+printf 'pool/fs@e\t5\t50\t1500000000\n'
+`)()
+	fs := toDatasetPath("pool/fs")
+
+	// since the cursor bookmark, only snapshots
+	since, err := ZFSListSnapshotsSince(context.Background(), fs, 2)
+	require.NoError(t, err)
+	var names []string
+	for _, v := range since {
+		names = append(names, v.String())
+	}
+	assert.Equal(t, []string{"@c", "@e"}, names)
+
+	_, err = ZFSListSnapshotsSince(context.Background(), fs, 23)
+	_, ok := err.(*GUIDNotFoundError)
+	assert.True(t, ok, "%T %s", err, err)
+}
+
+func TestResolveGUID(t *testing.T) {
+	versions := []FilesystemVersion{
+		{Type: Bookmark, Name: "a", Guid: 1, CreateTXG: 10},
+		{Type: Snapshot, Name: "a", Guid: 1, CreateTXG: 10},
+		{Type: Bookmark, Name: "b", Guid: 2, CreateTXG: 20},
+	}
+
+	v, err := resolveGUID("pool/fs", versions, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "@a", v.String(), "snapshots are preferred over bookmarks")
+
+	v, err = resolveGUID("pool/fs", versions, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "#b", v.String())
+
+	_, err = resolveGUID("pool/fs", versions, 3)
+	nerr, ok := err.(*GUIDNotFoundError)
+	require.True(t, ok, "%T %s", err, err)
+	assert.Equal(t, uint64(3), nerr.GUID)
+	assert.Equal(t, "pool/fs", nerr.Filesystem)
+}
+
+func TestReplicationCursorBookmarkNameForJob(t *testing.T) {
+	name, err := ReplicationCursorBookmarkNameForJob("prod-to-backup1")
+	require.NoError(t, err)
+	assert.Equal(t, "zrepl_replication_cursor_prod-to-backup1", name)
+	assert.True(t, IsReplicationCursorBookmarkName(name))
+	assert.True(t, IsReplicationCursorBookmarkName(ReplicationCursorBookmarkName))
+	assert.False(t, IsReplicationCursorBookmarkName("zrepl_replication_cursorx"))
+
+	for _, invalid := range []string{"", "with space", "a/b", "a#b", "a@b", "G00000000000000ff", "job_G00000000000000ff"} {
+		_, err := ReplicationCursorBookmarkNameForJob(invalid)
+		assert.Error(t, err, "%q", invalid)
+	}
+}
+
+func TestZFSListBookmarks(t *testing.T) {
+	defer withFakeZFSBinary(t, `
+case "$*" in
+*"-t bookmark "*) ;;
+*) echo "unexpected args: $*" >&2; exit 1;;
+esac
+printf 'pool/fs#a\t1\t10\t1500000000\n'
+printf 'pool/fs#zrepl_replication_cursor\t2\t20\t1500000001\n'
+`)()
+
+	fs, err := NewDatasetPath("pool/fs")
+	require.NoError(t, err)
+	bms, err := ZFSListBookmarks(context.Background(), fs)
+	require.NoError(t, err)
+	require.Len(t, bms, 2)
+	assert.Equal(t, FilesystemVersion{Type: Bookmark, Name: "a", Guid: 1, CreateTXG: 10, Creation: bms[0].Creation}, bms[0])
+	assert.Equal(t, uint64(20), bms[1].CreateTXG)
+	assert.Equal(t, ReplicationCursorBookmarkName, bms[1].Name)
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"os/exec"
 	"sort"
@@ -20,12 +21,19 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/pkg/errors"
+	"github.com/zrepl/zrepl/util/circlog"
 	"github.com/zrepl/zrepl/util/envconst"
 )
 
 var (
-	ZFSSendPipeCapacityHint = int(envconst.Int64("ZFS_SEND_PIPE_CAPACITY_HINT", 1<<25))
-	ZFSRecvPipeCapacityHint = int(envconst.Int64("ZFS_RECV_PIPE_CAPACITY_HINT", 1<<25))
+	ZFSSendPipeCapacityHint  = int(envconst.Int64("ZFS_SEND_PIPE_CAPACITY_HINT", 1<<25))
+	ZFSRecvPipeCapacityHint  = int(envconst.Int64("ZFS_RECV_PIPE_CAPACITY_HINT", 1<<25))
+	ZFSSendStderrMaxCopySize = envconst.Int("ZFS_SEND_STDERR_MAX_COPY_SIZE", 1<<15)
+	ZFSListStderrMaxCopySize = envconst.Int("ZFS_LIST_STDERR_MAX_COPY_SIZE", 1<<15)
+	// maximum length of a line of `zfs list` output, i.e. of a dataset name and the requested properties
+	ZFSListMaxLineLength = envconst.Int("ZFS_LIST_MAX_LINE_LENGTH", 1<<17)
+	// default for SendOptions.SizeEstimateMaxDivergencePercent
+	ZFSSendSizeEstimateMaxDivergencePercent = envconst.Int("ZFS_SEND_SIZE_ESTIMATE_MAX_DIVERGENCE_PERCENT", 20)
 )
 
 type DatasetPath struct {
@@ -44,6 +52,17 @@ func (p *DatasetPath) Extend(extend *DatasetPath) {
 	p.comps = append(p.comps, extend.comps...)
 }
 
+// Less compares p and o component-wise, i.e. all children of a dataset
+// sort before its siblings that share a string prefix ("a/b" < "a-b").
+func (p *DatasetPath) Less(o *DatasetPath) bool {
+	for i := 0; i < len(p.comps) && i < len(o.comps); i++ {
+		if p.comps[i] != o.comps[i] {
+			return p.comps[i] < o.comps[i]
+		}
+	}
+	return len(p.comps) < len(o.comps)
+}
+
 func (p *DatasetPath) HasPrefix(prefix *DatasetPath) bool {
 	if len(prefix.comps) > len(p.comps) {
 		return false
@@ -69,6 +88,17 @@ func (p *DatasetPath) TrimPrefix(prefix *DatasetPath) {
 	}
 }
 
+// RelativeTo returns a new DatasetPath that is p with prefix base removed.
+// Unlike TrimPrefix, p is not modified, and it is an error if p is not base or below base.
+func (p *DatasetPath) RelativeTo(base *DatasetPath) (*DatasetPath, error) {
+	if !p.HasPrefix(base) {
+		return nil, fmt.Errorf("%q is not below %q", p.ToString(), base.ToString())
+	}
+	r := &DatasetPath{comps: make([]string, len(p.comps)-len(base.comps))}
+	copy(r.comps, p.comps[len(base.comps):])
+	return r, nil
+}
+
 func (p *DatasetPath) TrimNPrefixComps(n int) {
 	if len(p.comps) < n {
 		n = len(p.comps)
@@ -92,6 +122,25 @@ func (p DatasetPath) Equal(q *DatasetPath) bool {
 	return true
 }
 
+// Parent returns a copy of p without its last component.
+// The parent of the empty path and of single-component paths is the empty path.
+func (p *DatasetPath) Parent() *DatasetPath {
+	if len(p.comps) <= 1 {
+		return &DatasetPath{comps: make([]string, 0)}
+	}
+	c := p.Copy()
+	c.comps = c.comps[:len(c.comps)-1]
+	return c
+}
+
+// Base returns the last component of p, or "" if p is the empty path.
+func (p *DatasetPath) Base() string {
+	if len(p.comps) == 0 {
+		return ""
+	}
+	return p.comps[len(p.comps)-1]
+}
+
 func (p *DatasetPath) Length() int {
 	return len(p.comps)
 }
@@ -112,31 +161,166 @@ func (p *DatasetPath) UnmarshalJSON(b []byte) error {
 	return json.Unmarshal(b, &p.comps)
 }
 
+// Documenation of allowed characters in zfs names:
+// https://docs.oracle.com/cd/E19253-01/819-5461/gbcpt/index.html
+// Space is missing in the oracle list, but according to
+// https://github.com/zfsonlinux/zfs/issues/439
+// there is evidence that it was intentionally allowed
+const datasetPathForbiddenChars = "@#|\t<>*"
+
 func NewDatasetPath(s string) (p *DatasetPath, err error) {
 	p = &DatasetPath{}
 	if s == "" {
 		p.comps = make([]string, 0)
 		return p, nil // the empty dataset path
 	}
-	const FORBIDDEN = "@#|\t<>*"
-	/* Documenation of allowed characters in zfs names:
-	https://docs.oracle.com/cd/E19253-01/819-5461/gbcpt/index.html
-	Space is missing in the oracle list, but according to
-	https://github.com/zfsonlinux/zfs/issues/439
-	there is evidence that it was intentionally allowed
-	*/
-	if strings.ContainsAny(s, FORBIDDEN) {
-		err = fmt.Errorf("contains forbidden characters (any of '%s')", FORBIDDEN)
+	if strings.ContainsAny(s, datasetPathForbiddenChars) {
+		err = fmt.Errorf("contains forbidden characters (any of '%s')", datasetPathForbiddenChars)
 		return
 	}
+	if err := checkDatasetNameLength(s); err != nil {
+		return nil, err
+	}
 	p.comps = strings.Split(s, "/")
 	if p.comps[len(p.comps)-1] == "" {
 		err = fmt.Errorf("must not end with a '/'")
 		return
 	}
+	for i, c := range p.comps {
+		if reason := datasetPathComponentInvalidReason(c); reason != "" {
+			return nil, &DatasetPathComponentError{Path: s, Index: i, Component: c, Reason: reason}
+		}
+	}
 	return
 }
 
+// MaxDatasetNameLen is the maximum length in bytes of a dataset name
+// (ZFS_MAX_DATASET_NAME_LEN minus the terminating NUL byte).
+// It limits each component as well as the full path.
+const MaxDatasetNameLen = 255
+
+type DatasetNameTooLongError struct {
+	Name string
+}
+
+func (e *DatasetNameTooLongError) Error() string {
+	return fmt.Sprintf("dataset name %q is %d bytes long, exceeding the ZFS maximum of %d bytes", e.Name, len(e.Name), MaxDatasetNameLen)
+}
+
+func checkDatasetNameLength(name string) error {
+	if len(name) > MaxDatasetNameLen {
+		return &DatasetNameTooLongError{name}
+	}
+	return nil
+}
+
+// ValidateLength returns a *DatasetNameTooLongError if p exceeds MaxDatasetNameLen.
+// NewDatasetPath performs this check, but paths constructed using Extend might violate it.
+func (p *DatasetPath) ValidateLength() error {
+	return checkDatasetNameLength(p.ToString())
+}
+
+// DatasetPathComponentError is returned by NewDatasetPath for paths with a component
+// that ZFS would reject when creating the dataset.
+type DatasetPathComponentError struct {
+	Path      string
+	Index     int // of the offending component, 0 is the pool name
+	Component string
+	Reason    string
+}
+
+func (e *DatasetPathComponentError) Error() string {
+	return fmt.Sprintf("invalid component %d (%q) of dataset path %q: %s", e.Index, e.Component, e.Path, e.Reason)
+}
+
+// returns "" if c is a valid component of a dataset path
+func datasetPathComponentInvalidReason(c string) string {
+	switch {
+	case c == "":
+		return "must not be empty"
+	case c == "." || c == "..":
+		return "must not be '.' or '..'"
+	}
+	return ""
+}
+
+// pool names starting with any of these are reserved by ZFS (see pool_namecheck in zfs_namecheck.c)
+var reservedPoolNamePrefixes = []string{"mirror", "raidz", "draid", "spare"}
+
+// ValidatePoolName returns an error if ZFS would refuse to create a pool named name.
+//
+// ZFS only applies these rules at pool creation time, so this check must not be used
+// for dataset paths in general (NewDatasetPath is also used for client identities).
+func ValidatePoolName(name string) error {
+	p, err := NewDatasetPath(name)
+	if err != nil {
+		return err
+	}
+	if p.Length() != 1 {
+		return fmt.Errorf("pool name %q must not contain '/'", name)
+	}
+	if name == "log" {
+		return fmt.Errorf("pool name %q is reserved", name)
+	}
+	for _, prefix := range reservedPoolNamePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return fmt.Errorf("pool name %q is reserved: pool names must not start with %q", name, prefix)
+		}
+	}
+	return nil
+}
+
+// Match reports whether p matches pattern, which is a dataset path
+// whose components may contain the wildcard '*'.
+// A '*' matches any sequence of characters within a single component, i.e., it never crosses a '/':
+//   tank/users/*/home matches tank/users/alice/home but not tank/users/alice/sub/home
+//
+// Patterns must not contain any characters forbidden in dataset paths (except '*').
+func (p *DatasetPath) Match(pattern string) (bool, error) {
+	if strings.ContainsAny(pattern, strings.Replace(datasetPathForbiddenChars, "*", "", -1)) {
+		return false, fmt.Errorf("pattern %q contains forbidden characters (any of '%s' except '*')", pattern, datasetPathForbiddenChars)
+	}
+	var patComps []string
+	if pattern != "" {
+		patComps = strings.Split(pattern, "/")
+	}
+	for _, c := range patComps {
+		if c == "" {
+			return false, fmt.Errorf("pattern %q contains an empty component", pattern)
+		}
+	}
+	if len(patComps) != len(p.comps) {
+		return false, nil
+	}
+	for i := range patComps {
+		if !matchDatasetPathComponent(patComps[i], p.comps[i]) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// matchDatasetPathComponent matches a single component against a pattern in which '*' matches any sequence.
+func matchDatasetPathComponent(pattern, comp string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == comp
+	}
+	if !strings.HasPrefix(comp, parts[0]) {
+		return false
+	}
+	comp = comp[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		idx := strings.Index(comp, part)
+		if idx == -1 {
+			return false
+		}
+		comp = comp[idx+len(part):]
+	}
+	return len(comp) >= len(last) && strings.HasSuffix(comp, last)
+}
+
 func toDatasetPath(s string) *DatasetPath {
 	p, err := NewDatasetPath(s)
 	if err != nil {
@@ -156,7 +340,13 @@ func (e *ZFSError) Error() string {
 
 var ZFS_BINARY string = "zfs"
 
-func ZFSList(properties []string, zfsArgs ...string) (res [][]string, err error) {
+// ZFSList runs `zfs list -H -p -o properties zfsArgs...` and returns the fields of each output line.
+//
+// `zfs list -H` separates fields by tab, but property values (e.g. of user properties) may contain tabs as well.
+// Such values are only parsed correctly if the property is the last one in properties.
+// Lines with fewer fields than properties, or lines whose extra tabs could belong to
+// a property other than the last one, are reported as *ZFSListUnexpectedOutputError.
+func ZFSList(ctx context.Context, properties []string, zfsArgs ...string) (res [][]string, err error) {
 
 	args := make([]string, 0, 4+len(zfsArgs))
 	args = append(args,
@@ -164,7 +354,13 @@ func ZFSList(properties []string, zfsArgs ...string) (res [][]string, err error)
 		"-o", strings.Join(properties, ","))
 	args = append(args, zfsArgs...)
 
-	cmd := exec.Command(ZFS_BINARY, args...)
+	guard, err := acquireZFSListGetSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer guard.Release()
+
+	cmd := exec.CommandContext(ctx, ZFS_BINARY, args...)
 
 	var stdout io.Reader
 	stderr := bytes.NewBuffer(make([]byte, 0, 1024))
@@ -178,22 +374,25 @@ func ZFSList(properties []string, zfsArgs ...string) (res [][]string, err error)
 		return
 	}
 
-	s := bufio.NewScanner(stdout)
-	buf := make([]byte, 1024)
-	s.Buffer(buf, 0)
+	s := newZFSListScanner(stdout)
 
 	res = make([][]string, 0)
 
 	for s.Scan() {
-		fields := strings.SplitN(s.Text(), "\t", len(properties))
-
-		if len(fields) != len(properties) {
-			err = errors.New("unexpected output")
-			return
+		fields, err := splitZFSListLine(s.Text(), properties)
+		if err != nil {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+			return nil, err
 		}
-
 		res = append(res, fields)
 	}
+	if err := s.Err(); err != nil {
+		// zfs might block writing to the pipe if we stop reading
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return nil, zfsListScanError(err)
+	}
 
 	if waitErr := cmd.Wait(); waitErr != nil {
 		err := &ZFSError{
@@ -205,6 +404,77 @@ func ZFSList(properties []string, zfsArgs ...string) (res [][]string, err error)
 	return
 }
 
+// ZFSListUnexpectedOutputError is returned if a line of `zfs list -H` output
+// does not have a field for each of the requested properties.
+type ZFSListUnexpectedOutputError struct {
+	Line       string
+	Properties []string
+	NumFields  int
+}
+
+func (e *ZFSListUnexpectedOutputError) Error() string {
+	return fmt.Sprintf("unexpected zfs list output: expected %d tab-separated fields (%s), got %d: %q",
+		len(e.Properties), strings.Join(e.Properties, ","), e.NumFields, e.Line)
+}
+
+// splitZFSListLine splits a line of `zfs list -H -o properties` output into one field per property.
+//
+// Tabs in the value of the last property are preserved.
+// If the line has more fields than properties and a property other than the last one
+// may contain tabs, it is impossible to tell which value the extra tabs belong to.
+// Hence, the line is rejected instead of assigning shifted values to the properties.
+func splitZFSListLine(line string, properties []string) ([]string, error) {
+	fields := strings.Split(line, "\t")
+	if len(fields) > len(properties) && len(properties) > 0 {
+		for _, p := range properties[:len(properties)-1] {
+			if zfsListPropertyMayContainTabs(p) {
+				return nil, &ZFSListUnexpectedOutputError{
+					Line:       line,
+					Properties: properties,
+					NumFields:  len(fields),
+				}
+			}
+		}
+		last := len(properties) - 1
+		fields = append(fields[:last], strings.Join(fields[last:], "\t"))
+	}
+	if len(fields) != len(properties) {
+		return nil, &ZFSListUnexpectedOutputError{
+			Line:       line,
+			Properties: properties,
+			NumFields:  len(fields),
+		}
+	}
+	return fields, nil
+}
+
+// whether the value of property p is free-form text that may contain tabs
+func zfsListPropertyMayContainTabs(p string) bool {
+	// user properties (module:property) and paths
+	return strings.Contains(p, ":") || p == "mountpoint"
+}
+
+func newZFSListScanner(r io.Reader) *bufio.Scanner {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 1024), ZFSListMaxLineLength)
+	return s
+}
+
+type ZFSListLineTooLongError struct {
+	MaxLength int
+}
+
+func (e *ZFSListLineTooLongError) Error() string {
+	return fmt.Sprintf("zfs list output line exceeds %d bytes (adjust limit using ZFS_LIST_MAX_LINE_LENGTH)", e.MaxLength)
+}
+
+func zfsListScanError(err error) error {
+	if err == bufio.ErrTooLong {
+		return &ZFSListLineTooLongError{ZFSListMaxLineLength}
+	}
+	return err
+}
+
 type ZFSListResult struct {
 	Fields []string
 	Err    error
@@ -218,6 +488,10 @@ type ZFSListResult struct {
 //
 // However, if callers do not drain `out` or cancel via `ctx`, the process will leak either running because
 // IO is pending or as a zombie.
+//
+// The process counts towards the ZREPL_MAX_ZFS_COMMANDS limit until `out` is closed.
+// Hence, consumers of `out` must not run other `zfs list` or `zfs get` commands while
+// draining it, or they risk a deadlock under load.
 func ZFSListChan(ctx context.Context, out chan ZFSListResult, properties []string, zfsArgs ...string) {
 	defer close(out)
 
@@ -236,14 +510,25 @@ func ZFSListChan(ctx context.Context, out chan ZFSListResult, properties []strin
 		}
 	}
 
+	guard, err := acquireZFSListGetSlot(ctx)
+	if err != nil {
+		sendResult(nil, err)
+		return
+	}
+	defer guard.Release()
+
 	cmd := exec.CommandContext(ctx, ZFS_BINARY, args...)
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		sendResult(nil, err)
 		return
 	}
-	// TODO bounded buffer
-	stderr := bytes.NewBuffer(make([]byte, 0, 1024))
+	// only the tail of stderr is retained
+	stderr, err := circlog.NewCircularLog(ZFSListStderrMaxCopySize)
+	if err != nil {
+		sendResult(nil, err)
+		return
+	}
 	cmd.Stderr = stderr
 	if err = cmd.Start(); err != nil {
 		sendResult(nil, err)
@@ -251,37 +536,33 @@ func ZFSListChan(ctx context.Context, out chan ZFSListResult, properties []strin
 	}
 	defer func() {
 		// discard the error, this defer is only relevant if we return while parsing the output
-		// in which case we'll return an 'unexpected output' error and not the exit status
+		// in which case we'll return a parsing error and not the exit status
 		_ = cmd.Wait()
 	}()
 
-	s := bufio.NewScanner(stdout)
-	buf := make([]byte, 1024) // max line length
-	s.Buffer(buf, 0)
+	s := newZFSListScanner(stdout)
 
 	for s.Scan() {
-		fields := strings.SplitN(s.Text(), "\t", len(properties))
-		if len(fields) != len(properties) {
-			sendResult(nil, errors.New("unexpected output"))
+		fields, err := splitZFSListLine(s.Text(), properties)
+		if err != nil {
+			sendResult(nil, err)
 			return
 		}
 		if sendResult(fields, nil) {
 			return
 		}
 	}
-	if err := cmd.Wait(); err != nil {
-		if err, ok := err.(*exec.ExitError); ok {
-			sendResult(nil, &ZFSError{
-				Stderr:  stderr.Bytes(),
-				WaitErr: err,
-			})
-		} else {
-			sendResult(nil, &ZFSError{WaitErr: err})
-		}
+	if err := s.Err(); err != nil {
+		// zfs might block writing to the pipe if we stop reading, the deferred cmd.Wait reaps it
+		_ = cmd.Process.Kill()
+		sendResult(nil, zfsListScanError(err))
 		return
 	}
-	if s.Err() != nil {
-		sendResult(nil, s.Err())
+	if err := cmd.Wait(); err != nil {
+		sendResult(nil, &ZFSError{
+			Stderr:  stderr.Bytes(),
+			WaitErr: err,
+		})
 		return
 	}
 }
@@ -314,21 +595,174 @@ func absVersion(fs, v string) (full string, err error) {
 	return fmt.Sprintf("%s%s", fs, v), nil
 }
 
-func buildCommonSendArgs(fs string, from, to string, token string) ([]string, error) {
+// ZFSSendArgs bundles the arguments of a `zfs send` invocation.
+type ZFSSendArgs struct {
+	FS string
+	// From may be "", in which case a full send is done.
+	From, To string
+	// If not "", `zfs send -t ResumeToken` is used and From and To must be "".
+	// The resumed send uses the flags of the interrupted send, hence
+	// Raw, LargeBlocks and Compressed must not be set either.
+	ResumeToken string
+
+	// Raw (-w) is independent of encryption:
+	//   - For unencrypted filesystems, zfs send accepts it and it is equivalent to -Lec,
+	//     i.e. blocks are sent as they are on disk, without recompression.
+	//     Combining it with LargeBlocks, EmbeddedData or Compressed is accepted but redundant.
+	//   - For encrypted filesystems, the stream contains the encrypted blocks and
+	//     can be produced without the key being loaded. The received filesystem is encrypted
+	//     with the sender's key.
+	//   - A non-raw send of an encrypted filesystem sends plaintext and requires the key to be
+	//     loaded, which ZFSSend and ZFSSendDry check (see *EncryptedSendKeyUnavailableError).
+	Raw           bool   // -w
+	LargeBlocks   bool   // -L
+	EmbeddedData  bool   // -e
+	Compressed    bool   // -c
+	Properties    bool   // -p
+	Replicate     bool   // -R
+	Intermediates bool   // -I instead of -i
+	Holds         bool   // -h
+	Redact        string // --redact bookmark
+}
+
+type sendFlagIncompatibility struct {
+	a, b   string
+	isSetA func(a *ZFSSendArgs) bool
+	isSetB func(a *ZFSSendArgs) bool
+}
+
+var sendFlagIncompatibilities = []sendFlagIncompatibility{
+	{"resume token", "-R", func(a *ZFSSendArgs) bool { return a.ResumeToken != "" }, func(a *ZFSSendArgs) bool { return a.Replicate }},
+	{"resume token", "-I", func(a *ZFSSendArgs) bool { return a.ResumeToken != "" }, func(a *ZFSSendArgs) bool { return a.Intermediates }},
+	{"resume token", "-p", func(a *ZFSSendArgs) bool { return a.ResumeToken != "" }, func(a *ZFSSendArgs) bool { return a.Properties }},
+	{"resume token", "-h", func(a *ZFSSendArgs) bool { return a.ResumeToken != "" }, func(a *ZFSSendArgs) bool { return a.Holds }},
+	{"resume token", "--redact", func(a *ZFSSendArgs) bool { return a.ResumeToken != "" }, func(a *ZFSSendArgs) bool { return a.Redact != "" }},
+	// the flags of the interrupted send are encoded in the resume token (see ResumeToken)
+	{"resume token", "-w", func(a *ZFSSendArgs) bool { return a.ResumeToken != "" }, func(a *ZFSSendArgs) bool { return a.Raw }},
+	{"resume token", "-L", func(a *ZFSSendArgs) bool { return a.ResumeToken != "" }, func(a *ZFSSendArgs) bool { return a.LargeBlocks }},
+	{"resume token", "-c", func(a *ZFSSendArgs) bool { return a.ResumeToken != "" }, func(a *ZFSSendArgs) bool { return a.Compressed }},
+	{"resume token", "from", func(a *ZFSSendArgs) bool { return a.ResumeToken != "" }, func(a *ZFSSendArgs) bool { return a.From != "" }},
+	{"resume token", "to", func(a *ZFSSendArgs) bool { return a.ResumeToken != "" }, func(a *ZFSSendArgs) bool { return a.To != "" }},
+	{"-R", "--redact", func(a *ZFSSendArgs) bool { return a.Replicate }, func(a *ZFSSendArgs) bool { return a.Redact != "" }},
+}
+
+// validateFlagCombinations rejects combinations of send flags that zfs send
+// would reject with a (much less helpful) error of its own.
+func (a *ZFSSendArgs) validateFlagCombinations() error {
+	for _, i := range sendFlagIncompatibilities {
+		if i.isSetA(a) && i.isSetB(a) {
+			return fmt.Errorf("send args: %s and %s are mutually exclusive", i.a, i.b)
+		}
+	}
+	if a.Intermediates && a.From == "" {
+		return errors.New("send args: -I requires an incremental source")
+	}
+	return nil
+}
+
+type sendFlagVersionRequirement struct {
+	flags        string
+	isSet        func(a *ZFSSendArgs) bool
+	major, minor int
+}
+
+var sendFlagVersionRequirements = []sendFlagVersionRequirement{
+	// OpenZFS 0.8 cannot receive the encryption properties of a raw send with -p
+	{"-w with -p", func(a *ZFSSendArgs) bool { return a.Raw && a.Properties }, 2, 0},
+}
+
+// validateForZFSVersion rejects flag combinations that the version of ZFS_BINARY does not support.
+// If the version cannot be determined (`zfs version` is not available on all platforms),
+// the combination is left for zfs send to reject.
+func (a *ZFSSendArgs) validateForZFSVersion(ctx context.Context) error {
+	for _, r := range sendFlagVersionRequirements {
+		if !r.isSet(a) {
+			continue
+		}
+		version, err := ZFSBinaryVersion(ctx)
+		if _, ok := err.(*ZFSError); ok {
+			debug("send args: cannot determine zfs version, not checking %s: %s", r.flags, err)
+			continue
+		} else if err != nil {
+			return err
+		}
+		major, minor, ok := parseZFSBinaryVersion(version)
+		if !ok {
+			debug("send args: cannot parse zfs version %q, not checking %s", version, r.flags)
+			continue
+		}
+		if major < r.major || (major == r.major && minor < r.minor) {
+			return fmt.Errorf("send args: %s requires OpenZFS %d.%d or later, but zfs is version %q", r.flags, r.major, r.minor, version)
+		}
+	}
+	return nil
+}
+
+// Validate checks the arguments without invoking zfs.
+// ZFSSend and ZFSSendDry additionally check that the key of an encrypted
+// filesystem is loaded if a non-raw send is requested.
+func (a *ZFSSendArgs) Validate() error {
+	if err := a.validateFlagCombinations(); err != nil {
+		return err
+	}
+	if a.ResumeToken != "" {
+		return nil
+	}
+	if _, err := absVersion(a.FS, a.To); err != nil {
+		return errors.Wrap(err, "send args: invalid 'to'")
+	}
+	if a.From != "" {
+		if _, err := absVersion(a.FS, a.From); err != nil {
+			return errors.Wrap(err, "send args: invalid 'from'")
+		}
+	}
+	return nil
+}
+
+func (a *ZFSSendArgs) buildCommonSendArgs() ([]string, error) {
+	if err := a.Validate(); err != nil {
+		return nil, err
+	}
+
 	args := make([]string, 0, 3)
-	if token != "" {
-		args = append(args, "-t", token)
+	if a.Raw {
+		args = append(args, "-w")
+	}
+	if a.LargeBlocks {
+		args = append(args, "-L")
+	}
+	if a.EmbeddedData {
+		args = append(args, "-e")
+	}
+	if a.Compressed {
+		args = append(args, "-c")
+	}
+	if a.Properties {
+		args = append(args, "-p")
+	}
+	if a.Replicate {
+		args = append(args, "-R")
+	}
+	if a.Holds {
+		args = append(args, "-h")
+	}
+	if a.Redact != "" {
+		args = append(args, "--redact", a.Redact)
+	}
+
+	if a.ResumeToken != "" {
+		args = append(args, "-t", a.ResumeToken)
 		return args, nil
 	}
 
-	toV, err := absVersion(fs, to)
+	toV, err := absVersion(a.FS, a.To)
 	if err != nil {
 		return nil, err
 	}
 
 	fromV := ""
-	if from != "" {
-		fromV, err = absVersion(fs, from)
+	if a.From != "" {
+		fromV, err = absVersion(a.FS, a.From)
 		if err != nil {
 			return nil, err
 		}
@@ -336,6 +770,8 @@ func buildCommonSendArgs(fs string, from, to string, token string) ([]string, er
 
 	if fromV == "" { // Initial
 		args = append(args, toV)
+	} else if a.Intermediates {
+		args = append(args, "-I", fromV, toV)
 	} else {
 		args = append(args, "-i", fromV, toV)
 	}
@@ -377,6 +813,14 @@ func newSendStreamCopier(stream io.ReadCloser) *sendStreamCopier {
 	return &sendStreamCopier{recorder: readErrRecorder{stream, nil}}
 }
 
+// NewFileStreamCopier returns a StreamCopier that copies the stream read from r,
+// e.g., a stream that was previously captured to a file using TeeStreamCopier.
+// Errors are classified as read or write errors in the same way as for the StreamCopier returned by ZFSSend.
+// Close closes r.
+func NewFileStreamCopier(r io.ReadCloser) StreamCopier {
+	return newSendStreamCopier(r)
+}
+
 func (c *sendStreamCopier) WriteStreamTo(w io.Writer) StreamCopierError {
 	debug("sendStreamCopier.WriteStreamTo: begin")
 	_, err := io.Copy(w, &c.recorder)
@@ -417,7 +861,14 @@ type sendStream struct {
 
 	closeMtx     sync.Mutex
 	stdoutReader *os.File
+	stderrBuf    *circlog.CircularLog
 	opErr        error
+
+	bytesCounter prometheus.Counter
+	bytesRead    int64 // only accessed from Read and killAndWait, which is called from Read on EOF
+
+	sizeEstimateCheck *sendSizeEstimateCheck
+	events            *streamEvents
 }
 
 func (s *sendStream) Read(p []byte) (n int, err error) {
@@ -429,6 +880,11 @@ func (s *sendStream) Read(p []byte) (n int, err error) {
 	}
 
 	n, err = s.stdoutReader.Read(p)
+	if n > 0 {
+		s.bytesCounter.Add(float64(n))
+		s.bytesRead += int64(n)
+		s.events.transferred(n)
+	}
 	if err != nil {
 		debug("sendStream: read err: %T %s", err, err)
 		// TODO we assume here that any read error is permanent
@@ -446,7 +902,7 @@ func (s *sendStream) Close() error {
 	return s.killAndWait(nil)
 }
 
-func (s *sendStream) killAndWait(precedingReadErr error) error {
+func (s *sendStream) killAndWait(precedingReadErr error) (err error) {
 
 	debug("sendStream: killAndWait enter")
 	defer debug("sendStream: killAndWait leave")
@@ -466,6 +922,14 @@ func (s *sendStream) killAndWait(precedingReadErr error) error {
 		return s.opErr
 	}
 
+	defer func() {
+		if err == io.EOF {
+			s.events.finished(nil)
+		} else {
+			s.events.finished(err)
+		}
+	}()
+
 	waitErr := s.cmd.Wait()
 	// distinguish between ExitError (which is actually a non-problem for us)
 	// vs failed wait syscall (for which we give upper layers the chance to retyr)
@@ -494,7 +958,7 @@ func (s *sendStream) killAndWait(precedingReadErr error) error {
 	// we managed to tear things down, no let's give the user some pretty *ZFSError
 	if exitErr != nil {
 		s.opErr = &ZFSError{
-			Stderr:  exitErr.Stderr,
+			Stderr:  s.stderrBuf.Bytes(),
 			WaitErr: exitErr,
 		}
 	} else {
@@ -505,25 +969,104 @@ func (s *sendStream) killAndWait(precedingReadErr error) error {
 	// after the pipe EOFed and zfs send exited without errors
 	// this is actullay the "hot" / nice path
 	if exitErr == nil && precedingReadErr == io.EOF {
+		if s.sizeEstimateCheck != nil {
+			s.sizeEstimateCheck.check(s.bytesRead)
+		}
 		return precedingReadErr
 	}
 
 	return s.opErr
 }
 
-// if token != "", then send -t token is used
+type SendOptions struct {
+	// If not nil, `zfs send -v -P` is used and OnProgress is invoked
+	// for every progress line that zfs send writes to stderr.
+	OnProgress SendProgressFunc
+
+	// If SizeEstimate > 0 (e.g. from ZFSSendDry), the number of bytes actually sent
+	// is compared to it after the stream has been read completely.
+	// If they differ by more than SizeEstimateMaxDivergencePercent percent of SizeEstimate,
+	// the divergence is counted in the send_size_estimate_divergences metric
+	// and OnSizeEstimateDivergence is invoked (if not nil).
+	SizeEstimate int64
+	// If zero, ZFSSendSizeEstimateMaxDivergencePercent is used.
+	SizeEstimateMaxDivergencePercent int
+	OnSizeEstimateDivergence         func(estimate, actual int64)
+
+	// If not nil, OnEvent is invoked for the lifecycle events of the stream.
+	OnEvent StreamEventFunc
+
+	// Wrap the stream in checksummed frames (see NewChecksumFramingStreamCopier),
+	// the receiver must use RecvOptions.StreamChecksum.
+	// Detects corruption in transit at the cost of CPU time on both sides.
+	StreamChecksum bool
+}
+
+type sendSizeEstimateCheck struct {
+	fs           string
+	estimate     int64
+	maxDivergPct int
+	onDivergence func(estimate, actual int64)
+}
+
+func (o SendOptions) sizeEstimateCheck(fs string) *sendSizeEstimateCheck {
+	if o.SizeEstimate <= 0 {
+		return nil
+	}
+	c := &sendSizeEstimateCheck{
+		fs:           fs,
+		estimate:     o.SizeEstimate,
+		maxDivergPct: o.SizeEstimateMaxDivergencePercent,
+		onDivergence: o.OnSizeEstimateDivergence,
+	}
+	if c.maxDivergPct <= 0 {
+		c.maxDivergPct = ZFSSendSizeEstimateMaxDivergencePercent
+	}
+	return c
+}
+
+// diverges reports whether actual differs from the estimate by more than the allowed percentage
+func (c *sendSizeEstimateCheck) diverges(actual int64) bool {
+	diff := actual - c.estimate
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff*100 > c.estimate*int64(c.maxDivergPct)
+}
+
+func (c *sendSizeEstimateCheck) check(actual int64) {
+	if !c.diverges(actual) {
+		return
+	}
+	debug("send: size estimate divergence for %q: estimate=%v actual=%v", c.fs, c.estimate, actual)
+	prom.ZFSSendSizeEstimateDivergences.WithLabelValues(c.fs).Inc()
+	if c.onDivergence != nil {
+		c.onDivergence(c.estimate, actual)
+	}
+}
+
+// if sendArgs.ResumeToken != "", then send -t token is used
 // otherwise send [-i from] to is used
-// (if from is "" a full ZFS send is done)
-func ZFSSend(ctx context.Context, fs string, from, to string, token string) (streamCopier StreamCopier, err error) {
+// (if sendArgs.From is "" a full ZFS send is done)
+func ZFSSend(ctx context.Context, sendArgs ZFSSendArgs, opts SendOptions) (streamCopier StreamCopier, err error) {
 
 	args := make([]string, 0)
 	args = append(args, "send")
+	if opts.OnProgress != nil {
+		args = append(args, "-v", "-P")
+	}
 
-	sargs, err := buildCommonSendArgs(fs, from, to, token)
+	sargs, err := sendArgs.buildCommonSendArgs()
 	if err != nil {
 		return nil, err
 	}
 	args = append(args, sargs...)
+	if err := sendArgs.validateForZFSVersion(ctx); err != nil {
+		return nil, err
+	}
+	if err := sendArgs.validateKeyLoadedForNonRawSend(ctx); err != nil {
+		return nil, err
+	}
 
 	ctx, cancel := context.WithCancel(ctx)
 	cmd := exec.CommandContext(ctx, ZFS_BINARY, args...)
@@ -537,6 +1080,19 @@ func ZFSSend(ctx context.Context, fs string, from, to string, token string) (str
 
 	cmd.Stdout = stdoutWriter
 
+	stderrBuf, err := circlog.NewCircularLog(ZFSSendStderrMaxCopySize)
+	if err != nil {
+		cancel()
+		stdoutWriter.Close()
+		stdoutReader.Close()
+		return nil, err
+	}
+	if opts.OnProgress != nil {
+		cmd.Stderr = io.MultiWriter(stderrBuf, newSendProgressParser(opts.OnProgress))
+	} else {
+		cmd.Stderr = stderrBuf
+	}
+
 	if err := cmd.Start(); err != nil {
 		cancel()
 		stdoutWriter.Close()
@@ -549,8 +1105,17 @@ func ZFSSend(ctx context.Context, fs string, from, to string, token string) (str
 		cmd:          cmd,
 		kill:         cancel,
 		stdoutReader: stdoutReader,
+		stderrBuf:    stderrBuf,
+		bytesCounter: prom.ZFSSendBytes.WithLabelValues(sendArgs.FS),
+
+		sizeEstimateCheck: opts.sizeEstimateCheck(sendArgs.FS),
+		events:            newStreamEvents(sendArgs.FS, opts.OnEvent),
 	}
+	stream.events.started()
 
+	if opts.StreamChecksum {
+		return NewChecksumFramingStreamCopier(newSendStreamCopier(stream)), nil
+	}
 	return newSendStreamCopier(stream), err
 }
 
@@ -573,10 +1138,25 @@ func DrySendTypeFromString(s string) (DrySendType, error) {
 }
 
 type DrySendInfo struct {
-	Type         DrySendType
-	Filesystem   string // parsed from To field
-	From, To     string // direct copy from ZFS output
-	SizeEstimate int64  // -1 if size estimate is not possible
+	Type       DrySendType
+	Filesystem string // parsed from To field
+	From, To   string // direct copy from ZFS output
+	// -1 if size estimate is not possible (e.g. incremental send from a bookmark).
+	// 0 is a valid estimate: zfs send considers the stream (nearly) empty.
+	// Use HasSizeEstimate and NothingToSend instead of comparing with 0 or -1.
+	SizeEstimate int64
+}
+
+// HasSizeEstimate reports whether zfs send provided a size estimate.
+func (s *DrySendInfo) HasSizeEstimate() bool {
+	return s.SizeEstimate != -1
+}
+
+// NothingToSend reports whether zfs send estimated the incremental stream to contain no data,
+// e.g. because From and To refer to the same snapshot.
+// It is false if no estimate is available.
+func (s *DrySendInfo) NothingToSend() bool {
+	return s.Type == DrySendTypeIncremental && s.SizeEstimate == 0
 }
 
 var (
@@ -585,23 +1165,56 @@ var (
 	sendDryRunInfoLineRegexFull = regexp.MustCompile(`^(full)\t()([^\t]+@[^\t]+)\t([0-9]+)$`)
 	// cannot enforce '[#@]' in incremental source, see test cases
 	sendDryRunInfoLineRegexIncremental = regexp.MustCompile(`^(incremental)\t([^\t]+)\t([^\t]+@[^\t]+)\t([0-9]+)$`)
+
+	sendDryRunSizeLineRegex = regexp.MustCompile(`^size\t([0-9]+)$`)
 )
 
 // see test cases for example output
+//
+// `zfs send -I` prints one info line per snapshot in the range:
+// s describes the entire range, i.e., From is taken from the first and To from the last info line.
+// SizeEstimate is the total from the `size` line, or the sum of the info lines
+// if there is no such line (resume token output).
 func (s *DrySendInfo) unmarshalZFSOutput(output []byte) (err error) {
 	debug("DrySendInfo.unmarshalZFSOutput: output=%q", output)
 	lines := strings.Split(string(output), "\n")
+	matched := false
+	var sum, total int64 = 0, -1
 	for _, l := range lines {
-		regexMatched, err := s.unmarshalInfoLine(l)
+		if m := sendDryRunSizeLineRegex.FindStringSubmatch(l); m != nil {
+			total, err = strconv.ParseInt(m[1], 10, 64)
+			if err != nil {
+				return fmt.Errorf("line %q: cannot not parse size: %s", l, err)
+			}
+			continue
+		}
+		var hop DrySendInfo
+		regexMatched, err := hop.unmarshalInfoLine(l)
 		if err != nil {
 			return fmt.Errorf("line %q: %s", l, err)
 		}
 		if !regexMatched {
 			continue
 		}
-		return nil
+		if !matched {
+			*s = hop
+		} else {
+			if hop.Filesystem != s.Filesystem {
+				return fmt.Errorf("line %q: info lines refer to different filesystems %q and %q", l, s.Filesystem, hop.Filesystem)
+			}
+			s.To = hop.To
+		}
+		sum += hop.SizeEstimate
+		matched = true
+	}
+	if !matched {
+		return fmt.Errorf("no match for info line (regex1 %s) (regex2 %s)", sendDryRunInfoLineRegexFull, sendDryRunInfoLineRegexIncremental)
 	}
-	return fmt.Errorf("no match for info line (regex1 %s) (regex2 %s)", sendDryRunInfoLineRegexFull, sendDryRunInfoLineRegexIncremental)
+	s.SizeEstimate = sum
+	if total != -1 {
+		s.SizeEstimate = total
+	}
+	return nil
 }
 
 // unmarshal info line, looks like this:
@@ -643,17 +1256,18 @@ func (s *DrySendInfo) unmarshalInfoLine(l string) (regexMatched bool, err error)
 	return true, nil
 }
 
-// from may be "", in which case a full ZFS send is done
-// May return BookmarkSizeEstimationNotSupported as err if from is a bookmark.
-func ZFSSendDry(fs string, from, to string, token string) (_ *DrySendInfo, err error) {
+// sendArgs.From may be "", in which case a full ZFS send is done
+//
+// If from is a bookmark, the returned DrySendInfo has no size estimate (SizeEstimate == -1)
+// unless the zfs binary supports estimation from bookmarks (see BookmarkSizeEstimateSupported).
+func ZFSSendDry(ctx context.Context, sendArgs ZFSSendArgs) (_ *DrySendInfo, err error) {
+
+	fs, from, to := sendArgs.FS, sendArgs.From, sendArgs.To
+	if !strings.Contains(from, "#") {
+		return zfsSendDry(ctx, sendArgs)
+	}
 
-	if strings.Contains(from, "#") {
-		/* TODO:
-		 * ZFS at the time of writing does not support dry-run send because size-estimation
-		 * uses fromSnap's deadlist. However, for a bookmark, that deadlist no longer exists.
-		 * Redacted send & recv will bring this functionality, see
-		 * 	https://github.com/openzfs/openzfs/pull/484
-		 */
+	noEstimate := func() (*DrySendInfo, error) {
 		fromAbs, err := absVersion(fs, from)
 		if err != nil {
 			return nil, fmt.Errorf("error building abs version for 'from': %s", err)
@@ -670,18 +1284,42 @@ func ZFSSendDry(fs string, from, to string, token string) (_ *DrySendInfo, err e
 			SizeEstimate: -1}, nil
 	}
 
+	// Older ZFS does not support dry-run send from a bookmark because size-estimation
+	// uses fromSnap's deadlist. However, for a bookmark, that deadlist no longer exists.
+	// OpenZFS with redacted send & recv (and bookmark v2) can estimate from bookmarks, see
+	// 	https://github.com/openzfs/openzfs/pull/484
+	supported, err := BookmarkSizeEstimateSupported(ctx)
+	if err != nil || !supported {
+		return noEstimate()
+	}
+	si, err := zfsSendDry(ctx, sendArgs)
+	if _, ok := err.(*ZFSError); ok {
+		// e.g. bookmarks created by older ZFS versions lack the information required for estimation
+		debug("send dry-run from bookmark failed, falling back to no size estimate: %s", err)
+		return noEstimate()
+	}
+	return si, err
+}
+
+func zfsSendDry(ctx context.Context, sendArgs ZFSSendArgs) (_ *DrySendInfo, err error) {
 	args := make([]string, 0)
 	args = append(args, "send", "-n", "-v", "-P")
-	sargs, err := buildCommonSendArgs(fs, from, to, token)
+	sargs, err := sendArgs.buildCommonSendArgs()
 	if err != nil {
 		return nil, err
 	}
+	if err := sendArgs.validateForZFSVersion(ctx); err != nil {
+		return nil, err
+	}
+	if err := sendArgs.validateKeyLoadedForNonRawSend(ctx); err != nil {
+		return nil, err
+	}
 	args = append(args, sargs...)
 
 	cmd := exec.Command(ZFS_BINARY, args...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return nil, err
+		return nil, &ZFSError{Stderr: output, WaitErr: err}
 	}
 	var si DrySendInfo
 	if err := si.unmarshalZFSOutput(output); err != nil {
@@ -708,64 +1346,461 @@ type StreamCopier interface {
 	Close() error
 }
 
-type RecvOptions struct {
-	// Rollback to the oldest snapshot, destroy it, then perform `recv -F`.
-	// Note that this doesn't change property values, i.e. an existing local property value will be kept.
-	RollbackAndForceRecv bool
-}
+// FullRecvIntoExistingPolicy determines how ZFSRecv handles a full (non-incremental)
+// stream if the target filesystem already exists.
+type FullRecvIntoExistingPolicy int
 
-func ZFSRecv(ctx context.Context, fs string, streamCopier StreamCopier, opts RecvOptions) (err error) {
+const (
+	// Let zfs recv fail, the error is reported as *RecvDestinationExistsError.
+	FullRecvIntoExistingReject FullRecvIntoExistingPolicy = iota
+	// Destroy all snapshots of the existing filesystem and `recv -F` over it.
+	// This is destructive and must be opted into explicitly.
+	FullRecvIntoExistingForceOverwrite
+	// Receive into a new sibling of the target filesystem, named by FullRecvSiblingName.
+	FullRecvIntoExistingNewSibling
+)
 
-	if err := validateZFSFilesystem(fs); err != nil {
-		return err
+func (p FullRecvIntoExistingPolicy) String() string {
+	switch p {
+	case FullRecvIntoExistingReject:
+		return "reject"
+	case FullRecvIntoExistingForceOverwrite:
+		return "force-overwrite"
+	case FullRecvIntoExistingNewSibling:
+		return "new-sibling"
+	default:
+		return fmt.Sprintf("FullRecvIntoExistingPolicy(%d)", int(p))
+	}
+}
+
+// FullRecvSiblingName is the name of the filesystem that a full stream is received into
+// under policy FullRecvIntoExistingNewSibling.
+// toGUID is the GUID of the snapshot in the stream.
+func FullRecvSiblingName(fs string, toGUID uint64) string {
+	return fmt.Sprintf("%s_%016x", fs, toGUID)
+}
+
+type RecvDestinationExistsError struct {
+	Filesystem string
+	ZFSError   *ZFSError
+}
+
+func (e *RecvDestinationExistsError) Error() string {
+	return fmt.Sprintf("cannot receive full stream: destination filesystem %q exists", e.Filesystem)
+}
+
+var recvDestinationExistsRegexp = regexp.MustCompile(`cannot receive new filesystem stream: destination '([^']+)' exists`)
+
+// RecvOutOfSpaceError is returned by ZFSRecv if the receive failed
+// because the receiving pool or a quota ran out of space.
+type RecvOutOfSpaceError struct {
+	Filesystem string
+	ZFSError   *ZFSError
+}
+
+func (e *RecvOutOfSpaceError) Error() string {
+	return fmt.Sprintf("cannot receive into %q: out of space", e.Filesystem)
+}
+
+var recvOutOfSpaceRegexp = regexp.MustCompile(`(?i)out of space|no space left on device|quota exceeded`)
+
+// RecvIncrementalSourceMismatchError is returned by ZFSRecv if an incremental stream
+// cannot be received because the receiving filesystem does not have the stream's
+// incremental source (e.g. because it was destroyed) or has diverged from it.
+// Callers may fall back to a full send.
+type RecvIncrementalSourceMismatchError struct {
+	Filesystem string
+	Reason     string // as reported by zfs recv
+	ZFSError   *ZFSError
+}
+
+func (e *RecvIncrementalSourceMismatchError) Error() string {
+	return fmt.Sprintf("cannot receive incremental stream into %q: %s", e.Filesystem, e.Reason)
+}
+
+var recvIncrementalSourceMismatchRegexps = []*regexp.Regexp{
+	// the message is wrapped over two lines by libzfs
+	regexp.MustCompile(`most recent snapshot of (\S+) does not\s+match incremental source`),
+	regexp.MustCompile(`incremental source \(?(\S+?)\)? does not exist`),
+}
+
+// RecvDestinationModifiedError is returned by ZFSRecv if an incremental stream
+// cannot be received because the receiving filesystem was modified since its most
+// recent snapshot. Unlike RecvIncrementalSourceMismatchError, the incremental source
+// is still present: rolling back to it (RecvOptions.RollbackAndForceRecv) resolves this,
+// a full send does not.
+type RecvDestinationModifiedError struct {
+	Filesystem string
+	ZFSError   *ZFSError
+}
+
+func (e *RecvDestinationModifiedError) Error() string {
+	return fmt.Sprintf("cannot receive incremental stream: destination %q has been modified since most recent snapshot", e.Filesystem)
+}
+
+// the message is wrapped over two lines by libzfs
+var recvDestinationModifiedRegexp = regexp.MustCompile(`destination (\S+) has been modified\s+since most recent snapshot`)
+
+// returns nil if stderr does not indicate an incremental source mismatch
+func tryRecvIncrementalSourceMismatchError(fs string, zfsErr *ZFSError) *RecvIncrementalSourceMismatchError {
+	for _, re := range recvIncrementalSourceMismatchRegexps {
+		m := re.FindSubmatch(zfsErr.Stderr)
+		if m == nil {
+			continue
+		}
+		return &RecvIncrementalSourceMismatchError{
+			Filesystem: fs,
+			Reason:     strings.Join(strings.Fields(string(m[0])), " "),
+			ZFSError:   zfsErr,
+		}
+	}
+	return nil
+}
+
+type RecvOptions struct {
+	// Rollback to the oldest snapshot, destroy it, then perform `recv -F`.
+	// Note that this doesn't change property values, i.e. an existing local property value will be kept.
+	RollbackAndForceRecv bool
+	// Only relevant if RollbackAndForceRecv is false.
+	FullRecvIntoExisting FullRecvIntoExistingPolicy
+	// Capacity hint for the pipe between zrepl and `zfs recv`.
+	// If zero, ZFSRecvPipeCapacityHint is used.
+	PipeCapacity int
+	// If not nil, OnProgress is called with the number of bytes written to `zfs recv` so far.
+	// It is called at most once per ProgressInterval while the stream is copied,
+	// and once more after the copy has finished.
+	OnProgress       func(received int64)
+	ProgressInterval time.Duration
+	// If not nil, OnEvent is invoked for the lifecycle events of the stream.
+	OnEvent StreamEventFunc
+	// After zfs recv exited successfully, check that the received snapshot
+	// is listed on the receiving filesystem (with the GUID from the stream).
+	// If it is not, *RecvVerificationError is returned.
+	VerifyReceivedSnapshot bool
+	// Use `zfs recv -n -v`: the stream is consumed but nothing is received.
+	// No rollback is done for RollbackAndForceRecv, and VerifyReceivedSnapshot and SavePartial are ignored.
+	DryRun bool
+	// Use `zfs recv -v` to learn the resulting snapshot name (see RecvResult).
+	Verbose bool
+	// Use `zfs recv -s`: if the receive is interrupted, ZFS keeps the partially received state,
+	// which can be resumed using RecvResult.PartialResumeToken.
+	SavePartial bool
+	// Properties to set on the received filesystem regardless of the stream (`zfs recv -o k=v`),
+	// e.g. canmount=off for streams sent with properties.
+	Overrides map[string]string
+	// Properties of the stream that are not received (`zfs recv -x k`),
+	// i.e. the received filesystem inherits them.
+	Excludes []string
+	// Receive filesystems with `-o canmount=noauto` so that they are not mounted,
+	// neither by the receive nor at boot. This avoids collisions with the sender's
+	// mountpoints in local replication setups. Ignored for volume streams.
+	// Must not be combined with canmount in Overrides or Excludes.
+	NoAutoMount bool
+	// The stream was produced with SendOptions.StreamChecksum,
+	// checksums are verified while receiving (see NewChecksumVerifyingStreamCopier).
+	StreamChecksum bool
+	// Receive the stream as a clone of snapshot Origin (`zfs recv -o origin=pool/fs@snap`).
+	// Origin must exist, which is checked before zfs recv is started (see *RecvOriginDoesNotExistError).
+	// Must not be combined with RollbackAndForceRecv or with forcibly overwriting
+	// an existing filesystem (FullRecvIntoExistingForceOverwrite),
+	// nor with origin in Overrides or Excludes.
+	Origin string
+
+	// called with the stream header once it has been read, used by ZFSRecvDryRun
+	onHeader func(*sendStreamBeginHeader)
+}
+
+// appendPropertyArgs appends the -o and -x arguments for o.Overrides and o.Excludes to args
+// (in a deterministic order).
+func (o RecvOptions) appendPropertyArgs(args *[]string) error {
+	keys := make([]string, 0, len(o.Overrides))
+	for k := range o.Overrides {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		single := NewZFSProperties()
+		single.Set(k, o.Overrides[k])
+		if err := single.appendOptionArgs(args); err != nil {
+			return err
+		}
+	}
+	if o.NoAutoMount {
+		if _, ok := o.Overrides["canmount"]; ok {
+			return fmt.Errorf("NoAutoMount cannot be combined with a canmount override")
+		}
+	}
+	for _, x := range o.Excludes {
+		if o.NoAutoMount && x == "canmount" {
+			return fmt.Errorf("NoAutoMount cannot be combined with excluding canmount")
+		}
+		if x == "" || strings.Contains(x, "=") {
+			return fmt.Errorf("invalid property name to exclude from receive: %q", x)
+		}
+		if _, ok := o.Overrides[x]; ok {
+			return fmt.Errorf("property %q cannot be both overridden and excluded", x)
+		}
+		*args = append(*args, "-x", x)
+	}
+	return nil
+}
+
+type RecvOriginDoesNotExistError struct {
+	Origin string
+}
+
+func (e *RecvOriginDoesNotExistError) Error() string {
+	return fmt.Sprintf("cannot receive as clone: origin snapshot %q does not exist", e.Origin)
+}
+
+// validateOrigin validates o.Origin and checks that it exists.
+// No-op if o.Origin is empty.
+func (o RecvOptions) validateOrigin(ctx context.Context) error {
+	if o.Origin == "" {
+		return nil
+	}
+	if _, typ, _, err := DecomposeVersionString(o.Origin); err != nil {
+		return fmt.Errorf("invalid receive origin: %s", err)
+	} else if typ != Snapshot {
+		return fmt.Errorf("invalid receive origin %q: must be a snapshot", o.Origin)
+	}
+	if o.RollbackAndForceRecv {
+		return fmt.Errorf("receive origin cannot be combined with RollbackAndForceRecv")
+	}
+	if _, ok := o.Overrides["origin"]; ok {
+		return fmt.Errorf("receive origin cannot be combined with an origin override")
+	}
+	for _, x := range o.Excludes {
+		if x == "origin" {
+			return fmt.Errorf("receive origin cannot be combined with excluding origin")
+		}
+	}
+	exists, err := zfsExists(ctx, o.Origin)
+	if err != nil {
+		return fmt.Errorf("cannot check whether receive origin %q exists: %s", o.Origin, err)
+	}
+	if !exists {
+		return &RecvOriginDoesNotExistError{o.Origin}
+	}
+	return nil
+}
+
+func (o RecvOptions) pipeCapacity() int {
+	if o.PipeCapacity > 0 {
+		return o.PipeCapacity
+	}
+	return ZFSRecvPipeCapacityHint
+}
+
+// destroy all snapshots before `recv -F` because `recv -F`
+// does not perform a rollback unless `send -R` was used (which we assume hasn't been the case)
+func zfsRecvRollbackForForcedRecv(ctx context.Context, fsdp *DatasetPath) error {
+	var snaps []FilesystemVersion
+	{
+		vs, err := ZFSListFilesystemVersions(ctx, fsdp, nil)
+		if err != nil {
+			return fmt.Errorf("cannot list versions for rollback for forced receive: %s", err)
+		}
+		for _, v := range vs {
+			if v.Type == Snapshot {
+				snaps = append(snaps, v)
+			}
+		}
+		sort.Slice(snaps, func(i, j int) bool {
+			return snaps[i].CreateTXG < snaps[j].CreateTXG
+		})
+	}
+	// bookmarks are rolled back automatically
+	if len(snaps) > 0 {
+		// use rollback to efficiently destroy all but the earliest snapshot
+		// then destroy that earliest snapshot
+		// afterwards, `recv -F` will work
+		rollbackTarget := snaps[0]
+		rollbackTargetAbs := rollbackTarget.ToAbsPath(fsdp)
+		debug("recv: rollback to %q", rollbackTargetAbs)
+		destroyed, err := ZFSRollback(ctx, fsdp, rollbackTarget, "-r")
+		if err != nil {
+			return fmt.Errorf("cannot rollback %s to %s for forced receive: %s", fsdp.ToString(), rollbackTarget, err)
+		}
+		debug("recv: rollback destroyed %v", destroyed)
+		debug("recv: destroy %q", rollbackTargetAbs)
+		if err := ZFSDestroy(ctx, rollbackTargetAbs); err != nil {
+			return fmt.Errorf("cannot destroy %s for forced receive: %s", rollbackTargetAbs, err)
+		}
+	}
+	return nil
+}
+
+// ZFSRecv receives the stream provided by streamCopier into fs.
+//
+// If the snapshot name in the stream header would make the received snapshot's name
+// exceed MaxDatasetNameLen, *DatasetNameTooLongError is returned without invoking zfs recv.
+//
+// The returned *RecvResult is non-nil once `zfs recv` has been started, even if err != nil:
+// with opts.SavePartial, it then reports how far an interrupted receive got.
+func ZFSRecv(ctx context.Context, fs string, streamCopier StreamCopier, opts RecvOptions) (*RecvResult, error) {
+	res := &RecvResult{}
+	err := zfsRecv(ctx, fs, streamCopier, opts, res)
+	if !res.started {
+		return nil, err
+	}
+	if err != nil && opts.SavePartial && !opts.DryRun {
+		res.PartialResumeToken = recvPartialResumeToken(ctx, res.Filesystem)
+	}
+	return res, err
+}
+
+// res is filled in as the receive progresses
+func zfsRecv(ctx context.Context, fs string, streamCopier StreamCopier, opts RecvOptions, res *RecvResult) (err error) {
+
+	if err := validateZFSFilesystem(fs); err != nil {
+		return err
+	}
+	var propertyArgs []string
+	if err := opts.appendPropertyArgs(&propertyArgs); err != nil {
+		return err
+	}
+	if err := opts.validateOrigin(ctx); err != nil {
+		return err
 	}
 	fsdp, err := NewDatasetPath(fs)
 	if err != nil {
 		return err
 	}
 
-	if opts.RollbackAndForceRecv {
-		// destroy all snapshots before `recv -F` because `recv -F`
-		// does not perform a rollback unless `send -R` was used (which we assume hasn't been the case)
-		var snaps []FilesystemVersion
-		{
-			vs, err := ZFSListFilesystemVersions(fsdp, nil)
-			if err != nil {
-				return fmt.Errorf("cannot list versions for rollback for forced receive: %s", err)
+	events := newStreamEvents(fs, opts.OnEvent)
+	events.started()
+	defer func() {
+		events.finished(err)
+	}()
+
+	if opts.StreamChecksum {
+		streamCopier = NewChecksumVerifyingStreamCopier(streamCopier)
+	}
+
+	stdin, stdinWriter, err := pipeWithCapacityHint(opts.pipeCapacity())
+	if err != nil {
+		return err
+	}
+
+	// Start copying right away, the pipe buffers the beginning of the stream until zfs recv is started.
+	// That allows us to look at the stream header before deciding how to invoke zfs recv.
+	// copierErrChan is buffered so that the copier does not leak if we return early.
+	applyFullRecvPolicy := !opts.RollbackAndForceRecv && opts.FullRecvIntoExisting != FullRecvIntoExistingReject
+	// without these options, the header is only used to check the snapshot name length
+	requireHeader := applyFullRecvPolicy || opts.VerifyReceivedSnapshot || opts.NoAutoMount || opts.onHeader != nil
+	var peeker *streamHeaderPeeker
+	copierErrChan := make(chan StreamCopierError, 1)
+	{
+		var w io.Writer = NewPromCountingWriter(stdinWriter, prom.ZFSRecvBytes.WithLabelValues(fs))
+		w = &recvResultCountingWriter{w, res}
+		if events != nil {
+			w = streamEventsWriter{w, events}
+		}
+		var pw *recvProgressWriter
+		if opts.OnProgress != nil {
+			pw = newRecvProgressWriter(w, opts.ProgressInterval, opts.OnProgress)
+			w = pw
+		}
+		peeker = newStreamHeaderPeeker(w, sendStreamBeginHeaderLen)
+		w = peeker
+		go func() {
+			copierErr := streamCopier.WriteStreamTo(w)
+			if pw != nil {
+				pw.finish()
 			}
-			for _, v := range vs {
-				if v.Type == Snapshot {
-					snaps = append(snaps, v)
+			copierErrChan <- copierErr
+		}()
+	}
+	// closing both ends of the pipe makes the copier fail with a write error
+	abortBeforeStart := func(err error) error {
+		stdinWriter.Close()
+		stdin.Close()
+		return err
+	}
+
+	var copierErr StreamCopierError
+	copierDone := false
+	forceRecv := opts.RollbackAndForceRecv
+	recvTarget := fs
+	var header *sendStreamBeginHeader
+	select {
+	case <-peeker.done:
+	case copierErr = <-copierErrChan:
+		copierDone = true
+	case <-ctx.Done():
+		return abortBeforeStart(ctx.Err())
+	}
+	select {
+	case <-peeker.done:
+		header, err = parseSendStreamBeginHeader(peeker.buf)
+		if err != nil && requireHeader {
+			return abortBeforeStart(err)
+		} else if err != nil {
+			// zfs recv will produce a meaningful error
+			debug("recv: cannot parse stream header: %s", err)
+			break
+		}
+		if opts.onHeader != nil {
+			opts.onHeader(header)
+		}
+		if applyFullRecvPolicy && header.IsFull() {
+			exists, err := zfsExists(ctx, fs)
+			if err != nil {
+				return abortBeforeStart(err)
+			} else if exists {
+				switch opts.FullRecvIntoExisting {
+				case FullRecvIntoExistingForceOverwrite:
+					forceRecv = true
+				case FullRecvIntoExistingNewSibling:
+					recvTarget = FullRecvSiblingName(fs, header.ToGUID)
 				}
 			}
-			sort.Slice(snaps, func(i, j int) bool {
-				return snaps[i].CreateTXG < snaps[j].CreateTXG
-			})
-		}
-		// bookmarks are rolled back automatically
-		if len(snaps) > 0 {
-			// use rollback to efficiently destroy all but the earliest snapshot
-			// then destroy that earliest snapshot
-			// afterwards, `recv -F` will work
-			rollbackTarget := snaps[0]
-			rollbackTargetAbs := rollbackTarget.ToAbsPath(fsdp)
-			debug("recv: rollback to %q", rollbackTargetAbs)
-			if err := ZFSRollback(fsdp, rollbackTarget, "-r"); err != nil {
-				return fmt.Errorf("cannot rollback %s to %s for forced receive: %s", fsdp.ToString(), rollbackTarget, err)
-			}
-			debug("recv: destroy %q", rollbackTargetAbs)
-			if err := ZFSDestroy(rollbackTargetAbs); err != nil {
-				return fmt.Errorf("cannot destroy %s for forced receive: %s", rollbackTargetAbs, err)
+		}
+		debug("recv: stream header %#v, policy %s: target=%q force=%v", header, opts.FullRecvIntoExisting, recvTarget, forceRecv)
+		// reject snapshot names that zfs recv cannot create before starting it
+		if snap := header.ToSnapshotName(); snap != "" {
+			if err := checkDatasetNameLength(recvTarget + "@" + snap); err != nil {
+				return abortBeforeStart(err)
 			}
 		}
+	default:
+		// stream ended before the header was complete, zfs recv will produce a meaningful error
+		debug("recv: stream ended before header could be peeked: copierErr=%T %s", copierErr, copierErr)
+	}
+
+	if forceRecv && opts.Origin != "" {
+		return abortBeforeStart(fmt.Errorf("cannot overwrite existing filesystem %q when receiving as clone of %q", fs, opts.Origin))
+	}
+
+	if forceRecv && !opts.DryRun {
+		if err := zfsRecvRollbackForForcedRecv(ctx, fsdp); err != nil {
+			return abortBeforeStart(err)
+		}
 	}
 
 	args := make([]string, 0)
 	args = append(args, "recv")
-	if opts.RollbackAndForceRecv {
+	if opts.DryRun {
+		args = append(args, "-n")
+	}
+	if opts.DryRun || opts.Verbose {
+		args = append(args, "-v")
+	}
+	if opts.SavePartial && !opts.DryRun {
+		args = append(args, "-s")
+	}
+	if forceRecv {
 		args = append(args, "-F")
 	}
-	args = append(args, fs)
+	args = append(args, propertyArgs...)
+	if opts.NoAutoMount && header != nil && header.IsFilesystem() {
+		args = append(args, "-o", "canmount=noauto")
+	}
+	if opts.Origin != "" {
+		args = append(args, "-o", "origin="+opts.Origin)
+	}
+	args = append(args, recvTarget)
 
 	ctx, cancelCmd := context.WithCancel(ctx)
 	defer cancelCmd()
@@ -781,18 +1816,13 @@ func ZFSRecv(ctx context.Context, fs string, streamCopier StreamCopier, opts Rec
 	stdout := bytes.NewBuffer(make([]byte, 0, 1024))
 	cmd.Stdout = stdout
 
-	stdin, stdinWriter, err := pipeWithCapacityHint(ZFSRecvPipeCapacityHint)
-	if err != nil {
-		return err
-	}
-
 	cmd.Stdin = stdin
 
 	if err = cmd.Start(); err != nil {
-		stdinWriter.Close()
-		stdin.Close()
-		return err
+		return abortBeforeStart(err)
 	}
+	res.started = true
+	res.Filesystem = recvTarget
 	stdin.Close()
 	defer stdinWriter.Close()
 
@@ -803,14 +1833,10 @@ func ZFSRecv(ctx context.Context, fs string, streamCopier StreamCopier, opts Rec
 
 	debug("started")
 
-	copierErrChan := make(chan StreamCopierError)
-	go func() {
-		copierErrChan <- streamCopier.WriteStreamTo(stdinWriter)
-	}()
 	waitErrChan := make(chan *ZFSError)
 	go func() {
 		defer close(waitErrChan)
-		if err = cmd.Wait(); err != nil {
+		if err := cmd.Wait(); err != nil {
 			waitErrChan <- &ZFSError{
 				Stderr:  stderr.Bytes(),
 				WaitErr: err,
@@ -821,7 +1847,9 @@ func ZFSRecv(ctx context.Context, fs string, streamCopier StreamCopier, opts Rec
 
 	// streamCopier always fails before or simultaneously with Wait
 	// thus receive from it first
-	copierErr := <-copierErrChan
+	if !copierDone {
+		copierErr = <-copierErrChan
+	}
 	debug("copierErr: %T %s", copierErr, copierErr)
 	if copierErr != nil {
 		cancelCmd()
@@ -829,14 +1857,66 @@ func ZFSRecv(ctx context.Context, fs string, streamCopier StreamCopier, opts Rec
 
 	waitErr := <-waitErrChan
 	debug("waitErr: %T %s", waitErr, waitErr)
+	if opts.DryRun || opts.Verbose {
+		res.setFromVerboseOutput(stdout.Bytes())
+	}
 	if copierErr == nil && waitErr == nil {
+		if opts.VerifyReceivedSnapshot && !opts.DryRun {
+			return verifyReceivedSnapshot(ctx, recvTarget, header)
+		}
 		return nil
 	} else if waitErr != nil && (copierErr == nil || copierErr.IsWriteError()) {
+		if sm := recvDestinationExistsRegexp.FindSubmatch(waitErr.Stderr); sm != nil {
+			return &RecvDestinationExistsError{Filesystem: string(sm[1]), ZFSError: waitErr}
+		}
+		if recvOutOfSpaceRegexp.Match(waitErr.Stderr) {
+			return &RecvOutOfSpaceError{Filesystem: recvTarget, ZFSError: waitErr}
+		}
+		if header != nil && header.IsFull() {
+			return waitErr
+		}
+		if sm := recvDestinationModifiedRegexp.FindSubmatch(waitErr.Stderr); sm != nil {
+			return &RecvDestinationModifiedError{Filesystem: string(sm[1]), ZFSError: waitErr}
+		}
+		if merr := tryRecvIncrementalSourceMismatchError(recvTarget, waitErr); merr != nil {
+			return merr
+		}
 		return waitErr // has more interesting info in that case
 	}
 	return copierErr // if it's not a write error, the copier error is more interesting
 }
 
+type RecvVerificationError struct {
+	Filesystem string
+	GUID       uint64 // 0 if the stream header could not be read
+	Reason     string
+}
+
+func (e *RecvVerificationError) Error() string {
+	return fmt.Sprintf("cannot verify receive into %q: %s", e.Filesystem, e.Reason)
+}
+
+// header may be nil if the stream was too short to contain a header
+func verifyReceivedSnapshot(ctx context.Context, fs string, header *sendStreamBeginHeader) error {
+	if header == nil {
+		return &RecvVerificationError{Filesystem: fs, Reason: "stream did not contain a header"}
+	}
+	fsdp, err := NewDatasetPath(fs)
+	if err != nil {
+		return err
+	}
+	versions, err := ZFSListFilesystemVersions(ctx, fsdp, nil)
+	if err != nil {
+		return &RecvVerificationError{Filesystem: fs, GUID: header.ToGUID, Reason: fmt.Sprintf("cannot list versions: %s", err)}
+	}
+	snap := findVersionByGUID(versions, Snapshot, header.ToGUID)
+	if snap == nil {
+		return &RecvVerificationError{Filesystem: fs, GUID: header.ToGUID, Reason: fmt.Sprintf("no snapshot with GUID %v", header.ToGUID)}
+	}
+	debug("recv: verified snapshot %s with GUID %v", snap.ToAbsPath(fsdp), header.ToGUID)
+	return nil
+}
+
 type ClearResumeTokenError struct {
 	ZFSOutput []byte
 	CmdError  error
@@ -879,6 +1959,63 @@ func (p *ZFSProperties) Get(key string) string {
 	return p.m[key]
 }
 
+// GetUint64 parses the value of key as an unsigned decimal integer,
+// as printed by `zfs get -p`.
+func (p *ZFSProperties) GetUint64(key string) (uint64, error) {
+	v, err := strconv.ParseUint(p.m[key], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("property %q: %s", key, err)
+	}
+	return v, nil
+}
+
+// GetInt64 parses the value of key as a signed decimal integer,
+// as printed by `zfs get -p`.
+func (p *ZFSProperties) GetInt64(key string) (int64, error) {
+	v, err := strconv.ParseInt(p.m[key], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("property %q: %s", key, err)
+	}
+	return v, nil
+}
+
+// GetBytes parses the value of key as a size in bytes.
+// It understands both the exact values printed by `zfs get -p`
+// and the human-readable values printed without -p, e.g. "1.5T" or "512".
+func (p *ZFSProperties) GetBytes(key string) (uint64, error) {
+	v, err := parseZFSHumanBytes(p.m[key])
+	if err != nil {
+		return 0, fmt.Errorf("property %q: %s", key, err)
+	}
+	return v, nil
+}
+
+var zfsHumanBytesRegexp = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)([BKMGTPE]?)$`)
+
+// zfs prints sizes with binary prefixes, see zfs_nicenum in the ZFS source code
+func parseZFSHumanBytes(s string) (uint64, error) {
+	if v, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return v, nil
+	}
+	m := zfsHumanBytesRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	num, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %s", s, err)
+	}
+	shift := uint(strings.Index("BKMGTPE", m[2]) * 10)
+	if m[2] == "" {
+		shift = 0
+	}
+	v := num * float64(uint64(1)<<shift)
+	if v >= math.MaxUint64 {
+		return 0, fmt.Errorf("size %q overflows uint64", s)
+	}
+	return uint64(math.Round(v)), nil
+}
+
 func (p *ZFSProperties) appendArgs(args *[]string) (err error) {
 	for prop, val := range p.m {
 		if strings.Contains(prop, "=") {
@@ -889,11 +2026,24 @@ func (p *ZFSProperties) appendArgs(args *[]string) (err error) {
 	return nil
 }
 
-func ZFSSet(fs *DatasetPath, props *ZFSProperties) (err error) {
-	return zfsSet(fs.ToString(), props)
+// appendOptionArgs appends a `-o prop=val` pair to args for each property in p, sorted by property name
+func (p *ZFSProperties) appendOptionArgs(args *[]string) (err error) {
+	var kvs []string
+	if err := p.appendArgs(&kvs); err != nil {
+		return err
+	}
+	sort.Strings(kvs)
+	for _, kv := range kvs {
+		*args = append(*args, "-o", kv)
+	}
+	return nil
+}
+
+func ZFSSet(ctx context.Context, fs *DatasetPath, props *ZFSProperties) (err error) {
+	return zfsSet(ctx, fs.ToString(), props)
 }
 
-func zfsSet(path string, props *ZFSProperties) (err error) {
+func zfsSet(ctx context.Context, path string, props *ZFSProperties) (err error) {
 	args := make([]string, 0)
 	args = append(args, "set")
 	err = props.appendArgs(&args)
@@ -902,7 +2052,7 @@ func zfsSet(path string, props *ZFSProperties) (err error) {
 	}
 	args = append(args, path)
 
-	cmd := exec.Command(ZFS_BINARY, args...)
+	cmd := exec.CommandContext(ctx, ZFS_BINARY, args...)
 
 	stderr := bytes.NewBuffer(make([]byte, 0, 1024))
 	cmd.Stderr = stderr
@@ -921,12 +2071,44 @@ func zfsSet(path string, props *ZFSProperties) (err error) {
 	return
 }
 
-func ZFSGet(fs *DatasetPath, props []string) (*ZFSProperties, error) {
-	return zfsGet(fs.ToString(), props, sourceAny)
+// ZFSInherit clears the local value of property on fs (`zfs inherit`),
+// i.e., the property is inherited from the parent or reverts to its default.
+// If received is true, it reverts to the received value instead (`zfs inherit -S`).
+func ZFSInherit(ctx context.Context, fs *DatasetPath, property string, received bool) (err error) {
+	if property == "" {
+		return fmt.Errorf("inherit: property must not be empty")
+	}
+	args := []string{"inherit"}
+	if received {
+		args = append(args, "-S")
+	}
+	args = append(args, property, fs.ToString())
+
+	cmd := exec.CommandContext(ctx, ZFS_BINARY, args...)
+
+	stderr := bytes.NewBuffer(make([]byte, 0, 1024))
+	cmd.Stderr = stderr
+
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+
+	if err = cmd.Wait(); err != nil {
+		err = &ZFSError{
+			Stderr:  stderr.Bytes(),
+			WaitErr: err,
+		}
+	}
+
+	return
+}
+
+func ZFSGet(ctx context.Context, fs *DatasetPath, props []string) (*ZFSProperties, error) {
+	return zfsGet(ctx, fs.ToString(), props, sourceAny)
 }
 
-func ZFSGetRawAnySource(path string, props []string) (*ZFSProperties, error) {
-	return zfsGet(path, props, sourceAny)
+func ZFSGetRawAnySource(ctx context.Context, path string, props []string) (*ZFSProperties, error) {
+	return zfsGet(ctx, path, props, sourceAny)
 }
 
 var zfsGetDatasetDoesNotExistRegexp = regexp.MustCompile(`^cannot open '([^)]+)': (dataset does not exist|no such pool or dataset)`) // verified in platformtest
@@ -937,6 +2119,31 @@ type DatasetDoesNotExist struct {
 
 func (d *DatasetDoesNotExist) Error() string { return fmt.Sprintf("dataset %q does not exist", d.Path) }
 
+// ZFSExists reports whether filesystem or volume fs exists.
+// Errors other than *DatasetDoesNotExist are returned as is.
+func ZFSExists(ctx context.Context, fs *DatasetPath) (bool, error) {
+	return zfsExists(ctx, fs.ToString())
+}
+
+// ZFSSnapshotExists reports whether snapshot fs@snap exists.
+// Errors other than *DatasetDoesNotExist are returned as is.
+func ZFSSnapshotExists(ctx context.Context, fs *DatasetPath, snap string) (bool, error) {
+	if snap == "" || strings.ContainsAny(snap, "@#/") {
+		return false, fmt.Errorf("invalid snapshot name %q", snap)
+	}
+	return zfsExists(ctx, zfsBuildSnapName(fs, snap))
+}
+
+func zfsExists(ctx context.Context, ds string) (bool, error) {
+	_, err := zfsGet(ctx, ds, []string{"guid"}, sourceAny)
+	if _, ok := err.(*DatasetDoesNotExist); ok {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 type zfsPropertySource uint
 
 const (
@@ -976,10 +2183,149 @@ func (s zfsPropertySource) zfsGetSourceFieldPrefixes() []string {
 	return prefixes
 }
 
-func zfsGet(path string, props []string, allowedSources zfsPropertySource) (*ZFSProperties, error) {
-	args := []string{"get", "-Hp", "-o", "property,value,source", strings.Join(props, ","), path}
-	cmd := exec.Command(ZFS_BINARY, args...)
+func zfsGet(ctx context.Context, path string, props []string, allowedSources zfsPropertySource) (*ZFSProperties, error) {
+	tuples, err := zfsGetTuples(ctx, path, strings.Join(props, ","))
+	if err != nil {
+		return nil, err
+	}
+	if len(tuples) != len(props) {
+		return nil, fmt.Errorf("zfs get did not return the number of expected property values")
+	}
+	res := &ZFSProperties{
+		make(map[string]string, len(tuples)),
+	}
+	allowedPrefixes := allowedSources.zfsGetSourceFieldPrefixes()
+	for _, t := range tuples {
+		for _, p := range allowedPrefixes {
+			if strings.HasPrefix(t.source, p) {
+				res.m[t.property] = t.value
+				break
+			}
+		}
+	}
+	return res, nil
+}
+
+// ZFSGetAllProps returns all properties of fs (`zfs get all`),
+// including user properties, irrespective of their source.
+// This is intended for diagnostics, e.g. to capture the property state of fs before and after a receive.
+//
+// Returns *DatasetDoesNotExist if fs does not exist.
+func ZFSGetAllProps(ctx context.Context, fs *DatasetPath) (*ZFSProperties, error) {
+	tuples, err := zfsGetTuples(ctx, fs.ToString(), "all")
+	if err != nil {
+		return nil, err
+	}
+	res := &ZFSProperties{
+		make(map[string]string, len(tuples)),
+	}
+	for _, t := range tuples {
+		res.m[t.property] = t.value
+	}
+	return res, nil
+}
+
+// PropertySourceType is the type of the source column of `zfs get`.
+type PropertySourceType int
+
+const (
+	PropertySourceUnknown PropertySourceType = iota
+	PropertySourceLocal
+	PropertySourceDefault
+	PropertySourceInherited
+	PropertySourceNone // `-`, e.g. for read-only properties
+	PropertySourceTemporary
+	PropertySourceReceived
+)
+
+func (t PropertySourceType) String() string {
+	switch t {
+	case PropertySourceLocal:
+		return "local"
+	case PropertySourceDefault:
+		return "default"
+	case PropertySourceInherited:
+		return "inherited"
+	case PropertySourceNone:
+		return "none"
+	case PropertySourceTemporary:
+		return "temporary"
+	case PropertySourceReceived:
+		return "received"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(t))
+	}
+}
+
+// PropValueSource is a property value together with its source as reported by `zfs get`.
+type PropValueSource struct {
+	Value string
+	// The source column of `zfs get`, e.g. "local", "inherited from pool/fs", "received", "default" or "-".
+	Source string
+}
+
+func (p PropValueSource) SourceType() PropertySourceType {
+	switch {
+	case p.Source == "local":
+		return PropertySourceLocal
+	case p.Source == "default":
+		return PropertySourceDefault
+	case strings.HasPrefix(p.Source, "inherited"):
+		return PropertySourceInherited
+	case p.Source == "-":
+		return PropertySourceNone
+	case p.Source == "temporary":
+		return PropertySourceTemporary
+	case p.Source == "received":
+		return PropertySourceReceived
+	default:
+		return PropertySourceUnknown
+	}
+}
+
+// InheritedFrom returns the dataset the property is inherited from,
+// or "" if the property is not inherited.
+func (p PropValueSource) InheritedFrom() string {
+	if p.SourceType() != PropertySourceInherited {
+		return ""
+	}
+	return strings.TrimPrefix(p.Source, "inherited from ")
+}
+
+// ZFSGetWithSource is like ZFSGet but returns the source of each property along with its value,
+// e.g. to decide whether a received property should be restored using `zfs inherit -S`.
+//
+// Returns *DatasetDoesNotExist if fs does not exist.
+func ZFSGetWithSource(ctx context.Context, fs *DatasetPath, props []string) (map[string]PropValueSource, error) {
+	tuples, err := zfsGetTuples(ctx, fs.ToString(), strings.Join(props, ","))
+	if err != nil {
+		return nil, err
+	}
+	if len(tuples) != len(props) {
+		return nil, fmt.Errorf("zfs get did not return the number of expected property values")
+	}
+	res := make(map[string]PropValueSource, len(tuples))
+	for _, t := range tuples {
+		res[t.property] = PropValueSource{Value: t.value, Source: t.source}
+	}
+	return res, nil
+}
+
+type zfsGetTuple struct {
+	property, value, source string
+}
+
+// zfsGetTuples runs `zfs get -Hp -o property,value,source propsArg path`.
+// propsArg is a comma-separated list of properties or "all".
+func zfsGetTuples(ctx context.Context, path string, propsArg string) ([]zfsGetTuple, error) {
+	args := []string{"get", "-Hp", "-o", "property,value,source", propsArg, path}
+	guard, err := acquireZFSListGetSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, ZFS_BINARY, args...)
 	stdout, err := cmd.Output()
+	guard.Release()
 	if err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			if exitErr.Exited() {
@@ -999,14 +2345,10 @@ func zfsGet(path string, props []string, allowedSources zfsPropertySource) (*ZFS
 	}
 	o := string(stdout)
 	lines := strings.Split(o, "\n")
-	if len(lines) < 1 || // account for newlines
-		len(lines)-1 != len(props) {
+	if len(lines) < 1 { // account for newlines
 		return nil, fmt.Errorf("zfs get did not return the number of expected property values")
 	}
-	res := &ZFSProperties{
-		make(map[string]string, len(lines)),
-	}
-	allowedPrefixes := allowedSources.zfsGetSourceFieldPrefixes()
+	tuples := make([]zfsGetTuple, 0, len(lines)-1)
 	for _, line := range lines[:len(lines)-1] {
 		fields := strings.FieldsFunc(line, func(r rune) bool {
 			return r == '\t'
@@ -1014,13 +2356,93 @@ func zfsGet(path string, props []string, allowedSources zfsPropertySource) (*ZFS
 		if len(fields) != 3 {
 			return nil, fmt.Errorf("zfs get did not return property,value,source tuples")
 		}
+		tuples = append(tuples, zfsGetTuple{fields[0], fields[1], fields[2]})
+	}
+	return tuples, nil
+}
+
+type ZFSGetMultiResult struct {
+	// nil if Err != nil
+	Props *ZFSProperties
+	// *DatasetDoesNotExist if the dataset does not exist
+	Err error
+}
+
+// ZFSGetMulti is like ZFSGetRawAnySource for all of paths, but uses a single `zfs get` invocation.
+//
+// The returned map has an entry for each of paths.
+// Datasets that do not exist do not fail the whole call,
+// instead, the Err field of their entry is set to *DatasetDoesNotExist.
+func ZFSGetMulti(ctx context.Context, paths []string, props []string) (map[string]ZFSGetMultiResult, error) {
+	return zfsGetMulti(ctx, paths, props, sourceAny)
+}
+
+func zfsGetMulti(ctx context.Context, paths []string, props []string, allowedSources zfsPropertySource) (map[string]ZFSGetMultiResult, error) {
+	res := make(map[string]ZFSGetMultiResult, len(paths))
+	if len(paths) == 0 {
+		return res, nil
+	}
+	args := []string{"get", "-Hp", "-o", "name,property,value,source", strings.Join(props, ",")}
+	args = append(args, paths...)
+	guard, err := acquireZFSListGetSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, ZFS_BINARY, args...)
+	stderr := bytes.NewBuffer(make([]byte, 0, 1024))
+	cmd.Stderr = stderr
+	stdout, err := cmd.Output()
+	guard.Release()
+
+	// zfs get reports nonexistent datasets on stderr, but still outputs the properties of the others
+	notExist := make(map[string]bool)
+	if err != nil {
+		_, isExitErr := err.(*exec.ExitError)
+		for _, l := range strings.Split(strings.TrimSpace(stderr.String()), "\n") {
+			sm := zfsGetDatasetDoesNotExistRegexp.FindStringSubmatch(l)
+			if !isExitErr || sm == nil {
+				return nil, &ZFSError{
+					Stderr:  stderr.Bytes(),
+					WaitErr: err,
+				}
+			}
+			notExist[sm[1]] = true
+		}
+	}
+
+	allowedPrefixes := allowedSources.zfsGetSourceFieldPrefixes()
+	for _, line := range strings.Split(string(stdout), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == '\t'
+		})
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("zfs get did not return name,property,value,source tuples")
+		}
+		r, ok := res[fields[0]]
+		if !ok {
+			r.Props = NewZFSProperties()
+			res[fields[0]] = r
+		}
 		for _, p := range allowedPrefixes {
-			if strings.HasPrefix(fields[2], p) {
-				res.m[fields[0]] = fields[1]
+			if strings.HasPrefix(fields[3], p) {
+				r.Props.Set(fields[1], fields[2])
 				break
 			}
 		}
 	}
+
+	for _, path := range paths {
+		if notExist[path] {
+			res[path] = ZFSGetMultiResult{Err: &DatasetDoesNotExist{path}}
+			continue
+		}
+		if _, ok := res[path]; !ok {
+			return nil, fmt.Errorf("zfs get did not return properties for %q", path)
+		}
+	}
 	return res, nil
 }
 
@@ -1028,8 +2450,8 @@ type ZFSPropCreateTxgAndGuidProps struct {
 	CreateTXG, Guid uint64
 }
 
-func ZFSGetCreateTXGAndGuid(ds string) (ZFSPropCreateTxgAndGuidProps, error) {
-	props, err := zfsGetNumberProps(ds, []string{"createtxg", "guid"}, sourceAny)
+func ZFSGetCreateTXGAndGuid(ctx context.Context, ds string) (ZFSPropCreateTxgAndGuidProps, error) {
+	props, err := zfsGetNumberProps(ctx, ds, []string{"createtxg", "guid"}, sourceAny)
 	if err != nil {
 		return ZFSPropCreateTxgAndGuidProps{}, err
 	}
@@ -1039,9 +2461,43 @@ func ZFSGetCreateTXGAndGuid(ds string) (ZFSPropCreateTxgAndGuidProps, error) {
 	}, nil
 }
 
+type WrittenSinceSnapshotDoesNotExist struct {
+	Filesystem string
+	Snapshot   string
+}
+
+func (e *WrittenSinceSnapshotDoesNotExist) Error() string {
+	return fmt.Sprintf("cannot get bytes written since %s@%s: snapshot does not exist", e.Filesystem, e.Snapshot)
+}
+
+// ZFSGetWrittenSince returns the `written@snap` property of fs,
+// i.e., the number of bytes written to fs since snapshot snap (name without fs@ prefix).
+// This is an approximation of the size of an incremental send from snap that does not require a dry-run,
+// e.g. for skipping near-empty incrementals.
+// If snap is the latest snapshot and fs has not been modified since, the result is 0.
+//
+// Returns *DatasetDoesNotExist if fs does not exist
+// and *WrittenSinceSnapshotDoesNotExist if snap does not exist.
+func ZFSGetWrittenSince(ctx context.Context, fs *DatasetPath, snap string) (uint64, error) {
+	snap = strings.TrimPrefix(snap, "@")
+	if snap == "" || strings.ContainsAny(snap, "@#/") {
+		return 0, fmt.Errorf("invalid snapshot name %q", snap)
+	}
+	prop := "written@" + snap
+	props, err := zfsGet(ctx, fs.ToString(), []string{prop}, sourceAny)
+	if err != nil {
+		return 0, err
+	}
+	// zfs get prints '-' instead of failing if snap does not exist
+	if props.Get(prop) == "-" {
+		return 0, &WrittenSinceSnapshotDoesNotExist{fs.ToString(), snap}
+	}
+	return props.GetUint64(prop)
+}
+
 // returns *DatasetDoesNotExist if the dataset does not exist
-func zfsGetNumberProps(ds string, props []string, src zfsPropertySource) (map[string]uint64, error) {
-	sps, err := zfsGet(ds, props, sourceAny)
+func zfsGetNumberProps(ctx context.Context, ds string, props []string, src zfsPropertySource) (map[string]uint64, error) {
+	sps, err := zfsGet(ctx, ds, props, sourceAny)
 	if err != nil {
 		if _, ok := err.(*DatasetDoesNotExist); ok {
 			return nil, err // pass through as is
@@ -1050,9 +2506,9 @@ func zfsGetNumberProps(ds string, props []string, src zfsPropertySource) (map[st
 	}
 	r := make(map[string]uint64, len(props))
 	for _, p := range props {
-		v, err := strconv.ParseUint(sps.Get(p), 10, 64)
+		v, err := sps.GetUint64(p)
 		if err != nil {
-			return nil, errors.Wrapf(err, "zfs get: parse number property %q", p)
+			return nil, errors.Wrap(err, "zfs get: parse number property")
 		}
 		r[p] = v
 	}
@@ -1064,6 +2520,10 @@ type DestroySnapshotsError struct {
 	Filesystem    string
 	Undestroyable []string // snapshot name only (filesystem@ stripped)
 	Reason        []string
+	// The tags of the user holds that prevent destruction of busy snapshots,
+	// keyed by snapshot name (filesystem@ stripped).
+	// Only contains snapshots for which the holds could be determined.
+	Holds map[string][]string
 }
 
 func (e *DestroySnapshotsError) Error() string {
@@ -1074,9 +2534,81 @@ func (e *DestroySnapshotsError) Error() string {
 		panic(fmt.Sprintf("error must have one undestroyable snapshot, %q", e.Filesystem))
 	}
 	if len(e.Undestroyable) == 1 {
-		return fmt.Sprintf("zfs destroy failed: %s@%s: %s", e.Filesystem, e.Undestroyable[0], e.Reason[0])
+		return fmt.Sprintf("zfs destroy failed: %s@%s: %s%s", e.Filesystem, e.Undestroyable[0], e.Reason[0], e.heldBy(e.Undestroyable[0]))
+	}
+	if len(e.Holds) == 0 {
+		return strings.Join(e.RawLines, "\n")
+	}
+	lines := make([]string, len(e.RawLines))
+	for i := range e.RawLines {
+		lines[i] = e.RawLines[i]
+		if i < len(e.Undestroyable) {
+			lines[i] += e.heldBy(e.Undestroyable[i])
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (e *DestroySnapshotsError) heldBy(snap string) string {
+	tags := e.Holds[snap]
+	if len(tags) == 0 {
+		return ""
+	}
+	quoted := make([]string, len(tags))
+	for i := range tags {
+		quoted[i] = fmt.Sprintf("%q", tags[i])
+	}
+	return fmt.Sprintf(" (held by tag %s, use `zfs release` to release)", strings.Join(quoted, ", "))
+}
+
+// attachHolds looks up the holds of the snapshots that are undestroyable because they are busy
+// and records their tags in e.Holds.
+// A busy snapshot is not necessarily held, and errors of the lookup are ignored:
+// the holds are only additional information for the user.
+func (e *DestroySnapshotsError) attachHolds(ctx context.Context) {
+	for i, snap := range e.Undestroyable {
+		if e.Reason[i] != destroySnapshotsErrorReasonBusy {
+			continue
+		}
+		tags, err := ZFSHolds(ctx, e.Filesystem, snap)
+		if err != nil {
+			debug("destroy: cannot determine holds of busy snapshot %s@%s: %s", e.Filesystem, snap, err)
+			continue
+		}
+		if len(tags) == 0 {
+			continue
+		}
+		if e.Holds == nil {
+			e.Holds = make(map[string][]string)
+		}
+		e.Holds[snap] = tags
+	}
+}
+
+// withoutReason returns a copy of e without the snapshots that are undestroyable for reason.
+// Returns nil if no undestroyable snapshots remain.
+func (e *DestroySnapshotsError) withoutReason(reason string) *DestroySnapshotsError {
+	res := &DestroySnapshotsError{Filesystem: e.Filesystem}
+	for i := range e.Undestroyable {
+		if e.Reason[i] == reason {
+			continue
+		}
+		if i < len(e.RawLines) {
+			res.RawLines = append(res.RawLines, e.RawLines[i])
+		}
+		res.Undestroyable = append(res.Undestroyable, e.Undestroyable[i])
+		res.Reason = append(res.Reason, e.Reason[i])
+		if tags, ok := e.Holds[e.Undestroyable[i]]; ok {
+			if res.Holds == nil {
+				res.Holds = make(map[string][]string)
+			}
+			res.Holds[e.Undestroyable[i]] = tags
+		}
+	}
+	if len(res.Undestroyable) == 0 {
+		return nil
 	}
-	return strings.Join(e.RawLines, "\n")
+	return res
 }
 
 var destroySnapshotsErrorRegexp = regexp.MustCompile(`^cannot destroy snapshot ([^@]+)@(.+): (.*)$`) // yes, datasets can contain `:`
@@ -1119,26 +2651,151 @@ func tryParseDestroySnapshotsError(arg string, stderr []byte) *DestroySnapshotsE
 	}
 }
 
-func ZFSDestroy(arg string) (err error) {
-
-	var dstype, filesystem string
+// decomposeDatasetArg splits a dataset name as passed to the zfs command
+// into its filesystem and its type (filesystem, snapshot or bookmark)
+func decomposeDatasetArg(arg string) (dstype, filesystem string) {
 	idx := strings.IndexAny(arg, "@#")
 	if idx == -1 {
-		dstype = "filesystem"
-		filesystem = arg
-	} else {
-		switch arg[idx] {
-		case '@':
-			dstype = "snapshot"
-		case '#':
-			dstype = "bookmark"
+		return "filesystem", arg
+	}
+	switch arg[idx] {
+	case '@':
+		dstype = "snapshot"
+	case '#':
+		dstype = "bookmark"
+	}
+	return dstype, arg[:idx]
+}
+
+// ZFSDestroy destroys arg.
+//
+// If arg is a snapshot with clones, *SnapshotHasClonesError is returned.
+func ZFSDestroy(ctx context.Context, arg string) (err error) {
+	return zfsDestroy(ctx, arg, zfsDestroyOpts{})
+}
+
+// ZFSDestroyWithDependents destroys snapshot arg and all datasets that depend on it
+// using `zfs destroy -R`, i.e. its clones and their snapshots and children.
+//
+// DANGEROUS: this destroys datasets other than arg. Use it only if the caller
+// has determined that the dependents (see SnapshotHasClonesError) can be destroyed.
+func ZFSDestroyWithDependents(ctx context.Context, arg string) (err error) {
+	if dstype, _ := decomposeDatasetArg(arg); dstype != "snapshot" || strings.ContainsAny(arg, ",%") {
+		return fmt.Errorf("destroy with dependents is only supported for a single snapshot, got %q", arg)
+	}
+	return zfsDestroy(ctx, arg, zfsDestroyOpts{recursiveDependents: true})
+}
+
+// SnapshotHasClonesError is returned by ZFSDestroy if a snapshot
+// cannot be destroyed because it has dependent clones.
+type SnapshotHasClonesError struct {
+	Snapshot string
+	// The datasets that would be destroyed by ZFSDestroyWithDependents,
+	// i.e. the clones and their snapshots and children.
+	Clones   []string
+	ZFSError *ZFSError
+}
+
+func (e *SnapshotHasClonesError) Error() string {
+	return fmt.Sprintf("cannot destroy snapshot %q: has dependent clones %s", e.Snapshot, strings.Join(e.Clones, ", "))
+}
+
+var snapshotHasClonesErrorRegexp = regexp.MustCompile(`^cannot destroy '([^']+)': snapshot has dependent clones$`)
+
+// output of `zfs destroy pool/fs@snap` for a snapshot with clones:
+//   cannot destroy 'pool/fs@snap': snapshot has dependent clones
+//   use '-R' to destroy the following datasets:
+//   pool/clone@a
+//   pool/clone
+func tryParseSnapshotHasClonesError(arg string, zfsErr *ZFSError) *SnapshotHasClonesError {
+	lines := strings.Split(strings.TrimSpace(string(zfsErr.Stderr)), "\n")
+	if len(lines) < 2 {
+		return nil
+	}
+	if m := snapshotHasClonesErrorRegexp.FindStringSubmatch(lines[0]); m == nil || m[1] != arg {
+		return nil
+	}
+	if !strings.HasPrefix(lines[1], "use '-R' to destroy the following datasets") {
+		return nil
+	}
+	clones := []string{}
+	for _, l := range lines[2:] {
+		if l = strings.TrimSpace(l); l != "" {
+			clones = append(clones, l)
+		}
+	}
+	return &SnapshotHasClonesError{
+		Snapshot: arg,
+		Clones:   clones,
+		ZFSError: zfsErr,
+	}
+}
+
+const destroySnapshotsErrorReasonBusy = "dataset is busy"
+
+// ZFSDestroyDefer destroys snapshot arg using `zfs destroy -d`, i.e.
+// ZFS marks a held snapshot for deferred destruction instead of failing.
+//
+// Snapshots that are reported as busy are considered successfully deferred.
+// Other undestroyable snapshots are reported as *DestroySnapshotsError.
+func ZFSDestroyDefer(ctx context.Context, arg string) (err error) {
+	if !strings.Contains(arg, "@") {
+		return fmt.Errorf("deferred destroy is only supported for snapshots, got %q", arg)
+	}
+	err = zfsDestroy(ctx, arg, zfsDestroyOpts{deferred: true})
+	if dserr, ok := err.(*DestroySnapshotsError); ok {
+		if remaining := dserr.withoutReason(destroySnapshotsErrorReasonBusy); remaining != nil {
+			return remaining
 		}
-		filesystem = arg[:idx]
+		return nil
 	}
+	return err
+}
+
+// ZFSDestroySnapshotRange destroys all snapshots of fs from firstName to lastName
+// (both inclusive) in a single `zfs destroy fs@firstName%lastName` call.
+//
+// Both snapshots must exist and firstName must not be younger than lastName.
+// Partial failures are reported as *DestroySnapshotsError.
+func ZFSDestroySnapshotRange(ctx context.Context, fs *DatasetPath, firstName, lastName string) error {
+	if firstName == "" || lastName == "" {
+		return errors.New("range destroy: first and last snapshot name must not be empty")
+	}
+	first, err := ZFSGetCreateTXGAndGuid(ctx, zfsBuildSnapName(fs, firstName))
+	if err != nil {
+		return errors.Wrap(err, "range destroy: first snapshot")
+	}
+	last, err := ZFSGetCreateTXGAndGuid(ctx, zfsBuildSnapName(fs, lastName))
+	if err != nil {
+		return errors.Wrap(err, "range destroy: last snapshot")
+	}
+	if first.CreateTXG > last.CreateTXG {
+		return fmt.Errorf("range destroy: first snapshot %q (createtxg %v) is younger than last snapshot %q (createtxg %v)",
+			firstName, first.CreateTXG, lastName, last.CreateTXG)
+	}
+	return ZFSDestroy(ctx, fmt.Sprintf("%s@%s%%%s", fs.ToString(), firstName, lastName))
+}
+
+type zfsDestroyOpts struct {
+	deferred            bool // -d
+	recursiveDependents bool // -R
+}
+
+func zfsDestroy(ctx context.Context, arg string, opts zfsDestroyOpts) (err error) {
+
+	dstype, filesystem := decomposeDatasetArg(arg)
 
 	defer prometheus.NewTimer(prom.ZFSDestroyDuration.WithLabelValues(dstype, filesystem))
 
-	cmd := exec.Command(ZFS_BINARY, "destroy", arg)
+	args := []string{"destroy"}
+	if opts.deferred {
+		args = append(args, "-d")
+	}
+	if opts.recursiveDependents {
+		args = append(args, "-R")
+	}
+	args = append(args, arg)
+	cmd := exec.CommandContext(ctx, ZFS_BINARY, args...)
 
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
@@ -1148,12 +2805,18 @@ func ZFSDestroy(arg string) (err error) {
 	}
 
 	if err = cmd.Wait(); err != nil {
-		err = &ZFSError{
+		zfsErr := &ZFSError{
 			Stderr:  stderr.Bytes(),
 			WaitErr: err,
 		}
+		err = zfsErr
 		if dserr := tryParseDestroySnapshotsError(arg, stderr.Bytes()); dserr != nil {
+			if !opts.deferred { // busy snapshots are not an error for deferred destroy
+				dserr.attachHolds(ctx)
+			}
 			err = dserr
+		} else if cerr := tryParseSnapshotHasClonesError(arg, zfsErr); cerr != nil {
+			err = cerr
 		}
 
 	}
@@ -1162,6 +2825,63 @@ func ZFSDestroy(arg string) (err error) {
 
 }
 
+func validateRenameArgs(from, to string, recursive bool) error {
+	if from == "" || to == "" {
+		return errors.New("rename: source and target must not be empty")
+	}
+	fromType, fromFS := decomposeDatasetArg(from)
+	toType, toFS := decomposeDatasetArg(to)
+	if fromType != toType {
+		return fmt.Errorf("rename: cannot rename %s %q to %s %q", fromType, from, toType, to)
+	}
+	if recursive && fromType != "snapshot" {
+		return fmt.Errorf("rename: recursive rename is only supported for snapshots, got %s %q", fromType, from)
+	}
+	if fromType != "filesystem" && fromFS != toFS {
+		return fmt.Errorf("rename: %ss can only be renamed within the same filesystem", fromType)
+	}
+	return nil
+}
+
+// ZFSRename renames a filesystem, snapshot or bookmark.
+// from and to must be of the same type, recursive is only allowed for snapshots.
+//
+// Returns *DatasetDoesNotExist if from does not exist.
+func ZFSRename(from, to string, recursive bool) (err error) {
+
+	if err := validateRenameArgs(from, to, recursive); err != nil {
+		return err
+	}
+
+	args := []string{"rename"}
+	if recursive {
+		args = append(args, "-r")
+	}
+	args = append(args, from, to)
+
+	cmd := exec.Command(ZFS_BINARY, args...)
+
+	stderr := bytes.NewBuffer(make([]byte, 0, 1024))
+	cmd.Stderr = stderr
+
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+
+	if err = cmd.Wait(); err != nil {
+		if sm := zfsGetDatasetDoesNotExistRegexp.FindSubmatch(stderr.Bytes()); sm != nil && string(sm[1]) == from {
+			return &DatasetDoesNotExist{from}
+		}
+		err = &ZFSError{
+			Stderr:  stderr.Bytes(),
+			WaitErr: err,
+		}
+	}
+
+	return
+
+}
+
 func zfsBuildSnapName(fs *DatasetPath, name string) string { // TODO defensive
 	return fmt.Sprintf("%s@%s", fs.ToString(), name)
 }
@@ -1170,13 +2890,27 @@ func zfsBuildBookmarkName(fs *DatasetPath, name string) string { // TODO defensi
 	return fmt.Sprintf("%s#%s", fs.ToString(), name)
 }
 
-func ZFSSnapshot(fs *DatasetPath, name string, recursive bool) (err error) {
+// ZFSSnapshot creates snapshot fs@name.
+// If recursive is true, snapshots of the same name are created for all descendants of fs
+// (`zfs snapshot -r`), atomically, i.e., all in the same txg.
+// If props is not nil, its properties are set on the snapshot(s) as part of their creation (`zfs snapshot -o k=v`).
+func ZFSSnapshot(ctx context.Context, fs *DatasetPath, name string, recursive bool, props *ZFSProperties) (err error) {
 
 	promTimer := prometheus.NewTimer(prom.ZFSSnapshotDuration.WithLabelValues(fs.ToString()))
 	defer promTimer.ObserveDuration()
 
 	snapname := zfsBuildSnapName(fs, name)
-	cmd := exec.Command(ZFS_BINARY, "snapshot", snapname)
+	args := []string{"snapshot"}
+	if recursive {
+		args = append(args, "-r")
+	}
+	if props != nil {
+		if err := props.appendOptionArgs(&args); err != nil {
+			return err
+		}
+	}
+	args = append(args, snapname)
+	cmd := exec.CommandContext(ctx, ZFS_BINARY, args...)
 
 	stderr := bytes.NewBuffer(make([]byte, 0, 1024))
 	cmd.Stderr = stderr
@@ -1196,17 +2930,65 @@ func ZFSSnapshot(fs *DatasetPath, name string, recursive bool) (err error) {
 
 }
 
-func ZFSBookmark(fs *DatasetPath, snapshot, bookmark string) (err error) {
+func ZFSBookmark(ctx context.Context, fs *DatasetPath, snapshot, bookmark string) (err error) {
 
 	promTimer := prometheus.NewTimer(prom.ZFSBookmarkDuration.WithLabelValues(fs.ToString()))
 	defer promTimer.ObserveDuration()
 
-	snapname := zfsBuildSnapName(fs, snapshot)
-	bookmarkname := zfsBuildBookmarkName(fs, bookmark)
+	return zfsBookmark(ctx, zfsBuildSnapName(fs, snapshot), zfsBuildBookmarkName(fs, bookmark))
+}
+
+// source is either a snapshot or a bookmark
+func zfsBookmark(ctx context.Context, source, bookmarkname string) (err error) {
+
+	debug("bookmark: %q %q", source, bookmarkname)
+
+	cmd := exec.CommandContext(ctx, ZFS_BINARY, "bookmark", source, bookmarkname)
+
+	stderr := bytes.NewBuffer(make([]byte, 0, 1024))
+	cmd.Stderr = stderr
+
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+
+	if err = cmd.Wait(); err != nil {
+		err = &ZFSError{
+			Stderr:  stderr.Bytes(),
+			WaitErr: err,
+		}
+	}
+
+	return
+
+}
+
+// ZFSClone creates target as a writable clone of snapshot fs@snapName.
+// props may be nil.
+//
+// Returns *DatasetDoesNotExist if the snapshot does not exist
+// and *DatasetAlreadyExistsError if target already exists.
+func ZFSClone(fs *DatasetPath, snapName string, target *DatasetPath, props *ZFSProperties) (err error) {
+
+	snapname := zfsBuildSnapName(fs, snapName)
+	if _, vt, name, err := DecomposeVersionString(snapname); err != nil {
+		return err
+	} else if vt != Snapshot || name == "" || strings.ContainsAny(name, "@#") {
+		return fmt.Errorf("clone source must be a snapshot, got %q", snapname)
+	}
+	if target == nil || target.Empty() {
+		return errors.New("clone target must not be an empty dataset path")
+	}
 
-	debug("bookmark: %q %q", snapname, bookmarkname)
+	args := []string{"clone"}
+	if props != nil {
+		if err := props.appendOptionArgs(&args); err != nil {
+			return err
+		}
+	}
+	args = append(args, snapname, target.ToString())
 
-	cmd := exec.Command(ZFS_BINARY, "bookmark", snapname, bookmarkname)
+	cmd := exec.Command(ZFS_BINARY, args...)
 
 	stderr := bytes.NewBuffer(make([]byte, 0, 1024))
 	cmd.Stderr = stderr
@@ -1216,6 +2998,12 @@ func ZFSBookmark(fs *DatasetPath, snapshot, bookmark string) (err error) {
 	}
 
 	if err = cmd.Wait(); err != nil {
+		if sm := zfsGetDatasetDoesNotExistRegexp.FindSubmatch(stderr.Bytes()); sm != nil && string(sm[1]) == snapname {
+			return &DatasetDoesNotExist{snapname}
+		}
+		if sm := zfsCreateDatasetExistsRegexp.FindSubmatch(stderr.Bytes()); sm != nil && string(sm[1]) == target.ToString() {
+			return &DatasetAlreadyExistsError{target.ToString()}
+		}
 		err = &ZFSError{
 			Stderr:  stderr.Bytes(),
 			WaitErr: err,
@@ -1226,32 +3014,65 @@ func ZFSBookmark(fs *DatasetPath, snapshot, bookmark string) (err error) {
 
 }
 
-func ZFSRollback(fs *DatasetPath, snapshot FilesystemVersion, rollbackArgs ...string) (err error) {
+// ZFSRollback rolls fs back to snapshot.
+//
+// destroyed lists the versions of fs that no longer exist after the rollback,
+// i.e., those destroyed by `zfs rollback -r`.
+// (Clones destroyed by -R are not part of destroyed because they are other filesystems.)
+func ZFSRollback(ctx context.Context, fs *DatasetPath, snapshot FilesystemVersion, rollbackArgs ...string) (destroyed []FilesystemVersion, err error) {
 
 	snapabs := snapshot.ToAbsPath(fs)
 	if snapshot.Type != Snapshot {
-		return fmt.Errorf("can only rollback to snapshots, got %s", snapabs)
+		return nil, fmt.Errorf("can only rollback to snapshots, got %s", snapabs)
+	}
+
+	before, err := ZFSListFilesystemVersions(ctx, fs, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list versions before rollback: %s", err)
 	}
 
 	args := []string{"rollback"}
 	args = append(args, rollbackArgs...)
 	args = append(args, snapabs)
 
-	cmd := exec.Command(ZFS_BINARY, args...)
+	cmd := exec.CommandContext(ctx, ZFS_BINARY, args...)
 
 	stderr := bytes.NewBuffer(make([]byte, 0, 1024))
 	cmd.Stderr = stderr
 
 	if err = cmd.Start(); err != nil {
-		return err
+		return nil, err
 	}
 
 	if err = cmd.Wait(); err != nil {
-		err = &ZFSError{
+		return nil, &ZFSError{
 			Stderr:  stderr.Bytes(),
 			WaitErr: err,
 		}
 	}
 
-	return err
+	after, err := ZFSListFilesystemVersions(ctx, fs, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list versions after rollback: %s", err)
+	}
+	return versionsMissingIn(before, after), nil
+}
+
+// versionsMissingIn returns the versions in before that are not in after (compared by type and GUID).
+func versionsMissingIn(before, after []FilesystemVersion) []FilesystemVersion {
+	type key struct {
+		t    VersionType
+		guid uint64
+	}
+	remaining := make(map[key]bool, len(after))
+	for _, v := range after {
+		remaining[key{v.Type, v.Guid}] = true
+	}
+	missing := []FilesystemVersion{}
+	for _, v := range before {
+		if !remaining[key{v.Type, v.Guid}] {
+			missing = append(missing, v)
+		}
+	}
+	return missing
 }
@@ -0,0 +1,113 @@
+package zfs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SetZFSBinary validates that path is an executable and makes this package use it
+// for all zfs invocations (see ZFS_BINARY).
+// If path does not contain a slash, it is looked up in PATH, and the resolved absolute path is used.
+//
+// Like ZFS_BINARY, it must be set before any other function of this package is used,
+// typically at startup, so that a missing binary is reported early and clearly
+// instead of every zfs command failing.
+func SetZFSBinary(path string) error {
+	resolved, err := resolveBinary("zfs", path)
+	if err != nil {
+		return err
+	}
+	zfsBinaryVersion.mtx.Lock()
+	defer zfsBinaryVersion.mtx.Unlock()
+	ZFS_BINARY = resolved
+	zfsBinaryVersion.binary = ""
+	zfsBinaryVersion.version = ""
+	return nil
+}
+
+// SetZPoolBinary is SetZFSBinary for the zpool binary (see ZPOOL_BINARY).
+func SetZPoolBinary(path string) error {
+	resolved, err := resolveBinary("zpool", path)
+	if err != nil {
+		return err
+	}
+	ZPOOL_BINARY = resolved
+	return nil
+}
+
+func resolveBinary(name, path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("%s binary path must not be empty", name)
+	}
+	resolved, err := exec.LookPath(path)
+	if err != nil {
+		if !strings.Contains(path, "/") {
+			return "", fmt.Errorf("%s binary %q not found in PATH, configure the absolute path (e.g. /usr/sbin/%s): %s", name, path, name, err)
+		}
+		return "", fmt.Errorf("%s binary %q is not an executable file: %s", name, path, err)
+	}
+	return resolved, nil
+}
+
+// cache of ZFSBinaryVersion for binary
+var zfsBinaryVersion struct {
+	mtx             sync.Mutex
+	binary, version string
+}
+
+// ZFSBinaryVersion returns the userland version reported by `zfs version`, e.g. "zfs-2.1.5-1".
+// The result is cached until ZFS_BINARY changes.
+//
+// Note that `zfs version` is only available in OpenZFS 0.8 and later,
+// older versions return a *ZFSError.
+func ZFSBinaryVersion(ctx context.Context) (string, error) {
+	zfsBinaryVersion.mtx.Lock()
+	defer zfsBinaryVersion.mtx.Unlock()
+	if zfsBinaryVersion.binary == ZFS_BINARY && zfsBinaryVersion.version != "" {
+		return zfsBinaryVersion.version, nil
+	}
+
+	cmd := exec.CommandContext(ctx, ZFS_BINARY, "version")
+	stderr := bytes.NewBuffer(make([]byte, 0, 1024))
+	cmd.Stderr = stderr
+	stdout, err := cmd.Output()
+	if err != nil {
+		return "", &ZFSError{
+			Stderr:  stderr.Bytes(),
+			WaitErr: err,
+		}
+	}
+	// the second line, if any, is the kernel module version (zfs-kmod-...)
+	version := strings.TrimSpace(strings.SplitN(string(stdout), "\n", 2)[0])
+	if version == "" {
+		return "", fmt.Errorf("zfs version: empty output")
+	}
+	zfsBinaryVersion.binary = ZFS_BINARY
+	zfsBinaryVersion.version = version
+	return version, nil
+}
+
+var zfsBinaryVersionRegexp = regexp.MustCompile(`^zfs-(\d+)\.(\d+)`)
+
+// parseZFSBinaryVersion extracts major and minor version from the output of ZFSBinaryVersion.
+func parseZFSBinaryVersion(version string) (major, minor int, ok bool) {
+	m := zfsBinaryVersionRegexp.FindStringSubmatch(version)
+	if m == nil {
+		return 0, 0, false
+	}
+	major, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0, 0, false
+	}
+	minor, err = strconv.Atoi(m[2])
+	if err != nil {
+		return 0, 0, false
+	}
+	return major, minor, true
+}
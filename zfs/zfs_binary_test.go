@@ -0,0 +1,92 @@
+package zfs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetZFSBinary(t *testing.T) {
+	prev := ZFS_BINARY
+	defer func() { ZFS_BINARY = prev }()
+
+	dir, err := ioutil.TempDir("", "zrepl-zfs-binary-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	exe := filepath.Join(dir, "zfs")
+	require.NoError(t, ioutil.WriteFile(exe, []byte("#!/bin/sh\n"), 0755))
+	notExe := filepath.Join(dir, "notexe")
+	require.NoError(t, ioutil.WriteFile(notExe, []byte("#!/bin/sh\n"), 0644))
+
+	require.NoError(t, SetZFSBinary(exe))
+	assert.Equal(t, exe, ZFS_BINARY)
+
+	for _, invalid := range []string{"", notExe, dir, filepath.Join(dir, "nonexistent"), "zrepl-nonexistent-zfs-binary"} {
+		err := SetZFSBinary(invalid)
+		assert.Error(t, err, "%q", invalid)
+		assert.Equal(t, exe, ZFS_BINARY, "failed SetZFSBinary must not change ZFS_BINARY")
+	}
+	err = SetZFSBinary("zrepl-nonexistent-zfs-binary")
+	assert.Contains(t, err.Error(), "PATH")
+}
+
+func TestSetZPoolBinary(t *testing.T) {
+	prev := ZPOOL_BINARY
+	defer func() { ZPOOL_BINARY = prev }()
+
+	dir, err := ioutil.TempDir("", "zrepl-zfs-binary-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	exe := filepath.Join(dir, "zpool")
+	require.NoError(t, ioutil.WriteFile(exe, []byte("#!/bin/sh\n"), 0755))
+
+	require.NoError(t, SetZPoolBinary(exe))
+	assert.Equal(t, exe, ZPOOL_BINARY)
+
+	err = SetZPoolBinary("zrepl-nonexistent-zpool-binary")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "zpool binary")
+	}
+	assert.Equal(t, exe, ZPOOL_BINARY, "failed SetZPoolBinary must not change ZPOOL_BINARY")
+}
+
+func TestZFSBinaryVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zrepl-zfs-binary-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	calls := filepath.Join(dir, "calls")
+
+	defer withFakeZFSBinary(t, `
+echo "$*" >> `+calls+`
+test "$*" = "version" || exit 23
+printf 'zfs-2.1.5-1\nzfs-kmod-2.1.5-1\n'
+`)()
+	numCalls := func() int {
+		b, err := ioutil.ReadFile(calls)
+		require.NoError(t, err)
+		return strings.Count(string(b), "\n")
+	}
+
+	v, err := ZFSBinaryVersion(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "zfs-2.1.5-1", v)
+	v, err = ZFSBinaryVersion(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "zfs-2.1.5-1", v)
+	assert.Equal(t, 1, numCalls())
+
+	// a different binary is asked again
+	func() {
+		defer withFakeZFSBinary(t, `echo "unrecognized command 'version'" >&2; exit 2`)()
+		_, err := ZFSBinaryVersion(context.Background())
+		assert.IsType(t, &ZFSError{}, err)
+	}()
+}
@@ -0,0 +1,25 @@
+package zfs
+
+import (
+	"context"
+	"runtime"
+
+	"github.com/zrepl/zrepl/util/envconst"
+	"github.com/zrepl/zrepl/util/semaphore"
+)
+
+// zfsListGetSem limits the number of concurrently running `zfs list` and `zfs get` processes.
+// Without it, a snapshotter or pruner that works on many filesystems can fork
+// hundreds of them at once, spiking load and exhausting file descriptors.
+//
+// `zfs send` and `zfs recv` are exempt, they are limited by the endpoint's semaphores.
+var zfsListGetSem = semaphore.New(envconst.Int64("ZREPL_MAX_ZFS_COMMANDS", int64(4*runtime.GOMAXPROCS(0))))
+
+// acquireZFSListGetSlot must be called before starting a `zfs list` or `zfs get` process,
+// the returned guard must be released after the process has been waited for.
+//
+// Callers must not acquire another slot while holding one, otherwise
+// concurrent callers can deadlock once all slots are taken.
+func acquireZFSListGetSlot(ctx context.Context) (*semaphore.AcquireGuard, error) {
+	return zfsListGetSem.Acquire(ctx)
+}
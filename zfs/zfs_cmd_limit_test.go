@@ -0,0 +1,55 @@
+package zfs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/util/semaphore"
+)
+
+func TestZFSListGetLimit(t *testing.T) {
+	defer func(prev *semaphore.S) { zfsListGetSem = prev }(zfsListGetSem)
+	zfsListGetSem = semaphore.New(1)
+
+	defer withFakeZFSBinary(t, `printf 'pool/fs\n'`)()
+	defer withEncryptionCLISupport(true)()
+
+	held, err := acquireZFSListGetSlot(context.Background())
+	require.NoError(t, err)
+
+	done := make(chan error)
+	go func() {
+		_, err := ZFSList(context.Background(), []string{"name"})
+		done <- err
+	}()
+	select {
+	case <-done:
+		t.Fatal("zfs list must wait for a free slot")
+	case <-time.After(100 * time.Millisecond):
+	}
+	held.Release()
+	assert.NoError(t, <-done)
+
+	// ZFSListChan gives up waiting once ctx is cancelled
+	held, err = acquireZFSListGetSlot(context.Background())
+	require.NoError(t, err)
+	defer held.Release()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	out := make(chan ZFSListResult, 1)
+	ZFSListChan(ctx, out, []string{"name"})
+	for r := range out {
+		assert.Nil(t, r.Fields)
+		assert.Equal(t, context.DeadlineExceeded, r.Err)
+	}
+
+	// so do zfs get invocations
+	_, err = ZFSGetRawAnySource(ctx, "pool/fs", []string{"name"})
+	assert.Equal(t, context.DeadlineExceeded, err)
+	_, err = ZFSGetEncryptionEnabledMulti(ctx, []string{"pool/fs"})
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
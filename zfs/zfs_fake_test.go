@@ -0,0 +1,37 @@
+package zfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// withFakeZFSBinary points ZFS_BINARY to a shell script with the given body.
+// The returned function restores ZFS_BINARY and must be deferred by the caller.
+//
+// Tests using it must not run in parallel.
+func withFakeZFSBinary(t *testing.T, scriptBody string) (restore func()) {
+	return withFakeBinary(t, &ZFS_BINARY, "zfs", scriptBody)
+}
+
+// withFakeZPoolBinary is withFakeZFSBinary for ZPOOL_BINARY.
+func withFakeZPoolBinary(t *testing.T, scriptBody string) (restore func()) {
+	return withFakeBinary(t, &ZPOOL_BINARY, "zpool", scriptBody)
+}
+
+func withFakeBinary(t *testing.T, binary *string, name, scriptBody string) (restore func()) {
+	dir, err := ioutil.TempDir("", "zrepl-zfs-test")
+	require.NoError(t, err)
+	fake := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(fake, []byte("#!/bin/sh\n"+scriptBody), 0755))
+
+	prev := *binary
+	*binary = fake
+	return func() {
+		*binary = prev
+		os.RemoveAll(dir)
+	}
+}
@@ -1,9 +1,18 @@
 package zfs
 
 import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestZFSListHandlesProducesZFSErrorOnNonZeroExit(t *testing.T) {
@@ -13,7 +22,7 @@ func TestZFSListHandlesProducesZFSErrorOnNonZeroExit(t *testing.T) {
 
 	ZFS_BINARY = "./test_helpers/zfs_failer.sh"
 
-	_, err = ZFSList([]string{"fictionalprop"}, "nonexistent/dataset")
+	_, err = ZFSList(context.Background(), []string{"fictionalprop"}, "nonexistent/dataset")
 
 	assert.Error(t, err)
 	zfsError, ok := err.(*ZFSError)
@@ -21,6 +30,125 @@ func TestZFSListHandlesProducesZFSErrorOnNonZeroExit(t *testing.T) {
 	assert.Equal(t, "error: this is a mock\n", string(zfsError.Stderr))
 }
 
+func TestZFSListChanBoundsStderr(t *testing.T) {
+	defer func(prev int) { ZFSListStderrMaxCopySize = prev }(ZFSListStderrMaxCopySize)
+	ZFSListStderrMaxCopySize = 1 << 15
+
+	defer withFakeZFSBinary(t, `
+i=0
+while [ $i -lt 5000 ]; do echo "noise line $i" >&2; i=$((i+1)); done
+echo "the actual error" >&2
+exit 1
+`)()
+
+	out := make(chan ZFSListResult)
+	go ZFSListChan(context.Background(), out, []string{"name"})
+	var err error
+	for r := range out {
+		err = r.Err
+	}
+	zfsErr, ok := err.(*ZFSError)
+	require.True(t, ok, "%T %s", err, err)
+	assert.True(t, len(zfsErr.Stderr) <= 1<<15, "%d", len(zfsErr.Stderr))
+	assert.True(t, strings.HasSuffix(string(zfsErr.Stderr), "the actual error\n"), "%q", zfsErr.Stderr)
+}
+
+func TestZFSListLineTooLong(t *testing.T) {
+	defer func(prev int) { ZFSListMaxLineLength = prev }(ZFSListMaxLineLength)
+	ZFSListMaxLineLength = 1 << 12
+
+	// long enough to exceed the pipe buffer if zfs was not killed
+	defer withFakeZFSBinary(t, `
+printf 'pool/short\n'
+name=pool/$(head -c 5000 /dev/zero | tr '\0' 'a')
+i=0
+while [ $i -lt 100 ]; do printf '%s\n' "$name"; i=$((i+1)); done
+`)()
+
+	_, err := ZFSList(context.Background(), []string{"name"})
+	_, ok := err.(*ZFSListLineTooLongError)
+	assert.True(t, ok, "%T %s", err, err)
+
+	out := make(chan ZFSListResult)
+	go ZFSListChan(context.Background(), out, []string{"name"})
+	var results []ZFSListResult
+	for r := range out {
+		results = append(results, r)
+	}
+	require.Len(t, results, 2)
+	assert.Equal(t, []string{"pool/short"}, results[0].Fields)
+	_, ok = results[1].Err.(*ZFSListLineTooLongError)
+	assert.True(t, ok, "%T %s", results[1].Err, results[1].Err)
+
+	// lines longer than the previous hard-coded limit of 1024 bytes are fine
+	ZFSListMaxLineLength = 1 << 13
+	res, err := ZFSList(context.Background(), []string{"name"})
+	require.NoError(t, err)
+	assert.Len(t, res, 101)
+}
+
+func TestZFSExists(t *testing.T) {
+	defer withFakeZFSBinary(t, `
+test "$1 $2 $3 $4 $5" = "get -Hp -o property,value,source guid" || exit 23
+case "$6" in
+pool/fs|pool/fs@a) printf 'guid\t1234\t-\n';;
+pool/broken) echo "permission denied" >&2; exit 1;;
+*) echo "cannot open '$6': dataset does not exist" >&2; exit 1;;
+esac
+`)()
+
+	exists, err := ZFSExists(context.Background(), toDatasetPath("pool/fs"))
+	require.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = ZFSExists(context.Background(), toDatasetPath("pool/nonexistent"))
+	require.NoError(t, err)
+	assert.False(t, exists)
+	_, err = ZFSExists(context.Background(), toDatasetPath("pool/broken"))
+	assert.Error(t, err)
+
+	exists, err = ZFSSnapshotExists(context.Background(), toDatasetPath("pool/fs"), "a")
+	require.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = ZFSSnapshotExists(context.Background(), toDatasetPath("pool/fs"), "b")
+	require.NoError(t, err)
+	assert.False(t, exists)
+	_, err = ZFSSnapshotExists(context.Background(), toDatasetPath("pool/fs"), "")
+	assert.Error(t, err)
+}
+
+func TestSplitZFSListLine(t *testing.T) {
+	props := []string{"name", "zrepl:comment"}
+
+	fields, err := splitZFSListLine("pool/fs\tfoo\tbar", props)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"pool/fs", "foo\tbar"}, fields)
+
+	_, err = splitZFSListLine("pool/fs", props)
+	uerr, ok := err.(*ZFSListUnexpectedOutputError)
+	require.True(t, ok, "%T %s", err, err)
+	assert.Equal(t, "pool/fs", uerr.Line)
+	assert.Equal(t, 1, uerr.NumFields)
+	assert.Contains(t, uerr.Error(), `"pool/fs"`)
+
+	// values without tabs: no ambiguity, even with user properties in non-final columns
+	props = []string{"name", "zrepl:comment", "guid"}
+	fields, err = splitZFSListLine("pool/fs\tfoo\t123", props)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"pool/fs", "foo", "123"}, fields)
+
+	// the extra tab could belong to zrepl:comment or to guid
+	_, err = splitZFSListLine("pool/fs\tfoo\tbar\t123", props)
+	uerr, ok = err.(*ZFSListUnexpectedOutputError)
+	require.True(t, ok, "%T %s", err, err)
+	assert.Equal(t, 4, uerr.NumFields)
+
+	// non-final properties that cannot contain tabs
+	props = []string{"name", "guid", "zrepl:comment"}
+	fields, err = splitZFSListLine("pool/fs\t123\tfoo\tbar", props)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"pool/fs", "123", "foo\tbar"}, fields)
+}
+
 func TestDatasetPathTrimNPrefixComps(t *testing.T) {
 	p, err := NewDatasetPath("foo/bar/a/b")
 	assert.Nil(t, err)
@@ -32,6 +160,55 @@ func TestDatasetPathTrimNPrefixComps(t *testing.T) {
 	assert.True(t, p.Empty(), "empty trimming shouldn't do harm")
 }
 
+func TestNewDatasetPathInvalidComponents(t *testing.T) {
+	tcs := []struct {
+		path  string
+		index int
+	}{
+		{"a//b", 1},
+		{"/a", 0},
+		{"pool/./b", 1},
+		{"pool/a/..", 2},
+	}
+	for _, tc := range tcs {
+		_, err := NewDatasetPath(tc.path)
+		cerr, ok := err.(*DatasetPathComponentError)
+		if assert.True(t, ok, "%q: %T %v", tc.path, err, err) {
+			assert.Equal(t, tc.index, cerr.Index, "%q", tc.path)
+		}
+	}
+
+	// pool name rules are only enforced by ValidatePoolName, client identities use NewDatasetPath, too
+	for _, valid := range []string{"pool/mirror", "logs/a", "pool/a.b/..c", "pool/with space", "mirror-host", "spare1", "raidzbox", "log"} {
+		_, err := NewDatasetPath(valid)
+		assert.NoError(t, err, "%q", valid)
+	}
+}
+
+func TestValidatePoolName(t *testing.T) {
+	for _, invalid := range []string{"", "mirror1", "raidz", "draid2", "spare", "log", "pool/a", "pool@snap"} {
+		assert.Error(t, ValidatePoolName(invalid), "%q", invalid)
+	}
+	for _, valid := range []string{"tank", "logs", "zroot", "pool-mirror"} {
+		assert.NoError(t, ValidatePoolName(valid), "%q", valid)
+	}
+}
+
+func TestDatasetPathLength(t *testing.T) {
+	maxComp := strings.Repeat("a", MaxDatasetNameLen-len("pool/"))
+	p, err := NewDatasetPath("pool/" + maxComp)
+	require.NoError(t, err)
+	assert.NoError(t, p.ValidateLength())
+
+	_, err = NewDatasetPath("pool/" + maxComp + "a")
+	_, ok := err.(*DatasetNameTooLongError)
+	assert.True(t, ok, "%T %v", err, err)
+
+	p.Extend(toDatasetPath("b"))
+	_, ok = p.ValidateLength().(*DatasetNameTooLongError)
+	assert.True(t, ok)
+}
+
 func TestZFSPropertySource(t *testing.T) {
 
 	tcs := []struct {
@@ -136,6 +313,7 @@ size	10518512
 	fullWithSpacesInIntermediateComponent := "\nfull\tpool1/otherjob/another ds with spaces/childfs@blaffoo\t12912\nsize\t12912\n"
 	incrementalWithSpaces := "\nincremental\tblaffoo\tpool1/otherjob/another ds with spaces@blaffoo2\t624\nsize\t624\n"
 	incrementalWithSpacesInIntermediateComponent := "\nincremental\tblaffoo\tpool1/otherjob/another ds with spaces/childfs@blaffoo2\t624\nsize\t624\n"
+	incrementalZeroEstimate := "\nincremental\t1\tzroot/test/a@1\t0\nsize\t0\n"
 
 	type tc struct {
 		name   string
@@ -237,6 +415,16 @@ size	10518512
 				SizeEstimate: 624,
 			},
 		},
+		{
+			name: "incrementalZeroEstimate", in: incrementalZeroEstimate,
+			exp: &DrySendInfo{
+				Type:         DrySendTypeIncremental,
+				Filesystem:   "zroot/test/a",
+				From:         "1",
+				To:           "zroot/test/a@1",
+				SizeEstimate: 0,
+			},
+		},
 	}
 
 	for _, tc := range tcs {
@@ -256,3 +444,849 @@ size	10518512
 		})
 	}
 }
+
+func TestRecvOptionsPipeCapacity(t *testing.T) {
+	assert.Equal(t, ZFSRecvPipeCapacityHint, RecvOptions{}.pipeCapacity())
+	assert.Equal(t, 1<<20, RecvOptions{PipeCapacity: 1 << 20}.pipeCapacity())
+}
+
+func TestZFSClone(t *testing.T) {
+	defer withFakeZFSBinary(t, `
+case "$*" in
+"clone -o mountpoint=none pool/fs@a pool/clone") ;;
+"clone pool/fs@a pool/plain") ;;
+"clone pool/fs@nope pool/clone") echo "cannot open 'pool/fs@nope': dataset does not exist" >&2; exit 1;;
+"clone pool/fs@a pool/exists") echo "cannot create 'pool/exists': dataset already exists" >&2; exit 1;;
+"clone pool/fs@a pool/noparent/clone") echo "cannot create 'pool/noparent/clone': parent does not exist" >&2; exit 1;;
+*) echo "unexpected: $*" >&2; exit 23;;
+esac
+`)()
+	fs := toDatasetPath("pool/fs")
+
+	props := NewZFSProperties()
+	props.Set("mountpoint", "none")
+	require.NoError(t, ZFSClone(fs, "a", toDatasetPath("pool/clone"), props))
+	require.NoError(t, ZFSClone(fs, "a", toDatasetPath("pool/plain"), nil))
+
+	err := ZFSClone(fs, "nope", toDatasetPath("pool/clone"), nil)
+	nerr, ok := err.(*DatasetDoesNotExist)
+	require.True(t, ok, "%T %s", err, err)
+	assert.Equal(t, "pool/fs@nope", nerr.Path)
+
+	err = ZFSClone(fs, "a", toDatasetPath("pool/exists"), nil)
+	eerr, ok := err.(*DatasetAlreadyExistsError)
+	require.True(t, ok, "%T %s", err, err)
+	assert.Equal(t, "pool/exists", eerr.Path)
+
+	_, ok = ZFSClone(fs, "a", toDatasetPath("pool/noparent/clone"), nil).(*ZFSError)
+	assert.True(t, ok)
+
+	// rejected before invoking zfs
+	assert.Error(t, ZFSClone(fs, "", toDatasetPath("pool/clone"), nil))
+	assert.Error(t, ZFSClone(fs, "a#b", toDatasetPath("pool/clone"), nil))
+	assert.Error(t, ZFSClone(fs, "a", toDatasetPath(""), nil))
+}
+
+func TestZFSPropertiesAppendOptionArgs(t *testing.T) {
+	props := NewZFSProperties()
+	props.Set("mountpoint", "none")
+	args := []string{"clone"}
+	assert.NoError(t, props.appendOptionArgs(&args))
+	assert.Equal(t, []string{"clone", "-o", "mountpoint=none"}, args)
+
+	props.Set("inva=lid", "foo")
+	assert.Error(t, props.appendOptionArgs(&args))
+}
+
+func TestZFSSendArgsValidate(t *testing.T) {
+
+	tcs := []struct {
+		name   string
+		args   ZFSSendArgs
+		expErr bool
+	}{
+		{"full", ZFSSendArgs{FS: "pool/fs", To: "@a"}, false},
+		{"incremental", ZFSSendArgs{FS: "pool/fs", From: "#a", To: "@b"}, false},
+		{"incrementalIntermediates", ZFSSendArgs{FS: "pool/fs", From: "@a", To: "@b", Intermediates: true}, false},
+		{"rawCompressedLargeBlocks", ZFSSendArgs{FS: "pool/fs", To: "@a", Raw: true, Compressed: true, LargeBlocks: true}, false},
+		{"replicateProperties", ZFSSendArgs{FS: "pool/fs", To: "@a", Replicate: true, Properties: true}, false},
+		{"resumeToken", ZFSSendArgs{FS: "pool/fs", ResumeToken: "1-abc"}, false},
+		{"resumeTokenEmbeddedData", ZFSSendArgs{FS: "pool/fs", ResumeToken: "1-abc", EmbeddedData: true}, false},
+		{"redact", ZFSSendArgs{FS: "pool/fs", From: "@a", To: "@b", Redact: "pool/fs#redact"}, false},
+
+		{"emptyTo", ZFSSendArgs{FS: "pool/fs"}, true},
+		{"invalidFrom", ZFSSendArgs{FS: "pool/fs", From: "a", To: "@b"}, true},
+		{"emptyFS", ZFSSendArgs{To: "@b"}, true},
+		{"intermediatesWithoutFrom", ZFSSendArgs{FS: "pool/fs", To: "@b", Intermediates: true}, true},
+		{"resumeTokenAndReplicate", ZFSSendArgs{FS: "pool/fs", ResumeToken: "1-abc", Replicate: true}, true},
+		{"resumeTokenAndIntermediates", ZFSSendArgs{FS: "pool/fs", ResumeToken: "1-abc", Intermediates: true}, true},
+		{"resumeTokenAndProperties", ZFSSendArgs{FS: "pool/fs", ResumeToken: "1-abc", Properties: true}, true},
+		{"resumeTokenAndHolds", ZFSSendArgs{FS: "pool/fs", ResumeToken: "1-abc", Holds: true}, true},
+		{"resumeTokenAndRedact", ZFSSendArgs{FS: "pool/fs", ResumeToken: "1-abc", Redact: "pool/fs#redact"}, true},
+		{"resumeTokenAndFrom", ZFSSendArgs{FS: "pool/fs", ResumeToken: "1-abc", From: "@a"}, true},
+		{"resumeTokenAndTo", ZFSSendArgs{FS: "pool/fs", ResumeToken: "1-abc", To: "@b"}, true},
+		{"resumeTokenAndRaw", ZFSSendArgs{FS: "pool/fs", ResumeToken: "1-abc", Raw: true}, true},
+		{"resumeTokenAndLargeBlocks", ZFSSendArgs{FS: "pool/fs", ResumeToken: "1-abc", LargeBlocks: true}, true},
+		{"resumeTokenAndCompressed", ZFSSendArgs{FS: "pool/fs", ResumeToken: "1-abc", Compressed: true}, true},
+		{"replicateAndRedact", ZFSSendArgs{FS: "pool/fs", From: "@a", To: "@b", Replicate: true, Redact: "pool/fs#redact"}, true},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.args.Validate()
+			if tc.expErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestZFSSendDryRawPropertiesRequiresOpenZFS2(t *testing.T) {
+	fakeZFS := func(version string) string {
+		return fmt.Sprintf(`
+case "$1" in
+version) %s ;;
+send) printf 'full\tpool/fs@a\t100\nsize\t100\n' ;;
+*) exit 23 ;;
+esac
+`, version)
+	}
+	args := ZFSSendArgs{FS: "pool/fs", To: "@a", Raw: true, Properties: true}
+
+	func() {
+		defer withFakeZFSBinary(t, fakeZFS(`printf 'zfs-0.8.6-1\nzfs-kmod-0.8.6-1\n'`))()
+		_, err := ZFSSendDry(context.Background(), args)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "requires OpenZFS 2.0")
+		}
+		// the requirement only applies to the combination
+		_, err = ZFSSendDry(context.Background(), ZFSSendArgs{FS: "pool/fs", To: "@a", Raw: true})
+		assert.NoError(t, err)
+	}()
+
+	func() {
+		defer withFakeZFSBinary(t, fakeZFS(`printf 'zfs-2.1.5-1\nzfs-kmod-2.1.5-1\n'`))()
+		_, err := ZFSSendDry(context.Background(), args)
+		assert.NoError(t, err)
+	}()
+
+	// unknown versions are left for zfs send to judge
+	func() {
+		defer withFakeZFSBinary(t, fakeZFS(`echo "unrecognized command 'version'" >&2; exit 2`))()
+		_, err := ZFSSendDry(context.Background(), args)
+		assert.NoError(t, err)
+	}()
+}
+
+func TestParseZFSBinaryVersion(t *testing.T) {
+	for _, c := range []struct {
+		in           string
+		major, minor int
+		ok           bool
+	}{
+		{"zfs-2.1.5-1", 2, 1, true},
+		{"zfs-0.8.3-1ubuntu12.14", 0, 8, true},
+		{"zfs-2.1.4-FreeBSD_g52bad4f23", 2, 1, true},
+		{"zfs-kmod-2.1.5-1", 0, 0, false},
+		{"2.1.5", 0, 0, false},
+	} {
+		major, minor, ok := parseZFSBinaryVersion(c.in)
+		assert.Equal(t, c.ok, ok, c.in)
+		assert.Equal(t, c.major, major, c.in)
+		assert.Equal(t, c.minor, minor, c.in)
+	}
+}
+
+func TestZFSSendArgsBuildCommonSendArgs(t *testing.T) {
+	a := ZFSSendArgs{FS: "pool/fs", From: "@a", To: "@b", Raw: true, Intermediates: true}
+	args, err := a.buildCommonSendArgs()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"-w", "-I", "pool/fs@a", "pool/fs@b"}, args)
+
+	a = ZFSSendArgs{FS: "pool/fs", ResumeToken: "1-abc"}
+	args, err = a.buildCommonSendArgs()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"-t", "1-abc"}, args)
+}
+
+func TestValidateRenameArgs(t *testing.T) {
+
+	tcs := []struct {
+		from, to  string
+		recursive bool
+		expErr    bool
+	}{
+		{"pool/a", "pool/b", false, false},
+		{"pool/a", "pool/b/c", false, false},
+		{"pool/a@1", "pool/a@2", false, false},
+		{"pool/a@1", "pool/a@2", true, false},
+		{"pool/a#1", "pool/a#2", false, false},
+
+		{"", "pool/b", false, true},
+		{"pool/a", "", false, true},
+		{"pool/a", "pool/b", true, true},
+		{"pool/a#1", "pool/a#2", true, true},
+		{"pool/a@1", "pool/a#1", false, true},
+		{"pool/a@1", "pool/b", false, true},
+		{"pool/a", "pool/b@1", false, true},
+		{"pool/a@1", "pool/b@1", false, true},
+		{"pool/a#1", "pool/b#1", false, true},
+	}
+
+	for _, tc := range tcs {
+		err := validateRenameArgs(tc.from, tc.to, tc.recursive)
+		if tc.expErr {
+			assert.Error(t, err, "%#v", tc)
+		} else {
+			assert.NoError(t, err, "%#v", tc)
+		}
+	}
+}
+
+func TestDestroySnapshotsErrorWithoutReason(t *testing.T) {
+	stderr := []byte("cannot destroy snapshot pool/fs@a: dataset is busy\n" +
+		"cannot destroy snapshot pool/fs@b: snapshot has dependent clones\n" +
+		"cannot destroy snapshot pool/fs@c: dataset is busy\n")
+	dserr := tryParseDestroySnapshotsError("pool/fs@a,b,c", stderr)
+	require.NotNil(t, dserr)
+
+	remaining := dserr.withoutReason(destroySnapshotsErrorReasonBusy)
+	require.NotNil(t, remaining)
+	assert.Equal(t, "pool/fs", remaining.Filesystem)
+	assert.Equal(t, []string{"b"}, remaining.Undestroyable)
+	assert.Equal(t, []string{"snapshot has dependent clones"}, remaining.Reason)
+	assert.Equal(t, []string{"cannot destroy snapshot pool/fs@b: snapshot has dependent clones"}, remaining.RawLines)
+
+	onlyBusy := tryParseDestroySnapshotsError("pool/fs@a", []byte("cannot destroy snapshot pool/fs@a: dataset is busy\n"))
+	require.NotNil(t, onlyBusy)
+	assert.Nil(t, onlyBusy.withoutReason(destroySnapshotsErrorReasonBusy))
+}
+
+func TestZFSDestroyReportsHoldTags(t *testing.T) {
+	defer withFakeZFSBinary(t, `
+case "$1" in
+destroy)
+	echo "cannot destroy snapshot pool/fs@a: dataset is busy" >&2
+	echo "cannot destroy snapshot pool/fs@b: dataset is busy" >&2
+	echo "cannot destroy snapshot pool/fs@c: snapshot has dependent clones" >&2
+	exit 1
+	;;
+holds)
+	case "$3" in
+	pool/fs@a) printf 'pool/fs@a\tzrepl_x\tThu Oct 10 13:37:00 2019\npool/fs@a\tkeep\tThu Oct 10 13:37:01 2019\n';;
+	pool/fs@b) ;; # busy for another reason
+	*) exit 23;;
+	esac
+	;;
+*)
+	exit 23
+	;;
+esac
+`)()
+
+	err := ZFSDestroy(context.Background(), "pool/fs@a,b,c")
+	dserr, ok := err.(*DestroySnapshotsError)
+	require.True(t, ok, "%T %s", err, err)
+	assert.Equal(t, map[string][]string{"a": {"zrepl_x", "keep"}}, dserr.Holds)
+	assert.Contains(t, dserr.Error(), `pool/fs@a: dataset is busy (held by tag "zrepl_x", "keep"`)
+
+	remaining := dserr.withoutReason(destroySnapshotsErrorReasonBusy)
+	require.NotNil(t, remaining)
+	assert.Nil(t, remaining.Holds)
+	assert.Equal(t, "zfs destroy failed: pool/fs@c: snapshot has dependent clones", remaining.Error())
+}
+
+func TestZFSDestroySnapshotHasClones(t *testing.T) {
+	defer withFakeZFSBinary(t, `
+case "$*" in
+"destroy pool/fs@a")
+	echo "cannot destroy 'pool/fs@a': snapshot has dependent clones" >&2
+	echo "use '-R' to destroy the following datasets:" >&2
+	echo "pool/clone@1" >&2
+	echo "pool/clone" >&2
+	exit 1
+	;;
+"destroy -R pool/fs@a")
+	;;
+*)
+	exit 23
+	;;
+esac
+`)()
+
+	err := ZFSDestroy(context.Background(), "pool/fs@a")
+	cerr, ok := err.(*SnapshotHasClonesError)
+	require.True(t, ok, "%T %s", err, err)
+	assert.Equal(t, "pool/fs@a", cerr.Snapshot)
+	assert.Equal(t, []string{"pool/clone@1", "pool/clone"}, cerr.Clones)
+	require.NotNil(t, cerr.ZFSError)
+
+	assert.NoError(t, ZFSDestroyWithDependents(context.Background(), "pool/fs@a"))
+	for _, invalid := range []string{"pool/fs", "pool/fs#a", "pool/fs@a,b", "pool/fs@a%b"} {
+		assert.Error(t, ZFSDestroyWithDependents(context.Background(), invalid), "%q", invalid)
+	}
+}
+
+func TestZFSSendPreflightCheckNotReceiving(t *testing.T) {
+	fs := toDatasetPath("pool/fs")
+
+	func() {
+		defer withFakeZFSBinary(t, `printf 'receive_resume_token\t1-abc\t-\n'`)()
+		err := ZFSSendPreflightCheckNotReceiving(context.Background(), fs)
+		require.Error(t, err)
+		arErr, ok := err.(*ActiveReceiveError)
+		require.True(t, ok, "%T", err)
+		assert.Equal(t, "pool/fs", arErr.Filesystem)
+		assert.Equal(t, "1-abc", arErr.ResumeToken)
+	}()
+
+	func() {
+		defer withFakeZFSBinary(t, `printf 'receive_resume_token\t-\t-\n'`)()
+		assert.NoError(t, ZFSSendPreflightCheckNotReceiving(context.Background(), fs))
+	}()
+}
+
+func TestZFSDestroySnapshotRange(t *testing.T) {
+	defer withFakeZFSBinary(t, `
+case "$1" in
+get)
+	case "$6" in
+	pool/fs@a) printf 'createtxg\t10\t-\nguid\t1\t-\n';;
+	pool/fs@b) printf 'createtxg\t20\t-\nguid\t2\t-\n';;
+	*) echo "cannot open '$6': dataset does not exist" >&2; exit 1;;
+	esac;;
+destroy)
+	[ "$2" = "pool/fs@a%b" ] || exit 23;;
+*)
+	exit 42;;
+esac
+`)()
+	fs := toDatasetPath("pool/fs")
+
+	assert.NoError(t, ZFSDestroySnapshotRange(context.Background(), fs, "a", "b"))
+
+	err := ZFSDestroySnapshotRange(context.Background(), fs, "b", "a")
+	assert.Error(t, err)
+	_, isZFSError := err.(*ZFSError)
+	assert.False(t, isZFSError, "order must be validated before calling zfs destroy")
+
+	err = ZFSDestroySnapshotRange(context.Background(), fs, "a", "nonexistent")
+	assert.Error(t, err)
+	_, isNotExist := errors.Cause(err).(*DatasetDoesNotExist)
+	assert.True(t, isNotExist, "%T %s", err, err)
+
+	assert.Error(t, ZFSDestroySnapshotRange(context.Background(), fs, "", "b"))
+}
+
+func TestSendSizeEstimateCheckDiverges(t *testing.T) {
+	c := SendOptions{SizeEstimate: 1000, SizeEstimateMaxDivergencePercent: 10}.sizeEstimateCheck("pool/fs")
+	assert.False(t, c.diverges(1000))
+	assert.False(t, c.diverges(1100))
+	assert.False(t, c.diverges(900))
+	assert.True(t, c.diverges(1101))
+	assert.True(t, c.diverges(899))
+
+	assert.Nil(t, SendOptions{}.sizeEstimateCheck("pool/fs"))
+}
+
+func TestZFSSendWarnsOnSizeEstimateDivergence(t *testing.T) {
+	const actual = 1 << 20
+	defer withFakeZFSBinary(t, fmt.Sprintf("head -c %d /dev/zero\n", actual))()
+
+	var divergences [][2]int64
+	opts := SendOptions{
+		SizeEstimate: 1 << 10,
+		OnSizeEstimateDivergence: func(estimate, actual int64) {
+			divergences = append(divergences, [2]int64{estimate, actual})
+		},
+	}
+	copier, err := ZFSSend(context.Background(), ZFSSendArgs{FS: "pool/fs", To: "@snap"}, opts)
+	require.NoError(t, err)
+	defer copier.Close()
+	require.NoError(t, copier.WriteStreamTo(ioutil.Discard))
+
+	require.Len(t, divergences, 1)
+	assert.Equal(t, [2]int64{1 << 10, actual}, divergences[0])
+}
+
+func TestVersionsMissingIn(t *testing.T) {
+	s1 := FilesystemVersion{Type: Snapshot, Name: "1", Guid: 1}
+	s2 := FilesystemVersion{Type: Snapshot, Name: "2", Guid: 2}
+	b2 := FilesystemVersion{Type: Bookmark, Name: "2", Guid: 2}
+	s3 := FilesystemVersion{Type: Snapshot, Name: "3", Guid: 3}
+
+	missing := versionsMissingIn([]FilesystemVersion{s1, s2, b2, s3}, []FilesystemVersion{s1, b2})
+	assert.Equal(t, []FilesystemVersion{s2, s3}, missing)
+
+	missing = versionsMissingIn([]FilesystemVersion{s1}, []FilesystemVersion{s1})
+	assert.NotNil(t, missing)
+	assert.Empty(t, missing)
+}
+
+func TestDatasetPathMatch(t *testing.T) {
+	type tc struct {
+		path, pattern string
+		match         bool
+	}
+	tcs := []tc{
+		{"tank/users/alice/home", "tank/users/*/home", true},
+		{"tank/users/alice/sub/home", "tank/users/*/home", false},
+		{"tank/users/home", "tank/users/*/home", false},
+		{"tank/users/alice", "tank/users/*", true},
+		{"tank/users/alice/home", "tank/users/*", false},
+		{"tank/users/alice", "tank/users/al*", true},
+		{"tank/users/alice", "tank/users/*ce", true},
+		{"tank/users/alice", "tank/users/a*i*e", true},
+		{"tank/users/alice", "tank/users/a*x*e", false},
+		{"tank/users/ab", "tank/users/ab*b", false},
+		{"tank/users/alice", "tank/users/alice", true},
+		{"tank/users/alice", "tank/users/bob", false},
+		{"", "", true},
+		{"tank", "", false},
+	}
+	for _, c := range tcs {
+		t.Run(c.pattern, func(t *testing.T) {
+			m, err := toDatasetPath(c.path).Match(c.pattern)
+			require.NoError(t, err)
+			assert.Equal(t, c.match, m, "path=%q pattern=%q", c.path, c.pattern)
+		})
+	}
+
+	for _, pattern := range []string{"tank/users/*@snap", "tank/#book", "tank//*", "tank/"} {
+		_, err := toDatasetPath("tank/users/alice").Match(pattern)
+		assert.Error(t, err, "pattern=%q", pattern)
+	}
+}
+
+func TestDatasetPathParentAndBase(t *testing.T) {
+	p := toDatasetPath("pool/a/b")
+	parent := p.Parent()
+	assert.Equal(t, "pool/a", parent.ToString())
+	assert.Equal(t, "pool/a/b", p.ToString(), "Parent must not modify p")
+	assert.Equal(t, "b", p.Base())
+
+	parent.Extend(toDatasetPath("c"))
+	assert.Equal(t, "pool/a/b", p.ToString(), "Parent must return a copy")
+
+	single := toDatasetPath("pool")
+	assert.True(t, single.Parent().Empty())
+	assert.Equal(t, "pool", single.Base())
+
+	empty := toDatasetPath("")
+	assert.True(t, empty.Parent().Empty())
+	assert.Equal(t, "", empty.Base())
+}
+
+func TestDatasetPathRelativeTo(t *testing.T) {
+	p := toDatasetPath("pool/root/a/b")
+
+	rel, err := p.RelativeTo(toDatasetPath("pool/root"))
+	require.NoError(t, err)
+	assert.Equal(t, "a/b", rel.ToString())
+	assert.Equal(t, "pool/root/a/b", p.ToString(), "RelativeTo must not modify p")
+
+	rel, err = p.RelativeTo(p)
+	require.NoError(t, err)
+	assert.True(t, rel.Empty())
+
+	rel, err = p.RelativeTo(toDatasetPath(""))
+	require.NoError(t, err)
+	assert.Equal(t, "pool/root/a/b", rel.ToString())
+
+	_, err = p.RelativeTo(toDatasetPath("pool/other"))
+	assert.Error(t, err)
+	_, err = toDatasetPath("pool").RelativeTo(toDatasetPath("pool/root"))
+	assert.Error(t, err)
+}
+
+func TestZFSGetMulti(t *testing.T) {
+	defer withFakeZFSBinary(t, `
+test "$*" = "get -Hp -o name,property,value,source zrepl:placeholder,name pool/a pool/nonexistent pool/b" || exit 2
+printf 'pool/a\tzrepl:placeholder\ton\tlocal\n'
+printf 'pool/a\tname\tpool/a\t-\n'
+echo "cannot open 'pool/nonexistent': dataset does not exist" >&2
+printf 'pool/b\tzrepl:placeholder\t-\t-\n'
+printf 'pool/b\tname\tpool/b\t-\n'
+exit 1
+`)()
+
+	res, err := ZFSGetMulti(context.Background(), []string{"pool/a", "pool/nonexistent", "pool/b"}, []string{"zrepl:placeholder", "name"})
+	require.NoError(t, err)
+	require.Len(t, res, 3)
+
+	require.NoError(t, res["pool/a"].Err)
+	assert.Equal(t, "on", res["pool/a"].Props.Get("zrepl:placeholder"))
+	assert.Equal(t, "pool/a", res["pool/a"].Props.Get("name"))
+
+	require.NoError(t, res["pool/b"].Err)
+	assert.Equal(t, "-", res["pool/b"].Props.Get("zrepl:placeholder"))
+
+	dne, ok := res["pool/nonexistent"].Err.(*DatasetDoesNotExist)
+	require.True(t, ok, "%T", res["pool/nonexistent"].Err)
+	assert.Equal(t, "pool/nonexistent", dne.Path)
+	assert.Nil(t, res["pool/nonexistent"].Props)
+}
+
+func TestZFSGetFilesystemPlaceholderStates(t *testing.T) {
+	defer withFakeZFSBinary(t, `
+test "$*" = "get -Hp -o name,property,value,source zrepl:placeholder pool/a pool/a/child pool/nonexistent pool/b" || exit 2
+printf 'pool/a\tzrepl:placeholder\ton\tlocal\n'
+printf 'pool/a/child\tzrepl:placeholder\ton\tinherited from pool/a\n'
+echo "cannot open 'pool/nonexistent': dataset does not exist" >&2
+printf 'pool/b\tzrepl:placeholder\t-\t-\n'
+exit 1
+`)()
+
+	paths := []*DatasetPath{toDatasetPath("pool/a"), toDatasetPath("pool/a/child"), toDatasetPath("pool/nonexistent"), toDatasetPath("pool/b")}
+	states, err := ZFSGetFilesystemPlaceholderStates(context.Background(), paths, PlaceholderPropertyName)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]*FilesystemPlaceholderState{
+		"pool/a":           {FS: "pool/a", FSExists: true, IsPlaceholder: true, RawLocalPropertyValue: "on"},
+		"pool/a/child":     {FS: "pool/a/child", FSExists: true},
+		"pool/nonexistent": {FS: "pool/nonexistent"},
+		"pool/b":           {FS: "pool/b", FSExists: true},
+	}, states)
+}
+
+func TestZFSGetMultiOtherError(t *testing.T) {
+	defer withFakeZFSBinary(t, `echo "internal error" >&2; exit 1`)()
+	_, err := ZFSGetMulti(context.Background(), []string{"pool/a"}, []string{"name"})
+	_, ok := err.(*ZFSError)
+	assert.True(t, ok, "%T %s", err, err)
+}
+
+func TestZFSInherit(t *testing.T) {
+	defer withFakeZFSBinary(t, `test "$*" = "inherit -S compression pool/fs"`)()
+	assert.NoError(t, ZFSInherit(context.Background(), toDatasetPath("pool/fs"), "compression", true))
+	assert.Error(t, ZFSInherit(context.Background(), toDatasetPath("pool/fs"), "compression", false))
+}
+
+func TestDrySendInfoMultipleHops(t *testing.T) {
+	// $ zfs send -nvP -I @1 zroot/test/a@4
+	out := `
+incremental	1	zroot/test/a@2	1000
+incremental	2	zroot/test/a@3	2000
+incremental	3	zroot/test/a@4	3000
+size	6000
+`
+	var si DrySendInfo
+	require.NoError(t, si.unmarshalZFSOutput([]byte(out)))
+	assert.Equal(t, DrySendInfo{
+		Type:         DrySendTypeIncremental,
+		Filesystem:   "zroot/test/a",
+		From:         "1",
+		To:           "zroot/test/a@4",
+		SizeEstimate: 6000,
+	}, si)
+
+	// without the size line, e.g. for resumed sends, the hops are summed up
+	var noTotal DrySendInfo
+	require.NoError(t, noTotal.unmarshalZFSOutput([]byte(strings.Replace(out, "size\t6000\n", "", 1))))
+	assert.Equal(t, int64(6000), noTotal.SizeEstimate)
+	assert.Equal(t, "zroot/test/a@4", noTotal.To)
+
+	var mixed DrySendInfo
+	err := mixed.unmarshalZFSOutput([]byte("incremental\t1\tzroot/test/a@2\t1\nincremental\t1\tzroot/test/b@2\t1\n"))
+	assert.Error(t, err)
+}
+
+func TestDrySendInfoZeroVersusNoEstimate(t *testing.T) {
+	var zero DrySendInfo
+	require.NoError(t, zero.unmarshalZFSOutput([]byte("incremental\t1\tzroot/test/a@1\t0\nsize\t0\n")))
+	assert.True(t, zero.HasSizeEstimate())
+	assert.True(t, zero.NothingToSend())
+
+	var full DrySendInfo
+	require.NoError(t, full.unmarshalZFSOutput([]byte("full\tzroot/test/a@1\t0\nsize\t0\n")))
+	assert.True(t, full.HasSizeEstimate())
+	assert.False(t, full.NothingToSend(), "a full send always creates the filesystem")
+
+	// incremental sends from bookmarks do not support size estimation on older ZFS
+	resetBookmarkSizeEstimateSupport()
+	defer resetBookmarkSizeEstimateSupport()
+	defer withFakeZFSBinary(t, `
+echo "usage:" >&2
+echo "	send [-DnPpRvLecr] [-[i|I] snapshot] <snapshot>" >&2
+exit 2
+`)()
+	bookmark, err := ZFSSendDry(context.Background(), ZFSSendArgs{FS: "zroot/test/a", From: "#1", To: "@2"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), bookmark.SizeEstimate)
+	assert.False(t, bookmark.HasSizeEstimate())
+	assert.False(t, bookmark.NothingToSend())
+}
+
+func resetBookmarkSizeEstimateSupport() {
+	bookmarkSizeEstimateSupport.invalidate(nil)
+}
+
+func TestZFSSendDryFromBookmark(t *testing.T) {
+	resetBookmarkSizeEstimateSupport()
+	defer resetBookmarkSizeEstimateSupport()
+
+	defer withFakeZFSBinary(t, `
+case "$*" in
+send)
+	echo "usage:" >&2
+	echo "	send [-DnPpRVvLecwhb] [-i|-I snapshot]" >&2
+	echo "	     [--redact <bookmark>] <snapshot>" >&2
+	exit 2;;
+"get -Hp -o property,value,source encryption zroot/test/a")
+	printf 'encryption\toff\tdefault\n';;
+"send -n -v -P -i zroot/test/a#1 zroot/test/a@2")
+	printf 'incremental\tzroot/test/a#1\tzroot/test/a@2\t4096\nsize\t4096\n';;
+"send -n -v -P -i zroot/test/a#old zroot/test/a@2")
+	echo "cannot estimate space for bookmark zroot/test/a#old" >&2
+	exit 1;;
+*)
+	echo "unexpected invocation: $*" >&2
+	exit 23;;
+esac
+`)()
+
+	si, err := ZFSSendDry(context.Background(), ZFSSendArgs{FS: "zroot/test/a", From: "#1", To: "@2"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4096), si.SizeEstimate)
+	assert.Equal(t, "zroot/test/a#1", si.From)
+
+	// zfs cannot estimate from every bookmark
+	si, err = ZFSSendDry(context.Background(), ZFSSendArgs{FS: "zroot/test/a", From: "#old", To: "@2"})
+	require.NoError(t, err)
+	assert.False(t, si.HasSizeEstimate())
+	assert.Equal(t, "zroot/test/a#old", si.From)
+}
+
+func TestZFSPropertiesNumericAccessors(t *testing.T) {
+	p := NewZFSProperties()
+	p.Set("guid", "12345678901234567890")
+	p.Set("negative", "-23")
+	p.Set("string", "on")
+
+	u, err := p.GetUint64("guid")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(12345678901234567890), u)
+
+	i, err := p.GetInt64("negative")
+	require.NoError(t, err)
+	assert.Equal(t, int64(-23), i)
+
+	_, err = p.GetUint64("string")
+	assert.Error(t, err)
+	_, err = p.GetInt64("nonexistent")
+	assert.Error(t, err)
+}
+
+func TestParseZFSHumanBytes(t *testing.T) {
+	tcs := map[string]uint64{
+		"0":             0,
+		"512":           512,
+		"1649267441664": 1649267441664,
+		"512B":          512,
+		"1K":            1 << 10,
+		"1.50K":         1536,
+		"20M":           20 << 20,
+		"1.5T":          3 << 39,
+		"2E":            2 << 60,
+	}
+	for in, exp := range tcs {
+		v, err := parseZFSHumanBytes(in)
+		require.NoError(t, err, "%q", in)
+		assert.Equal(t, exp, v, "%q", in)
+	}
+
+	for _, in := range []string{"", "-", "none", "1.5X", "K", "-1K", "16E"} {
+		_, err := parseZFSHumanBytes(in)
+		assert.Error(t, err, "%q", in)
+	}
+
+	p := NewZFSProperties()
+	p.Set("used", "1.5T")
+	v, err := p.GetBytes("used")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3<<39), v)
+}
+
+func TestDrySendInfoVolume(t *testing.T) {
+	// zvol snapshots are named like filesystem snapshots
+	var si DrySendInfo
+	require.NoError(t, si.unmarshalZFSOutput([]byte("incremental\t1\tpool/vols/vol1@2\t4096\nsize\t4096\n")))
+	assert.Equal(t, "pool/vols/vol1", si.Filesystem)
+	assert.Equal(t, int64(4096), si.SizeEstimate)
+
+	fs, typ, name, err := DecomposeVersionString("pool/vols/vol1#1")
+	require.NoError(t, err)
+	assert.Equal(t, "pool/vols/vol1", fs)
+	assert.Equal(t, Bookmark, typ)
+	assert.Equal(t, "1", name)
+}
+
+func TestZFSGetAllProps(t *testing.T) {
+	defer withFakeZFSBinary(t, `
+test "$*" = "get -Hp -o property,value,source all pool/fs" || exit 1
+printf 'type\tfilesystem\t-\n'
+printf 'compression\tlz4\tinherited from pool\n'
+printf 'mountpoint\t/mnt\tlocal\n'
+printf 'zrepl:placeholder\toff\treceived\n'
+`)()
+	props, err := ZFSGetAllProps(context.Background(), toDatasetPath("pool/fs"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"type":              "filesystem",
+		"compression":       "lz4",
+		"mountpoint":        "/mnt",
+		"zrepl:placeholder": "off",
+	}, props.m)
+}
+
+func TestZFSGetAllPropsDatasetDoesNotExist(t *testing.T) {
+	defer withFakeZFSBinary(t, `echo "cannot open 'pool/fs': dataset does not exist" >&2; exit 1`)()
+	_, err := ZFSGetAllProps(context.Background(), toDatasetPath("pool/fs"))
+	assert.IsType(t, &DatasetDoesNotExist{}, err)
+}
+
+func TestZFSGetWithSource(t *testing.T) {
+	defer withFakeZFSBinary(t, `
+test "$*" = "get -Hp -o property,value,source compression,mountpoint,zrepl:foo,used,atime pool/fs" || exit 1
+printf 'compression\tlz4\tinherited from pool\n'
+printf 'mountpoint\t/mnt\tlocal\n'
+printf 'zrepl:foo\tbar\treceived\n'
+printf 'used\t1024\t-\n'
+printf 'atime\ton\tdefault\n'
+`)()
+	props, err := ZFSGetWithSource(context.Background(), toDatasetPath("pool/fs"), []string{"compression", "mountpoint", "zrepl:foo", "used", "atime"})
+	require.NoError(t, err)
+
+	tcs := []struct {
+		prop, value   string
+		typ           PropertySourceType
+		inheritedFrom string
+	}{
+		{"compression", "lz4", PropertySourceInherited, "pool"},
+		{"mountpoint", "/mnt", PropertySourceLocal, ""},
+		{"zrepl:foo", "bar", PropertySourceReceived, ""},
+		{"used", "1024", PropertySourceNone, ""},
+		{"atime", "on", PropertySourceDefault, ""},
+	}
+	require.Len(t, props, len(tcs))
+	for _, tc := range tcs {
+		p, ok := props[tc.prop]
+		require.True(t, ok, tc.prop)
+		assert.Equal(t, tc.value, p.Value, tc.prop)
+		assert.Equal(t, tc.typ, p.SourceType(), tc.prop)
+		assert.Equal(t, tc.inheritedFrom, p.InheritedFrom(), tc.prop)
+	}
+}
+
+func TestZFSGetWrittenSince(t *testing.T) {
+	defer withFakeZFSBinary(t, `
+test "$*" = "get -Hp -o property,value,source written@1 pool/fs" || exit 1
+printf 'written@1\t23042\tlocal\n'
+`)()
+	written, err := ZFSGetWrittenSince(context.Background(), toDatasetPath("pool/fs"), "@1")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(23042), written)
+}
+
+func TestZFSGetWrittenSinceLatestSnapshot(t *testing.T) {
+	defer withFakeZFSBinary(t, `printf 'written@latest\t0\t-\n'`)()
+	written, err := ZFSGetWrittenSince(context.Background(), toDatasetPath("pool/fs"), "latest")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), written)
+}
+
+func TestZFSGetWrittenSinceSnapshotDoesNotExist(t *testing.T) {
+	defer withFakeZFSBinary(t, `printf 'written@nonexistent\t-\t-\n'`)()
+	_, err := ZFSGetWrittenSince(context.Background(), toDatasetPath("pool/fs"), "nonexistent")
+	nerr, ok := err.(*WrittenSinceSnapshotDoesNotExist)
+	require.True(t, ok, "%T %s", err, err)
+	assert.Equal(t, "nonexistent", nerr.Snapshot)
+}
+
+func TestValidatePlaceholderPropertyName(t *testing.T) {
+	for _, invalid := range []string{"", "placeholder", "Zrepl:placeholder", "zrepl placeholder:x", "zrepl:" + strings.Repeat("a", 256)} {
+		assert.Error(t, ValidatePlaceholderPropertyName(invalid), "%q", invalid)
+	}
+	assert.NoError(t, ValidatePlaceholderPropertyName(PlaceholderPropertyName))
+	assert.NoError(t, ValidatePlaceholderPropertyName("zrepl.sitea:placeholder"))
+
+	assert.Error(t, ZFSCreatePlaceholderFilesystem(toDatasetPath("pool/a"), "placeholder"))
+	defer withFakeZFSBinary(t, `
+test "$*" = "create -o zrepl.sitea:placeholder=on -o canmount=off -o mountpoint=none pool/a" || exit 1
+`)()
+	assert.NoError(t, ZFSCreatePlaceholderFilesystem(toDatasetPath("pool/a"), "zrepl.sitea:placeholder"))
+}
+
+func TestZFSClearPlaceholderRevertsCanmount(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zrepl-zfs-test-placeholder")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+
+	defer withFakeZFSBinary(t, `echo "$@" >> `+out+"\n")()
+
+	require.NoError(t, ZFSClearPlaceholder(context.Background(), toDatasetPath("pool/ph"), PlaceholderPropertyName))
+	o, err := ioutil.ReadFile(out)
+	require.NoError(t, err)
+	assert.Equal(t, "set zrepl:placeholder=off pool/ph\ninherit -S canmount pool/ph\n", string(o))
+}
+
+func TestZFSSnapshotRecursive(t *testing.T) {
+	defer withFakeZFSBinary(t, `
+test "$*" = "snapshot -r pool/fs@a" || exit 1
+`)()
+	assert.NoError(t, ZFSSnapshot(context.Background(), toDatasetPath("pool/fs"), "a", true, nil))
+	assert.Error(t, ZFSSnapshot(context.Background(), toDatasetPath("pool/fs"), "a", false, nil))
+}
+
+func TestZFSSnapshotProperties(t *testing.T) {
+	defer withFakeZFSBinary(t, `
+test "$*" = "snapshot -o zrepl:job=prod -o zrepl:seq=23 pool/fs@a" || exit 1
+`)()
+	props := NewZFSProperties()
+	props.Set("zrepl:seq", "23")
+	props.Set("zrepl:job", "prod")
+	assert.NoError(t, ZFSSnapshot(context.Background(), toDatasetPath("pool/fs"), "a", false, props))
+}
+
+func TestZFSManagementCommandsAreCancellable(t *testing.T) {
+	defer withFakeZFSBinary(t, `exec sleep 10`)()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	begin := time.Now()
+	err := ZFSSnapshot(ctx, toDatasetPath("pool/fs"), "a", false, nil)
+	assert.Error(t, err)
+	assert.True(t, time.Since(begin) < 5*time.Second, "zfs snapshot was not killed")
+}
+
+func TestParseResumeTokenOutput(t *testing.T) {
+	output := []byte(`resume token contents:
+nvlist version: 0
+	fromguid = 0x595d9f81aa9dddab
+	object = 0x1
+	offset = 0x0
+	bytes = 0x0
+	toguid = 0x854f02a2dd32cf0d
+	toname = pool1/test@b
+	compressok = 1
+	rawok = 1
+cannot resume send: 'pool1/test@b' used in the initial send no longer exists
+`)
+	rt, err := parseResumeTokenOutput(output)
+	require.NoError(t, err)
+	assert.Equal(t, &ResumeToken{
+		HasFromGUID: true, FromGUID: 0x595d9f81aa9dddab,
+		HasToGUID: true, ToGUID: 0x854f02a2dd32cf0d,
+		ToName: "pool1/test@b",
+		RawOK:  true, CompressOK: true,
+	}, rt)
+	assert.Equal(t, "incremental fromguid=0x595d9f81aa9dddab toguid=0x854f02a2dd32cf0d toname=pool1/test@b rawok=true compressok=true", rt.Describe())
+
+	full := &ResumeToken{HasToGUID: true, ToGUID: 0x2}
+	assert.Equal(t, "full toguid=0x2 rawok=false compressok=false", full.Describe())
+
+	_, err = parseResumeTokenOutput([]byte("resume token is corrupt\n"))
+	assert.Equal(t, ResumeTokenCorruptError, err)
+}
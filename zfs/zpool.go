@@ -0,0 +1,148 @@
+package zfs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+var ZPOOL_BINARY string = "zpool"
+
+// ZPoolGetFeatures returns the state ("disabled", "enabled" or "active")
+// of each pool feature supported by pool, keyed by feature name without the feature@ prefix.
+// Features unknown to the pool's ZFS version are not contained in the result.
+func ZPoolGetFeatures(ctx context.Context, pool string) (map[string]string, error) {
+	if err := validateZPoolName(pool); err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, ZPOOL_BINARY, "get", "-H", "-p", "-o", "property,value", "all", pool)
+	stderr := bytes.NewBuffer(make([]byte, 0, 1024))
+	cmd.Stderr = stderr
+	stdout, err := cmd.Output()
+	if err != nil {
+		return nil, &ZFSError{
+			Stderr:  stderr.Bytes(),
+			WaitErr: err,
+		}
+	}
+	return parseZPoolGetFeatures(stdout)
+}
+
+// ZPoolGetProps returns the values of props of pool (`zpool get -H -p`),
+// e.g. free or capacity. Sizes are in bytes.
+func ZPoolGetProps(ctx context.Context, pool string, props []string) (map[string]string, error) {
+	if err := validateZPoolName(pool); err != nil {
+		return nil, err
+	}
+	if len(props) == 0 {
+		return nil, fmt.Errorf("zpool get: no properties requested")
+	}
+	cmd := exec.CommandContext(ctx, ZPOOL_BINARY, "get", "-H", "-p", "-o", "property,value", strings.Join(props, ","), pool)
+	stderr := bytes.NewBuffer(make([]byte, 0, 1024))
+	cmd.Stderr = stderr
+	stdout, err := cmd.Output()
+	if err != nil {
+		return nil, &ZFSError{
+			Stderr:  stderr.Bytes(),
+			WaitErr: err,
+		}
+	}
+	lines := strings.Split(string(stdout), "\n")
+	if len(lines)-1 != len(props) { // account for trailing newline
+		return nil, fmt.Errorf("zpool get did not return the number of expected property values")
+	}
+	res := make(map[string]string, len(props))
+	for _, line := range lines[:len(lines)-1] {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("zpool get: unexpected output line %q", line)
+		}
+		res[fields[0]] = fields[1]
+	}
+	return res, nil
+}
+
+func validateZPoolName(pool string) error {
+	if pool == "" || strings.ContainsAny(pool, "/@#") {
+		return fmt.Errorf("invalid pool name %q", pool)
+	}
+	return nil
+}
+
+func parseZPoolGetFeatures(output []byte) (map[string]string, error) {
+	features := make(map[string]string)
+	for _, line := range strings.Split(string(output), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("zpool get: unexpected output line %q", line)
+		}
+		if !strings.HasPrefix(fields[0], "feature@") {
+			continue
+		}
+		features[strings.TrimPrefix(fields[0], "feature@")] = fields[1]
+	}
+	return features, nil
+}
+
+type poolFeatureKey struct {
+	pool, feature string
+}
+
+var poolFeatureCache cachedProbe
+
+// PoolFeature reports whether pool feature feature (without the feature@ prefix)
+// is enabled or active on pool, using `zpool get feature@feature pool`.
+// Features unknown to the pool's ZFS version are reported as not enabled.
+//
+// The result is cached per (pool, feature) because pool features are only ever enabled,
+// not disabled. Call InvalidatePoolFeatureCache after re-creating or re-importing a pool.
+func PoolFeature(ctx context.Context, pool, feature string) (bool, error) {
+	if err := validateZPoolName(pool); err != nil {
+		return false, err
+	}
+	if feature == "" || strings.ContainsAny(feature, "@, \t") {
+		return false, fmt.Errorf("invalid pool feature name %q", feature)
+	}
+	return poolFeatureCache.get(poolFeatureKey{pool, feature}, func() (bool, error) {
+		return zpoolGetFeature(ctx, pool, feature)
+	})
+}
+
+// InvalidatePoolFeatureCache drops the cached PoolFeature results for pool,
+// or for all pools if pool is "".
+func InvalidatePoolFeatureCache(pool string) {
+	poolFeatureCache.invalidate(func(key interface{}) bool {
+		return pool == "" || key.(poolFeatureKey).pool == pool
+	})
+}
+
+func zpoolGetFeature(ctx context.Context, pool, feature string) (bool, error) {
+	prop := "feature@" + feature
+	cmd := exec.CommandContext(ctx, ZPOOL_BINARY, "get", "-H", "-p", "-o", "property,value", prop, pool)
+	stderr := bytes.NewBuffer(make([]byte, 0, 1024))
+	cmd.Stderr = stderr
+	stdout, err := cmd.Output()
+	if err != nil {
+		return false, &ZFSError{
+			Stderr:  stderr.Bytes(),
+			WaitErr: err,
+		}
+	}
+	features, err := parseZPoolGetFeatures(stdout)
+	if err != nil {
+		return false, err
+	}
+	switch state := features[feature]; state {
+	case "enabled", "active":
+		return true, nil
+	case "disabled", "-", "":
+		return false, nil
+	default:
+		return false, fmt.Errorf("zpool get: unexpected state %q of feature %q on pool %q", state, feature, pool)
+	}
+}
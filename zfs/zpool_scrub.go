@@ -0,0 +1,268 @@
+package zfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ScrubAlreadyInProgressError struct {
+	Pool string
+}
+
+func (e *ScrubAlreadyInProgressError) Error() string {
+	return fmt.Sprintf("cannot scrub pool %q: scrub already in progress", e.Pool)
+}
+
+var zpoolScrubInProgressRegexp = regexp.MustCompile(`currently scrubbing`)
+
+// ZPoolScrub starts a scrub of pool (`zpool scrub`), e.g. to verify a backup after a full receive.
+// It returns once the scrub has been started, use ZPoolScrubStatus to monitor it.
+//
+// Returns *ScrubAlreadyInProgressError if pool is already being scrubbed.
+func ZPoolScrub(ctx context.Context, pool string) error {
+	if err := validateZPoolName(pool); err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, ZPOOL_BINARY, "scrub", pool)
+	stderr := bytes.NewBuffer(make([]byte, 0, 1024))
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		if zpoolScrubInProgressRegexp.Match(stderr.Bytes()) {
+			return &ScrubAlreadyInProgressError{pool}
+		}
+		return &ZFSError{
+			Stderr:  stderr.Bytes(),
+			WaitErr: err,
+		}
+	}
+	return nil
+}
+
+type ScrubState int
+
+const (
+	ScrubStateNone ScrubState = iota // no scrub was ever requested (or the last scan was a resilver)
+	ScrubStateInProgress
+	ScrubStatePaused
+	ScrubStateFinished
+	ScrubStateCanceled
+)
+
+func (s ScrubState) String() string {
+	switch s {
+	case ScrubStateNone:
+		return "none"
+	case ScrubStateInProgress:
+		return "in progress"
+	case ScrubStatePaused:
+		return "paused"
+	case ScrubStateFinished:
+		return "finished"
+	case ScrubStateCanceled:
+		return "canceled"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(s))
+	}
+}
+
+// ScrubStatus is the state of the last scrub of a pool, as reported by `zpool status -v`.
+type ScrubStatus struct {
+	Pool  string
+	State ScrubState
+	// The `scan:` line of zpool status and its continuation lines, for display.
+	ScanLines []string
+
+	// Only meaningful if State is ScrubStateInProgress or ScrubStatePaused.
+	PercentDone float64
+	HasETA      bool
+	ETA         time.Duration
+
+	// Bytes repaired by the scrub so far (in progress) or in total (finished).
+	Repaired uint64
+	// Only set for ScrubStateFinished: the number of errors found by the scrub.
+	ScrubErrors uint64
+
+	// The `errors:` line of zpool status, e.g. "No known data errors".
+	DataErrors string
+	// The files with permanent errors listed by zpool status -v.
+	ErrorFiles []string
+}
+
+// HasDataErrors reports whether the pool has known data errors.
+func (s *ScrubStatus) HasDataErrors() bool {
+	return s.DataErrors != "" && s.DataErrors != "No known data errors"
+}
+
+// ZPoolScrubStatus returns the status of the last scrub of pool.
+func ZPoolScrubStatus(ctx context.Context, pool string) (*ScrubStatus, error) {
+	if err := validateZPoolName(pool); err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, ZPOOL_BINARY, "status", "-v", pool)
+	stderr := bytes.NewBuffer(make([]byte, 0, 1024))
+	cmd.Stderr = stderr
+	stdout, err := cmd.Output()
+	if err != nil {
+		return nil, &ZFSError{
+			Stderr:  stderr.Bytes(),
+			WaitErr: err,
+		}
+	}
+	return parseZPoolStatusScrub(pool, stdout)
+}
+
+var (
+	zpoolStatusScrubFinishedRegexp = regexp.MustCompile(`^scrub repaired (\S+) in .* with (\d+) errors on `)
+	zpoolStatusRepairedRegexp      = regexp.MustCompile(`(\S+) repaired`)
+	zpoolStatusPercentDoneRegexp   = regexp.MustCompile(`([0-9.]+)% done`)
+	// OpenZFS >= 0.8: `00:03:14 to go` or `1 days 02:03:04 to go`
+	zpoolStatusETARegexp = regexp.MustCompile(`(?:(\d+) days )?(\d+):(\d\d):(\d\d) to go`)
+	// ZoL 0.7: `0h1m to go`
+	zpoolStatusETAOldRegexp = regexp.MustCompile(`(\d+)h(\d+)m to go`)
+)
+
+// output of zpool status -v looks like this (some lines omitted):
+//
+//     pool: tank
+//    state: ONLINE
+//     scan: scrub in progress since Sun Jul 25 16:07:49 2021
+//           1.23G scanned at 100M/s, 500M issued at 50M/s, 10.0G total
+//           0B repaired, 4.88% done, 00:03:14 to go
+//   config:
+//           ...
+//   errors: Permanent errors have been detected in the following files:
+//
+//           /tank/file
+func parseZPoolStatusScrub(pool string, output []byte) (*ScrubStatus, error) {
+	st := &ScrubStatus{Pool: pool}
+	const (
+		sectionOther = iota
+		sectionScan
+		sectionErrors
+	)
+	section := sectionOther
+	sawScan := false
+	s := bufio.NewScanner(bytes.NewReader(output))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		label, rest := "", line
+		if section == sectionErrors {
+			// the last section, file names may contain anything
+		} else if i := strings.Index(line, ": "); i != -1 && !strings.Contains(line[:i], " ") {
+			label, rest = line[:i], strings.TrimSpace(line[i+2:])
+		} else if strings.HasSuffix(line, ":") && !strings.Contains(line, " ") {
+			label, rest = strings.TrimSuffix(line, ":"), ""
+		}
+		switch label {
+		case "":
+			// continuation line
+		case "scan":
+			section = sectionScan
+			sawScan = true
+		case "errors":
+			section = sectionErrors
+			st.DataErrors = rest
+			continue
+		default:
+			section = sectionOther
+			continue
+		}
+		switch section {
+		case sectionScan:
+			if rest != "" {
+				st.ScanLines = append(st.ScanLines, rest)
+			}
+		case sectionErrors:
+			if rest != "" {
+				st.ErrorFiles = append(st.ErrorFiles, rest)
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if !sawScan {
+		return nil, fmt.Errorf("zpool status: no scan line in output for pool %q", pool)
+	}
+	if err := st.parseScanLines(); err != nil {
+		return nil, fmt.Errorf("zpool status: cannot parse scan status of pool %q: %s", pool, err)
+	}
+	return st, nil
+}
+
+func (st *ScrubStatus) parseScanLines() error {
+	if len(st.ScanLines) == 0 {
+		return fmt.Errorf("empty scan line")
+	}
+	first := st.ScanLines[0]
+	switch {
+	case strings.HasPrefix(first, "scrub in progress"):
+		st.State = ScrubStateInProgress
+	case strings.HasPrefix(first, "scrub paused"):
+		st.State = ScrubStatePaused
+	case strings.HasPrefix(first, "scrub canceled"):
+		st.State = ScrubStateCanceled
+		return nil
+	case strings.HasPrefix(first, "scrub repaired"):
+		st.State = ScrubStateFinished
+		m := zpoolStatusScrubFinishedRegexp.FindStringSubmatch(first)
+		if m == nil {
+			return fmt.Errorf("unexpected line %q", first)
+		}
+		var err error
+		if st.Repaired, err = parseZFSHumanBytes(m[1]); err != nil {
+			return err
+		}
+		if st.ScrubErrors, err = strconv.ParseUint(m[2], 10, 64); err != nil {
+			return err
+		}
+		return nil
+	default:
+		// none requested, resilver, ...
+		st.State = ScrubStateNone
+		return nil
+	}
+
+	// in progress or paused
+	for _, l := range st.ScanLines[1:] {
+		if m := zpoolStatusRepairedRegexp.FindStringSubmatch(l); m != nil {
+			v, err := parseZFSHumanBytes(m[1])
+			if err != nil {
+				return err
+			}
+			st.Repaired = v
+		}
+		if m := zpoolStatusPercentDoneRegexp.FindStringSubmatch(l); m != nil {
+			v, err := strconv.ParseFloat(m[1], 64)
+			if err != nil {
+				return err
+			}
+			st.PercentDone = v
+		}
+		if m := zpoolStatusETARegexp.FindStringSubmatch(l); m != nil {
+			var days, h, min, sec int64
+			if m[1] != "" {
+				days, _ = strconv.ParseInt(m[1], 10, 64)
+			}
+			h, _ = strconv.ParseInt(m[2], 10, 64)
+			min, _ = strconv.ParseInt(m[3], 10, 64)
+			sec, _ = strconv.ParseInt(m[4], 10, 64)
+			st.HasETA = true
+			st.ETA = time.Duration(days)*24*time.Hour + time.Duration(h)*time.Hour +
+				time.Duration(min)*time.Minute + time.Duration(sec)*time.Second
+		} else if m := zpoolStatusETAOldRegexp.FindStringSubmatch(l); m != nil {
+			h, _ := strconv.ParseInt(m[1], 10, 64)
+			min, _ := strconv.ParseInt(m[2], 10, 64)
+			st.HasETA = true
+			st.ETA = time.Duration(h)*time.Hour + time.Duration(min)*time.Minute
+		}
+	}
+	return nil
+}
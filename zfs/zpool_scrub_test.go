@@ -0,0 +1,116 @@
+package zfs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const zpoolStatusHeader = `  pool: tank
+ state: ONLINE
+`
+
+const zpoolStatusConfig = `config:
+
+	NAME        STATE     READ WRITE CKSUM
+	tank        ONLINE       0     0     0
+	  sda       ONLINE       0     0     0
+
+`
+
+func TestParseZPoolStatusScrub(t *testing.T) {
+
+	t.Run("inProgress", func(t *testing.T) {
+		out := zpoolStatusHeader +
+			`  scan: scrub in progress since Sun Jul 25 16:07:49 2021
+	1.23G scanned at 100M/s, 500M issued at 50M/s, 10.0G total
+	1M repaired, 4.88% done, 1 days 00:03:14 to go
+` + zpoolStatusConfig + `errors: No known data errors
+`
+		st, err := parseZPoolStatusScrub("tank", []byte(out))
+		require.NoError(t, err)
+		assert.Equal(t, ScrubStateInProgress, st.State)
+		assert.Equal(t, 4.88, st.PercentDone)
+		assert.True(t, st.HasETA)
+		assert.Equal(t, 24*time.Hour+3*time.Minute+14*time.Second, st.ETA)
+		assert.Equal(t, uint64(1<<20), st.Repaired)
+		assert.Len(t, st.ScanLines, 3)
+		assert.False(t, st.HasDataErrors())
+		assert.Empty(t, st.ErrorFiles)
+	})
+
+	t.Run("inProgressOldFormat", func(t *testing.T) {
+		out := zpoolStatusHeader +
+			`  scan: scrub in progress since Sat Nov 10 10:00:00 2018
+    1.23G scanned out of 10.0G at 100M/s, 2h30m to go
+    0B repaired, 12.30% done
+` + zpoolStatusConfig + `errors: No known data errors
+`
+		st, err := parseZPoolStatusScrub("tank", []byte(out))
+		require.NoError(t, err)
+		assert.Equal(t, ScrubStateInProgress, st.State)
+		assert.Equal(t, 12.30, st.PercentDone)
+		assert.True(t, st.HasETA)
+		assert.Equal(t, 2*time.Hour+30*time.Minute, st.ETA)
+	})
+
+	t.Run("finishedWithErrors", func(t *testing.T) {
+		out := zpoolStatusHeader +
+			`status: One or more devices has experienced an error resulting in data
+	corruption.  Applications may be affected.
+  scan: scrub repaired 4K in 0 days 00:00:01 with 2 errors on Sun Jul 25 16:07:50 2021
+` + zpoolStatusConfig + `errors: Permanent errors have been detected in the following files:
+
+        /tank/some file: with colon
+        tank/fs@snap:<0x1>
+`
+		st, err := parseZPoolStatusScrub("tank", []byte(out))
+		require.NoError(t, err)
+		assert.Equal(t, ScrubStateFinished, st.State)
+		assert.Equal(t, uint64(4096), st.Repaired)
+		assert.Equal(t, uint64(2), st.ScrubErrors)
+		assert.False(t, st.HasETA)
+		assert.True(t, st.HasDataErrors())
+		assert.Equal(t, []string{"/tank/some file: with colon", "tank/fs@snap:<0x1>"}, st.ErrorFiles)
+	})
+
+	for _, tc := range []struct {
+		scan  string
+		state ScrubState
+	}{
+		{"none requested", ScrubStateNone},
+		{"scrub canceled on Sun Jul 25 16:07:50 2021", ScrubStateCanceled},
+		{"scrub paused since Sun Jul 25 16:07:50 2021\n\tscrub started on Sun Jul 25 16:00:00 2021\n\t0B repaired, 50.00% done", ScrubStatePaused},
+		{"resilvered 1.2G in 0 days 00:01:00 with 0 errors on Sun Jul 25 16:07:50 2021", ScrubStateNone},
+	} {
+		out := zpoolStatusHeader + "  scan: " + tc.scan + "\n" + zpoolStatusConfig + "errors: No known data errors\n"
+		st, err := parseZPoolStatusScrub("tank", []byte(out))
+		require.NoError(t, err, tc.scan)
+		assert.Equal(t, tc.state, st.State, tc.scan)
+	}
+
+	_, err := parseZPoolStatusScrub("tank", []byte(zpoolStatusHeader+zpoolStatusConfig))
+	assert.Error(t, err)
+
+	// a bare scan line must not panic
+	_, err = parseZPoolStatusScrub("tank", []byte(zpoolStatusHeader+"  scan:\n"+zpoolStatusConfig))
+	assert.Error(t, err)
+}
+
+func TestZPoolScrub(t *testing.T) {
+	defer withFakeZPoolBinary(t, `
+case "$*" in
+"scrub tank") ;;
+"scrub busy") echo "cannot scrub busy: currently scrubbing; use 'zpool scrub -s' to cancel current scrub" >&2; exit 1;;
+*) echo "cannot open '$2': no such pool" >&2; exit 1;;
+esac
+`)()
+	ctx := context.Background()
+	assert.NoError(t, ZPoolScrub(ctx, "tank"))
+	assert.IsType(t, &ScrubAlreadyInProgressError{}, ZPoolScrub(ctx, "busy"))
+	assert.IsType(t, &ZFSError{}, ZPoolScrub(ctx, "nopool"))
+	assert.Error(t, ZPoolScrub(ctx, "tank/fs"))
+}
@@ -0,0 +1,113 @@
+package zfs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoolFeature(t *testing.T) {
+	defer InvalidatePoolFeatureCache("")
+
+	dir, err := ioutil.TempDir("", "zrepl-zpool-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	calls := filepath.Join(dir, "calls")
+
+	defer withFakeZPoolBinary(t, `
+echo "$*" >> `+calls+`
+test "$1 $2 $3 $4 $5" = "get -H -p -o property,value" || exit 23
+case "$7" in
+p1)
+	case "$6" in
+	feature@large_blocks) printf 'feature@large_blocks\tactive\n';;
+	feature@bookmark_v2) printf 'feature@bookmark_v2\tenabled\n';;
+	feature@encryption) printf 'feature@encryption\tdisabled\n';;
+	*) printf '%s\t-\n' "$6";;
+	esac
+	;;
+p2)
+	printf '%s\tdisabled\n' "$6"
+	;;
+*)
+	echo "cannot open '$7': no such pool" >&2
+	exit 1
+	;;
+esac
+`)()
+	ctx := context.Background()
+	numCalls := func() int {
+		b, err := ioutil.ReadFile(calls)
+		require.NoError(t, err)
+		return strings.Count(string(b), "\n")
+	}
+
+	for _, tc := range []struct {
+		pool, feature string
+		enabled       bool
+	}{
+		{"p1", "large_blocks", true},
+		{"p1", "bookmark_v2", true},
+		{"p1", "encryption", false},
+		{"p1", "unknown_feature", false},
+		{"p2", "large_blocks", false},
+	} {
+		enabled, err := PoolFeature(ctx, tc.pool, tc.feature)
+		require.NoError(t, err, "%v", tc)
+		assert.Equal(t, tc.enabled, enabled, "%v", tc)
+	}
+	assert.Equal(t, 5, numCalls())
+
+	// cached per (pool, feature)
+	enabled, err := PoolFeature(ctx, "p1", "large_blocks")
+	require.NoError(t, err)
+	assert.True(t, enabled)
+	assert.Equal(t, 5, numCalls())
+
+	InvalidatePoolFeatureCache("p2")
+	_, err = PoolFeature(ctx, "p1", "large_blocks")
+	require.NoError(t, err)
+	_, err = PoolFeature(ctx, "p2", "large_blocks")
+	require.NoError(t, err)
+	assert.Equal(t, 6, numCalls())
+
+	// errors are not cached
+	_, err = PoolFeature(ctx, "nopool", "large_blocks")
+	assert.IsType(t, &ZFSError{}, err)
+	_, err = PoolFeature(ctx, "nopool", "large_blocks")
+	assert.Error(t, err)
+	assert.Equal(t, 8, numCalls())
+
+	_, err = PoolFeature(ctx, "p1/fs", "large_blocks")
+	assert.Error(t, err)
+	_, err = PoolFeature(ctx, "p1", "feature@large_blocks")
+	assert.Error(t, err)
+}
+
+func TestZPoolGetProps(t *testing.T) {
+	defer withFakeZPoolBinary(t, `
+case "$*" in
+"get -H -p -o property,value free,capacity tank") printf 'free\t1073741824\ncapacity\t42\n';;
+"get -H -p -o property,value free short") ;;
+*) echo "cannot open '$7': no such pool" >&2; exit 1;;
+esac
+`)()
+	ctx := context.Background()
+
+	props, err := ZPoolGetProps(ctx, "tank", []string{"free", "capacity"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"free": "1073741824", "capacity": "42"}, props)
+
+	_, err = ZPoolGetProps(ctx, "short", []string{"free"})
+	assert.Error(t, err)
+	_, err = ZPoolGetProps(ctx, "nopool", []string{"free"})
+	assert.IsType(t, &ZFSError{}, err)
+	_, err = ZPoolGetProps(ctx, "tank", nil)
+	assert.Error(t, err)
+}